@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -130,9 +131,19 @@ func (c *Client) getWithPkSignature(path string, params map[string]string, pkSig
 }
 
 func (c *Client) get(path string, params map[string]string, secret *Secrets) ([]byte, error) {
+	query := url.Values{}
+	for paramKey, paramValue := range params {
+		query.Add(paramKey, paramValue)
+	}
+
+	return c.getValues(path, query, secret)
+}
+
+// getValues is get with repeated query params, used for list filters
+func (c *Client) getValues(path string, query url.Values, secret *Secrets) ([]byte, error) {
 	// Prepare request
-	url := fmt.Sprintf("%s%s", c.apiUrl, path)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	reqUrl := fmt.Sprintf("%s%s", c.apiUrl, path)
+	req, err := http.NewRequest(http.MethodGet, reqUrl, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -143,14 +154,7 @@ func (c *Client) get(path string, params map[string]string, secret *Secrets) ([]
 
 	c.setHeaders(req, "")
 
-	// Process query params
-	q := req.URL.Query()
-
-	for paramKey, paramValue := range params {
-		q.Add(paramKey, paramValue)
-	}
-
-	req.URL.RawQuery = q.Encode()
+	req.URL.RawQuery = query.Encode()
 
 	// Send request to server
 	resp, err := c.httpClient.Do(req)
@@ -17,14 +17,18 @@ const PATH_ONBOARDING = "/onboarding"
 const PATH_MARKETS = "/markets"
 const PATH_ORDERS = "/orders"
 const PATH_ORDERS_CANCEL_ALL = "/orders/cancel_all"
+const PATH_ORDERS_BATCH = "/orders/batch"
 
-const PATH_ORDERS_LIST = "/orders/list"
+const PATH_ORDERS_LIST = "/orders"
 const PATH_JWT = "/jwt"
 const PATH_CANDLES = "/candles"
 const PATH_ACCOUNT = "/account"
 const PATH_ACCOUNT_LEVERAGE = "/account/leverage"
 const PATH_ACCOUNT_VALIDATE = "/account/validate"
-const PATH_POSITIONS = "/positions/list"
+const PATH_POSITIONS = "/positions"
+const PATH_FILLS = "/fills"
+const PATH_FILLS_ORDER = "/fills/order"
+const PATH_CANCEL_ALL_AFTER = "/cancel_all_after"
 const PATH_DEPOSIT = "/balanceops/deposit"
 const PATH_WITHDRAW = "/balanceops/withdraw"
 const PATH_CANCEL_WITHDRAWAL = "/balanceops/cancel"
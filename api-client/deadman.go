@@ -0,0 +1,55 @@
+package api_client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/strips-finance/rabbit-dex-backend/api"
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+func (c *Client) DeadmanCreate(params *api.DeadmanCreateRequest) (*Response[model.DeadmanData], error) {
+	// HandleDeadmanCreate binds timeout from the query, the body is only signed
+	path := fmt.Sprintf("%s?timeout=%d", PATH_CANCEL_ALL_AFTER, params.Timeout)
+	respBody, err := c.post(path, struct{}{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.DeadmanData]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) DeadmanGet() (*Response[model.DeadmanData], error) {
+	queryParams := make(map[string]string)
+
+	respBody, err := c.get(PATH_CANCEL_ALL_AFTER, queryParams, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.DeadmanData]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) DeadmanDelete() (*Response[model.DeadmanData], error) {
+	respBody, err := c.delete(PATH_CANCEL_ALL_AFTER, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.DeadmanData]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,53 @@
+package api_client
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/strips-finance/rabbit-dex-backend/api"
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+func (c *Client) FillsList(params *api.FillListRequest) (*Response[model.FillData], error) {
+	queryParams := make(map[string]string)
+	if params.MarketId != "" {
+		queryParams["market_id"] = params.MarketId
+	}
+	if params.TimeStamp > 0 {
+		queryParams["start_time"] = strconv.FormatUint(params.TimeStamp, 10)
+	}
+	if params.EndTime > 0 {
+		queryParams["end_time"] = strconv.FormatUint(params.EndTime, 10)
+	}
+
+	respBody, err := c.get(PATH_FILLS, queryParams, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.FillData]
+
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) FillsForOrder(params *api.FillForOrderRequest) (*Response[model.FillData], error) {
+	queryParams := make(map[string]string)
+	queryParams["order_id"] = params.OrderId
+
+	respBody, err := c.get(PATH_FILLS_ORDER, queryParams, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.FillData]
+
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,136 @@
+package api_client
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/strips-finance/rabbit-dex-backend/api"
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+func (c *Client) OrderCreate(params *api.OrderCreateRequest) (*Response[model.OrderCreateRes], error) {
+	respBody, err := c.post(PATH_ORDERS, params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.OrderCreateRes]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) OrderAmend(params *api.OrderAmendRequest) (*Response[model.OrderAmendRes], error) {
+	respBody, err := c.put(PATH_ORDERS, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.OrderAmendRes]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) OrderCancel(params *api.OrderCancelRequest) (*Response[model.OrderCancelRes], error) {
+	respBody, err := c.delete(PATH_ORDERS, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.OrderCancelRes]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// OrdersList returns the order history of the profile, served from timescale
+func (c *Client) OrdersList(params *api.OrderListRequest) (*Response[model.OrderData], error) {
+	query := url.Values{}
+	if params.MarketId != "" {
+		query.Set("market_id", params.MarketId)
+	}
+	if params.TimeStamp > 0 {
+		query.Set("start_time", strconv.FormatUint(params.TimeStamp, 10))
+	}
+	if params.EndTime > 0 {
+		query.Set("end_time", strconv.FormatUint(params.EndTime, 10))
+	}
+	if params.OrderId != "" {
+		query.Set("order_id", params.OrderId)
+	}
+	if params.ClientOrderId != "" {
+		query.Set("client_order_id", params.ClientOrderId)
+	}
+	if params.GroupId != "" {
+		query.Set("group_id", params.GroupId)
+	}
+	for _, status := range params.Status {
+		query.Add("status", status)
+	}
+	for _, orderType := range params.OrderType {
+		query.Add("order_type", orderType)
+	}
+
+	respBody, err := c.getValues(PATH_ORDERS_LIST, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.OrderData]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) OrderCancelAll() (*Response[bool], error) {
+	// Empty object body, the server still expects a signed json payload
+	respBody, err := c.delete(PATH_ORDERS_CANCEL_ALL, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[bool]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) OrdersBatch(params *api.OrderBatchRequest) (*Response[model.OrderBatchRes], error) {
+	respBody, err := c.post(PATH_ORDERS_BATCH, params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.OrderBatchRes]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) OrdersCancelBatch(params *api.OrderCancelBatchRequest) (*Response[model.OrderBatchRes], error) {
+	respBody, err := c.delete(PATH_ORDERS_BATCH, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.OrderBatchRes]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
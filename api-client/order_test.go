@@ -0,0 +1,237 @@
+package api_client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/strips-finance/rabbit-dex-backend/api"
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+const orderTestMarket = "BTC-USD"
+
+type OrderSuite struct {
+	APITestSuite
+}
+
+func (s *OrderSuite) depositCredit(profileId uint, amount float64) {
+	broker, err := model.GetBroker()
+	require.NoError(s.T(), err)
+
+	_, err = model.NewApiModel(broker).DepositCredit(context.Background(), profileId, amount)
+	require.NoError(s.T(), err)
+}
+
+// counterparty onboards a second market maker to trade against
+func (s *OrderSuite) counterparty() *Client {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(s.T(), err)
+
+	credentials := &ClientCredentials{PrivateKey: hexutil.Encode(crypto.FromECDSA(privateKey))}
+	client, err := NewClient(LOCAL_URL, credentials)
+	require.NoError(s.T(), err)
+
+	resp, err := client.Onboarding()
+	require.NoError(s.T(), err)
+	require.True(s.T(), resp.Success)
+
+	s.depositCredit(client.Credentials.ProfileID, 100000)
+
+	return client
+}
+
+func (s *OrderSuite) TestOrderCreateAmendCancel() {
+	s.OnboardMarketMaker()
+	s.depositCredit(s.Client().Credentials.ProfileID, 100000)
+
+	price, size := 1000.0, 0.01
+	createResp, err := s.Client().OrderCreate(&api.OrderCreateRequest{
+		MarketId: orderTestMarket,
+		Type:     model.LIMIT,
+		Side:     model.LONG,
+		Price:    &price,
+		Size:     &size,
+	})
+	require.NoError(s.T(), err)
+	require.True(s.T(), createResp.Success)
+	require.Empty(s.T(), createResp.Error)
+
+	created := createResp.Result[0]
+	require.NotEmpty(s.T(), created.OrderId)
+	require.Equal(s.T(), orderTestMarket, created.MarketId)
+	require.Equal(s.T(), s.Client().Credentials.ProfileID, created.ProfileId)
+	require.Equal(s.T(), "processing", created.Status)
+	time.Sleep(time.Second)
+
+	newPrice := 999.0
+	amendResp, err := s.Client().OrderAmend(&api.OrderAmendRequest{
+		OrderId:  created.OrderId,
+		MarketId: orderTestMarket,
+		Price:    &newPrice,
+	})
+	require.NoError(s.T(), err)
+	require.True(s.T(), amendResp.Success)
+	require.Empty(s.T(), amendResp.Error)
+
+	amended := amendResp.Result[0]
+	require.Equal(s.T(), created.OrderId, amended.OrderId)
+	require.Equal(s.T(), "999", amended.Price.String())
+	require.Equal(s.T(), "amending", amended.Status)
+	time.Sleep(time.Second)
+
+	cancelResp, err := s.Client().OrderCancel(&api.OrderCancelRequest{
+		OrderId:  created.OrderId,
+		MarketId: orderTestMarket,
+	})
+	require.NoError(s.T(), err)
+	require.True(s.T(), cancelResp.Success)
+	require.Empty(s.T(), cancelResp.Error)
+	require.Equal(s.T(), created.OrderId, cancelResp.Result[0].OrderId)
+	require.Equal(s.T(), "canceling", cancelResp.Result[0].Status)
+
+	cancelAllResp, err := s.Client().OrderCancelAll()
+	require.NoError(s.T(), err)
+	require.True(s.T(), cancelAllResp.Success)
+}
+
+func (s *OrderSuite) TestOrdersList() {
+	s.OnboardMarketMaker()
+	s.depositCredit(s.Client().Credentials.ProfileID, 100000)
+
+	price, size := 1000.0, 0.01
+	createResp, err := s.Client().OrderCreate(&api.OrderCreateRequest{
+		MarketId: orderTestMarket,
+		Type:     model.LIMIT,
+		Side:     model.LONG,
+		Price:    &price,
+		Size:     &size,
+	})
+	require.NoError(s.T(), err)
+	require.True(s.T(), createResp.Success)
+
+	orderId := createResp.Result[0].OrderId
+
+	// Orders are served from timescale, give the archiver time to catch up
+	var orders []model.OrderData
+	require.Eventually(s.T(), func() bool {
+		resp, err := s.Client().OrdersList(&api.OrderListRequest{
+			MarketId: orderTestMarket,
+			OrderId:  orderId,
+			Status:   []string{"open", "processing"},
+		})
+		if err != nil || !resp.Success {
+			return false
+		}
+		orders = resp.Result
+		return len(orders) > 0
+	}, 30*time.Second, time.Second)
+
+	require.Equal(s.T(), orderId, orders[0].OrderId)
+	require.Equal(s.T(), orderTestMarket, orders[0].MarketID)
+	require.Equal(s.T(), model.LONG, orders[0].Side)
+
+	resp, err := s.Client().OrdersList(&api.OrderListRequest{
+		MarketId: orderTestMarket,
+		OrderId:  orderId,
+		Status:   []string{"closed"},
+	})
+	require.NoError(s.T(), err)
+	require.True(s.T(), resp.Success)
+	require.Empty(s.T(), resp.Result)
+}
+
+func (s *OrderSuite) TestOrderCancelError() {
+	s.OnboardMarketMaker()
+
+	resp, err := s.Client().OrderCancel(&api.OrderCancelRequest{
+		MarketId: orderTestMarket,
+	})
+	require.NoError(s.T(), err)
+	require.False(s.T(), resp.Success)
+	require.NotEmpty(s.T(), resp.Error)
+}
+
+func (s *OrderSuite) TestOrderFills() {
+	s.OnboardMarketMaker()
+	s.depositCredit(s.Client().Credentials.ProfileID, 100000)
+	taker := s.counterparty()
+
+	price, size := 1000.0, 0.01
+	makerResp, err := s.Client().OrderCreate(&api.OrderCreateRequest{
+		MarketId: orderTestMarket,
+		Type:     model.LIMIT,
+		Side:     model.SHORT,
+		Price:    &price,
+		Size:     &size,
+	})
+	require.NoError(s.T(), err)
+	require.True(s.T(), makerResp.Success)
+	time.Sleep(time.Second)
+
+	takerResp, err := taker.OrderCreate(&api.OrderCreateRequest{
+		MarketId: orderTestMarket,
+		Type:     model.LIMIT,
+		Side:     model.LONG,
+		Price:    &price,
+		Size:     &size,
+	})
+	require.NoError(s.T(), err)
+	require.True(s.T(), takerResp.Success)
+
+	makerOrderId := makerResp.Result[0].OrderId
+
+	// Fills are served from timescale, give the archiver time to catch up
+	var fills []model.FillData
+	require.Eventually(s.T(), func() bool {
+		resp, err := s.Client().FillsForOrder(&api.FillForOrderRequest{OrderId: makerOrderId})
+		if err != nil || !resp.Success {
+			return false
+		}
+		fills = resp.Result
+		return len(fills) > 0
+	}, 30*time.Second, time.Second)
+
+	fill := fills[0]
+	require.Equal(s.T(), makerOrderId, fill.OrderId)
+	require.Equal(s.T(), orderTestMarket, fill.MarketId)
+	require.True(s.T(), fill.IsMaker)
+
+	listResp, err := s.Client().FillsList(&api.FillListRequest{MarketId: orderTestMarket})
+	require.NoError(s.T(), err)
+	require.True(s.T(), listResp.Success)
+	require.NotEmpty(s.T(), listResp.Result)
+
+	positionsResp, err := s.Client().Positions()
+	require.NoError(s.T(), err)
+	require.True(s.T(), positionsResp.Success)
+	require.Len(s.T(), positionsResp.Result, 1)
+	require.Equal(s.T(), orderTestMarket, positionsResp.Result[0].MarketID)
+	require.Equal(s.T(), model.SHORT, positionsResp.Result[0].Side)
+}
+
+func (s *OrderSuite) TestDeadman() {
+	s.OnboardMarketMaker()
+
+	createResp, err := s.Client().DeadmanCreate(&api.DeadmanCreateRequest{Timeout: 60000})
+	require.NoError(s.T(), err)
+	require.True(s.T(), createResp.Success)
+	require.Equal(s.T(), uint(60000), createResp.Result[0].Timeout)
+
+	getResp, err := s.Client().DeadmanGet()
+	require.NoError(s.T(), err)
+	require.True(s.T(), getResp.Success)
+	require.Equal(s.T(), s.Client().Credentials.ProfileID, getResp.Result[0].ProfileId)
+
+	deleteResp, err := s.Client().DeadmanDelete()
+	require.NoError(s.T(), err)
+	require.True(s.T(), deleteResp.Success)
+}
+
+func TestOrderSuite(t *testing.T) {
+	suite.Run(t, &OrderSuite{})
+}
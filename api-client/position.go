@@ -0,0 +1,24 @@
+package api_client
+
+import (
+	"encoding/json"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+func (c *Client) Positions() (*Response[model.PositionData], error) {
+	queryParams := make(map[string]string)
+
+	respBody, err := c.get(PATH_POSITIONS, queryParams, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[model.PositionData]
+
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
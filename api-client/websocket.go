@@ -22,6 +22,15 @@ type WSClientCallback interface {
 	TradeData(data []*model.TradeData)
 }
 
+// WSPrivateCallback is implemented by the callbacks that also want the
+// orders and fills channels of the profile, they are subscribed only then
+type WSPrivateCallback interface {
+	OrdersInit(data *model.OrdersSnapshot)
+	OrdersData(data *model.OrderEventsData)
+	FillsInit(data *model.FillsSnapshot)
+	FillsData(data *model.FillEventsData)
+}
+
 type WSClient struct {
 	client     *Client
 	connection *websocket.Conn
@@ -117,8 +126,9 @@ func (c *WSClient) Start() error {
 
 	// Prepare channels for subscription
 	accountChannel := fmt.Sprintf("account@%d", c.client.Credentials.ProfileID)
-	channels := make([]string, 0, len(c.marketIDs)+1)
+	channels := make([]string, 0, len(c.marketIDs)*5+1)
 	channels = append(channels, accountChannel)
+	_, private := c.callback.(WSPrivateCallback)
 
 	if c.marketIDs != nil {
 		for _, marketID := range c.marketIDs {
@@ -126,6 +136,12 @@ func (c *WSClient) Start() error {
 			tradeChannel := fmt.Sprintf("trade:%s", marketID)
 			marketChannel := fmt.Sprintf("market:%s", marketID)
 			channels = append(channels, orderBookChannel, tradeChannel, marketChannel)
+
+			if private {
+				ordersChannel := fmt.Sprintf("orders:%s@%d", marketID, c.client.Credentials.ProfileID)
+				fillsChannel := fmt.Sprintf("fills:%s@%d", marketID, c.client.Credentials.ProfileID)
+				channels = append(channels, ordersChannel, fillsChannel)
+			}
 		}
 	}
 
@@ -227,6 +243,54 @@ func (c *WSClient) processMessage(resp *wsResponse) error {
 			c.callback.AccountData(&profile)
 		}
 
+	case "orders":
+		callback, ok := c.callback.(WSPrivateCallback)
+		if !ok {
+			return nil
+		}
+
+		if initial {
+			var orders model.OrdersSnapshot
+
+			if err = json.Unmarshal(data, &orders); err != nil {
+				return err
+			}
+
+			callback.OrdersInit(&orders)
+		} else {
+			var events model.OrderEventsData
+
+			if err = json.Unmarshal(data, &events); err != nil {
+				return err
+			}
+
+			callback.OrdersData(&events)
+		}
+
+	case "fills":
+		callback, ok := c.callback.(WSPrivateCallback)
+		if !ok {
+			return nil
+		}
+
+		if initial {
+			var fills model.FillsSnapshot
+
+			if err = json.Unmarshal(data, &fills); err != nil {
+				return err
+			}
+
+			callback.FillsInit(&fills)
+		} else {
+			var events model.FillEventsData
+
+			if err = json.Unmarshal(data, &events); err != nil {
+				return err
+			}
+
+			callback.FillsData(&events)
+		}
+
 	case "orderbook":
 		var orderbook model.OrderbookData
 
@@ -14,6 +14,11 @@ type AccountSetLeverageRequest struct {
 	Leverage uint   `json:"leverage" binding:"oneof=1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20,required"`
 }
 
+type AccountSetMarginModeRequest struct {
+	MarketId   string `json:"market_id" binding:"required"`
+	MarginMode string `json:"margin_mode" binding:"required,oneof=cross isolated"`
+}
+
 type AccountValidateRequest struct {
 	Jwt string `form:"jwt"`
 }
@@ -33,6 +38,7 @@ func HandleAccount(c *gin.Context) {
 		ErrorResponse(c, err)
 		return
 	}
+	setMarginModes(profileData.Positions, profileData.IsolatedMargins)
 
 	SuccessResponse(c, profileData)
 }
@@ -99,6 +105,7 @@ func HandleAccountValidate(c *gin.Context) {
 		ErrorResponse(c, err)
 		return
 	}
+	setMarginModes(profileData.Positions, profileData.IsolatedMargins)
 
 	SuccessResponse(c, profileData)
 }
@@ -138,3 +145,34 @@ func HandleAccountSetLeverage(c *gin.Context) {
 
 	SuccessResponse(c, profile)
 }
+
+func HandleAccountSetMarginMode(c *gin.Context) {
+	var request AccountSetMarginModeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	ctx := GetRabbitContext(c)
+	apiModel := model.NewApiModel(ctx.Broker)
+
+	_, err := apiModel.SetMarginMode(
+		c.Request.Context(),
+		ctx.Profile.ProfileId,
+		request.MarketId,
+		request.MarginMode,
+	)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	profile, err := apiModel.InvalidateCacheAndNotify(c.Request.Context(), ctx.Profile.ProfileId)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, profile)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"github.com/strips-finance/rabbit-dex-backend/model"
 )
 
@@ -133,6 +134,63 @@ func HandleChangeMarketTitle(c *gin.Context) {
 	SuccessResponse(c, res)
 }
 
+const (
+	WITHDRAWAL_REVIEW_APPROVE = "approve"
+	WITHDRAWAL_REVIEW_REJECT  = "reject"
+)
+
+type ReviewWithdrawalRequest struct {
+	Id     string `json:"id" binding:"required"`
+	Action string `json:"action" binding:"oneof=approve reject,required"`
+}
+
+// Withdrawals held by the settlement withdrawal policy
+func HandleGetReviewWithdrawals(c *gin.Context) {
+	ctx := GetRabbitContext(c)
+	apiModel := model.NewApiModel(ctx.Broker)
+
+	res, err := apiModel.GetReviewWithdrawals(c.Request.Context())
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, res)
+}
+
+func HandleReviewWithdrawal(c *gin.Context) {
+	var request ReviewWithdrawalRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	ctx := GetRabbitContext(c)
+	apiModel := model.NewApiModel(ctx.Broker)
+
+	approve := request.Action == WITHDRAWAL_REVIEW_APPROVE
+	res, err := apiModel.ReviewWithdrawal(c.Request.Context(), request.Id, approve)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+	logrus.Warnf("withdrawal id=%s profile_id=%d amount=%s %s by admin profile_id=%d",
+		res.OpsId, res.ProfileId, res.Amount.String(), request.Action, ctx.Profile.ProfileId)
+
+	// a rejected withdrawal is refunded
+	if !approve {
+		_, err = apiModel.InvalidateCacheAndNotify(c.Request.Context(), res.ProfileId)
+		if err != nil {
+			logrus.Error(err)
+			ErrorResponse(c, errors.New("WITHDRAWAL_REVIEW_CACHE_ERROR"))
+			return
+		}
+	}
+
+	SuccessResponse(c, res)
+}
+
 /*
 type Tier struct {
 	Tier      uint             `msgpack:"tier" json:"tier"`
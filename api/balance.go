@@ -82,6 +82,12 @@ func HandleDeposit(c *gin.Context) {
 		return
 	}
 
+	// a subaccount has no wallet, the master transfers to it
+	if ctx.Profile != nil && ctx.Profile.Type == model.PROFILE_TYPE_SUBACCOUNT {
+		ErrorResponse(c, fmt.Errorf("NOT_ALLOWED_FOR_SUBACCOUNT"))
+		return
+	}
+
 	rounded_amount := tick.RoundDownToUsdtTick(request.Amount)
 
 	amount := tdecimal.NewDecimal(decimal.NewFromFloat(rounded_amount))
@@ -143,6 +149,13 @@ func HandleStake(c *gin.Context) {
 		return
 	}
 
+	if stakerProfile.Type == model.PROFILE_TYPE_SUBACCOUNT {
+		err = fmt.Errorf("NOT_ALLOWED_FOR_SUBACCOUNT")
+		logrus.Error(err)
+		ErrorResponse(c, err)
+		return
+	}
+
 	// check the vaultWallet profile
 	vaultWallet := model.GetWalletStringInRabbitTntStandardFormat(request.VaultWallet)
 	vaultProfile, err := apiModel.GetProfileByWalletForExchangeId(c.Request.Context(), vaultWallet, ctx.ExchangeId)
@@ -691,6 +704,12 @@ func HandleWithdrawal(c *gin.Context) {
 		return
 	}
 
+	// a subaccount has no wallet, it transfers to the master
+	if ctx.Profile.Type == model.PROFILE_TYPE_SUBACCOUNT {
+		ErrorResponse(c, errors.New("NOT_ALLOWED_FOR_SUBACCOUNT"))
+		return
+	}
+
 	//1. Acquire withdraw Lock
 	_, err := apiModel.AcquireWithdrawLock(c.Request.Context(), ctx.Profile.ProfileId)
 	if err != nil {
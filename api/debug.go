@@ -240,7 +240,7 @@ func HandleDepositInsurance(c *gin.Context) {
 	}
 
 	apiModel := model.NewApiModel(ctx.Broker)
-	ops, err := apiModel.DepositCredit(c.Request.Context(), 0, request.Amount)
+	ops, err := apiModel.DepositInsurance(c.Request.Context(), request.Amount)
 
 	if err != nil {
 		ErrorResponse(c, err)
@@ -14,12 +14,33 @@ type FundingRateListRequest struct {
 	EndTime   uint64 `form:"end_time,default=0" binding:"omitempty,min=0"`
 }
 
+type FundingPaymentListRequest struct {
+	MarketId  string `form:"market_id" binding:"omitempty"`
+	TimeStamp uint64 `form:"start_time,default=0" binding:"omitempty,min=0"`
+	EndTime   uint64 `form:"end_time,default=0" binding:"omitempty,min=0"`
+}
+
 type FundingRateData struct {
 	MarketId    string          `json:"market_id"`
 	TimeStamp   uint64          `json:"timestamp"`
 	FundingRate decimal.Decimal `json:"funding_rate"`
 }
 
+// amount is negative for a debit, funding_time is the time (microseconds)
+// of the rate the payment was made for
+type FundingPaymentData struct {
+	Id          string          `json:"id"`
+	ProfileId   uint            `json:"profile_id"`
+	MarketId    string          `json:"market_id"`
+	Side        string          `json:"side"`
+	Size        decimal.Decimal `json:"size"`
+	Price       decimal.Decimal `json:"price"`
+	Rate        decimal.Decimal `json:"rate"`
+	Amount      decimal.Decimal `json:"amount"`
+	FundingTime int64           `json:"funding_time"`
+	Timestamp   int64           `json:"timestamp"`
+}
+
 func HandleFundingRateList(c *gin.Context) {
 	var request FundingRateListRequest
 	if err := c.ShouldBindQuery(&request); err != nil {
@@ -91,3 +112,87 @@ func HandleFundingRateList(c *gin.Context) {
 	}
 	SuccessResponsePaginated(c, pagination, results...)
 }
+
+func HandleFundingPaymentList(c *gin.Context) {
+	var request FundingPaymentListRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	ctx := GetRabbitContext(c)
+
+	db := ctx.TimeScaleDB
+	q := `SELECT "id", "profile_id", "market_id", "side", "size", "price", "rate", "amount", "funding_time", "timestamp"
+		  FROM app_funding_payment
+          WHERE profile_id = @profile_id AND timestamp >= @timestamp
+		  %s
+          ORDER BY timestamp ` + ctx.Pagination.Order
+	limit := ` LIMIT @limit OFFSET @offset`
+
+	filters := ""
+	if request.MarketId != "" {
+		filters += " AND market_id = @market_id"
+	}
+
+	if request.EndTime > 0 {
+		filters += " AND timestamp <= @end_time"
+	}
+
+	q = fmt.Sprintf(q, filters)
+	args := pgx.NamedArgs{
+		"profile_id": ctx.Profile.ProfileId,
+		"market_id":  request.MarketId,
+		"timestamp":  request.TimeStamp,
+		"order":      ctx.Pagination.Order,
+		"limit":      ctx.Pagination.Limit,
+		"end_time":   request.EndTime,
+		"offset":     nil,
+	}
+
+	pagination := &types.PaginationResponse{
+		Limit: ctx.Pagination.Limit,
+		Page:  ctx.Pagination.Page,
+		Order: ctx.Pagination.Order,
+	}
+	totalQuery := `SELECT COUNT(*) FROM (` + q + `) as t`
+	db.QueryRow(c.Request.Context(), totalQuery, args).Scan(&pagination.Total)
+
+	q = q + limit
+	args["offset"] = ctx.Pagination.Limit * ctx.Pagination.Page
+	rows, err := db.Query(c.Request.Context(), q, args)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+	defer rows.Close()
+
+	results := make([]FundingPaymentData, 0)
+	for rows.Next() {
+		var r FundingPaymentData
+		err = rows.Scan(
+			&r.Id,
+			&r.ProfileId,
+			&r.MarketId,
+			&r.Side,
+			&r.Size,
+			&r.Price,
+			&r.Rate,
+			&r.Amount,
+			&r.FundingTime,
+			&r.Timestamp,
+		)
+
+		if err != nil {
+			ErrorResponse(c, err)
+			return
+		}
+		results = append(results, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+	SuccessResponsePaginated(c, pagination, results...)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/strips-finance/rabbit-dex-backend/insurancedata"
+)
+
+func HandleInsuranceHistory(c *gin.Context) {
+	var request insurancedata.HistoryRequest
+
+	if err := c.ShouldBindQuery(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	ctx := GetRabbitContext(c)
+
+	response, pagination, err := insurancedata.HandleInsuranceHistory(c.Request.Context(), ctx.TimeScaleDB, request, ctx.Pagination)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponsePaginated(c, pagination, response...)
+}
+
+func HandleInsuranceBalance(c *gin.Context) {
+	var request insurancedata.BalanceRequest
+
+	if err := c.ShouldBindQuery(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	ctx := GetRabbitContext(c)
+
+	response, err := insurancedata.HandleInsuranceBalance(c.Request.Context(), ctx.TimeScaleDB, request)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, response...)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"github.com/strips-finance/rabbit-dex-backend/api/types"
+)
+
+type LiquidationListRequest struct {
+	MarketId  string `form:"market_id" binding:"omitempty"`
+	TimeStamp uint64 `form:"start_time,default=0" binding:"omitempty,min=0"`
+	EndTime   uint64 `form:"end_time,default=0" binding:"omitempty,min=0"`
+}
+
+// side is the side of the liquidated profile fill, kind is orderbook or
+// takeover by the insurance
+type LiquidationHistoryData struct {
+	Id        string          `json:"id"`
+	MarketId  string          `json:"market_id"`
+	Side      string          `json:"side"`
+	Size      decimal.Decimal `json:"size"`
+	Price     decimal.Decimal `json:"price"`
+	Kind      string          `json:"kind"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+func HandleLiquidationList(c *gin.Context) {
+	var request LiquidationListRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	ctx := GetRabbitContext(c)
+
+	db := ctx.TimeScaleDB
+	q := `SELECT "id", "market_id", "side", "size", "price", "kind", "timestamp"
+		  FROM app_liquidation
+          WHERE timestamp >= @timestamp
+		  %s
+          ORDER BY timestamp ` + ctx.Pagination.Order
+	limit := ` LIMIT @limit OFFSET @offset`
+
+	filters := ""
+	if request.MarketId != "" {
+		filters += " AND market_id = @market_id"
+	}
+
+	if request.EndTime > 0 {
+		filters += " AND timestamp <= @end_time"
+	}
+
+	q = fmt.Sprintf(q, filters)
+	args := pgx.NamedArgs{
+		"market_id": request.MarketId,
+		"timestamp": request.TimeStamp,
+		"order":     ctx.Pagination.Order,
+		"limit":     ctx.Pagination.Limit,
+		"end_time":  request.EndTime,
+		"offset":    nil,
+	}
+
+	pagination := &types.PaginationResponse{
+		Limit: ctx.Pagination.Limit,
+		Page:  ctx.Pagination.Page,
+		Order: ctx.Pagination.Order,
+	}
+	totalQuery := `SELECT COUNT(*) FROM (` + q + `) as t`
+	db.QueryRow(c.Request.Context(), totalQuery, args).Scan(&pagination.Total)
+
+	q = q + limit
+	args["offset"] = ctx.Pagination.Limit * ctx.Pagination.Page
+	rows, err := db.Query(c.Request.Context(), q, args)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+	defer rows.Close()
+
+	results := make([]LiquidationHistoryData, 0)
+	for rows.Next() {
+		var r LiquidationHistoryData
+		err = rows.Scan(
+			&r.Id,
+			&r.MarketId,
+			&r.Side,
+			&r.Size,
+			&r.Price,
+			&r.Kind,
+			&r.Timestamp,
+		)
+
+		if err != nil {
+			ErrorResponse(c, err)
+			return
+		}
+		results = append(results, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+	SuccessResponsePaginated(c, pagination, results...)
+}
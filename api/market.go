@@ -22,6 +22,8 @@ type MarketResponse struct {
 	LongRatio                decimal.Decimal `json:"long_ratio"`
 	ShortRatio               decimal.Decimal `json:"short_ratio"`
 	NextFundingRateTimestamp int64           `json:"next_funding_rate_timestamp"`
+	NextFundingCountdown     int64           `json:"next_funding_countdown"`
+	PredictedFundingRate     decimal.Decimal `json:"predicted_funding_rate"`
 
 	AverageDailyVolume              decimal.Decimal `json:"average_daily_volume"`
 	LastTradePrice24High            decimal.Decimal `json:"last_trade_price_24high"`
@@ -232,16 +234,20 @@ func HandleMarket(c *gin.Context) {
 			logrus.Warnf("UNFORMATED market_id = %s", market)
 		}
 
-		//We pay funding at the first minute of each hour, so we can just align it to 1 hour
+		nextFunding, countdown := NextFunding(res1)
 		res2 := MarketResponse{
 			BaseCurrency:             baseCurrency,
 			QuoteCurrency:            quoteCurrency,
 			ProductType:              model.DEFAULT_INSTRUMENT_PRODUCT_TYPE,
-			NextFundingRateTimestamp: NextHourTimestamp(),
+			NextFundingRateTimestamp: nextFunding,
+			NextFundingCountdown:     countdown,
 			OpenInterest:             OpenInterest,
 			LongRatio:                LongRatio,
 			ShortRatio:               ShortRatio,
 		}
+		if res1.InstantFundingRate != nil {
+			res2.PredictedFundingRate = res1.InstantFundingRate.Decimal
+		}
 
 		func() {
 			marketViewDailyMapMut.RLock()
@@ -33,6 +33,7 @@ const (
 	PKTimestampHeader     = "RBT-PK-TS"
 	IPHeader              = "X-Forwarded-For"
 	ExchangeIdHeader      = "EID"
+	SubaccountHeader      = "RBT-SUBACCOUNT"
 	SignatureLifetime     = 600
 	ClientHeader          = "X-RBT-Client"
 	SrvTimestampHeader    = "SRV-TIMESTAMP"
@@ -40,6 +41,9 @@ const (
 
 	ADHOC_TESTNET_BFX_MM_PROFILE_ID = 22823
 	ADHOC_MAINNET_BFX_MM_PROFILE_ID = 23028
+
+	// error of a request the api key has no scope for
+	API_KEY_SCOPE_DENIED = "API_KEY_SCOPE_DENIED"
 )
 
 type responseBodyWriter struct {
@@ -75,6 +79,10 @@ type RabbitContext struct {
 	EIP712Encoder         *signer.EIP712Encoder
 	AnalyticCollector     *AnalyticsCollector
 	RequiredRole          uint
+	RequiredScope         string
+	APISecret             *model.APISecret
+	SubaccountId          uint
+	MasterProfile         *model.Profile
 	ProfileIdFromJwt      uint
 	ExchangeId            string
 	ExchangeCfg           ExchangeConfig
@@ -332,6 +340,17 @@ func RabbitMiddleware() gin.HandlerFunc {
 
 		rabbitContext.PKTimestamp = pkTimestamp
 
+		// The master profile acts on its subaccount, checked once authenticated
+		if subaccountStr := c.GetHeader(SubaccountHeader); subaccountStr != "" {
+			subaccountId, err := strconv.ParseUint(subaccountStr, 10, 64)
+			if err != nil || !IsAllowedProfileId(uint(subaccountId)) {
+				ErrorResponse(c, fmt.Errorf("wrong %s header: %s", SubaccountHeader, subaccountStr))
+				c.Abort()
+				return
+			}
+			rabbitContext.SubaccountId = uint(subaccountId)
+		}
+
 		// Now assign collected context to Gin's context
 		c.Set("context", rabbitContext)
 
@@ -524,6 +543,7 @@ func AuthMiddleware(c *gin.Context) {
 		}
 
 		ctx.Profile = profile
+		ctx.APISecret = apiSecret
 		secret = apiSecret.Secret
 		c.Set("context", ctx)
 	} else {
@@ -564,20 +584,140 @@ func AuthMiddleware(c *gin.Context) {
 
 	// Next we should verify payload
 	rMethod := c.Request.Method
-	if !(rMethod == http.MethodPost || rMethod == http.MethodPut || rMethod == http.MethodDelete) {
-		c.Next()
-		return
+	if rMethod == http.MethodPost || rMethod == http.MethodPut || rMethod == http.MethodDelete {
+		if err = ctx.Payload.Verify(ctx.Signature, secret, ctx.Config.Service.EnvMode); err != nil {
+			ErrorResponse(c, err)
+			c.Abort()
+			return
+		}
 	}
 
-	if err = ctx.Payload.Verify(ctx.Signature, secret, ctx.Config.Service.EnvMode); err != nil {
-		ErrorResponse(c, err)
-		c.Abort()
-		return
+	if ctx.SubaccountId != 0 {
+		isSubaccount, err := apiModel.IsSubaccountOf(c.Request.Context(), ctx.SubaccountId, ctx.Profile.ProfileId)
+		if err != nil {
+			ErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+		if !isSubaccount {
+			ErrorResponse(c, errors.New("NOT_YOUR_SUBACCOUNT"))
+			c.Abort()
+			return
+		}
+
+		subaccount, err := apiModel.GetProfileById(c.Request.Context(), ctx.SubaccountId)
+		if err != nil {
+			ErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+
+		ctx.MasterProfile = ctx.Profile
+		ctx.Profile = subaccount
+	}
+
+	// The frontend has full access
+	if ctx.APISecret != nil {
+		if err = CheckApiKeyScope(ctx.APISecret, ctx.RequiredScope, ctx.Payload); err != nil {
+			ScopeErrorResponse(c, err)
+			return
+		}
 	}
 
 	c.Next()
 }
 
+// ScopeMiddleware sets the scope an api key needs for the routes of the group,
+// it goes before AuthMiddleware. The routes without a scope need full access.
+func ScopeMiddleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := GetRabbitContext(c)
+		ctx.RequiredScope = scope
+
+		c.Next()
+	}
+}
+
+// CheckApiKeyScope checks the key has the scope, and for the trade and cancel
+// scopes that the key can trade the markets of the request. A request without
+// a market is for all markets and needs a key without market restrictions.
+func CheckApiKeyScope(apiSecret *model.APISecret, scope string, payload *auth.Payload) error {
+	if scope == "" {
+		if len(apiSecret.Scopes) > 0 {
+			return errors.New(API_KEY_SCOPE_DENIED)
+		}
+		return nil
+	}
+
+	if !apiSecret.HasScope(scope) {
+		return errors.New(API_KEY_SCOPE_DENIED)
+	}
+
+	if scope == model.API_SCOPE_READ || len(apiSecret.Markets) == 0 {
+		return nil
+	}
+
+	marketIds, err := payloadMarketIds(payload)
+	if err != nil {
+		return err
+	}
+
+	if len(marketIds) == 0 {
+		return errors.New(API_KEY_SCOPE_DENIED)
+	}
+
+	for _, marketId := range marketIds {
+		if !apiSecret.AllowsMarket(marketId) {
+			return errors.New(API_KEY_SCOPE_DENIED)
+		}
+	}
+
+	return nil
+}
+
+// payloadMarketIds returns the markets of an order request, a batch has
+// the market in each of its orders
+func payloadMarketIds(payload *auth.Payload) ([]string, error) {
+	if payload == nil {
+		return nil, nil
+	}
+
+	if marketId, ok := payload.Data["market_id"]; ok {
+		return []string{marketId}, nil
+	}
+
+	orders, ok := payload.Data["orders"]
+	if !ok {
+		return nil, nil
+	}
+
+	var items []struct {
+		MarketId string              `json:"market_id"`
+		Create   *OrderCreateRequest `json:"create"`
+		Amend    *OrderAmendRequest  `json:"amend"`
+		Cancel   *OrderCancelRequest `json:"cancel"`
+	}
+	if err := json.Unmarshal([]byte(orders), &items); err != nil {
+		return nil, err
+	}
+
+	marketIds := make([]string, 0, len(items))
+	for _, item := range items {
+		switch {
+		case item.Create != nil:
+			marketIds = append(marketIds, item.Create.MarketId)
+		case item.Amend != nil:
+			marketIds = append(marketIds, item.Amend.MarketId)
+		case item.Cancel != nil:
+			marketIds = append(marketIds, item.Cancel.MarketId)
+		default:
+			marketIds = append(marketIds, item.MarketId)
+		}
+	}
+
+	return marketIds, nil
+}
+
 func extractPayload(c *gin.Context, timestamp int64) (*auth.Payload, error) {
 	var data map[string]json.RawMessage
 
@@ -608,6 +748,11 @@ func extractPayload(c *gin.Context, timestamp int64) (*auth.Payload, error) {
 	payloadData["method"] = rMethod
 	payloadData["path"] = c.FullPath()
 
+	// The header switches the profile the request acts on, so it's signed
+	if subaccount := c.GetHeader(SubaccountHeader); subaccount != "" {
+		payloadData[auth.PayloadKeySubaccount] = subaccount
+	}
+
 	return auth.NewPayload(timestamp, payloadData)
 }
 
@@ -750,16 +895,22 @@ func MetamaskSignatureMiddleware(requireRole uint) gin.HandlerFunc {
 
 		ctx.RequiredRole = requireRole
 
+		// A subaccount has no wallet of its own, the master signs for it
+		signerProfile := ctx.Profile
+		if ctx.MasterProfile != nil {
+			signerProfile = ctx.MasterProfile
+		}
+
 		verifyRequest := &auth.MetamaskVerifyRequest{
-			Wallet:        ctx.Profile.Wallet,
+			Wallet:        signerProfile.Wallet,
 			Timestamp:     ctx.PKTimestamp,
 			Signature:     ctx.PKSignature,
-			ProfileType:   ctx.Profile.Type,
+			ProfileType:   signerProfile.Type,
 			EIP712Encoder: ctx.EIP712Encoder,
 		}
 
 		logrus.
-			WithField("Wallet", ctx.Profile.Wallet).
+			WithField("Wallet", signerProfile.Wallet).
 			WithField("Timestamp", ctx.PKTimestamp).
 			WithField("Signature", ctx.PKSignature).
 			Info("MetamaskSignatureMiddleware")
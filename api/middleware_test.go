@@ -0,0 +1,36 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/strips-finance/rabbit-dex-backend/auth"
+)
+
+func TestExtractPayloadSubaccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	request := func(subaccount string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/subaccounts/transfer", bytes.NewBufferString(`{"amount":1}`))
+		if subaccount != "" {
+			c.Request.Header.Set(SubaccountHeader, subaccount)
+		}
+		return c
+	}
+
+	payload, err := extractPayload(request(""), 1)
+	require.NoError(t, err)
+	assert.NotContains(t, payload.Data, auth.PayloadKeySubaccount)
+
+	// the subaccount header is part of the signed payload
+	signed, err := extractPayload(request("42"), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "42", signed.Data[auth.PayloadKeySubaccount])
+	assert.NotEqual(t, payload.Hash(), signed.Hash())
+}
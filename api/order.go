@@ -17,15 +17,16 @@ type OrderListRequest struct {
 	MarketId      string   `form:"market_id" binding:"omitempty"`
 	TimeStamp     uint64   `form:"start_time,default=0" binding:"omitempty,min=0"`
 	EndTime       uint64   `form:"end_time,default=0" binding:"omitempty,min=0"`
-	Status        []string `form:"status" binding:"omitempty,dive,oneof=processing open closed rejected canceled canceling amending cancelingall placed"`
+	Status        []string `form:"status" binding:"omitempty,dive,oneof=processing open closed rejected canceled canceling amending cancelingall placed pending"`
 	OrderId       string   `form:"order_id" binding:"omitempty"`
 	ClientOrderId string   `form:"client_order_id" binding:"omitempty"`
-	OrderType     []string `form:"order_type" binding:"omitempty,dive,oneof=limit market stop_loss take_profit stop_loss_limit take_profit_limit stop_market stop_limit cancel amend"`
+	GroupId       string   `form:"group_id" binding:"omitempty"`
+	OrderType     []string `form:"order_type" binding:"omitempty,dive,oneof=limit market stop_loss take_profit stop_loss_limit take_profit_limit stop_market stop_limit trailing_stop cancel amend"`
 }
 
 type OrderCreateRequest struct {
 	MarketId      string   `json:"market_id" binding:"required"`
-	Type          string   `json:"type" binding:"oneof=ping_limit limit market stop_loss take_profit stop_loss_limit take_profit_limit stop_market stop_limit cancel amend,required"`
+	Type          string   `json:"type" binding:"oneof=ping_limit limit market stop_loss take_profit stop_loss_limit take_profit_limit stop_market stop_limit trailing_stop cancel amend,required"`
 	Side          string   `json:"side" binding:"required_unless=Type ping_limit Type stop_loss Type take_profit Type stop_loss_limit Type take_profit_limit,omitempty,oneof=short long"`
 	Price         *float64 `json:"price" binding:"required_if=Type limit Type stop_limit Type stop_loss_limit Type take_profit_limit,omitempty"`
 	Size          *float64 `json:"size" binding:"required_unless=Type stop_loss Type take_profit Type stop_loss_limit Type take_profit_limit,omitempty"`
@@ -33,7 +34,29 @@ type OrderCreateRequest struct {
 	TriggerPrice  *float64 `json:"trigger_price" binding:"required_if=Type stop_loss Type take_profit Type stop_loss_limit Type take_profit_limit Type stop_market Type stop_limit,omitempty"`
 	SizePercent   *float64 `json:"size_percent" binding:"required_if=Type stop_loss Type take_profit Type stop_loss_limit Type take_profit_limit,omitempty"`
 	TimeInForce   *string  `json:"time_in_force" binding:"omitempty,oneof=good_till_cancel immediate_or_cancel fill_or_kill post_only"`
-	IsPm          bool     `json:"is_pm" binding:"omitempty"`
+	// trailing_stop distance from the running high/low, absolute or a fraction of the price
+	CallbackValue   *float64 `json:"callback_value" binding:"omitempty,gt=0"`
+	CallbackPercent *float64 `json:"callback_percent" binding:"omitempty,gt=0,lt=1"`
+	// price stream of conditional orders, mark by default
+	TriggerBy *string `json:"trigger_by" binding:"omitempty,oneof=mark last index"`
+	// oco or bracket, the request itself is the first oco order or the bracket entry
+	GroupType *string                `json:"group_type" binding:"omitempty,oneof=oco bracket"`
+	Legs      []OrderGroupLegRequest `json:"legs" binding:"required_with=GroupType,omitempty,min=1,max=2,dive"`
+	IsPm      bool                   `json:"is_pm" binding:"omitempty"`
+}
+
+// The rest of an oco/bracket group, bracket children get their side and size
+// from the position once the entry is filled
+type OrderGroupLegRequest struct {
+	Type          string   `json:"type" binding:"oneof=stop_loss take_profit stop_loss_limit take_profit_limit stop_market stop_limit,required"`
+	Side          string   `json:"side" binding:"required_if=Type stop_market Type stop_limit,omitempty,oneof=short long"`
+	Price         *float64 `json:"price" binding:"required_if=Type stop_limit Type stop_loss_limit Type take_profit_limit,omitempty"`
+	Size          *float64 `json:"size" binding:"required_if=Type stop_market Type stop_limit,omitempty"`
+	ClientOrderId *string  `json:"client_order_id" binding:"omitempty"`
+	TriggerPrice  *float64 `json:"trigger_price" binding:"required"`
+	SizePercent   *float64 `json:"size_percent" binding:"required_if=Type stop_loss Type take_profit Type stop_loss_limit Type take_profit_limit,omitempty"`
+	TimeInForce   *string  `json:"time_in_force" binding:"omitempty,oneof=good_till_cancel immediate_or_cancel fill_or_kill post_only"`
+	TriggerBy     *string  `json:"trigger_by" binding:"omitempty,oneof=mark last index"`
 }
 
 type OrderAmendRequest struct {
@@ -51,6 +74,21 @@ type OrderCancelRequest struct {
 	ClientOrderId string `json:"client_order_id" binding:"omitempty"`
 }
 
+type OrderBatchItemRequest struct {
+	Create *OrderCreateRequest `json:"create"`
+	Amend  *OrderAmendRequest  `json:"amend"`
+	Cancel *OrderCancelRequest `json:"cancel"`
+}
+
+type OrderBatchRequest struct {
+	Orders []OrderBatchItemRequest `json:"orders" binding:"required,min=1,max=100,dive"`
+	IsPm   bool                    `json:"is_pm" binding:"omitempty"`
+}
+
+type OrderCancelBatchRequest struct {
+	Orders []OrderCancelRequest `json:"orders" binding:"required,min=1,max=100,dive"`
+}
+
 func isRateLimitError(err error) bool {
 	if err == nil {
 		return false
@@ -79,9 +117,62 @@ func HandleOrderCreate(c *gin.Context) {
 
 	// profile_id uint, market_id, order_tpye, side string, price, size float64
 	ctx.Meta.SetPm(request.IsPm)
-	res, err := apiModel.OrderCreate(c.Request.Context(),
-		ctx.Profile.ProfileId,
-		request.MarketId,
+	if request.GroupType != nil {
+		orderGroupCreate(c, apiModel, ctx, &request)
+		return
+	}
+
+	var res model.OrderCreateRes
+	var err error
+	if request.Type == model.TRAILING_STOP {
+		res, err = apiModel.TrailingStopCreate(c.Request.Context(),
+			ctx.Profile.ProfileId,
+			request.MarketId,
+			request.Side,
+			request.Size,
+			request.ClientOrderId,
+			request.TriggerPrice,
+			request.CallbackValue,
+			request.CallbackPercent,
+			request.TriggerBy,
+
+			ctx.Meta,
+		)
+	} else {
+		res, err = apiModel.OrderCreateTriggerBy(c.Request.Context(),
+			ctx.Profile.ProfileId,
+			request.MarketId,
+			request.Type,
+			request.Side,
+			request.Price,
+			request.Size,
+			request.ClientOrderId,
+			request.TriggerPrice,
+			request.SizePercent,
+			request.TimeInForce,
+			request.TriggerBy,
+
+			ctx.Meta,
+		)
+	}
+	if err != nil {
+		if isRateLimitError(err) {
+			RateLimitErrorResponse(c, err)
+			return
+		}
+		ErrorResponse(c, err)
+		return
+	}
+
+	logrus.
+		Info("Order task created")
+
+	SuccessResponse(c, res)
+}
+
+func orderGroupCreate(c *gin.Context, apiModel *model.ApiModel, ctx *RabbitContext, request *OrderCreateRequest) {
+	legs := make([]model.OrderGroupLeg, 0, len(request.Legs)+1)
+	legs = append(legs, model.NewOrderGroupLeg(
 		request.Type,
 		request.Side,
 		request.Price,
@@ -90,6 +181,27 @@ func HandleOrderCreate(c *gin.Context) {
 		request.TriggerPrice,
 		request.SizePercent,
 		request.TimeInForce,
+		request.TriggerBy,
+	))
+	for _, leg := range request.Legs {
+		legs = append(legs, model.NewOrderGroupLeg(
+			leg.Type,
+			leg.Side,
+			leg.Price,
+			leg.Size,
+			leg.ClientOrderId,
+			leg.TriggerPrice,
+			leg.SizePercent,
+			leg.TimeInForce,
+			leg.TriggerBy,
+		))
+	}
+
+	res, err := apiModel.OrderGroupCreate(c.Request.Context(),
+		ctx.Profile.ProfileId,
+		request.MarketId,
+		*request.GroupType,
+		legs,
 
 		ctx.Meta,
 	)
@@ -103,9 +215,10 @@ func HandleOrderCreate(c *gin.Context) {
 	}
 
 	logrus.
-		Info("Order task created")
+		WithField("group_type", *request.GroupType).
+		Info("Order group task created")
 
-	SuccessResponse(c, res)
+	SuccessResponse(c, res...)
 }
 
 func HandleOrderCancel(c *gin.Context) {
@@ -196,6 +309,151 @@ func HandleOrderAmend(c *gin.Context) {
 	SuccessResponse(c, res)
 }
 
+func HandleOrdersBatch(c *gin.Context) {
+	var request OrderBatchRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	marketIds := make([]string, len(request.Orders))
+	items := make([]model.OrderBatchItem, len(request.Orders))
+	for i, order := range request.Orders {
+		switch {
+		case order.Create != nil && order.Amend == nil && order.Cancel == nil:
+			create := order.Create
+			if create.GroupType != nil {
+				ErrorResponse(c, fmt.Errorf("orders[%d]: order groups are created by POST /orders only", i))
+				return
+			}
+			marketIds[i] = create.MarketId
+			items[i] = model.NewOrderBatchCreate(
+				create.Type,
+				create.Side,
+				create.Price,
+				create.Size,
+				create.ClientOrderId,
+				create.TriggerPrice,
+				create.SizePercent,
+				create.TimeInForce,
+				create.CallbackValue,
+				create.CallbackPercent,
+				create.TriggerBy,
+			)
+		case order.Amend != nil && order.Create == nil && order.Cancel == nil:
+			amend := order.Amend
+			marketIds[i] = amend.MarketId
+			items[i] = model.NewOrderBatchAmend(
+				amend.OrderId,
+				amend.Price,
+				amend.Size,
+				amend.TriggerPrice,
+				amend.SizePercent,
+			)
+		case order.Cancel != nil && order.Create == nil && order.Amend == nil:
+			cancel := order.Cancel
+			marketIds[i] = cancel.MarketId
+			items[i] = model.NewOrderBatchCancel(cancel.OrderId, cancel.ClientOrderId)
+		default:
+			ErrorResponse(c, fmt.Errorf("orders[%d]: exactly one of create, amend or cancel is required", i))
+			return
+		}
+	}
+
+	ctx := GetRabbitContext(c)
+	ctx.Meta.SetPm(request.IsPm)
+
+	res := ordersBatch(c, marketIds, items)
+
+	logrus.
+		WithField("size", len(items)).
+		Info("Order batch sent")
+
+	SuccessResponse(c, res...)
+}
+
+func HandleOrdersCancelBatch(c *gin.Context) {
+	var request OrderCancelBatchRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	marketIds := make([]string, len(request.Orders))
+	items := make([]model.OrderBatchItem, len(request.Orders))
+	for i, cancel := range request.Orders {
+		marketIds[i] = cancel.MarketId
+		items[i] = model.NewOrderBatchCancel(cancel.OrderId, cancel.ClientOrderId)
+	}
+
+	res := ordersBatch(c, marketIds, items)
+
+	logrus.
+		WithField("size", len(items)).
+		Info("Order cancel batch sent")
+
+	SuccessResponse(c, res...)
+}
+
+// Sends items to tarantool with one call per market and
+// returns results in the same order as items
+func ordersBatch(c *gin.Context, marketIds []string, items []model.OrderBatchItem) []model.OrderBatchRes {
+	ctx := GetRabbitContext(c)
+	apiModel := model.NewApiModel(ctx.Broker)
+
+	markets := make([]string, 0)
+	byMarket := make(map[string][]int)
+	for i, marketId := range marketIds {
+		if _, ok := byMarket[marketId]; !ok {
+			markets = append(markets, marketId)
+		}
+		byMarket[marketId] = append(byMarket[marketId], i)
+	}
+
+	results := make([]model.OrderBatchRes, len(items))
+	for _, marketId := range markets {
+		indexes := byMarket[marketId]
+
+		marketItems := make([]model.OrderBatchItem, len(indexes))
+		for j, i := range indexes {
+			marketItems[j] = items[i]
+		}
+
+		res, err := apiModel.OrdersBatch(c.Request.Context(),
+			ctx.Profile.ProfileId,
+			marketId,
+			marketItems,
+
+			ctx.Meta,
+		)
+		if err == nil && len(res) != len(indexes) {
+			err = fmt.Errorf("BATCH_RESULT_MISMATCH: sent=%d received=%d", len(indexes), len(res))
+		}
+
+		for j, i := range indexes {
+			if err != nil {
+				results[i] = model.OrderBatchRes{
+					Action: items[i].Action,
+					Error:  err.Error(),
+				}
+				continue
+			}
+			results[i] = res[j]
+		}
+
+		if err != nil {
+			logrus.
+				WithField("market_id", marketId).
+				WithField("profile_id", ctx.Profile.ProfileId).
+				Error(err)
+		}
+	}
+
+	return results
+}
+
 func HandleOrdersList(c *gin.Context) {
 	var request OrderListRequest
 	if err := c.ShouldBindQuery(&request); err != nil {
@@ -208,7 +466,8 @@ func HandleOrdersList(c *gin.Context) {
 	db := ctx.TimeScaleDB
 	q := `SELECT "id", "profile_id", "market_id", "order_type", "status", "price", "size", "initial_size",
                  "total_filled_size", "side", "timestamp", "reason", "client_order_id",
-				 "trigger_price", "size_percent", "time_in_force", "shard_id", "archive_id"
+				 "trigger_price", "size_percent", "time_in_force", "callback_value", "callback_percent",
+				 "group_id", "group_type", "trigger_by", "shard_id", "archive_id"
 		  FROM app_order
           WHERE profile_id = @profile_id AND timestamp >= @timestamp
           %s
@@ -236,6 +495,10 @@ func HandleOrdersList(c *gin.Context) {
 		filters += " AND client_order_id = @client_order_id"
 	}
 
+	if request.GroupId != "" {
+		filters += " AND group_id = @group_id"
+	}
+
 	if request.EndTime > 0 {
 		filters += " AND timestamp <= @end_time"
 	}
@@ -249,6 +512,7 @@ func HandleOrdersList(c *gin.Context) {
 		"order_type":      request.OrderType,
 		"order_id":        request.OrderId,
 		"client_order_id": request.ClientOrderId,
+		"group_id":        request.GroupId,
 		"end_time":        request.EndTime,
 		"limit":           ctx.Pagination.Limit,
 		"offset":          nil,
@@ -291,6 +555,11 @@ func HandleOrdersList(c *gin.Context) {
 			&r.TriggerPrice,
 			&r.SizePercent,
 			&r.TimeInForce,
+			&r.CallbackValue,
+			&r.CallbackPercent,
+			&r.GroupId,
+			&r.GroupType,
+			&r.TriggerBy,
 			&r.ShardId,
 			&r.ArchiveId)
 
@@ -1,10 +1,53 @@
 package api
 
 import (
+	"errors"
+	"math"
+
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+	"github.com/strips-finance/rabbit-dex-backend/tick"
 )
 
+type PositionMarginRequest struct {
+	MarketId string  `json:"market_id" binding:"required"`
+	Amount   float64 `json:"amount" binding:"required,ne=0"`
+}
+
+// sets the ADL quantile of the positions in the markets which answered
+func setAdlQuantiles(positions []*model.PositionData, quantiles []*model.MarketAdlQuantile) {
+	byMarket := make(map[string]uint, len(quantiles))
+	for _, q := range quantiles {
+		byMarket[q.MarketID] = q.Quantile
+	}
+
+	for _, pos := range positions {
+		if quantile, ok := byMarket[pos.MarketID]; ok {
+			pos.AdlQuantile = &quantile
+		}
+	}
+}
+
+// marks the positions of the isolated markets with their margin, the others
+// are on cross margin
+func setMarginModes(positions []*model.PositionData, isolatedMargins []*model.IsolatedMargin) {
+	isolated := make(map[string]*model.IsolatedMargin, len(isolatedMargins))
+	for _, margin := range isolatedMargins {
+		isolated[margin.MarketID] = margin
+	}
+
+	for _, pos := range positions {
+		pos.MarginMode = model.MARGIN_MODE_CROSS
+		if margin, ok := isolated[pos.MarketID]; ok {
+			pos.MarginMode = model.MARGIN_MODE_ISOLATED
+			pos.IsolatedMargin = margin.Margin
+		}
+	}
+}
+
 func HandlePositionsList(c *gin.Context) {
 	ctx := GetRabbitContext(c)
 	apiModel := model.NewApiModel(ctx.Broker)
@@ -15,5 +58,80 @@ func HandlePositionsList(c *gin.Context) {
 		return
 	}
 
+	isolatedMargins, err := apiModel.GetIsolatedMargins(c.Request.Context(), ctx.Profile.ProfileId)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+	setMarginModes(res, isolatedMargins)
+
+	// the ADL quantile is informative, the positions are returned without it on error
+	quantiles, err := apiModel.GetAdlQuantiles(c.Request.Context(), ctx.Profile.ProfileId)
+	if err != nil {
+		logrus.Warnf("error getting adl quantiles of profile %d: %v", ctx.Profile.ProfileId, err)
+	} else {
+		setAdlQuantiles(res, quantiles)
+	}
+
 	SuccessResponse(c, res...)
 }
+
+// adds margin to an isolated position with a positive amount, removes it
+// with a negative one
+func HandlePositionMargin(c *gin.Context) {
+	var request PositionMarginRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	ctx := GetRabbitContext(c)
+	apiModel := model.NewApiModel(ctx.Broker)
+
+	amount := decimal.NewFromFloat(tick.RoundDownToUsdtTick(math.Abs(request.Amount)))
+	if request.Amount < 0 {
+		amount = amount.Neg()
+	}
+	if amount.IsZero() {
+		ErrorResponse(c, errors.New("WRONG_AMOUNT"))
+		return
+	}
+
+	// the same lock as the withdrawals, both spend the withdrawable balance
+	_, err := apiModel.AcquireWithdrawLock(c.Request.Context(), ctx.Profile.ProfileId)
+	if err != nil {
+		ErrorResponse(c, errors.New("MARGIN_UNAVAILABLE_LOCK_ACQUIRE_ERROR"))
+		return
+	}
+	defer func() {
+		_, err := apiModel.ReleaseWithdrawLock(c.Request.Context(), ctx.Profile.ProfileId)
+		if err != nil {
+			logrus.Error(err)
+		}
+	}()
+
+	_, err = apiModel.InvalidateCache(c.Request.Context(), ctx.Profile.ProfileId)
+	if err != nil {
+		logrus.Error(err)
+		ErrorResponse(c, err)
+		return
+	}
+
+	res, err := apiModel.UpdateIsolatedMargin(c.Request.Context(),
+		ctx.Profile.ProfileId,
+		request.MarketId,
+		tdecimal.NewDecimal(amount),
+	)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	_, err = apiModel.InvalidateCacheAndNotify(c.Request.Context(), ctx.Profile.ProfileId)
+	if err != nil {
+		logrus.Error(err)
+	}
+
+	SuccessResponse(c, res)
+}
@@ -73,3 +73,18 @@ func RateLimitErrorResponse(c *gin.Context, err error) {
 
 	c.Abort()
 }
+
+func ScopeErrorResponse(c *gin.Context, err error) {
+	c.JSON(http.StatusForbidden, Response[int]{
+		Success: false,
+		Error:   err.Error(),
+		Result:  make([]int, 0),
+	})
+
+	logrus.
+		WithField("error response code:", http.StatusForbidden).
+		WithField("request url:", c.Request.URL).
+		Error(err)
+
+	c.Abort()
+}
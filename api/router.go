@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/strips-finance/rabbit-dex-backend/auth"
+	"github.com/strips-finance/rabbit-dex-backend/model"
 )
 
 func Router() *gin.Engine {
@@ -56,41 +57,65 @@ func Router() *gin.Engine {
 	router.GET("/vaults", HandleVault)
 	router.GET("/vaults/navhistory", HandleNavHistory)
 
+	router.GET("/insurance/history", HandleInsuranceHistory)
+	router.GET("/insurance/balance", HandleInsuranceBalance)
+	router.GET("/liquidations", HandleLiquidationList)
+
 	router.GET("/blast/points", HandleBlastPoints)
 
+	// the scoped api keys can call only the routes of their scopes, the
+	// other routes need an api key without scopes or the frontend
+	readScope := router.Group("/")
+	readScope.Use(ScopeMiddleware(model.API_SCOPE_READ))
+	readScope.Use(AuthMiddleware)
+
+	tradeScope := router.Group("/")
+	tradeScope.Use(ScopeMiddleware(model.API_SCOPE_TRADE))
+	tradeScope.Use(AuthMiddleware)
+
+	cancelScope := router.Group("/")
+	cancelScope.Use(ScopeMiddleware(model.API_SCOPE_CANCEL_ONLY))
+	cancelScope.Use(AuthMiddleware)
+
 	authRequired := router.Group("/")
 	authRequired.Use(AuthMiddleware)
-	authRequired.POST("/orders", HandleOrderCreate)
-	authRequired.GET("/orders", HandleOrdersList)
-	authRequired.PUT("/orders", HandleOrderAmend)
-	authRequired.DELETE("/orders", HandleOrderCancel)
-	authRequired.DELETE("/orders/cancel_all", HandleOrderCancelAll)
+	tradeScope.POST("/orders", HandleOrderCreate)
+	readScope.GET("/orders", HandleOrdersList)
+	tradeScope.PUT("/orders", HandleOrderAmend)
+	cancelScope.DELETE("/orders", HandleOrderCancel)
+	cancelScope.DELETE("/orders/cancel_all", HandleOrderCancelAll)
+	tradeScope.POST("/orders/batch", HandleOrdersBatch)
+	cancelScope.DELETE("/orders/batch", HandleOrdersCancelBatch)
 
 	// vault info
-	authRequired.GET("/vaults/holdings", HandleVaultHoldings)
-	authRequired.GET("/vaults/balanceops", HandleVaultBalanceOperations)
+	readScope.GET("/vaults/holdings", HandleVaultHoldings)
+	readScope.GET("/vaults/balanceops", HandleVaultBalanceOperations)
 
 	// dead man's switch
-	authRequired.GET("/cancel_all_after", HandleDeadmanList)
-	authRequired.POST("/cancel_all_after", HandleDeadmanCreate)
-	authRequired.DELETE("/cancel_all_after", HandleDeadmanDelete)
+	readScope.GET("/cancel_all_after", HandleDeadmanList)
+	tradeScope.POST("/cancel_all_after", HandleDeadmanCreate)
+	cancelScope.DELETE("/cancel_all_after", HandleDeadmanDelete)
 
 	// portfolio
-	authRequired.GET("/portfolio", HandlePortfolioList)
+	readScope.GET("/portfolio", HandlePortfolioList)
 
 	// IMPORTANT: urls path has changed
-	authRequired.GET("/balanceops", HandleBalanceOpsList)
+	readScope.GET("/balanceops", HandleBalanceOpsList)
+
+	readScope.GET("/account", HandleAccount)
+	tradeScope.PUT("/account/leverage", HandleAccountSetLeverage)
+	tradeScope.PUT("/account/margin_mode", HandleAccountSetMarginMode)
 
-	authRequired.GET("/account", HandleAccount)
-	authRequired.PUT("/account/leverage", HandleAccountSetLeverage)
+	readScope.GET("/fills", HandleFillsList)
+	readScope.GET("/fills/order", HandleFillsForOrder)
+	readScope.GET("/positions", HandlePositionsList)
+	tradeScope.POST("/positions/margin", HandlePositionMargin)
 
-	authRequired.GET("/fills", HandleFillsList)
-	authRequired.GET("/fills/order", HandleFillsForOrder)
-	authRequired.GET("/positions", HandlePositionsList)
+	readScope.GET("/funding/payments", HandleFundingPaymentList)
 
-	authRequired.GET("/profile", HandleProfileCacheRequest)
+	readScope.GET("/profile", HandleProfileCacheRequest)
 
-	authRequired.GET("/airdrops", HandleAirdropList)
+	readScope.GET("/airdrops", HandleAirdropList)
 	authRequired.POST("/airdrops/claim", HandleClaimAll)
 
 	authRequired.POST("/secrets/refresh", HandleSecretRefresh)
@@ -103,22 +128,27 @@ func Router() *gin.Engine {
 	authRequired.POST("/balanceops/stake_from_balance", HandleStakeFromBalance)
 	authRequired.POST("/balanceops/unstake/begin", BeginUnstake)
 	authRequired.POST("/balanceops/unstake/cancel", CancelUnstake)
-	authRequired.GET("/balanceops/unstake/requested", HandleRequestedUnstakesList)
+	readScope.GET("/balanceops/unstake/requested", HandleRequestedUnstakesList)
 
 	authRequired.POST("/balanceops/init_vault", InitVault)
 	authRequired.POST("/balanceops/reactivate_vault", ReactivateVault)
 	authRequired.POST("/balanceops/unstake/process", ProcessUnstakes)
 
-	authRequired.GET("/game_assets/blast", HandleGameAssetsBlastGet)
-	authRequired.GET("/game_assets/blast_leaderboard", HandleBlastLeaderboard)
-	authRequired.GET("/game_assets/bfx_points", HandleBfxGetPoints)
+	readScope.GET("/game_assets/blast", HandleGameAssetsBlastGet)
+	readScope.GET("/game_assets/blast_leaderboard", HandleBlastLeaderboard)
+	readScope.GET("/game_assets/bfx_points", HandleBfxGetPoints)
 
-	authRequired.GET("/storage/profile_data", HandleProfileDataRead)
+	readScope.GET("/storage/profile_data", HandleProfileDataRead)
 	authRequired.POST("/storage/profile_data", HandleProfileDataReplace)
 
+	// subaccounts of the authenticated profile
+	readScope.GET("/subaccounts", HandleSubaccountList)
+	authRequired.POST("/subaccounts", HandleSubaccountCreate)
+	authRequired.POST("/subaccounts/transfer", HandleSubaccountTransfer)
+
 	// referral
 	authRequired.POST("/referral", HandleReferralCreate)
-	authRequired.GET("/referral", HandleReferralGet)
+	readScope.GET("/referral", HandleReferralGet)
 	authRequired.PATCH("/referral", HandleReferralEdit)
 	router.GET("/referral/leaderboard", HandleGetLeaderBoard)
 
@@ -141,6 +171,8 @@ func Router() *gin.Engine {
 	adminAuthRequired.Use(AdminAuthMiddleware)
 	adminAuthRequired.POST("/markets/url", HandleChangeIconUrl)
 	adminAuthRequired.POST("/markets/title", HandleChangeMarketTitle)
+	adminAuthRequired.GET("/withdrawals/review", HandleGetReviewWithdrawals)
+	adminAuthRequired.POST("/withdrawals/review", HandleReviewWithdrawal)
 
 	superAdminAuthRequired := router.Group("/super/admin")
 	superAdminAuthRequired.Use(AuthMiddleware)
@@ -218,6 +250,7 @@ func setupCORS(router *gin.Engine) {
 		"RBT-PK-SIGNATURE",
 		"RBT-PK-TS",
 		"EID",
+		"RBT-SUBACCOUNT",
 	}
 	exposeHeaders := []string{
 		"Access-Control-Allow-Credentials",
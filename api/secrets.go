@@ -18,6 +18,10 @@ type SecretCreateRequest struct {
 	Tag           string   `json:"tag" binding:"required"`
 	Expiration    int64    `json:"expiration" binding:"required"`
 	AllowedIpList []string `json:"allowed_ip_list"`
+	// no scopes for full access, trade implies read and cancel_only, no markets
+	// to trade all markets
+	Scopes  []string `json:"scopes" binding:"omitempty,unique,dive,oneof=read trade cancel_only"`
+	Markets []string `json:"markets" binding:"omitempty,unique,dive,required"`
 }
 
 type SecretDeleteRequest struct {
@@ -80,7 +84,9 @@ func HandleSecretCreate(c *gin.Context) {
 		&expiresAt,
 		jwt,
 		refreshToken,
-		request.AllowedIpList)
+		request.AllowedIpList,
+		request.Scopes,
+		request.Markets)
 
 	if err != nil {
 		logrus.Error(err)
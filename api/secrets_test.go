@@ -0,0 +1,50 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/strips-finance/rabbit-dex-backend/auth"
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+func TestCheckApiKeyScope(t *testing.T) {
+	payload := func(data map[string]string) *auth.Payload {
+		return &auth.Payload{Data: data}
+	}
+	order := payload(map[string]string{"market_id": "BTC-USD"})
+	otherOrder := payload(map[string]string{"market_id": "ETH-USD"})
+	batch := payload(map[string]string{"orders": `[{"create":{"market_id":"BTC-USD"}},{"cancel":{"market_id":"ETH-USD"}}]`})
+	cancelBatch := payload(map[string]string{"orders": `[{"market_id":"BTC-USD"},{"market_id":"BTC-USD"}]`})
+	allMarkets := payload(map[string]string{})
+
+	full := &model.APISecret{}
+	assert.NoError(t, CheckApiKeyScope(full, "", nil))
+	assert.NoError(t, CheckApiKeyScope(full, model.API_SCOPE_TRADE, batch))
+
+	reader := &model.APISecret{Scopes: []string{model.API_SCOPE_READ}}
+	assert.NoError(t, CheckApiKeyScope(reader, model.API_SCOPE_READ, nil))
+	assert.EqualError(t, CheckApiKeyScope(reader, model.API_SCOPE_TRADE, order), API_KEY_SCOPE_DENIED)
+	assert.EqualError(t, CheckApiKeyScope(reader, model.API_SCOPE_CANCEL_ONLY, order), API_KEY_SCOPE_DENIED)
+	assert.EqualError(t, CheckApiKeyScope(reader, "", nil), API_KEY_SCOPE_DENIED)
+
+	// trade implies cancel only, not read
+	trader := &model.APISecret{Scopes: []string{model.API_SCOPE_TRADE}}
+	assert.NoError(t, CheckApiKeyScope(trader, model.API_SCOPE_TRADE, order))
+	assert.NoError(t, CheckApiKeyScope(trader, model.API_SCOPE_CANCEL_ONLY, allMarkets))
+	assert.NoError(t, CheckApiKeyScope(trader, model.API_SCOPE_READ, nil))
+
+	canceler := &model.APISecret{Scopes: []string{model.API_SCOPE_READ, model.API_SCOPE_CANCEL_ONLY}, Markets: []string{"BTC-USD"}}
+	assert.NoError(t, CheckApiKeyScope(canceler, model.API_SCOPE_READ, nil))
+	assert.NoError(t, CheckApiKeyScope(canceler, model.API_SCOPE_CANCEL_ONLY, order))
+	assert.NoError(t, CheckApiKeyScope(canceler, model.API_SCOPE_CANCEL_ONLY, cancelBatch))
+	assert.EqualError(t, CheckApiKeyScope(canceler, model.API_SCOPE_TRADE, order), API_KEY_SCOPE_DENIED)
+	assert.EqualError(t, CheckApiKeyScope(canceler, model.API_SCOPE_CANCEL_ONLY, otherOrder), API_KEY_SCOPE_DENIED)
+	// cancel all is for all the markets
+	assert.EqualError(t, CheckApiKeyScope(canceler, model.API_SCOPE_CANCEL_ONLY, allMarkets), API_KEY_SCOPE_DENIED)
+
+	btcTrader := &model.APISecret{Scopes: []string{model.API_SCOPE_TRADE}, Markets: []string{"BTC-USD"}}
+	assert.EqualError(t, CheckApiKeyScope(btcTrader, model.API_SCOPE_TRADE, batch), API_KEY_SCOPE_DENIED)
+	assert.NoError(t, CheckApiKeyScope(btcTrader, model.API_SCOPE_TRADE, payload(map[string]string{"orders": `[{"create":{"market_id":"BTC-USD"}}]`})))
+}
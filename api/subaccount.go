@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+	"github.com/strips-finance/rabbit-dex-backend/tick"
+)
+
+type SubaccountTransferRequest struct {
+	FromProfileId uint    `json:"from_profile_id" binding:"required"`
+	ToProfileId   uint    `json:"to_profile_id" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+}
+
+// masterProfile is the authenticated profile, also when it acts on one of its
+// subaccounts
+func masterProfile(ctx *RabbitContext) *model.Profile {
+	if ctx.MasterProfile != nil {
+		return ctx.MasterProfile
+	}
+
+	return ctx.Profile
+}
+
+func HandleSubaccountCreate(c *gin.Context) {
+	ctx := GetRabbitContext(c)
+	apiModel := model.NewApiModel(ctx.Broker)
+
+	subaccount, err := apiModel.CreateSubaccount(c.Request.Context(), masterProfile(ctx).ProfileId)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, subaccount)
+}
+
+func HandleSubaccountList(c *gin.Context) {
+	ctx := GetRabbitContext(c)
+	apiModel := model.NewApiModel(ctx.Broker)
+
+	subaccounts, err := apiModel.GetSubaccounts(c.Request.Context(), masterProfile(ctx).ProfileId)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	SuccessResponse(c, subaccounts...)
+}
+
+func HandleSubaccountTransfer(c *gin.Context) {
+	var request SubaccountTransferRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	ctx := GetRabbitContext(c)
+	apiModel := model.NewApiModel(ctx.Broker)
+
+	amount := decimal.NewFromFloat(tick.RoundDownToUsdtTick(request.Amount))
+	if !amount.IsPositive() {
+		ErrorResponse(c, errors.New("WRONG_AMOUNT"))
+		return
+	}
+
+	// only the master and its subaccounts, checked before locking a profile
+	master := masterProfile(ctx).ProfileId
+	for _, profileId := range []uint{request.FromProfileId, request.ToProfileId} {
+		if profileId == master {
+			continue
+		}
+		isSubaccount, err := apiModel.IsSubaccountOf(c.Request.Context(), profileId, master)
+		if err != nil {
+			ErrorResponse(c, err)
+			return
+		}
+		if !isSubaccount {
+			ErrorResponse(c, errors.New("NOT_YOUR_SUBACCOUNT"))
+			return
+		}
+	}
+
+	// the same lock as the withdrawals, both spend the withdrawable balance
+	_, err := apiModel.AcquireWithdrawLock(c.Request.Context(), request.FromProfileId)
+	if err != nil {
+		ErrorResponse(c, errors.New("TRANSFER_UNAVAILABLE_LOCK_ACQUIRE_ERROR"))
+		return
+	}
+	defer func() {
+		_, err := apiModel.ReleaseWithdrawLock(c.Request.Context(), request.FromProfileId)
+		if err != nil {
+			logrus.Error(err)
+		}
+	}()
+
+	_, err = apiModel.InvalidateCache(c.Request.Context(), request.FromProfileId)
+	if err != nil {
+		logrus.Error(err)
+		ErrorResponse(c, err)
+		return
+	}
+
+	res, err := apiModel.SubaccountTransfer(c.Request.Context(),
+		master,
+		request.FromProfileId,
+		request.ToProfileId,
+		tdecimal.NewDecimal(amount),
+	)
+	if err != nil {
+		ErrorResponse(c, err)
+		return
+	}
+
+	for _, profileId := range []uint{request.FromProfileId, request.ToProfileId} {
+		_, err = apiModel.InvalidateCacheAndNotify(c.Request.Context(), profileId)
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+
+	SuccessResponse(c, res...)
+}
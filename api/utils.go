@@ -22,3 +22,20 @@ func NextHourTimestamp() int64 {
 
 	return nextHour.Unix()
 }
+
+// NextFunding returns the time (unix seconds) the next funding rate of the
+// market is set at and the seconds left until then. Markets without it yet
+// fall back to the next hour, the periodics set the rate hourly.
+func NextFunding(market *model.MarketData) (int64, int64) {
+	next := NextHourTimestamp()
+	if market != nil && market.NextFundingTime > 0 {
+		next = market.NextFundingTime / int64(time.Second/time.Microsecond)
+	}
+
+	countdown := next - time.Now().Unix()
+	if countdown < 0 {
+		countdown = 0
+	}
+
+	return next, countdown
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+func TestNextFunding(t *testing.T) {
+	next := time.Now().Add(90 * time.Second).Truncate(time.Second)
+	market := &model.MarketData{NextFundingTime: next.UnixMicro()}
+
+	ts, countdown := NextFunding(market)
+	assert.Equal(t, next.Unix(), ts)
+	assert.InDelta(t, 90, countdown, 1)
+
+	// already passed, the rate is being set
+	market.NextFundingTime = time.Now().Add(-time.Minute).UnixMicro()
+	_, countdown = NextFunding(market)
+	assert.Equal(t, int64(0), countdown)
+
+	// not set yet
+	ts, _ = NextFunding(&model.MarketData{})
+	assert.Equal(t, NextHourTimestamp(), ts)
+}
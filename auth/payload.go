@@ -16,6 +16,8 @@ import (
 const (
 	PayloadKeyMethod = "method"
 	PayloadKeyPath   = "path"
+	// The subaccount a master profile acts on, signed with the request
+	PayloadKeySubaccount = "subaccount"
 )
 
 var requiredKeys = []string{PayloadKeyMethod, PayloadKeyPath}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/strips-finance/rabbit-dex-backend/funding"
+	"github.com/strips-finance/rabbit-dex-backend/model"
 )
 
 const (
@@ -17,6 +22,15 @@ func main() {
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 	logrus.SetReportCaller(true)
 
+	reproduce := flag.String("reproduce", "", "recompute the stored funding rate of the market from its premium samples and exit")
+	at := flag.String("at", "", "reproduce: funding time in RFC3339")
+	flag.Parse()
+
+	if *reproduce != "" {
+		runReproduce(*reproduce, *at)
+		return
+	}
+
 	go func() {
 		funding_service, err := funding.NewFundingService(FUNDING_INTERVAL)
 		if err != nil {
@@ -34,3 +48,30 @@ func main() {
 
 	select {}
 }
+
+func runReproduce(market_id, at string) {
+	fundingTime, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		logrus.Fatalf("error <%s> parsing funding time", err.Error())
+	}
+
+	config, err := funding.ReadConfig()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	broker, err := model.GetBroker()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	rate, err := funding.Reproduce(context.Background(), model.NewApiModel(broker), market_id, fundingTime, config.Service.Premium.FundingInterval)
+	if rate != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(rate)
+	}
+	if err != nil {
+		logrus.Fatal(err)
+	}
+}
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sirupsen/logrus"
 
 	"github.com/strips-finance/rabbit-dex-backend/liqengine"
@@ -11,6 +18,23 @@ func main() {
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 	logrus.SetReportCaller(true)
 
+	dryRun := flag.Bool("dry-run", false, "report the liquidations of a shocked snapshot instead of running the engine")
+	snapshotFile := flag.String("snapshot", "", "dry run: json snapshot of markets, profiles and positions")
+	timescaleUri := flag.String("timescale", "", "dry run: timescaledb connection uri to load the archived snapshot from")
+	at := flag.String("at", "", "dry run: archived snapshot time in RFC3339, latest if empty")
+	shocks := flag.String("shocks", "", "dry run: price shocks per market, e.g. BTC-USD=-0.1,ETH-USD=-0.15")
+	flag.Parse()
+
+	config, err := liqengine.ReadConfig()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if *dryRun {
+		runDryRun(config, *snapshotFile, *timescaleUri, *at, *shocks)
+		return
+	}
+
 	broker, err := model.GetBroker()
 	if err != nil {
 		logrus.Fatal(err)
@@ -22,9 +46,65 @@ func main() {
 	}
 
 	liq_service := liqengine.NewLiquidationService(1, as)
+	liq_service.SetConfig(config)
 
 	cancelf := liq_service.Run()
 	defer cancelf()
 
+	if len(config.Service.Adl.Markets) > 0 {
+		insuranceId, err := as.GetOrCreateInsurance(context.Background())
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		adl_service := liqengine.NewAdlService(model.NewApiModel(broker), insuranceId, config.Service.Adl.Markets, config.AdlInterval())
+		cancelAdl := adl_service.Run()
+		defer cancelAdl()
+	}
+
 	select {}
 }
+
+func runDryRun(config *liqengine.Config, snapshotFile string, timescaleUri string, at string, shocksValue string) {
+	shocks, err := liqengine.ParsePriceShocks(shocksValue)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	var snapshot *liqengine.Snapshot
+	switch {
+	case snapshotFile != "":
+		snapshot, err = liqengine.LoadSnapshotFile(snapshotFile)
+	case timescaleUri != "":
+		timestamp := time.Now()
+		if at != "" {
+			timestamp, err = time.Parse(time.RFC3339, at)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		ctx := context.Background()
+		var pool *pgxpool.Pool
+		pool, err = pgxpool.New(ctx, timescaleUri)
+		if err != nil {
+			logrus.Fatal("Unable to connect to database: ", err)
+		}
+		defer pool.Close()
+		snapshot, err = liqengine.LoadTimescaleSnapshot(ctx, pool, timestamp.UnixMicro())
+	default:
+		logrus.Fatal("dry run requires --snapshot or --timescale")
+	}
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	report, err := liqengine.Simulate(snapshot, shocks, config)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(report); err != nil {
+		logrus.Fatal(err)
+	}
+}
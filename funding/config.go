@@ -3,6 +3,7 @@ package funding
 import (
 	"os"
 	"path"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -13,13 +14,66 @@ const (
 )
 
 type ServiceConfig struct {
-	Markets []string `yaml:"markets"`
+	Markets []string      `yaml:"markets"`
+	Premium PremiumConfig `yaml:"premium"`
+}
+
+// Premium index sampling and the funding rate params, InterestRate, Dampener
+// and Cap are fractions per funding interval. Cap also limits the paid rate
+// when the rate is set by the engine periodics.
+type PremiumConfig struct {
+	Enabled         bool           `yaml:"enabled"`
+	SampleInterval  time.Duration  `yaml:"sample_interval" env-default:"5s"`
+	FundingInterval time.Duration  `yaml:"funding_interval" env-default:"1h"`
+	ImpactNotional  float64        `yaml:"impact_notional" env-default:"10000"`
+	InterestRate    float64        `yaml:"interest_rate" env-default:"0.0000125"`
+	Dampener        float64        `yaml:"dampener" env-default:"0.0005"`
+	Cap             float64        `yaml:"cap" env-default:"0.01"`
+	MarketParams    []MarketParams `yaml:"market_params"`
+}
+
+// per market overrides of PremiumConfig, unset fields use the service values
+type MarketParams struct {
+	MarketId       string   `yaml:"market_id"`
+	ImpactNotional *float64 `yaml:"impact_notional"`
+	InterestRate   *float64 `yaml:"interest_rate"`
+	Dampener       *float64 `yaml:"dampener"`
+	Cap            *float64 `yaml:"cap"`
 }
 
 type Config struct {
 	Service ServiceConfig `yaml:"service"`
 }
 
+func (c *PremiumConfig) Params(market_id string) RateParams {
+	params := RateParams{
+		ImpactNotional: c.ImpactNotional,
+		InterestRate:   c.InterestRate,
+		Dampener:       c.Dampener,
+		Cap:            c.Cap,
+	}
+
+	for _, mp := range c.MarketParams {
+		if mp.MarketId != market_id {
+			continue
+		}
+		if mp.ImpactNotional != nil {
+			params.ImpactNotional = *mp.ImpactNotional
+		}
+		if mp.InterestRate != nil {
+			params.InterestRate = *mp.InterestRate
+		}
+		if mp.Dampener != nil {
+			params.Dampener = *mp.Dampener
+		}
+		if mp.Cap != nil {
+			params.Cap = *mp.Cap
+		}
+	}
+
+	return params
+}
+
 func ReadConfig() (*Config, error) {
 	config := &Config{}
 	homeDir, err := os.UserHomeDir()
@@ -11,7 +11,6 @@ import (
 	"github.com/strips-finance/rabbit-dex-backend/pkg/log"
 
 	"github.com/strips-finance/rabbit-dex-backend/model"
-	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
 )
 
 const (
@@ -57,6 +56,13 @@ func NewFundingService(interval time.Duration) (*FundingService, error) {
 
 func (fs *FundingService) Run() (context.CancelFunc, error) {
 	ctx, cancelf := context.WithCancel(context.Background())
+	if fs.cfg.Service.Premium.Enabled {
+		premium := fs.cfg.Service.Premium
+		for _, market_id := range fs.cfg.Service.Markets {
+			NewPremiumSampler(market_id, fs.apiModel, premium.Params(market_id), premium.SampleInterval, premium.FundingInterval).start(ctx)
+			logrus.Infof("Started premium sampler for market_id=%s", market_id)
+		}
+	}
 	ticker := time.NewTicker(fs.interval)
 	go func() {
 		defer ticker.Stop()
@@ -94,7 +100,7 @@ func (fs *FundingService) ProcessFunding(ctx context.Context) {
 			logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("Funding service, error retrieving funding_meta for market %s: %v", market_id, err)
 			continue
 		}
-		if marketData.LastFundingUpdateTime <= fundingMeta.LastUpdate || marketData.LastFundingRate.InexactFloat64() == 0.0 {
+		if marketData.LastFundingUpdateTime <= fundingMeta.LastUpdate || marketData.LastFundingRate.IsZero() {
 			text := fmt.Sprintf("SKIP funding payment for market_id=%s now=%d marketMeta.LastFundingUpdateTime=%d marketFunding.LastUpdate=%d marketMeta.FundingRate=%f",
 				market_id,
 				time.Now().Unix(),
@@ -109,44 +115,24 @@ func (fs *FundingService) ProcessFunding(ctx context.Context) {
 		marketPositions, err := fs.apiModel.GetAllActivePositions(ctx, market_id, 0, MAX_POSITIONS)
 		if err != nil {
 			logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("Funding service, error retrieving positions for market %s: %v", market_id, err)
-			return
-		}
-		fs.fundingPayments = fs.fundingPayments[:0]
-		var totalLong, totalShort float64
-		for _, position := range marketPositions {
-			fundingUpdate := position.Size.InexactFloat64() * marketData.FairPrice.InexactFloat64() * limit(marketData.LastFundingRate.InexactFloat64())
-			if position.Side == model.LONG {
-				fundingUpdate = -fundingUpdate
-				totalLong += fundingUpdate
-			} else {
-				totalShort += fundingUpdate
-			}
-
-			d_funding_amount := tdecimal.NewDecimal(decimal.NewFromFloat(fundingUpdate))
-
-			fs.fundingPayments = append(fs.fundingPayments, model.FundingPayment{
-				MarketId:      position.MarketID,
-				ProfileId:     position.ProfileID,
-				FundingAmount: d_funding_amount})
+			continue
 		}
+		rateCap := decimal.NewFromFloat(fs.cfg.Service.Premium.Params(market_id).Cap)
+		rate := clamp(marketData.LastFundingRate.Decimal, rateCap)
+		refPrice := marketData.ReferencePrice(model.MARK_PRICE_USAGE_FUNDING).Decimal
+		round := NewFundingRound(marketPositions, refPrice, rate, fs.fundingPayments[:0])
+		fs.fundingPayments = round.Payments
 
 		if len(fs.fundingPayments) > 0 {
-			err = fs.apiModel.PayFunding(ctx, market_id, fs.fundingPayments, marketData.LastFundingUpdateTime, totalLong, totalShort)
+			if !round.Residual.IsZero() {
+				logrus.Infof("Funding residual to insurance market_id=%s funding_time=%d residual=%s total_long=%s total_short=%s",
+					market_id, marketData.LastFundingUpdateTime, round.Residual, round.TotalLong, round.TotalShort)
+			}
+			// the engine skips a round already paid, a failed one is retried on the next tick
+			err = fs.apiModel.PayFunding(ctx, market_id, fs.fundingPayments, marketData.LastFundingUpdateTime, round.TotalLong, round.TotalShort, round.Residual)
 			if err != nil {
 				logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("Funding service, error paying funding for market %s: %v", market_id, err)
-				return
 			}
 		}
 	}
-
-}
-
-func limit(rate float64) float64 {
-	if rate < -0.01 {
-		return -0.01
-	}
-	if rate > 0.01 {
-		return 0.01
-	}
-	return rate
 }
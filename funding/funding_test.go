@@ -50,7 +50,7 @@ func TestBasic(t *testing.T) {
 	logrus.Info(marketData.LastFundingUpdateTime)
 	logrus.Info(marketData)
 
-	err = apiModel.PayFunding(context.Background(), market_id, fundingPayments, marketData.LastFundingUpdateTime, 11.2, 12.2)
+	err = apiModel.PayFunding(context.Background(), market_id, fundingPayments, marketData.LastFundingUpdateTime, decimal.Zero, decimal.NewFromInt(1), decimal.NewFromInt(-1))
 	assert.NoError(t, err)
 }
 
@@ -0,0 +1,62 @@
+package funding
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+// usdt tick, balances are not credited below it
+const FUNDING_AMOUNT_PRECISION = 6
+
+// FundingRound is the funding of a market for one funding_time. Payments are
+// rounded down to FUNDING_AMOUNT_PRECISION: debits away from zero, credits
+// towards zero, so with the same long and short size the residual is never
+// negative. Payments and residual always net to zero.
+type FundingRound struct {
+	Payments   []model.FundingPayment
+	TotalLong  decimal.Decimal
+	TotalShort decimal.Decimal
+	// credited to the insurance fund, debited if negative
+	Residual decimal.Decimal
+}
+
+// NewFundingRound computes the payments of the positions, longs pay shorts
+// when the rate is positive. Payments are appended to the payments slice.
+func NewFundingRound(positions []*model.PositionData, price, rate decimal.Decimal, payments []model.FundingPayment) *FundingRound {
+	round := &FundingRound{
+		Payments:   payments,
+		TotalLong:  decimal.Zero,
+		TotalShort: decimal.Zero,
+	}
+
+	d_price := tdecimal.NewDecimal(price)
+	d_rate := tdecimal.NewDecimal(rate)
+	for _, position := range positions {
+		amount := position.Size.Mul(price).Mul(rate)
+		if position.Side == model.LONG {
+			amount = amount.Neg()
+		}
+		amount = amount.RoundFloor(FUNDING_AMOUNT_PRECISION)
+
+		if position.Side == model.LONG {
+			round.TotalLong = round.TotalLong.Add(amount)
+		} else {
+			round.TotalShort = round.TotalShort.Add(amount)
+		}
+
+		round.Payments = append(round.Payments, model.FundingPayment{
+			MarketId:      position.MarketID,
+			ProfileId:     position.ProfileID,
+			FundingAmount: tdecimal.NewDecimal(amount),
+			Side:          position.Side,
+			Size:          tdecimal.NewDecimal(position.Size.Decimal),
+			Price:         d_price,
+			Rate:          d_rate,
+		})
+	}
+
+	round.Residual = round.TotalLong.Add(round.TotalShort).Neg()
+	return round
+}
@@ -0,0 +1,79 @@
+package funding
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+func position(profile_id uint, side, size string) *model.PositionData {
+	return &model.PositionData{
+		MarketID:  "TEST",
+		ProfileID: profile_id,
+		Side:      side,
+		Size:      *tdecimal.NewDecimal(decimal.RequireFromString(size)),
+	}
+}
+
+func netted(round *FundingRound) decimal.Decimal {
+	sum := round.Residual
+	for _, payment := range round.Payments {
+		sum = sum.Add(payment.FundingAmount.Decimal)
+	}
+	return sum
+}
+
+func TestFundingRound(t *testing.T) {
+	positions := []*model.PositionData{
+		position(1, model.LONG, "0.3"),
+		position(2, model.LONG, "0.7"),
+		position(3, model.SHORT, "0.1"),
+		position(4, model.SHORT, "0.9"),
+	}
+	price := decimal.RequireFromString("30000.123")
+	rate := decimal.RequireFromString("0.000012345678")
+
+	// longs pay, debits rounded away from zero and credits towards zero
+	round := NewFundingRound(positions, price, rate, nil)
+	assert.Len(t, round.Payments, 4)
+	assert.Equal(t, "-0.111112", round.Payments[0].FundingAmount.String())
+	assert.Equal(t, "-0.259261", round.Payments[1].FundingAmount.String())
+	assert.Equal(t, "0.037037", round.Payments[2].FundingAmount.String())
+	assert.Equal(t, "0.333334", round.Payments[3].FundingAmount.String())
+	assert.Equal(t, "-0.370373", round.TotalLong.String())
+	assert.Equal(t, "0.370371", round.TotalShort.String())
+	assert.Equal(t, "0.000002", round.Residual.String())
+	assert.True(t, netted(round).IsZero())
+	assert.Equal(t, model.LONG, round.Payments[0].Side)
+	assert.Equal(t, "0.000012345678", round.Payments[0].Rate.String())
+
+	// shorts pay
+	round = NewFundingRound(positions, price, rate.Neg(), nil)
+	assert.Equal(t, "0.111111", round.Payments[0].FundingAmount.String())
+	assert.Equal(t, "-0.037038", round.Payments[2].FundingAmount.String())
+	assert.True(t, round.Residual.IsPositive())
+	assert.True(t, netted(round).IsZero())
+
+	// the same inputs give the same payments
+	again := NewFundingRound(positions, price, rate.Neg(), nil)
+	assert.Equal(t, round.Residual.String(), again.Residual.String())
+
+	// more longs than shorts in the snapshot, the insurance pays the difference
+	round = NewFundingRound(positions[:3], price, rate.Neg(), nil)
+	assert.True(t, round.Residual.IsNegative())
+	assert.True(t, netted(round).IsZero())
+
+	// the payments slice is reused
+	payments := make([]model.FundingPayment, 0, EXPECTED_POSITIONS)
+	round = NewFundingRound(positions, price, rate, payments)
+	assert.Len(t, round.Payments, 4)
+	assert.Equal(t, EXPECTED_POSITIONS, cap(round.Payments))
+
+	round = NewFundingRound(nil, price, rate, nil)
+	assert.Empty(t, round.Payments)
+	assert.True(t, round.Residual.IsZero())
+}
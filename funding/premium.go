@@ -0,0 +1,279 @@
+package funding
+
+/*
+Premium index sampler. Every sample_interval the impact bid and ask are the
+average prices of selling and buying impact_notional on the book, the premium
+is (impact mid - index) / index. Samples are stored in tarantool, at the end
+of each funding_interval the rate is computed from the samples of the interval:
+
+	premium = average of the samples premium
+	rate    = premium + clamp(interest_rate - premium, -dampener, dampener)
+	rate    = clamp(rate, -cap, cap)
+
+The rate is stored with the params it was computed with, so it can be
+recomputed from the stored samples (see Reproduce). The rate predicted from the
+samples of the current interval is kept as the market instant funding rate.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/pkg/log"
+	"github.com/strips-finance/rabbit-dex-backend/pricing"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+const (
+	PREMIUM_PRECISION      = 12
+	FUNDING_RATE_PRECISION = 12
+
+	DEFAULT_SAMPLE_INTERVAL  = 5 * time.Second
+	DEFAULT_FUNDING_INTERVAL = time.Hour
+	DEFAULT_IMPACT_NOTIONAL  = 10000.0
+)
+
+var ErrNoPremiumSamples = errors.New("no premium samples")
+
+type PremiumModel interface {
+	GetMarketData(ctx context.Context, market_id string) (*model.MarketData, error)
+	GetOrderbookData(ctx context.Context, market_id string) (*model.OrderbookData, error)
+	AddPremiumSample(ctx context.Context, sample *model.PremiumSample, instant_rate decimal.Decimal, next_funding_time int64) error
+	GetPremiumSamples(ctx context.Context, market_id string, from, to int64) ([]*model.PremiumSample, error)
+	SetFundingRate(ctx context.Context, rate *model.FundingRate) error
+	GetFundingRate(ctx context.Context, market_id string, funding_time int64) (*model.FundingRate, error)
+}
+
+// compile-time check that model.ApiModel implements PremiumModel
+var _ PremiumModel = (*model.ApiModel)(nil)
+
+type RateParams struct {
+	ImpactNotional float64
+	InterestRate   float64
+	Dampener       float64
+	Cap            float64
+}
+
+type PremiumSampler struct {
+	marketId        string
+	apiModel        PremiumModel
+	params          RateParams
+	sampleInterval  time.Duration
+	fundingInterval time.Duration
+	// start of the current funding interval
+	intervalStart time.Time
+	// samples of the current interval, for the predicted rate
+	current []*model.PremiumSample
+}
+
+func NewPremiumSampler(marketId string, apiModel PremiumModel, params RateParams, sampleInterval, fundingInterval time.Duration) *PremiumSampler {
+	if params.ImpactNotional <= 0 {
+		params.ImpactNotional = DEFAULT_IMPACT_NOTIONAL
+	}
+	if sampleInterval <= 0 {
+		sampleInterval = DEFAULT_SAMPLE_INTERVAL
+	}
+	if fundingInterval <= 0 {
+		fundingInterval = DEFAULT_FUNDING_INTERVAL
+	}
+	return &PremiumSampler{
+		marketId:        marketId,
+		apiModel:        apiModel,
+		params:          params,
+		sampleInterval:  sampleInterval,
+		fundingInterval: fundingInterval,
+	}
+}
+
+func (s *PremiumSampler) start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.sampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				err := s.tick(ctx, now)
+				if err != nil {
+					logrus.Warnf("%v in premium sample for market_id %s", err, s.marketId)
+				}
+			}
+		}
+	}()
+}
+
+func (s *PremiumSampler) tick(ctx context.Context, now time.Time) error {
+	market, err := s.apiModel.GetMarketData(ctx, s.marketId)
+	if err != nil {
+		return err
+	}
+
+	start := now.Truncate(s.fundingInterval)
+	if start.After(s.intervalStart) {
+		s.openInterval(ctx, market, start, now)
+	}
+
+	book, err := s.apiModel.GetOrderbookData(ctx, s.marketId)
+	if err != nil {
+		return err
+	}
+
+	sample, err := s.sample(market, book, now)
+	if err != nil {
+		return err
+	}
+
+	s.current = append(s.current, sample)
+	end := start.Add(s.fundingInterval).UnixMicro()
+	predicted, err := FundingRateFromSamples(s.marketId, end, s.current, s.params)
+	if err != nil {
+		return err
+	}
+
+	return s.apiModel.AddPremiumSample(ctx, sample, predicted.Rate.Decimal, end)
+}
+
+// sets the rate of the interval ending at start, unless it was already set
+// (restart), and loads the samples taken since start
+func (s *PremiumSampler) openInterval(ctx context.Context, market *model.MarketData, start, now time.Time) {
+	if market.LastFundingUpdateTime < start.UnixMicro() {
+		rate, err := s.settle(ctx, start)
+		if err != nil {
+			logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("Funding rate not set for market_id=%s funding_time=%s: %v", s.marketId, start, err)
+		} else {
+			logrus.Infof("Funding rate set for market_id=%s funding_time=%s rate=%s premium=%s samples=%d",
+				s.marketId, start, rate.Rate, rate.Premium, rate.Samples)
+		}
+	}
+
+	current, err := s.apiModel.GetPremiumSamples(ctx, s.marketId, start.UnixMicro(), now.UnixMicro())
+	if err != nil {
+		logrus.Warnf("%v loading premium samples for market_id %s", err, s.marketId)
+		current = nil
+	}
+
+	s.intervalStart = start
+	s.current = current
+}
+
+func (s *PremiumSampler) settle(ctx context.Context, end time.Time) (*model.FundingRate, error) {
+	samples, err := s.apiModel.GetPremiumSamples(ctx, s.marketId, end.Add(-s.fundingInterval).UnixMicro(), end.UnixMicro())
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := FundingRateFromSamples(s.marketId, end.UnixMicro(), samples, s.params)
+	if err != nil {
+		return nil, err
+	}
+
+	return rate, s.apiModel.SetFundingRate(ctx, rate)
+}
+
+func (s *PremiumSampler) sample(market *model.MarketData, book *model.OrderbookData, now time.Time) (*model.PremiumSample, error) {
+	if market.IndexPrice == nil || !market.IndexPrice.IsPositive() {
+		return nil, fmt.Errorf("no index price in market %s", s.marketId)
+	}
+
+	bid, bidOk := pricing.ImpactPrice(book.Bids, s.params.ImpactNotional, true)
+	ask, askOk := pricing.ImpactPrice(book.Asks, s.params.ImpactNotional, false)
+	if !bidOk || !askOk {
+		return nil, fmt.Errorf("book too thin for impact notional %f in market %s", s.params.ImpactNotional, s.marketId)
+	}
+
+	index := market.IndexPrice.Decimal
+	impactBid := decimal.NewFromFloat(bid)
+	impactAsk := decimal.NewFromFloat(ask)
+	mid := impactBid.Add(impactAsk).Div(decimal.NewFromInt(2))
+
+	return &model.PremiumSample{
+		MarketId:   s.marketId,
+		Timestamp:  now.UnixMicro(),
+		IndexPrice: tdecimal.NewDecimal(index),
+		ImpactBid:  tdecimal.NewDecimal(impactBid),
+		ImpactAsk:  tdecimal.NewDecimal(impactAsk),
+		Premium:    tdecimal.NewDecimal(mid.Sub(index).DivRound(index, PREMIUM_PRECISION)),
+	}, nil
+}
+
+// FundingRateFromSamples computes the rate of the interval ending at
+// funding_time (microseconds). Decimal math rounded to FUNDING_RATE_PRECISION,
+// the same samples and params always give the same rate.
+func FundingRateFromSamples(market_id string, funding_time int64, samples []*model.PremiumSample, params RateParams) (*model.FundingRate, error) {
+	return rateFromSamples(market_id, funding_time, samples,
+		decimal.NewFromFloat(params.InterestRate),
+		decimal.NewFromFloat(params.Dampener),
+		decimal.NewFromFloat(params.Cap))
+}
+
+func rateFromSamples(market_id string, funding_time int64, samples []*model.PremiumSample, interest, dampener, rateCap decimal.Decimal) (*model.FundingRate, error) {
+	if len(samples) == 0 {
+		return nil, ErrNoPremiumSamples
+	}
+
+	sum := decimal.Zero
+	for _, sample := range samples {
+		sum = sum.Add(sample.Premium.Decimal)
+	}
+	premium := sum.DivRound(decimal.NewFromInt(int64(len(samples))), FUNDING_RATE_PRECISION)
+
+	rate := premium.Add(clamp(interest.Sub(premium), dampener))
+	rate = clamp(rate, rateCap).Round(FUNDING_RATE_PRECISION)
+
+	return &model.FundingRate{
+		MarketId:     market_id,
+		FundingTime:  funding_time,
+		Rate:         tdecimal.NewDecimal(rate),
+		Premium:      tdecimal.NewDecimal(premium),
+		InterestRate: tdecimal.NewDecimal(interest),
+		Dampener:     tdecimal.NewDecimal(dampener),
+		Cap:          tdecimal.NewDecimal(rateCap),
+		Samples:      uint(len(samples)),
+	}, nil
+}
+
+// Reproduce recomputes the stored rate of the interval ending at fundingTime
+// from the stored samples with the stored params, it returns the recomputed
+// rate and an error if it doesn't match the stored one.
+func Reproduce(ctx context.Context, apiModel PremiumModel, market_id string, fundingTime time.Time, fundingInterval time.Duration) (*model.FundingRate, error) {
+	stored, err := apiModel.GetFundingRate(ctx, market_id, fundingTime.UnixMicro())
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := apiModel.GetPremiumSamples(ctx, market_id, fundingTime.Add(-fundingInterval).UnixMicro(), fundingTime.UnixMicro())
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := rateFromSamples(market_id, stored.FundingTime, samples,
+		stored.InterestRate.Decimal, stored.Dampener.Decimal, stored.Cap.Decimal)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rate.Rate.Equal(stored.Rate.Decimal) || rate.Samples != stored.Samples {
+		return rate, fmt.Errorf("funding rate mismatch for market_id=%s funding_time=%d: stored=%s samples=%d recomputed=%s samples=%d",
+			market_id, stored.FundingTime, stored.Rate, stored.Samples, rate.Rate, rate.Samples)
+	}
+
+	return rate, nil
+}
+
+// clamps value to [-limit, limit]
+func clamp(value, limit decimal.Decimal) decimal.Decimal {
+	if value.GreaterThan(limit) {
+		return limit
+	}
+	if value.LessThan(limit.Neg()) {
+		return limit.Neg()
+	}
+	return value
+}
@@ -0,0 +1,212 @@
+package funding
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+type fakePremiumModel struct {
+	market  *model.MarketData
+	book    *model.OrderbookData
+	samples []*model.PremiumSample
+	rates   map[int64]*model.FundingRate
+	instant decimal.Decimal
+	next    int64
+}
+
+func newFakePremiumModel(index float64) *fakePremiumModel {
+	return &fakePremiumModel{
+		market: &model.MarketData{
+			MarketID:   "TEST",
+			IndexPrice: tdecimal.NewDecimal(decimal.NewFromFloat(index)),
+		},
+		rates: make(map[int64]*model.FundingRate),
+	}
+}
+
+func (f *fakePremiumModel) GetMarketData(ctx context.Context, market_id string) (*model.MarketData, error) {
+	return f.market, nil
+}
+
+func (f *fakePremiumModel) GetOrderbookData(ctx context.Context, market_id string) (*model.OrderbookData, error) {
+	return f.book, nil
+}
+
+func (f *fakePremiumModel) AddPremiumSample(ctx context.Context, sample *model.PremiumSample, instant_rate decimal.Decimal, next_funding_time int64) error {
+	f.samples = append(f.samples, sample)
+	f.instant = instant_rate
+	f.next = next_funding_time
+	return nil
+}
+
+func (f *fakePremiumModel) GetPremiumSamples(ctx context.Context, market_id string, from, to int64) ([]*model.PremiumSample, error) {
+	res := make([]*model.PremiumSample, 0)
+	for _, sample := range f.samples {
+		if sample.Timestamp >= from && sample.Timestamp < to {
+			res = append(res, sample)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakePremiumModel) SetFundingRate(ctx context.Context, rate *model.FundingRate) error {
+	if rate.FundingTime <= f.market.LastFundingUpdateTime {
+		return fmt.Errorf("funding_time_not_after_last_funding_update")
+	}
+	f.rates[rate.FundingTime] = rate
+	f.market.LastFundingRate = rate.Rate
+	f.market.LastFundingUpdateTime = rate.FundingTime
+	return nil
+}
+
+func (f *fakePremiumModel) GetFundingRate(ctx context.Context, market_id string, funding_time int64) (*model.FundingRate, error) {
+	rate, ok := f.rates[funding_time]
+	if !ok {
+		return nil, fmt.Errorf("FUNDING_RATE_NOT_FOUND")
+	}
+	return rate, nil
+}
+
+func book(bid, ask float64) *model.OrderbookData {
+	return &model.OrderbookData{
+		Bids: [][]tdecimal.Decimal{{*tdecimal.NewDecimal(decimal.NewFromFloat(bid)), *tdecimal.NewDecimal(decimal.NewFromInt(1000))}},
+		Asks: [][]tdecimal.Decimal{{*tdecimal.NewDecimal(decimal.NewFromFloat(ask)), *tdecimal.NewDecimal(decimal.NewFromInt(1000))}},
+	}
+}
+
+func premiumSamples(premiums ...string) []*model.PremiumSample {
+	res := make([]*model.PremiumSample, 0, len(premiums))
+	for i, p := range premiums {
+		res = append(res, &model.PremiumSample{
+			MarketId:  "TEST",
+			Timestamp: int64(i),
+			Premium:   tdecimal.NewDecimal(decimal.RequireFromString(p)),
+		})
+	}
+	return res
+}
+
+func TestFundingRateFromSamples(t *testing.T) {
+	params := RateParams{InterestRate: 0.0001, Dampener: 0.0005, Cap: 0.003}
+
+	// premium within the dampener of the interest rate, the rate is the interest rate
+	rate, err := FundingRateFromSamples("TEST", 1, premiumSamples("0.0002", "0.0004", "0.0003"), params)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0003", rate.Premium.String())
+	assert.Equal(t, "0.0001", rate.Rate.String())
+	assert.Equal(t, uint(3), rate.Samples)
+
+	// premium above the dampener band
+	rate, err = FundingRateFromSamples("TEST", 1, premiumSamples("0.001", "0.002"), params)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.001", rate.Rate.String())
+
+	// negative premium
+	rate, err = FundingRateFromSamples("TEST", 1, premiumSamples("-0.001"), params)
+	assert.NoError(t, err)
+	assert.Equal(t, "-0.0005", rate.Rate.String())
+
+	// capped
+	rate, err = FundingRateFromSamples("TEST", 1, premiumSamples("0.02", "0.01"), params)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.003", rate.Rate.String())
+
+	// repeating average is rounded the same way
+	a, _ := FundingRateFromSamples("TEST", 1, premiumSamples("0.001", "0.001", "0.002"), params)
+	b, _ := FundingRateFromSamples("TEST", 1, premiumSamples("0.001", "0.001", "0.002"), params)
+	assert.Equal(t, "0.001333333333", a.Premium.String())
+	assert.True(t, a.Rate.Equal(b.Rate.Decimal))
+
+	_, err = FundingRateFromSamples("TEST", 1, nil, params)
+	assert.ErrorIs(t, err, ErrNoPremiumSamples)
+}
+
+func TestConfigParams(t *testing.T) {
+	rateCap := 0.001
+	notional := 500.0
+	cfg := PremiumConfig{
+		ImpactNotional: 10000,
+		InterestRate:   0.0001,
+		Dampener:       0.0005,
+		Cap:            0.01,
+		MarketParams: []MarketParams{
+			{MarketId: "ETH-USD", Cap: &rateCap, ImpactNotional: &notional},
+		},
+	}
+
+	assert.Equal(t, RateParams{ImpactNotional: 10000, InterestRate: 0.0001, Dampener: 0.0005, Cap: 0.01}, cfg.Params("BTC-USD"))
+	assert.Equal(t, RateParams{ImpactNotional: 500, InterestRate: 0.0001, Dampener: 0.0005, Cap: 0.001}, cfg.Params("ETH-USD"))
+
+	d_cap := decimal.NewFromFloat(rateCap)
+	assert.Equal(t, "0.001", clamp(decimal.RequireFromString("0.002"), d_cap).String())
+	assert.Equal(t, "-0.001", clamp(decimal.RequireFromString("-0.002"), d_cap).String())
+	assert.Equal(t, "0.0005", clamp(decimal.RequireFromString("0.0005"), d_cap).String())
+}
+
+func TestPremiumSampler(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakePremiumModel(100)
+	params := RateParams{ImpactNotional: 1000, InterestRate: 0.0001, Dampener: 0.0005, Cap: 0.01}
+	s := NewPremiumSampler("TEST", fake, params, time.Minute, time.Hour)
+
+	start := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	// impact mid 100.1, premium 0.001
+	fake.book = book(100.0, 100.2)
+	assert.NoError(t, s.tick(ctx, start.Add(time.Minute)))
+	assert.Len(t, fake.samples, 1)
+	assert.Equal(t, "0.001", fake.samples[0].Premium.String())
+	// no samples for the interval before the first one, no rate
+	assert.Empty(t, fake.rates)
+	assert.Equal(t, "0.0005", fake.instant.String())
+	assert.Equal(t, start.Add(time.Hour).UnixMicro(), fake.next)
+
+	// impact mid 100.3, premium 0.003, the prediction follows the average
+	fake.book = book(100.2, 100.4)
+	assert.NoError(t, s.tick(ctx, start.Add(30*time.Minute)))
+	assert.Equal(t, "0.0015", fake.instant.String())
+
+	// a thin book is not sampled
+	fake.book = book(100.0, 0)
+	assert.Error(t, s.tick(ctx, start.Add(31*time.Minute)))
+	assert.Len(t, fake.samples, 2)
+
+	// the next interval sets the rate of the previous one
+	fake.book = book(99.9, 100.1)
+	assert.NoError(t, s.tick(ctx, start.Add(61*time.Minute)))
+	end := start.Add(time.Hour).UnixMicro()
+	assert.Contains(t, fake.rates, end)
+	assert.Equal(t, "0.0015", fake.rates[end].Rate.String())
+	assert.Equal(t, "0.002", fake.rates[end].Premium.String())
+	assert.Equal(t, uint(2), fake.rates[end].Samples)
+	assert.Equal(t, end, fake.market.LastFundingUpdateTime)
+	// the prediction only uses the samples of the new interval
+	assert.Equal(t, "0.0001", fake.instant.String())
+	assert.Equal(t, start.Add(2*time.Hour).UnixMicro(), fake.next)
+
+	// a restarted sampler doesn't set the rate again and picks up the samples of the interval
+	s = NewPremiumSampler("TEST", fake, params, time.Minute, time.Hour)
+	fake.book = book(100.0, 100.2)
+	assert.NoError(t, s.tick(ctx, start.Add(62*time.Minute)))
+	assert.Len(t, fake.rates, 1)
+	assert.Len(t, s.current, 2)
+	assert.Equal(t, "0.0001", fake.instant.String())
+
+	// the rate is reproduced from the stored samples and params
+	rate, err := Reproduce(ctx, fake, "TEST", start.Add(time.Hour), time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, rate.Rate.Equal(fake.rates[end].Rate.Decimal))
+
+	// a sample lost from the store is detected
+	fake.samples = fake.samples[1:]
+	_, err = Reproduce(ctx, fake, "TEST", start.Add(time.Hour), time.Hour)
+	assert.Error(t, err)
+}
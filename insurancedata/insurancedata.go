@@ -0,0 +1,220 @@
+package insurancedata
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/strips-finance/rabbit-dex-backend/api/types"
+)
+
+// ledger kinds written by the tarantool engine and profile instances,
+// archived from the insurance_ledger space to app_insurance_ledger
+const (
+	KIND_TRADING_FEE  = "trading_fee"
+	KIND_TAKEOVER_PNL = "takeover_pnl"
+	KIND_CLAWBACK     = "clawback"
+	KIND_DEPOSIT      = "deposit"
+)
+
+type HistoryRequest struct {
+	MarketId  string `form:"market_id" binding:"omitempty"`
+	ProfileId uint64 `form:"profile_id" binding:"omitempty"`
+	Kind      string `form:"kind" binding:"omitempty,oneof=trading_fee takeover_pnl clawback deposit"`
+	StartTime uint64 `form:"start_time,default=0" binding:"omitempty,min=0"`
+	EndTime   uint64 `form:"end_time,default=0" binding:"omitempty,min=0"`
+}
+
+type LedgerEntry struct {
+	Id          string          `json:"id"`
+	InsuranceId uint64          `json:"insurance_id"`
+	ProfileId   uint64          `json:"profile_id"`
+	MarketId    string          `json:"market_id"`
+	Kind        string          `json:"kind"`
+	Amount      decimal.Decimal `json:"amount"`
+	RefId       string          `json:"ref_id"`
+	Timestamp   int64           `json:"timestamp"`
+}
+
+type BalanceRequest struct {
+	Range string `form:"range" binding:"oneof=1h 1d 1w 1m 1y all"`
+}
+
+// Balance is the running sum of the ledger at the end of the bucket,
+// Inflow and Outflow are the positive and negative entries inside it
+type BalancePoint struct {
+	Time    int64           `json:"time"`
+	Balance decimal.Decimal `json:"balance"`
+	Inflow  decimal.Decimal `json:"inflow"`
+	Outflow decimal.Decimal `json:"outflow"`
+}
+
+type rangeEntry struct {
+	window time.Duration // 0 for the whole history
+	bucket time.Duration
+}
+
+var ranges = map[string]rangeEntry{
+	"1h":  {window: time.Hour, bucket: time.Minute},
+	"1d":  {window: 24 * time.Hour, bucket: 15 * time.Minute},
+	"1w":  {window: 7 * 24 * time.Hour, bucket: 30 * time.Minute},
+	"1m":  {window: 28 * 24 * time.Hour, bucket: time.Hour},
+	"1y":  {window: 365 * 24 * time.Hour, bucket: 24 * time.Hour},
+	"all": {window: 0, bucket: 24 * time.Hour},
+}
+
+func HandleInsuranceHistory(ctx context.Context, db *pgxpool.Pool, request HistoryRequest, pagination types.PaginationRequestParams) ([]LedgerEntry, *types.PaginationResponse, error) {
+	qSelect := `SELECT
+		l.id,
+		l.insurance_id,
+		l.profile_id,
+		l.market_id,
+		l.kind,
+		l.amount,
+		l.ref_id,
+		l.timestamp
+`
+	qFrom := `
+	FROM app_insurance_ledger as l
+	WHERE l.timestamp >= @start_time
+	`
+
+	args := pgx.NamedArgs{
+		"start_time": request.StartTime,
+	}
+	if request.MarketId != "" {
+		qFrom += " AND l.market_id = @market_id"
+		args["market_id"] = request.MarketId
+	}
+	if request.ProfileId != 0 {
+		qFrom += " AND l.profile_id = @profile_id"
+		args["profile_id"] = request.ProfileId
+	}
+	if request.Kind != "" {
+		qFrom += " AND l.kind = @kind"
+		args["kind"] = request.Kind
+	}
+	if request.EndTime > 0 {
+		qFrom += " AND l.timestamp <= @end_time"
+		args["end_time"] = request.EndTime
+	}
+
+	paginationResponse := &types.PaginationResponse{
+		Limit: pagination.Limit,
+		Page:  pagination.Page,
+		Order: pagination.Order,
+	}
+	totalQuery := `SELECT COUNT(*) ` + qFrom
+	err := db.QueryRow(ctx, totalQuery, args).Scan(&paginationResponse.Total)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "execute total query")
+	}
+
+	selectQuery := qSelect + qFrom +
+		" ORDER BY l.timestamp " + pagination.Order + ", l.id " + pagination.Order +
+		" LIMIT @limit OFFSET @offset"
+
+	args["limit"] = pagination.Limit
+	args["offset"] = pagination.Limit * pagination.Page
+
+	rows, err := db.Query(ctx, selectQuery, args)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "execute query")
+	}
+	defer rows.Close()
+
+	response := make([]LedgerEntry, 0)
+	for rows.Next() {
+		var r LedgerEntry
+		err = rows.Scan(
+			&r.Id,
+			&r.InsuranceId,
+			&r.ProfileId,
+			&r.MarketId,
+			&r.Kind,
+			&r.Amount,
+			&r.RefId,
+			&r.Timestamp,
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "scan row")
+		}
+		response = append(response, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "rows error")
+	}
+
+	return response, paginationResponse, nil
+}
+
+// HandleInsuranceBalance buckets the whole ledger so the balance of the first
+// bucket in the range includes everything recorded before it
+func HandleInsuranceBalance(ctx context.Context, db *pgxpool.Pool, request BalanceRequest) ([]BalancePoint, error) {
+	entry, found := ranges[request.Range]
+	if !found {
+		return nil, fmt.Errorf("RANGE_NOT_FOUND %s", request.Range)
+	}
+
+	var startTime int64
+	if entry.window > 0 {
+		startTime = time.Now().Add(-entry.window).UnixMicro()
+	}
+
+	q := `WITH buckets AS (
+			SELECT
+				time_bucket(@bucket::bigint, l.timestamp) as bucket,
+				COALESCE(SUM(l.amount) FILTER (WHERE l.amount > 0), 0) as inflow,
+				COALESCE(SUM(l.amount) FILTER (WHERE l.amount < 0), 0) as outflow,
+				SUM(l.amount) as net
+			FROM app_insurance_ledger as l
+			GROUP BY 1
+		), series AS (
+			SELECT
+				bucket,
+				SUM(net) OVER (ORDER BY bucket) as balance,
+				inflow,
+				outflow
+			FROM buckets
+		)
+		SELECT bucket, balance, inflow, outflow
+		FROM series
+		WHERE bucket + @bucket::bigint > @start_time
+		ORDER BY 1 ASC;`
+
+	args := pgx.NamedArgs{
+		"bucket":     entry.bucket.Microseconds(),
+		"start_time": startTime,
+	}
+
+	rows, err := db.Query(ctx, q, args)
+	if err != nil {
+		return nil, errors.Wrap(err, "query error")
+	}
+	defer rows.Close()
+
+	results := make([]BalancePoint, 0)
+	for rows.Next() {
+		var r BalancePoint
+		err = rows.Scan(
+			&r.Time,
+			&r.Balance,
+			&r.Inflow,
+			&r.Outflow)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "scan row error")
+		}
+		results = append(results, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows error")
+	}
+	return results, nil
+}
@@ -0,0 +1,116 @@
+package insurancedata
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/suite"
+	"github.com/strips-finance/rabbit-dex-backend/api/types"
+	"github.com/strips-finance/rabbit-dex-backend/dbtestsuite"
+)
+
+const (
+	insuranceID = uint64(0)
+	traderID    = uint64(7)
+)
+
+var tables = []string{
+	"app_insurance_ledger",
+}
+
+type dbTestSuite struct {
+	dbtestsuite.DBTestSuite
+}
+
+func Test_dbTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timescaledb integration test")
+	}
+	testSuite := new(dbTestSuite)
+	suite.Run(t, testSuite)
+}
+
+func (s *dbTestSuite) SetupSuite() {
+	s.BaseSetupSuite()
+	ApplyTestMigrations(s.T(), s.MigrationConnectionString())
+}
+
+func (s *dbTestSuite) TearDownSuite() {
+	s.BaseTearDownSuite()
+}
+
+func (s *dbTestSuite) SetupTest() {
+	s.DeleteTables(tables)
+}
+
+func (s *dbTestSuite) insertEntry(id string, profileId uint64, marketId, kind string, amount float64, timestamp int64) {
+	s.Execute(`INSERT INTO app_insurance_ledger
+		(id, insurance_id, profile_id, market_id, kind, amount, ref_id, timestamp, shard_id, archive_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		id, insuranceID, profileId, marketId, kind, decimal.NewFromFloat(amount), "ref-"+id, timestamp, marketId, timestamp)
+}
+
+func (s *dbTestSuite) TestHandleInsuranceHistory() {
+	now := time.Now().UnixMicro()
+	s.insertEntry("1", insuranceID, "", KIND_DEPOSIT, 1000, now-3000)
+	s.insertEntry("2", traderID, "BTC-USD", KIND_TAKEOVER_PNL, 0, now-2000)
+	s.insertEntry("3", traderID, "BTC-USD", KIND_TAKEOVER_PNL, -150.5, now-1000)
+	s.insertEntry("4", traderID+1, "ETH-USD", KIND_CLAWBACK, 20, now)
+
+	pagination := types.PaginationRequestParams{Page: 0, Limit: 50, Order: "desc"}
+
+	entries, paginationResponse, err := HandleInsuranceHistory(context.Background(), s.GetDB(), HistoryRequest{}, pagination)
+	s.NoError(err)
+	s.Equal(int64(4), paginationResponse.Total)
+	s.Equal([]string{"4", "3", "2", "1"}, ids(entries))
+
+	entries, _, err = HandleInsuranceHistory(context.Background(), s.GetDB(), HistoryRequest{
+		MarketId:  "BTC-USD",
+		ProfileId: traderID,
+	}, pagination)
+	s.NoError(err)
+	s.Equal([]string{"3", "2"}, ids(entries))
+	s.True(entries[0].Amount.Equal(decimal.NewFromFloat(-150.5)))
+	s.Equal("ref-3", entries[0].RefId)
+
+	entries, _, err = HandleInsuranceHistory(context.Background(), s.GetDB(), HistoryRequest{
+		Kind:      KIND_TAKEOVER_PNL,
+		StartTime: uint64(now - 1500),
+	}, pagination)
+	s.NoError(err)
+	s.Equal([]string{"3"}, ids(entries))
+}
+
+func (s *dbTestSuite) TestHandleInsuranceBalance() {
+	now := time.Now()
+	s.insertEntry("1", insuranceID, "", KIND_DEPOSIT, 1000, now.Add(-48*time.Hour).UnixMicro())
+	s.insertEntry("2", traderID, "BTC-USD", KIND_TAKEOVER_PNL, -200, now.Add(-10*time.Minute).UnixMicro())
+	s.insertEntry("3", traderID, "BTC-USD", KIND_TRADING_FEE, 50, now.Add(-10*time.Minute).UnixMicro())
+
+	// the deposit is outside the range but still in the balance
+	points, err := HandleInsuranceBalance(context.Background(), s.GetDB(), BalanceRequest{Range: "1h"})
+	s.NoError(err)
+	s.Len(points, 1)
+	s.True(points[0].Balance.Equal(decimal.NewFromInt(850)), points[0].Balance.String())
+	s.True(points[0].Inflow.Equal(decimal.NewFromInt(50)))
+	s.True(points[0].Outflow.Equal(decimal.NewFromInt(-200)))
+
+	points, err = HandleInsuranceBalance(context.Background(), s.GetDB(), BalanceRequest{Range: "all"})
+	s.NoError(err)
+	s.Len(points, 2)
+	s.True(points[0].Balance.Equal(decimal.NewFromInt(1000)))
+	s.True(points[1].Balance.Equal(decimal.NewFromInt(850)))
+
+	_, err = HandleInsuranceBalance(context.Background(), s.GetDB(), BalanceRequest{Range: "2h"})
+	s.Error(err)
+}
+
+func ids(entries []LedgerEntry) []string {
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.Id)
+	}
+	return result
+}
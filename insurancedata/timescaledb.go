@@ -0,0 +1,15 @@
+package insurancedata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/strips-finance/rabbit-dex-backend/migrations"
+)
+
+func ApplyTestMigrations(t *testing.T, migrationConnStr string) {
+	r := require.New(t)
+
+	err := migrations.ApplyMigrations(migrationConnStr, "archiver", "archiver_db_version")
+	r.NoError(err)
+}
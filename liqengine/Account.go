@@ -8,6 +8,8 @@ type AccountData struct {
 	Cache     *model.ProfileCache
 	Positions []*model.PositionData
 	Markets   map[string]*model.MarketData
+	// markets in isolated margin mode, the cache holds the cross margin only
+	Isolated map[string]*model.IsolatedMargin
 }
 
 func FlipSide(side string) string {
@@ -16,3 +18,79 @@ func FlipSide(side string) string {
 	}
 	return model.LONG
 }
+
+// markets of the account positions with a frozen index price
+func (a *AccountData) DegradedMarkets() []string {
+	degraded := make([]string, 0)
+	for _, pos := range a.Positions {
+		market, ok := a.Markets[pos.MarketID]
+		if ok && market.IsPriceDegraded() {
+			degraded = append(degraded, pos.MarketID)
+		}
+	}
+	return degraded
+}
+
+// copy of the account without the positions in price degraded markets,
+// they are handled again once the price feed recovers
+func (a *AccountData) WithoutDegradedMarkets() *AccountData {
+	positions := make([]*model.PositionData, 0, len(a.Positions))
+	for _, pos := range a.Positions {
+		market, ok := a.Markets[pos.MarketID]
+		if ok && market.IsPriceDegraded() {
+			continue
+		}
+		positions = append(positions, pos)
+	}
+	return &AccountData{
+		Cache:     a.Cache,
+		Positions: positions,
+		Markets:   a.Markets,
+	}
+}
+
+// copy of the account without the positions in isolated markets, they are
+// liquidated on their own margin
+func (a *AccountData) CrossAccount() *AccountData {
+	if len(a.Isolated) == 0 {
+		return a
+	}
+	positions := make([]*model.PositionData, 0, len(a.Positions))
+	for _, pos := range a.Positions {
+		if _, ok := a.Isolated[pos.MarketID]; ok {
+			continue
+		}
+		positions = append(positions, pos)
+	}
+	return &AccountData{
+		Cache:     a.Cache,
+		Positions: positions,
+		Markets:   a.Markets,
+	}
+}
+
+// the position of an isolated market as an account of its own, with the
+// isolated margin in place of the cross margin
+func (a *AccountData) IsolatedAccount(isolated *model.IsolatedMargin) *AccountData {
+	cache := *a.Cache
+	cache.Balance = isolated.Balance
+	cache.AccountEquity = isolated.Equity
+	cache.TotalPositionMargin = isolated.TotalPositionMargin
+	cache.TotalOrderMargin = isolated.TotalOrderMargin
+	cache.TotalNotional = isolated.TotalNotional
+	cache.AccountMargin = isolated.AccountMargin
+	cache.WithdrawableBalance = isolated.RemovableMargin
+	cache.CumUnrealizedPnl = isolated.CumUnrealizedPnl
+
+	positions := make([]*model.PositionData, 0, 1)
+	for _, pos := range a.Positions {
+		if pos.MarketID == isolated.MarketID {
+			positions = append(positions, pos)
+		}
+	}
+	return &AccountData{
+		Cache:     &cache,
+		Positions: positions,
+		Markets:   a.Markets,
+	}
+}
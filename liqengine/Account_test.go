@@ -0,0 +1,76 @@
+package liqengine
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+func dec(value float64) *tdecimal.Decimal {
+	return tdecimal.NewDecimal(decimal.NewFromFloat(value))
+}
+
+func TestIsolatedAccount(t *testing.T) {
+	traderType := model.PROFILE_TYPE_TRADER
+	status := model.PROFILE_STATUS_ACTIVE
+	account := &AccountData{
+		Cache: &model.ProfileCache{
+			ProfileID:     7,
+			ProfileType:   &traderType,
+			Status:        &status,
+			AccountEquity: dec(1000),
+			TotalNotional: dec(2000),
+			AccountMargin: dec(0.5),
+		},
+		Positions: []*model.PositionData{
+			{MarketID: "BTC-USD", ProfileID: 7, Size: *dec(1), Side: model.LONG, FairPrice: dec(20000)},
+			{MarketID: "ETH-USD", ProfileID: 7, Size: *dec(1), Side: model.SHORT, FairPrice: dec(2000)},
+		},
+		Markets: map[string]*model.MarketData{},
+		Isolated: map[string]*model.IsolatedMargin{
+			"BTC-USD": {
+				ProfileID:     7,
+				MarketID:      "BTC-USD",
+				MarginMode:    model.MARGIN_MODE_ISOLATED,
+				Equity:        dec(200),
+				TotalNotional: dec(20000),
+				AccountMargin: dec(0.01),
+			},
+		},
+	}
+	le := LiquidationEngine{}
+
+	// the cross account is healthy and doesn't see the isolated position
+	cross := account.CrossAccount()
+	if len(cross.Positions) != 1 || cross.Positions[0].MarketID != "ETH-USD" {
+		t.Fatalf("Expected only the ETH-USD position in the cross account but got %+v", cross.Positions)
+	}
+	if actions, _ := le.requiredActions(cross); len(actions) != 0 {
+		t.Fatalf("Expected no cross actions but got %+v", actions)
+	}
+
+	// the isolated position is taken over on its own margin
+	isolated := account.IsolatedAccount(account.Isolated["BTC-USD"])
+	if isolated.Cache.AccountMargin.InexactFloat64() != 0.01 || account.Cache.AccountMargin.InexactFloat64() != 0.5 {
+		t.Fatalf("Unexpected isolated margin %v, cross margin %v", isolated.Cache.AccountMargin, account.Cache.AccountMargin)
+	}
+	actions, vaults := le.requiredActions(isolated)
+	if len(actions) != 1 || len(vaults) != 0 {
+		t.Fatalf("Expected a single takeover but got %+v %+v", actions, vaults)
+	}
+	if actions[0].Kind != model.AInsTakeover || actions[0].MarketId != "BTC-USD" || actions[0].TraderId != 7 {
+		t.Fatalf("Unexpected takeover %+v", actions[0])
+	}
+	if !almostEqual(actions[0].Price.InexactFloat64(), 20000*(1-0.01)) {
+		t.Fatalf("Unexpected takeover price %v", actions[0].Price)
+	}
+
+	// without isolated markets the account is all cross
+	account.Isolated = nil
+	if len(account.CrossAccount().Positions) != 2 {
+		t.Fatalf("Expected both positions in the cross account")
+	}
+}
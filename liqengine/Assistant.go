@@ -23,8 +23,11 @@ type Assistant interface {
 	GetInsuranceData(ctx context.Context, insurance_id uint) (*AccountData, error)
 	GetAccountData(ctx context.Context, profile *model.ProfileCache) (*AccountData, error)
 	ClawbackRequired(ctx context.Context) bool
-	GetWinningTraderPostns(ctx context.Context, marketId string, side string, atPrice float64, insuranceId uint) (map[uint]*model.PositionData, error)
+	GetAdlQueue(ctx context.Context, marketId string, side string, atPrice float64, insuranceId uint) ([]*AdlEntry, error)
 	GetNextLiquidationServiceId() ServiceId
 	GetOrCreateInsurance(ctx context.Context) (uint, error)
 	WaitForCancellAllAccepted(ctx context.Context, traderId uint) error
+	GetIsolatedLiqBatch(ctx context.Context, limit int) ([]*model.IsolatedMargin, error)
+	GetIsolatedAccountData(ctx context.Context, isolated *model.IsolatedMargin) (*AccountData, error)
+	WaitForMarketCancelAccepted(ctx context.Context, traderId uint, marketId string) error
 }
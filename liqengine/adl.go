@@ -0,0 +1,62 @@
+package liqengine
+
+import (
+	"sort"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+const ADL_QUANTILES = 5
+
+// AdlEntry is a winning position in the ADL queue of its market,
+// entries are deleveraged from the highest score down
+type AdlEntry struct {
+	Rank     int                 `json:"rank"`
+	Quantile uint                `json:"quantile"`
+	Score    float64             `json:"score"`
+	PnlPct   float64             `json:"pnl_pct"`
+	Leverage float64             `json:"leverage"`
+	Position *model.PositionData `json:"position"`
+}
+
+// RankAdlQueue ranks the positions profitable at atPrice by unrealized pnl% of the
+// entry notional times the effective leverage (notional at atPrice over the account
+// equity). Ties go to the lower profile id so the order is reproducible.
+func RankAdlQueue(positions []*model.PositionData, equities map[uint]float64, atPrice float64) []*AdlEntry {
+	queue := make([]*AdlEntry, 0, len(positions))
+	for _, pos := range positions {
+		size := pos.Size.InexactFloat64()
+		entryPrice := pos.EntryPrice.InexactFloat64()
+		if size <= 0 || entryPrice <= 0 {
+			continue
+		}
+		pnl := calcUnrealizedPnl(size, entryPrice, atPrice, pos.Side)
+		if pnl <= 0 {
+			continue
+		}
+
+		entry := &AdlEntry{
+			PnlPct:   pnl / (size * entryPrice),
+			Position: pos,
+		}
+		// accounts without equity are being liquidated, they go last
+		if equity := equities[pos.ProfileID]; equity > 0 {
+			entry.Leverage = size * atPrice / equity
+		}
+		entry.Score = entry.PnlPct * entry.Leverage
+		queue = append(queue, entry)
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].Score != queue[j].Score {
+			return queue[i].Score > queue[j].Score
+		}
+		return queue[i].Position.ProfileID < queue[j].Position.ProfileID
+	})
+
+	for i, entry := range queue {
+		entry.Rank = i + 1
+		entry.Quantile = uint(ADL_QUANTILES - i*ADL_QUANTILES/len(queue))
+	}
+	return queue
+}
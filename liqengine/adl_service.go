@@ -0,0 +1,209 @@
+package liqengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+const DEFAULT_ADL_INTERVAL = 5 * time.Second
+
+type AdlModel interface {
+	GetMarketData(ctx context.Context, market_id string) (*model.MarketData, error)
+	GetWinningPositions(ctx context.Context, market_id, side string) ([]*model.PositionData, error)
+	GetProfileCache(ctx context.Context, profile_id uint) (*model.ProfileCache, error)
+	UpdateAdlQuantiles(ctx context.Context, market_id string, quantiles []*model.AdlQuantile) error
+	PublishBatch(ctx context.Context, batch model.PubsubBatch, ttl, size, meta_ttl int) error
+}
+
+// compile-time check that model.ApiModel implements AdlModel
+var _ AdlModel = (*model.ApiModel)(nil)
+
+// quantile change published on the account channel, 0 once the position left the queue
+type AdlUpdate struct {
+	MarketID string `json:"market_id"`
+	Side     string `json:"side"`
+	Quantile uint   `json:"quantile"`
+}
+
+type adlKey struct {
+	marketId  string
+	profileId uint
+}
+
+// AdlService ranks the ADL queue of every market at the fair price, stores the
+// quantiles in the market instance for GET /positions and publishes the changes
+// on the account channels
+type AdlService struct {
+	apiModel    AdlModel
+	insuranceId uint
+	markets     []string
+	interval    time.Duration
+	published   map[adlKey]AdlUpdate
+	stopf       context.CancelFunc
+}
+
+func NewAdlService(apiModel AdlModel, insuranceId uint, markets []string, interval time.Duration) *AdlService {
+	if interval <= 0 {
+		interval = DEFAULT_ADL_INTERVAL
+	}
+	return &AdlService{
+		apiModel:    apiModel,
+		insuranceId: insuranceId,
+		markets:     markets,
+		interval:    interval,
+		published:   make(map[adlKey]AdlUpdate),
+	}
+}
+
+func (s *AdlService) Run() context.CancelFunc {
+	ctx, cancelf := context.WithCancel(context.Background())
+	ticker := time.NewTicker(s.interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.UpdateQuantiles(ctx); err != nil {
+					logrus.Errorf("ADL service: error updating quantiles: %v", err)
+				}
+			}
+		}
+	}()
+	s.stopf = cancelf
+	return cancelf
+}
+
+func (s *AdlService) Stop() {
+	if s.stopf != nil {
+		s.stopf()
+	}
+}
+
+func (s *AdlService) UpdateQuantiles(ctx context.Context) error {
+	equities := make(map[uint]float64)
+	current := make(map[adlKey]AdlUpdate)
+
+	for _, marketId := range s.markets {
+		queues, err := s.marketQueues(ctx, marketId, equities)
+		if err != nil {
+			logrus.Warnf("ADL service: skipping market %s: %v", marketId, err)
+			// keep what was published until the market is ranked again
+			for key, update := range s.published {
+				if key.marketId == marketId {
+					current[key] = update
+				}
+			}
+			continue
+		}
+
+		quantiles := make([]*model.AdlQuantile, 0)
+		for _, queue := range queues {
+			for _, entry := range queue {
+				quantiles = append(quantiles, &model.AdlQuantile{
+					ProfileID: entry.Position.ProfileID,
+					Side:      entry.Position.Side,
+					Quantile:  entry.Quantile,
+					Score:     *tdecimal.NewDecimal(decimal.NewFromFloat(entry.Score)),
+				})
+				current[adlKey{marketId, entry.Position.ProfileID}] = AdlUpdate{
+					MarketID: marketId,
+					Side:     entry.Position.Side,
+					Quantile: entry.Quantile,
+				}
+			}
+		}
+		if err = s.apiModel.UpdateAdlQuantiles(ctx, marketId, quantiles); err != nil {
+			logrus.Errorf("ADL service: error storing quantiles of market %s: %v", marketId, err)
+		}
+	}
+
+	return s.publish(ctx, current)
+}
+
+func (s *AdlService) marketQueues(ctx context.Context, marketId string, equities map[uint]float64) ([][]*AdlEntry, error) {
+	market, err := s.apiModel.GetMarketData(ctx, marketId)
+	if err != nil {
+		return nil, err
+	}
+	fairPrice := market.FairPrice.InexactFloat64()
+	if fairPrice <= 0 {
+		return nil, fmt.Errorf("no fair price")
+	}
+
+	queues := make([][]*AdlEntry, 0, 2)
+	for _, side := range []string{model.LONG, model.SHORT} {
+		winPositions, err := s.apiModel.GetWinningPositions(ctx, marketId, side)
+		if err != nil {
+			return nil, err
+		}
+		positions := make([]*model.PositionData, 0, len(winPositions))
+		for _, pos := range winPositions {
+			if pos.ProfileID == s.insuranceId || pos.MarketID != marketId {
+				continue
+			}
+			if _, ok := equities[pos.ProfileID]; !ok {
+				cache, err := s.apiModel.GetProfileCache(ctx, pos.ProfileID)
+				if err != nil {
+					return nil, err
+				}
+				equities[pos.ProfileID] = cache.AccountEquity.InexactFloat64()
+			}
+			positions = append(positions, pos)
+		}
+		queues = append(queues, RankAdlQueue(positions, equities, fairPrice))
+	}
+	return queues, nil
+}
+
+// publishes the quantiles that changed since the last round on account@<profile_id>
+func (s *AdlService) publish(ctx context.Context, current map[adlKey]AdlUpdate) error {
+	changed := make(map[uint][]AdlUpdate)
+	for key, update := range current {
+		if last, ok := s.published[key]; !ok || last != update {
+			changed[key.profileId] = append(changed[key.profileId], update)
+		}
+	}
+	for key, last := range s.published {
+		if _, ok := current[key]; !ok {
+			last.Quantile = 0
+			changed[key.profileId] = append(changed[key.profileId], last)
+		}
+	}
+	if len(changed) == 0 {
+		s.published = current
+		return nil
+	}
+
+	batch := make(model.PubsubBatch, len(changed))
+	for profileId, updates := range changed {
+		val := struct {
+			Data struct {
+				ID  uint        `json:"id"`
+				Adl []AdlUpdate `json:"adl"`
+			} `json:"data"`
+		}{}
+		val.Data.ID = profileId
+		val.Data.Adl = updates
+		encoded, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		batch[fmt.Sprint(model.ACCOUNT_PREFIX, profileId)] = encoded
+	}
+
+	if err := s.apiModel.PublishBatch(ctx, batch, 0, 0, 0); err != nil {
+		return err
+	}
+	s.published = current
+	return nil
+}
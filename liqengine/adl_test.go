@@ -0,0 +1,201 @@
+package liqengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+func adlPosition(profileId uint, side string, size, entryPrice float64) *model.PositionData {
+	return &model.PositionData{
+		PositionID: fmt.Sprintf("pos-%d", profileId),
+		MarketID:   "BTC-USD",
+		ProfileID:  profileId,
+		Side:       side,
+		Size:       *tdecimal.NewDecimal(decimal.NewFromFloat(size)),
+		EntryPrice: *tdecimal.NewDecimal(decimal.NewFromFloat(entryPrice)),
+	}
+}
+
+func TestRankAdlQueue(t *testing.T) {
+	logrus.Warn(".......TestRankAdlQueue")
+	positions := []*model.PositionData{
+		adlPosition(4, model.LONG, 1, 100),
+		adlPosition(1, model.LONG, 1, 100),
+		adlPosition(3, model.LONG, 1, 120), // losing at 110
+		adlPosition(5, model.LONG, 1, 50),  // no equity
+		adlPosition(2, model.LONG, 2, 100),
+	}
+	equities := map[uint]float64{1: 100, 2: 100, 3: 100, 4: 100}
+
+	queue := RankAdlQueue(positions, equities, 110)
+	if len(queue) != 4 {
+		t.Fatalf("Expected 4 entries but got %d", len(queue))
+	}
+
+	// profile 2 has twice the leverage, 1 and 4 tie and go by profile id
+	expected := []struct {
+		profileId uint
+		quantile  uint
+		score     float64
+	}{
+		{2, 5, 0.22},
+		{1, 4, 0.11},
+		{4, 3, 0.11},
+		{5, 2, 0},
+	}
+	for i, e := range expected {
+		entry := queue[i]
+		if entry.Position.ProfileID != e.profileId || entry.Rank != i+1 || entry.Quantile != e.quantile || !almostEqual(entry.Score, e.score) {
+			t.Fatalf("Unexpected entry %d: profile=%d rank=%d quantile=%d score=%f",
+				i, entry.Position.ProfileID, entry.Rank, entry.Quantile, entry.Score)
+		}
+	}
+
+	if len(RankAdlQueue(positions, equities, 40)) != 0 {
+		t.Fatalf("Expected no winning long below every entry price")
+	}
+}
+
+func TestClawbackActions(t *testing.T) {
+	logrus.Warn(".......TestClawbackActions")
+	minOrder := tdecimal.NewDecimal(decimal.NewFromFloat(0.1))
+	fairPrice := tdecimal.NewDecimal(decimal.NewFromFloat(100))
+	accountMargin := tdecimal.NewDecimal(decimal.NewFromFloat(0.05))
+	insurance := &AccountData{
+		Cache:   &model.ProfileCache{ProfileID: 1, AccountMargin: accountMargin},
+		Markets: map[string]*model.MarketData{"BTC-USD": {MarketID: "BTC-USD", MinOrder: minOrder}},
+	}
+	insurancePos := adlPosition(1, model.LONG, 0.5, 100)
+	insurancePos.FairPrice = fairPrice
+
+	queue := RankAdlQueue([]*model.PositionData{
+		adlPosition(30, model.SHORT, 1, 120),
+		adlPosition(20, model.SHORT, 0.3, 200),
+		adlPosition(10, model.SHORT, 1, 101),
+	}, map[uint]float64{10: 1000, 20: 100, 30: 1000}, 100)
+
+	le := NewLiquidationEngine(nil)
+	actions := le.clawbackActions(insurance, insurancePos, queue)
+	if len(actions) != 2 {
+		t.Fatalf("Expected 2 clawbacks but got %+v", actions)
+	}
+	// rank 1 gives back its whole position, rank 2 the rest of the deficit, rank 3 nothing
+	if actions[0].TraderId != 20 || !almostEqual(actions[0].Size.InexactFloat64(), 0.3) {
+		t.Fatalf("Unexpected first clawback %+v", actions[0])
+	}
+	if actions[1].TraderId != 30 || !almostEqual(actions[1].Size.InexactFloat64(), 0.2) {
+		t.Fatalf("Unexpected second clawback %+v", actions[1])
+	}
+	for _, action := range actions {
+		if action.Kind != model.AInsClawback || !almostEqual(action.Price.InexactFloat64(), 95) {
+			t.Fatalf("Unexpected clawback %+v", action)
+		}
+	}
+}
+
+type fakeAdlModel struct {
+	market    *model.MarketData
+	positions map[string][]*model.PositionData
+	equities  map[uint]float64
+	stored    map[string][]*model.AdlQuantile
+	batches   []model.PubsubBatch
+}
+
+func (m *fakeAdlModel) GetMarketData(ctx context.Context, market_id string) (*model.MarketData, error) {
+	return m.market, nil
+}
+
+func (m *fakeAdlModel) GetWinningPositions(ctx context.Context, market_id, side string) ([]*model.PositionData, error) {
+	return m.positions[side], nil
+}
+
+func (m *fakeAdlModel) GetProfileCache(ctx context.Context, profile_id uint) (*model.ProfileCache, error) {
+	equity := tdecimal.NewDecimal(decimal.NewFromFloat(m.equities[profile_id]))
+	return &model.ProfileCache{ProfileID: profile_id, AccountEquity: equity}, nil
+}
+
+func (m *fakeAdlModel) UpdateAdlQuantiles(ctx context.Context, market_id string, quantiles []*model.AdlQuantile) error {
+	m.stored[market_id] = quantiles
+	return nil
+}
+
+func (m *fakeAdlModel) PublishBatch(ctx context.Context, batch model.PubsubBatch, ttl, size, meta_ttl int) error {
+	m.batches = append(m.batches, batch)
+	return nil
+}
+
+func publishedAdl(t *testing.T, batch model.PubsubBatch, profileId uint) []AdlUpdate {
+	encoded, ok := batch[fmt.Sprint(model.ACCOUNT_PREFIX, profileId)]
+	if !ok {
+		return nil
+	}
+	val := struct {
+		Data struct {
+			ID  uint        `json:"id"`
+			Adl []AdlUpdate `json:"adl"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(encoded, &val); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return val.Data.Adl
+}
+
+func TestAdlServiceUpdateQuantiles(t *testing.T) {
+	logrus.Warn(".......TestAdlServiceUpdateQuantiles")
+	fake := &fakeAdlModel{
+		market: &model.MarketData{MarketID: "BTC-USD", FairPrice: tdecimal.NewDecimal(decimal.NewFromFloat(110))},
+		positions: map[string][]*model.PositionData{
+			model.LONG: {adlPosition(1, model.LONG, 1, 100), adlPosition(2, model.LONG, 2, 100), adlPosition(99, model.LONG, 1, 100)},
+		},
+		equities: map[uint]float64{1: 100, 2: 100, 99: 100},
+		stored:   make(map[string][]*model.AdlQuantile),
+	}
+	service := NewAdlService(fake, 99, []string{"BTC-USD"}, 0)
+	ctx := context.Background()
+
+	if err := service.UpdateQuantiles(ctx); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	// the insurance position is never ranked
+	if len(fake.stored["BTC-USD"]) != 2 || len(fake.batches) != 1 {
+		t.Fatalf("Expected 2 quantiles published once but got %+v %+v", fake.stored, fake.batches)
+	}
+	if adl := publishedAdl(t, fake.batches[0], 2); len(adl) != 1 || adl[0].Quantile != 5 {
+		t.Fatalf("Unexpected quantile of profile 2 %+v", adl)
+	}
+	if adl := publishedAdl(t, fake.batches[0], 1); len(adl) != 1 || adl[0].Quantile != 3 {
+		t.Fatalf("Unexpected quantile of profile 1 %+v", adl)
+	}
+
+	// nothing changed, nothing published
+	if err := service.UpdateQuantiles(ctx); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(fake.batches) != 1 {
+		t.Fatalf("Expected no publish without changes but got %+v", fake.batches)
+	}
+
+	// profile 2 closed its position: profile 1 moves up and profile 2 gets 0
+	fake.positions[model.LONG] = fake.positions[model.LONG][:1]
+	if err := service.UpdateQuantiles(ctx); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(fake.batches) != 2 {
+		t.Fatalf("Expected a second publish but got %+v", fake.batches)
+	}
+	if adl := publishedAdl(t, fake.batches[1], 1); len(adl) != 1 || adl[0].Quantile != 5 {
+		t.Fatalf("Unexpected quantile of profile 1 %+v", adl)
+	}
+	if adl := publishedAdl(t, fake.batches[1], 2); len(adl) != 1 || adl[0].Quantile != 0 {
+		t.Fatalf("Unexpected quantile of profile 2 %+v", adl)
+	}
+}
@@ -0,0 +1,91 @@
+package liqengine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultConfigPath = ".rabbit"
+	DefaultConfigFile = "liqengine.yaml"
+)
+
+const (
+	LIQUIDATION_MODE_WATERFALL   = "waterfall"
+	LIQUIDATION_MODE_INCREMENTAL = "incremental"
+)
+
+type MarketConfig struct {
+	Mode         string  `yaml:"mode" json:"mode"`                   // waterfall (default) or incremental
+	StepSize     float64 `yaml:"step_size" json:"step_size"`         // incremental: size closed per slice, 10% of the position if 0
+	MarginBuffer float64 `yaml:"margin_buffer" json:"margin_buffer"` // incremental: margin above LIQUIDATION_MARGIN to reach, default 0.005
+}
+
+type AdlConfig struct {
+	Markets        []string `yaml:"markets"`         // markets ranked and published, none disables the ADL service
+	UpdateInterval string   `yaml:"update_interval"` // default 5s
+}
+
+type ServiceConfig struct {
+	Markets map[string]MarketConfig `yaml:"markets"`
+	Adl     AdlConfig               `yaml:"adl"`
+}
+
+type Config struct {
+	Service ServiceConfig `yaml:"service"`
+}
+
+// without a config file every market keeps the waterfall and no ADL quantiles are published
+func ReadConfig() (*Config, error) {
+	config := &Config{}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	configPath := path.Join(homeDir, DefaultConfigPath, DefaultConfigFile)
+	if _, err = os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		logrus.Infof("No config at %s, waterfall liquidation in all markets", configPath)
+		return config, nil
+	}
+
+	logrus.Info("Reading config from ", configPath)
+	err = cleanenv.ReadConfig(configPath, config)
+	if err != nil {
+		return nil, err
+	}
+	return config, config.Validate()
+}
+
+func (c *Config) Validate() error {
+	for marketId, market := range c.Service.Markets {
+		switch market.Mode {
+		case "", LIQUIDATION_MODE_WATERFALL, LIQUIDATION_MODE_INCREMENTAL:
+		default:
+			return fmt.Errorf("unknown liquidation mode %s for market %s", market.Mode, marketId)
+		}
+		if market.StepSize < 0 || market.MarginBuffer < 0 {
+			return fmt.Errorf("negative step_size or margin_buffer for market %s", marketId)
+		}
+	}
+	if c.Service.Adl.UpdateInterval != "" {
+		if _, err := time.ParseDuration(c.Service.Adl.UpdateInterval); err != nil {
+			return fmt.Errorf("invalid adl update_interval %s: %v", c.Service.Adl.UpdateInterval, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) AdlInterval() time.Duration {
+	interval, err := time.ParseDuration(c.Service.Adl.UpdateInterval)
+	if err != nil || interval <= 0 {
+		return DEFAULT_ADL_INTERVAL
+	}
+	return interval
+}
@@ -0,0 +1,206 @@
+package liqengine
+
+import (
+	"math"
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+const (
+	DEFAULT_INCREMENTAL_STEP_FRAC = 0.1
+	DEFAULT_MARGIN_BUFFER         = 0.005
+)
+
+// Positions in waterfall markets are sold off like before. Positions in incremental
+// markets are closed in slices of the market step size, the margin is projected after
+// every slice (waterfall orders included) and no more slices are placed once it is back
+// above LIQUIDATION_MARGIN plus the market buffer. The service re-checks the real margin
+// on its next round and places more slices if the orders didn't get it there.
+func (le *LiquidationEngine) liquidationOrders(account *AccountData, maxADVFrac float64) []model.Action {
+	waterfall := &AccountData{
+		Cache:     account.Cache,
+		Positions: make([]*model.PositionData, 0, len(account.Positions)),
+		Markets:   account.Markets,
+	}
+	incremental := make([]*model.PositionData, 0)
+	for _, pos := range account.Positions {
+		if le.liquidationMode(pos.MarketID) == LIQUIDATION_MODE_INCREMENTAL {
+			incremental = append(incremental, pos)
+		} else {
+			waterfall.Positions = append(waterfall.Positions, pos)
+		}
+	}
+
+	orders := le.generateSellOrders(waterfall, maxADVFrac)
+	if len(incremental) == 0 {
+		return orders
+	}
+
+	projection := newMarginProjection(account)
+	for _, order := range orders {
+		projection.fill(order.MarketId, order.Size.InexactFloat64(), order.Price.InexactFloat64())
+	}
+
+	// the biggest positions bring the margin back the fastest
+	sort.SliceStable(incremental, func(i, j int) bool {
+		ni := incremental[i].Size.InexactFloat64() * projection.fairPrice(incremental[i].MarketID)
+		nj := incremental[j].Size.InexactFloat64() * projection.fairPrice(incremental[j].MarketID)
+		if ni != nj {
+			return ni > nj
+		}
+		return incremental[i].MarketID < incremental[j].MarketID
+	})
+
+	for _, pos := range incremental {
+		if projection.margin() >= le.targetMargin(pos.MarketID) {
+			break
+		}
+		orders = append(orders, le.incrementalSellOrders(account.Cache.ProfileID, pos, account.Markets[pos.MarketID], maxADVFrac, projection)...)
+	}
+	return orders
+}
+
+func (le *LiquidationEngine) targetMargin(marketId string) float64 {
+	buffer := DEFAULT_MARGIN_BUFFER
+	if market, ok := le.markets[marketId]; ok && market.MarginBuffer > 0 {
+		buffer = market.MarginBuffer
+	}
+	return LIQUIDATION_MARGIN + buffer
+}
+
+func (le *LiquidationEngine) stepSize(pos *model.PositionData, minOrder float64) float64 {
+	step := pos.Size.InexactFloat64() * DEFAULT_INCREMENTAL_STEP_FRAC
+	if market, ok := le.markets[pos.MarketID]; ok && market.StepSize > 0 {
+		step = market.StepSize
+	}
+	step = roundDownToTick(step, minOrder)
+	if step < minOrder {
+		step = minOrder
+	}
+	return step
+}
+
+func (le *LiquidationEngine) incrementalSellOrders(
+	traderId uint,
+	pos *model.PositionData,
+	market *model.MarketData,
+	maxADVFrac float64,
+	projection *marginProjection) []model.Action {
+
+	price, ok := incrementalPrice(pos, market)
+	if !ok {
+		return nil
+	}
+
+	minOrder := market.MinOrder.InexactFloat64()
+	step := le.stepSize(pos, minOrder)
+	// same cap on the size liquidated per round as the waterfall
+	maxLiqSz := market.AverageDailyVolumeQ.InexactFloat64() * maxADVFrac
+	if maxLiqSz < minOrder {
+		maxLiqSz = minOrder
+	}
+	target := le.targetMargin(pos.MarketID)
+
+	orders := make([]model.Action, 0)
+	remaining := pos.Size.InexactFloat64()
+	var placed float64
+	for projection.margin() < target {
+		size := math.Min(step, math.Min(remaining, maxLiqSz-placed))
+		// the last slice closes what is left of the position
+		if remaining-size < minOrder {
+			size = remaining
+		}
+		size = roundDownToTick(size, minOrder)
+		if size < minOrder {
+			break
+		}
+
+		d_size := tdecimal.NewDecimal(decimal.NewFromFloat(size))
+		d_price := tdecimal.NewDecimal(decimal.NewFromFloat(price))
+		orders = append(orders, model.Action{
+			Kind:     model.APlaceSellOrders,
+			TraderId: traderId,
+			MarketId: pos.MarketID,
+			Size:     *d_size,
+			Price:    *d_price,
+		})
+
+		projection.fill(pos.MarketID, size, price)
+		remaining -= size
+		placed += size
+	}
+	return orders
+}
+
+// crossing price of the slices, the best price of the other side bounded by the
+// same risk limit as the waterfall
+func incrementalPrice(pos *model.PositionData, market *model.MarketData) (float64, bool) {
+	bestAsk := market.BestAsk.InexactFloat64()
+	bestBid := market.BestBid.InexactFloat64()
+	if bestAsk <= 0.0 && bestBid > 0.0 {
+		bestAsk = bestBid
+	} else if bestBid <= 0.0 && bestAsk > 0.0 {
+		bestBid = bestAsk
+	}
+	if bestBid <= 0.0 {
+		return 0, false
+	}
+	refPrice := market.ReferencePrice(model.MARK_PRICE_USAGE_LIQUIDATION).InexactFloat64()
+	tick := market.MinTick.InexactFloat64()
+
+	if pos.Side == model.SHORT {
+		return math.Min(bestAsk, roundToNearestTick(1.01*refPrice, tick)), true
+	}
+	return math.Max(bestBid, roundToNearestTick(0.99*refPrice, tick)), true
+}
+
+// account margin after the orders placed so far are filled, valued at the fair price
+// like the profile cache
+type marginProjection struct {
+	equity    float64
+	notional  float64
+	positions map[string]*model.PositionData
+	markets   map[string]*model.MarketData
+}
+
+func newMarginProjection(account *AccountData) *marginProjection {
+	positions := make(map[string]*model.PositionData, len(account.Positions))
+	for _, pos := range account.Positions {
+		positions[pos.MarketID] = pos
+	}
+	return &marginProjection{
+		equity:    account.Cache.AccountEquity.InexactFloat64(),
+		notional:  account.Cache.TotalNotional.InexactFloat64(),
+		positions: positions,
+		markets:   account.Markets,
+	}
+}
+
+func (p *marginProjection) fairPrice(marketId string) float64 {
+	if pos, ok := p.positions[marketId]; ok && pos.FairPrice != nil && pos.FairPrice.IsPositive() {
+		return pos.FairPrice.InexactFloat64()
+	}
+	return p.markets[marketId].FairPrice.InexactFloat64()
+}
+
+func (p *marginProjection) fill(marketId string, size float64, price float64) {
+	pos, ok := p.positions[marketId]
+	if !ok {
+		return
+	}
+	fairPrice := p.fairPrice(marketId)
+	// the difference to the fair price is realized, the closed notional goes away
+	p.equity += calcUnrealizedPnl(size, fairPrice, price, pos.Side)
+	p.notional -= size * fairPrice
+}
+
+func (p *marginProjection) margin() float64 {
+	if p.notional <= 0 {
+		return 1.0
+	}
+	return p.equity / p.notional
+}
@@ -0,0 +1,94 @@
+package liqengine
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+func incrementalConfig(stepSize float64) *Config {
+	return &Config{Service: ServiceConfig{Markets: map[string]MarketConfig{
+		"BTC-USD": {Mode: LIQUIDATION_MODE_INCREMENTAL, StepSize: stepSize, MarginBuffer: 0.005},
+	}}}
+}
+
+func traderActions(report *SimulationReport, traderId uint) []SimulatedAction {
+	actions := make([]SimulatedAction, 0)
+	for _, action := range report.Actions {
+		if action.TraderId == traderId {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+func TestIncrementalLiquidation(t *testing.T) {
+	logrus.Warn(".......TestIncrementalLiquidation")
+	snapshot, err := LoadSnapshotFile("testdata/snapshot.json")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// profile 11: equity 700 on 27000 notional, slices of 0.1 at the best bid 26999.1
+	// get the margin to 0.0288, 0.0324 and 0.0370 above the 0.035 target
+	report, err := Simulate(snapshot, PriceShocks{"BTC-USD": -0.1}, incrementalConfig(0))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	actions := traderActions(report, 11)
+	if len(actions) != 3 {
+		t.Fatalf("Expected 3 slices but got %+v", actions)
+	}
+	for _, action := range actions {
+		if action.Kind != model.APlaceSellOrders.Description() || action.Size != 0.1 || !almostEqual(action.Price, 26999.1) {
+			t.Fatalf("Unexpected slice %+v", action)
+		}
+	}
+
+	// the bankrupt profile is still taken over
+	actions = traderActions(report, 10)
+	if len(actions) != 1 || actions[0].Kind != model.AInsTakeover.Description() {
+		t.Fatalf("Expected takeover of profile 10 but got %+v", actions)
+	}
+
+	// bigger steps need less slices: 0.0346 after the first one
+	report, err = Simulate(snapshot, PriceShocks{"BTC-USD": -0.1}, incrementalConfig(0.25))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	actions = traderActions(report, 11)
+	if len(actions) != 2 || actions[0].Size != 0.25 || actions[1].Size != 0.25 {
+		t.Fatalf("Expected 2 slices of 0.25 but got %+v", actions)
+	}
+}
+
+func TestIncrementalLiquidationLastSlice(t *testing.T) {
+	logrus.Warn(".......TestIncrementalLiquidationLastSlice")
+	snapshot, err := LoadSnapshotFile("testdata/snapshot.json")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// steps bigger than the position close it in a single slice
+	report, err := Simulate(snapshot, PriceShocks{"BTC-USD": -0.1}, incrementalConfig(5))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	actions := traderActions(report, 11)
+	if len(actions) != 1 || actions[0].Size != 1.0 {
+		t.Fatalf("Expected a single slice closing the position but got %+v", actions)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	logrus.Warn(".......TestConfigValidate")
+	if err := incrementalConfig(0.1).Validate(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	config := &Config{Service: ServiceConfig{Markets: map[string]MarketConfig{"BTC-USD": {Mode: "partial"}}}}
+	if err := config.Validate(); err == nil {
+		t.Fatalf("Expected error for an unknown mode")
+	}
+}
@@ -83,6 +83,10 @@ func (is *InsuranceService) sellOnMarket(ctx context.Context) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if degraded := insurance.DegradedMarkets(); len(degraded) > 0 {
+		logrus.Warnf("SellInMarket skipping insurance positions, price degraded in markets %v", degraded)
+		insurance = insurance.WithoutDegradedMarkets()
+	}
 
 	interval_passed := IsIntervalPassedForMicroseconds(*insurance.Cache.LastLiqCheck, INSURANCE_WATERFALL_INTERVAL)
 	logrus.Infof("SellInMarket insuranceData received insurance.cache.LastLiqCheck = %d positions=%d interval_passed = %v",
@@ -128,17 +132,21 @@ func (is *InsuranceService) clawback(ctx context.Context) (int, error) {
 	}
 
 	for _, insurancePos := range insurance.Positions {
+		if market, ok := insurance.Markets[insurancePos.MarketID]; ok && market.IsPriceDegraded() {
+			logrus.Warnf("Clawback skipping market %s, price degraded", insurancePos.MarketID)
+			continue
+		}
 		requiredSide := FlipSide(insurancePos.Side)
 		zeroPrice := calcZp(insurancePos, margin)
-		winningTraders, err := is.assistant.GetWinningTraderPostns(ctx, insurancePos.MarketID, requiredSide, zeroPrice, 0)
+		queue, err := is.assistant.GetAdlQueue(ctx, insurancePos.MarketID, requiredSide, zeroPrice, is.insuranceId)
 		if err != nil {
 			return 0, err
 		}
 
-		if len(winningTraders) > 0 {
+		if len(queue) > 0 {
 			actions = append(
 				actions,
-				is.engine.clawbackActions(insurance, insurancePos, winningTraders)...,
+				is.engine.clawbackActions(insurance, insurancePos, queue)...,
 			)
 		}
 	}
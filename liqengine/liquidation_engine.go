@@ -9,7 +9,16 @@ import (
 	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
 )
 
-type LiquidationEngine struct{}
+type LiquidationEngine struct {
+	markets map[string]MarketConfig
+}
+
+func NewLiquidationEngine(config *Config) LiquidationEngine {
+	if config == nil {
+		return LiquidationEngine{}
+	}
+	return LiquidationEngine{markets: config.Service.Markets}
+}
 
 const LIQUIDATION_MARGIN = 0.03
 const TAKEOVER_MARGIN = 0.02
@@ -59,7 +68,14 @@ func (le *LiquidationEngine) insuranceSelloffActions(insurance *AccountData) []m
 }
 
 func (le *LiquidationEngine) waterfall1(account *AccountData) []model.Action {
-	return le.generateSellOrders(account, TRADER_MAX_ADV_FRAC)
+	return le.liquidationOrders(account, TRADER_MAX_ADV_FRAC)
+}
+
+func (le *LiquidationEngine) liquidationMode(marketId string) string {
+	if market, ok := le.markets[marketId]; ok && market.Mode == LIQUIDATION_MODE_INCREMENTAL {
+		return LIQUIDATION_MODE_INCREMENTAL
+	}
+	return LIQUIDATION_MODE_WATERFALL
 }
 
 func (le *LiquidationEngine) waterfall3(account *AccountData) []model.Action {
@@ -106,8 +122,10 @@ func (le *LiquidationEngine) generateSellOrders(account *AccountData, maxADVFrac
 		if bestBid <= 0.0 {
 			continue
 		}
+		// fair price, or mark price if the market uses it for liquidations
+		refPrice := pos_market.ReferencePrice(model.MARK_PRICE_USAGE_LIQUIDATION).InexactFloat64()
 		//oneKSize := 2000.0 / (bestAsk + bestBid) //26.2467191601
-		oneKSize := 1000.0 / pos_market.FairPrice.InexactFloat64()
+		oneKSize := 1000.0 / refPrice
 		var orderSz float64
 
 		pos_size := pos.Size.InexactFloat64() //50
@@ -135,7 +153,7 @@ func (le *LiquidationEngine) generateSellOrders(account *AccountData, maxADVFrac
 		}
 
 		// for SELL
-		risk_limit_price := roundToNearestTick(0.99*pos_market.FairPrice.InexactFloat64(), tick)
+		risk_limit_price := roundToNearestTick(0.99*refPrice, tick)
 
 		price1 := bestAsk + tick
 		if price1 < risk_limit_price {
@@ -159,7 +177,7 @@ func (le *LiquidationEngine) generateSellOrders(account *AccountData, maxADVFrac
 
 		// for BUY
 		if pos.Side == model.SHORT {
-			risk_limit_price = roundToNearestTick(1.01*pos_market.FairPrice.InexactFloat64(), tick)
+			risk_limit_price = roundToNearestTick(1.01*refPrice, tick)
 
 			price1 = bestBid - tick
 			if price1 > risk_limit_price {
@@ -273,18 +291,6 @@ func roundDownToTick(size float64, tick float64) float64 {
 	return numTicks * tick
 }
 
-func roundUpToTick(size float64, tick float64) float64 {
-	if tick <= 0 {
-		return size
-	}
-	milliTicks := int(math.Round(size * 1000 / tick))
-	numTicks := float64(milliTicks / 1000)
-	if milliTicks%1000 > 0 {
-		numTicks += 1.0
-	}
-	return numTicks * tick
-}
-
 func roundToNearestTick(size float64, tick float64) float64 {
 	if tick <= 0 {
 		return size
@@ -301,93 +307,40 @@ func calcZp(pos *model.PositionData, margin float64) float64 {
 	}
 }
 
-type traderCapacity struct {
-	clawbackSize float64
-	remaining    float64
-}
-
+// consumes the ADL queue in rank order, each trader gives back up to its whole
+// position until the insurance position is covered
 func (le *LiquidationEngine) clawbackActions(
 	insurance *AccountData,
 	insurancePos *model.PositionData,
-	winningTraders map[uint]*model.PositionData) []model.Action {
+	queue []*AdlEntry) []model.Action {
 
 	min_order := insurance.Markets[insurancePos.MarketID].MinOrder.InexactFloat64()
+	zp := calcZp(insurancePos, insurance.Cache.AccountMargin.InexactFloat64())
+	d_price := tdecimal.NewDecimal(decimal.NewFromFloat(zp))
 
-	var totalRemaining float64
-	clawbackMap := make(map[uint]*traderCapacity)
-	var totalWinningSize float64
-	for _, traderPos := range winningTraders {
-		totalWinningSize += traderPos.Size.InexactFloat64()
-	}
 	deficit := insurancePos.Size.InexactFloat64()
-	for traderId, traderPos := range winningTraders {
+	insClawbacks := make([]model.Action, 0, len(queue))
+	for _, entry := range queue {
 		if deficit < min_order {
 			break
 		}
-		frac := traderPos.Size.InexactFloat64() / totalWinningSize
-		clawbackSize := roundToNearestTick(insurancePos.Size.InexactFloat64()*frac, min_order)
-		if clawbackSize > deficit {
-			clawbackSize = deficit
-		}
-		var remaining float64
-		if clawbackSize > traderPos.Size.InexactFloat64() {
-			clawbackSize = traderPos.Size.InexactFloat64()
-		} else {
-			remaining = traderPos.Size.InexactFloat64() - clawbackSize
-		}
-		if clawbackSize > 0.0 || remaining > 0.0 {
-			clawbackMap[traderId] = &traderCapacity{clawbackSize, remaining}
-			deficit -= clawbackSize
-			totalRemaining += remaining
-		}
-	}
-
-	if deficit >= min_order {
-		var remainingFrac float64
-		if totalRemaining <= deficit {
-			remainingFrac = 1.0
-		} else if totalRemaining > 0 {
-			remainingFrac = deficit / totalRemaining
-		}
-
-		for _, traderCapacity := range clawbackMap {
-			remainingFrac := roundUpToTick(traderCapacity.remaining*remainingFrac, min_order)
-			if remainingFrac > traderCapacity.remaining {
-				remainingFrac = traderCapacity.remaining
-			}
-
-			traderCapacity.clawbackSize += remainingFrac
-			traderCapacity.remaining -= remainingFrac
-			deficit -= remainingFrac
-
-			if deficit < min_order {
-				break
-			}
+		clawbackSize := roundDownToTick(math.Min(deficit, entry.Position.Size.InexactFloat64()), min_order)
+		if clawbackSize < min_order {
+			continue
 		}
-	}
 
-	zp := calcZp(insurancePos, insurance.Cache.AccountMargin.InexactFloat64())
-	insClawbacks := make([]model.Action, 0, len(winningTraders))
-	for traderId, traderCapacity := range clawbackMap {
-		if deficit >= min_order && traderCapacity.remaining >= min_order {
-			extra := math.Min(deficit, traderCapacity.remaining)
-			traderCapacity.clawbackSize += extra
-			traderCapacity.remaining -= extra
-			deficit -= extra
-		}
+		logrus.Infof(".... ADL clawback market_id=%s rank=%d trader_id=%d score=%f size=%f zp=%f",
+			insurancePos.MarketID, entry.Rank, entry.Position.ProfileID, entry.Score, clawbackSize, zp)
 
-		if traderCapacity.clawbackSize > 0.0 {
-			d_size := tdecimal.NewDecimal(decimal.NewFromFloat(traderCapacity.clawbackSize))
-			d_price := tdecimal.NewDecimal(decimal.NewFromFloat(zp))
-
-			insClawbacks = append(insClawbacks, model.Action{
-				Kind:     model.AInsClawback,
-				TraderId: traderId,
-				MarketId: insurancePos.MarketID,
-				Size:     *d_size,
-				Price:    *d_price,
-			})
-		}
+		d_size := tdecimal.NewDecimal(decimal.NewFromFloat(clawbackSize))
+		insClawbacks = append(insClawbacks, model.Action{
+			Kind:     model.AInsClawback,
+			TraderId: entry.Position.ProfileID,
+			MarketId: insurancePos.MarketID,
+			Size:     *d_size,
+			Price:    *d_price,
+		})
+		deficit -= clawbackSize
 	}
 
 	return insClawbacks
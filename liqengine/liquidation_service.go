@@ -45,6 +45,11 @@ func NewLiquidationService(insuranceId uint, assistant Assistant) *LiquidationSe
 	return &ls
 }
 
+// selects the liquidation mode of the markets, waterfall if not set
+func (ls *LiquidationService) SetConfig(config *Config) {
+	ls.engine = NewLiquidationEngine(config)
+}
+
 func (ls *LiquidationService) Run() context.CancelFunc {
 	ctx, cancelf := context.WithCancel(context.Background())
 	ticker := time.NewTicker(ls.checkInterval)
@@ -127,6 +132,17 @@ func (ls *LiquidationService) ProcessLiquidations(ctx context.Context) (uint, er
 			}
 
 			if ls.engine.belowLiquidationMargin(profile.AccountMargin.InexactFloat64()) {
+				// margin is not reliable while an index price is frozen, wait for the feed to recover
+				account, err = ls.assistant.GetAccountData(ctx, profile)
+				if err != nil {
+					logrus.WithField(log.AlertTag, log.AlertCrit).Errorf("Liquidation service, error getting account %d:\n%s", profile.ProfileID, err.Error())
+					continue
+				}
+				if degraded := account.CrossAccount().DegradedMarkets(); len(degraded) > 0 {
+					logrus.Warnf("Liquidation of profile %d postponed, price degraded in markets %v", profile.ProfileID, degraded)
+					continue
+				}
+
 				//TODO: can be replaced with CancelAllOrders (risky to do it now)
 				err = ls.assistant.WaitForCancellAllAccepted(ctx, profile.ProfileID)
 				if err != nil {
@@ -142,7 +158,7 @@ func (ls *LiquidationService) ProcessLiquidations(ctx context.Context) (uint, er
 					continue
 				}
 
-				actions, liquidatedVaults := ls.engine.requiredActions(account)
+				actions, liquidatedVaults := ls.engine.requiredActions(account.CrossAccount())
 
 				if len(actions) > 0 {
 					all_actions = append(all_actions, actions...)
@@ -163,9 +179,69 @@ func (ls *LiquidationService) ProcessLiquidations(ctx context.Context) (uint, er
 		logrus.Warnf(".... LIQ total=%d", total)
 		logrus.Warnf(".... for liquidation total=%d", total_liq)
 	}
+
+	all_actions = append(all_actions, ls.ProcessIsolatedLiquidations(ctx)...)
+
 	return total, nil, all_actions
 }
 
+// liquidates the positions of the isolated markets below the liquidation
+// margin, only the orders of the market are canceled and the rest of the
+// account is left as it is
+func (ls *LiquidationService) ProcessIsolatedLiquidations(ctx context.Context) []model.Action {
+	all_actions := make([]model.Action, 0)
+
+	batch, err := ls.assistant.GetIsolatedLiqBatch(ctx, LIQ_BATCH_LIMIT)
+	if err != nil {
+		logrus.WithField(log.AlertTag, log.AlertCrit).Error(err)
+		return all_actions
+	}
+
+	for _, isolated := range batch {
+		select {
+		case <-ctx.Done():
+			return all_actions
+		default:
+		}
+
+		if !ls.engine.belowLiquidationMargin(isolated.AccountMargin.InexactFloat64()) {
+			continue
+		}
+		logrus.Warnf("....profileId=%d market=%s isolated margin=%f equity=%f notional=%f", isolated.ProfileID, isolated.MarketID, isolated.AccountMargin.InexactFloat64(), isolated.Equity.InexactFloat64(), isolated.TotalNotional.InexactFloat64())
+
+		account, err := ls.assistant.GetIsolatedAccountData(ctx, isolated)
+		if err != nil {
+			logrus.WithField(log.AlertTag, log.AlertCrit).Errorf("Liquidation service, error getting isolated account %d %s:\n%s", isolated.ProfileID, isolated.MarketID, err.Error())
+			continue
+		}
+		if degraded := account.DegradedMarkets(); len(degraded) > 0 {
+			logrus.Warnf("Liquidation of profile %d isolated market %s postponed, price degraded", isolated.ProfileID, isolated.MarketID)
+			continue
+		}
+
+		err = ls.assistant.WaitForMarketCancelAccepted(ctx, isolated.ProfileID, isolated.MarketID)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+
+		account, err = ls.assistant.GetIsolatedAccountData(ctx, isolated)
+		if err != nil {
+			logrus.WithField(log.AlertTag, log.AlertCrit).Errorf("Liquidation service, error getting isolated account %d %s:\n%s", isolated.ProfileID, isolated.MarketID, err.Error())
+			continue
+		}
+
+		// vaults trade on cross margin, no vault is liquidated here
+		actions, _ := ls.engine.requiredActions(account)
+		if len(actions) > 0 {
+			all_actions = append(all_actions, actions...)
+			ls.assistant.Queue(ctx, actions)
+		}
+	}
+
+	return all_actions
+}
+
 func (ls *LiquidationService) CancelAllOrders(ctx context.Context, profile *model.ProfileCache) error {
 	err := ls.assistant.WaitForCancellAllAccepted(ctx, profile.ProfileID)
 	if err != nil {
@@ -183,7 +259,7 @@ func (ls *LiquidationService) QueueLiquidateActions(ctx context.Context, profile
 		return err
 	}
 
-	actions, liquidatedVaults := ls.engine.requiredActions(account)
+	actions, liquidatedVaults := ls.engine.requiredActions(account.CrossAccount())
 	if len(actions) > 0 {
 		ls.assistant.Queue(ctx, actions)
 	}
@@ -0,0 +1,443 @@
+package liqengine
+
+/*
+Liquidation dry run. A snapshot of markets, profiles and positions is shocked
+per market (fair, mark, index, book and last trade prices move by the same
+relative amount), accounts are re-priced the way the engine enricher does it and
+the liquidation and insurance services decisions are replayed on it without
+touching tarantool.
+
+Sell orders of waterfall1 are reported but not filled, takeovers of waterfall3
+move the positions to the insurance at the zero price. If the insurance account
+ends up below the clawback margin the winning traders that would be clawed back
+are reported, otherwise the insurance sell-off orders are.
+*/
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+// same bounds as LiquidationService.ProcessLiquidations and TntAssistant.ClawbackRequired
+const (
+	SIM_MARGIN_ERROR       = -0.1
+	SIM_CLAWBACK_MARGIN    = 0.001
+	SIM_OUTCOME_WATERFALL1 = "waterfall1"
+	SIM_OUTCOME_WATERFALL3 = "waterfall3"
+	SIM_OUTCOME_COMPLETED  = "completed"
+	SIM_OUTCOME_MARGIN_ERR = "margin_error"
+	SIM_OUTCOME_DEGRADED   = "price_degraded"
+)
+
+type Snapshot struct {
+	Timestamp   int64                 `json:"timestamp,omitempty"`
+	InsuranceId uint                  `json:"insurance_id"`
+	Markets     []*model.MarketData   `json:"markets"`
+	Profiles    []*model.ProfileCache `json:"profiles"`
+	Positions   []*model.PositionData `json:"positions"`
+}
+
+// relative price move per market, -0.1 is a 10% drop
+type PriceShocks map[string]float64
+
+type SimulatedAction struct {
+	Kind     string  `json:"kind"`
+	TraderId uint    `json:"trader_id"`
+	MarketId string  `json:"market_id"`
+	Size     float64 `json:"size"`
+	Price    float64 `json:"price"`
+}
+
+type SimulatedProfile struct {
+	ProfileId     uint    `json:"profile_id"`
+	ProfileType   string  `json:"profile_type"`
+	MarginBefore  float64 `json:"margin_before"`
+	Margin        float64 `json:"margin"`
+	AccountEquity float64 `json:"account_equity"`
+	TotalNotional float64 `json:"total_notional"`
+	Outcome       string  `json:"outcome"`
+}
+
+type SimulatedClawback struct {
+	SimulatedAction
+	Rank  int     `json:"rank"`
+	Score float64 `json:"score"`
+	Pnl   float64 `json:"pnl"`
+}
+
+type SimulatedInsurance struct {
+	ProfileId     uint    `json:"profile_id"`
+	EquityBefore  float64 `json:"equity_before"`
+	EquityShocked float64 `json:"equity_shocked"`
+	EquityAfter   float64 `json:"equity_after"`
+	Drawdown      float64 `json:"drawdown"`
+	Margin        float64 `json:"margin"`
+	Clawback      bool    `json:"clawback"`
+}
+
+type SimulationReport struct {
+	Timestamp        int64               `json:"timestamp,omitempty"`
+	Shocks           PriceShocks         `json:"shocks"`
+	Profiles         []SimulatedProfile  `json:"profiles"`
+	Actions          []SimulatedAction   `json:"actions"`
+	LiquidatedVaults []uint              `json:"liquidated_vaults"`
+	Insurance        SimulatedInsurance  `json:"insurance"`
+	Clawbacks        []SimulatedClawback `json:"clawbacks"`
+}
+
+// parses "BTC-USD=-0.1,ETH-USD=0.05"
+func ParsePriceShocks(value string) (PriceShocks, error) {
+	shocks := make(PriceShocks)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid price shock %q, expected MARKET=FRACTION", item)
+		}
+		shock, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid price shock %q: %v", item, err)
+		}
+		shocks[strings.TrimSpace(parts[0])] = shock
+	}
+	return shocks, nil
+}
+
+// Simulate replays the liquidation and insurance decisions on the shocked snapshot
+// with the liquidation modes of config (nil for the waterfall everywhere),
+// the snapshot itself is not modified
+func Simulate(snapshot *Snapshot, shocks PriceShocks, config *Config) (*SimulationReport, error) {
+	le := NewLiquidationEngine(config)
+
+	markets := make(map[string]*model.MarketData, len(snapshot.Markets))
+	shocked := make(map[string]*model.MarketData, len(snapshot.Markets))
+	for _, market := range snapshot.Markets {
+		markets[market.MarketID] = market
+		shocked[market.MarketID] = shockMarket(market, shocks[market.MarketID])
+	}
+	for marketId, shock := range shocks {
+		if _, ok := markets[marketId]; !ok {
+			return nil, fmt.Errorf("price shock for unknown market %s", marketId)
+		}
+		if shock <= -1.0 {
+			return nil, fmt.Errorf("price shock %f for market %s makes the price non positive", shock, marketId)
+		}
+	}
+
+	positions := make(map[uint][]*model.PositionData)
+	for _, pos := range snapshot.Positions {
+		if _, ok := markets[pos.MarketID]; !ok {
+			return nil, fmt.Errorf("position %s in unknown market %s", pos.PositionID, pos.MarketID)
+		}
+		posCopy := *pos
+		positions[pos.ProfileID] = append(positions[pos.ProfileID], &posCopy)
+	}
+
+	profiles := make([]*model.ProfileCache, 0, len(snapshot.Profiles))
+	var insurance *model.ProfileCache
+	for _, profile := range snapshot.Profiles {
+		profileCopy := simProfile(profile)
+		if profileCopy.ProfileID == snapshot.InsuranceId || *profileCopy.ProfileType == model.PROFILE_TYPE_INSURANCE {
+			if insurance != nil && insurance.ProfileID != profileCopy.ProfileID {
+				return nil, fmt.Errorf("more than one insurance profile in snapshot: %d and %d", insurance.ProfileID, profileCopy.ProfileID)
+			}
+			insurance = profileCopy
+			continue
+		}
+		profiles = append(profiles, profileCopy)
+	}
+	if insurance == nil {
+		return nil, fmt.Errorf("no insurance profile in snapshot")
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].ProfileID < profiles[j].ProfileID })
+
+	report := &SimulationReport{
+		Timestamp:        snapshot.Timestamp,
+		Shocks:           shocks,
+		Profiles:         make([]SimulatedProfile, 0),
+		Actions:          make([]SimulatedAction, 0),
+		LiquidatedVaults: make([]uint, 0),
+		Clawbacks:        make([]SimulatedClawback, 0),
+	}
+
+	insuranceBalance := decimalOrZero(insurance.Balance).InexactFloat64()
+	report.Insurance.ProfileId = insurance.ProfileID
+	report.Insurance.EquityBefore, _, _ = accountTotals(insuranceBalance, positions[insurance.ProfileID], markets)
+	report.Insurance.EquityShocked, _, _ = accountTotals(insuranceBalance, positions[insurance.ProfileID], shocked)
+
+	for _, profile := range profiles {
+		marginBefore := decimalOrZero(profile.AccountMargin).InexactFloat64()
+		account := repriceAccount(profile, positions[profile.ProfileID], shocked)
+		margin := account.Cache.AccountMargin.InexactFloat64()
+
+		if margin >= LIQUIDATION_MARGIN && !le.isLiquidationEnding(account.Cache) {
+			continue
+		}
+
+		result := SimulatedProfile{
+			ProfileId:     profile.ProfileID,
+			ProfileType:   *profile.ProfileType,
+			MarginBefore:  marginBefore,
+			Margin:        margin,
+			AccountEquity: account.Cache.AccountEquity.InexactFloat64(),
+			TotalNotional: account.Cache.TotalNotional.InexactFloat64(),
+		}
+
+		// the wait of shouldLiquidationHaveMoreTime is not replayed,
+		// the report shows what is queued once the profile is due
+		switch {
+		case le.isLiquidationEnding(account.Cache):
+			result.Outcome = SIM_OUTCOME_COMPLETED
+		case margin < SIM_MARGIN_ERROR:
+			result.Outcome = SIM_OUTCOME_MARGIN_ERR
+		case len(account.DegradedMarkets()) > 0:
+			result.Outcome = SIM_OUTCOME_DEGRADED
+		default:
+			actions, liquidatedVaults := le.requiredActions(account)
+			result.Outcome = SIM_OUTCOME_WATERFALL1
+			if margin < TAKEOVER_MARGIN {
+				result.Outcome = SIM_OUTCOME_WATERFALL3
+			}
+			for _, action := range actions {
+				report.Actions = append(report.Actions, simAction(action))
+				if action.Kind == model.AInsTakeover {
+					insuranceBalance += takeOver(insurance.ProfileID, positions, action)
+				}
+			}
+			report.LiquidatedVaults = append(report.LiquidatedVaults, liquidatedVaults...)
+		}
+		report.Profiles = append(report.Profiles, result)
+	}
+
+	insurance.Balance = simDecimal(insuranceBalance)
+	insuranceAccount := repriceAccount(insurance, positions[insurance.ProfileID], shocked)
+	report.Insurance.EquityAfter = insuranceAccount.Cache.AccountEquity.InexactFloat64()
+	report.Insurance.Drawdown = report.Insurance.EquityBefore - report.Insurance.EquityAfter
+	report.Insurance.Margin = insuranceAccount.Cache.AccountMargin.InexactFloat64()
+	// inv3 is not replayed, only the insurance margin part of ClawbackRequired
+	report.Insurance.Clawback = report.Insurance.Margin <= SIM_CLAWBACK_MARGIN
+
+	if !report.Insurance.Clawback {
+		for _, action := range le.insuranceSelloffActions(insuranceAccount.WithoutDegradedMarkets()) {
+			report.Actions = append(report.Actions, simAction(action))
+		}
+		return report, nil
+	}
+
+	equities := make(map[uint]float64, len(profiles))
+	for _, profile := range profiles {
+		equities[profile.ProfileID] = profile.AccountEquity.InexactFloat64()
+	}
+
+	insurancePositions := insuranceAccount.Positions
+	sort.Slice(insurancePositions, func(i, j int) bool { return insurancePositions[i].MarketID < insurancePositions[j].MarketID })
+	for _, insurancePos := range insurancePositions {
+		if shocked[insurancePos.MarketID].IsPriceDegraded() {
+			continue
+		}
+		zeroPrice := calcZp(insurancePos, report.Insurance.Margin)
+		queue := simAdlQueue(positions, equities, insurance.ProfileID, insurancePos.MarketID, FlipSide(insurancePos.Side), zeroPrice)
+		entries := make(map[uint]*AdlEntry, len(queue))
+		for _, entry := range queue {
+			entries[entry.Position.ProfileID] = entry
+		}
+		// in ADL queue order
+		for _, action := range le.clawbackActions(insuranceAccount, insurancePos, queue) {
+			entry := entries[action.TraderId]
+			report.Clawbacks = append(report.Clawbacks, SimulatedClawback{
+				SimulatedAction: simAction(action),
+				Rank:            entry.Rank,
+				Score:           entry.Score,
+				Pnl: calcUnrealizedPnl(action.Size.InexactFloat64(), entry.Position.EntryPrice.InexactFloat64(),
+					action.Price.InexactFloat64(), entry.Position.Side),
+			})
+		}
+	}
+	return report, nil
+}
+
+func shockMarket(market *model.MarketData, shock float64) *model.MarketData {
+	shockedMarket := *market
+	if shock == 0 {
+		return &shockedMarket
+	}
+	factor := decimal.NewFromFloat(1.0 + shock)
+	shockPrice := func(price *tdecimal.Decimal) *tdecimal.Decimal {
+		if price == nil {
+			return nil
+		}
+		return tdecimal.NewDecimal(price.Mul(factor))
+	}
+	shockedMarket.FairPrice = shockPrice(market.FairPrice)
+	shockedMarket.MarkPrice = shockPrice(market.MarkPrice)
+	shockedMarket.IndexPrice = shockPrice(market.IndexPrice)
+	shockedMarket.MarketPrice = shockPrice(market.MarketPrice)
+	shockedMarket.LastTradePrice = shockPrice(market.LastTradePrice)
+	shockedMarket.BestBid = shockPrice(market.BestBid)
+	shockedMarket.BestAsk = shockPrice(market.BestAsk)
+	return &shockedMarket
+}
+
+// equity, notional and margin like profile/cache.lua computes them from the fair price
+func accountTotals(balance float64, positions []*model.PositionData, markets map[string]*model.MarketData) (float64, float64, float64) {
+	var cumUnrealizedPnl, totalNotional float64
+	for _, pos := range positions {
+		fairPrice := decimalOrZero(markets[pos.MarketID].FairPrice).InexactFloat64()
+		cumUnrealizedPnl += calcUnrealizedPnl(pos.Size.InexactFloat64(), pos.EntryPrice.InexactFloat64(), fairPrice, pos.Side)
+		totalNotional += pos.Size.InexactFloat64() * fairPrice
+	}
+	equity := balance + cumUnrealizedPnl
+	margin := 1.0
+	if totalNotional != 0 {
+		margin = equity / totalNotional
+	}
+	return equity, totalNotional, margin
+}
+
+func repriceAccount(profile *model.ProfileCache, positions []*model.PositionData, markets map[string]*model.MarketData) *AccountData {
+	balance := decimalOrZero(profile.Balance).InexactFloat64()
+	equity, totalNotional, margin := accountTotals(balance, positions, markets)
+
+	var cumUnrealizedPnl float64
+	for _, pos := range positions {
+		fairPrice := decimalOrZero(markets[pos.MarketID].FairPrice)
+		pnl := calcUnrealizedPnl(pos.Size.InexactFloat64(), pos.EntryPrice.InexactFloat64(), fairPrice.InexactFloat64(), pos.Side)
+		cumUnrealizedPnl += pnl
+		pos.FairPrice = fairPrice
+		pos.UnrealizedPnlFair = simDecimal(pnl)
+		pos.NotionalFair = simDecimal(pos.Size.InexactFloat64() * fairPrice.InexactFloat64())
+	}
+
+	profile.AccountEquity = simDecimal(equity)
+	profile.TotalNotional = simDecimal(totalNotional)
+	profile.AccountMargin = simDecimal(margin)
+	profile.CumUnrealizedPnl = simDecimal(cumUnrealizedPnl)
+	return &AccountData{
+		Cache:     profile,
+		Positions: positions,
+		Markets:   markets,
+	}
+}
+
+// moves the trader position to the insurance at the action price,
+// returns the pnl the insurance realizes against its opposite position
+func takeOver(insuranceId uint, positions map[uint][]*model.PositionData, action model.Action) float64 {
+	traderPositions := positions[action.TraderId]
+	var traderPos *model.PositionData
+	for i, pos := range traderPositions {
+		if pos.MarketID == action.MarketId {
+			traderPos = pos
+			positions[action.TraderId] = append(traderPositions[:i:i], traderPositions[i+1:]...)
+			break
+		}
+	}
+	if traderPos == nil {
+		return 0
+	}
+
+	size := action.Size.InexactFloat64()
+	price := action.Price.InexactFloat64()
+	for i, insurancePos := range positions[insuranceId] {
+		if insurancePos.MarketID != action.MarketId {
+			continue
+		}
+		insuranceSize := insurancePos.Size.InexactFloat64()
+		insuranceEntry := insurancePos.EntryPrice.InexactFloat64()
+		if insurancePos.Side == traderPos.Side {
+			entry := (insuranceSize*insuranceEntry + size*price) / (insuranceSize + size)
+			insurancePos.Size = *simDecimal(insuranceSize + size)
+			insurancePos.EntryPrice = *simDecimal(entry)
+			return 0
+		}
+
+		realized := calcUnrealizedPnl(math.Min(size, insuranceSize), insuranceEntry, price, insurancePos.Side)
+		switch {
+		case size < insuranceSize:
+			insurancePos.Size = *simDecimal(insuranceSize - size)
+		case size == insuranceSize:
+			insurancePositions := positions[insuranceId]
+			positions[insuranceId] = append(insurancePositions[:i:i], insurancePositions[i+1:]...)
+		default:
+			insurancePos.Side = traderPos.Side
+			insurancePos.Size = *simDecimal(size - insuranceSize)
+			insurancePos.EntryPrice = action.Price
+		}
+		return realized
+	}
+
+	positions[insuranceId] = append(positions[insuranceId], &model.PositionData{
+		PositionID: fmt.Sprintf("sim-%s-%d", action.MarketId, insuranceId),
+		MarketID:   action.MarketId,
+		ProfileID:  insuranceId,
+		Size:       action.Size,
+		Side:       traderPos.Side,
+		EntryPrice: action.Price,
+	})
+	return 0
+}
+
+// same selection as TntAssistant.GetAdlQueue on top of GetWinningPositions
+func simAdlQueue(positions map[uint][]*model.PositionData, equities map[uint]float64, insuranceId uint, marketId string, side string, atPrice float64) []*AdlEntry {
+	winning := make([]*model.PositionData, 0)
+	for traderId, traderPositions := range positions {
+		if traderId == insuranceId {
+			continue
+		}
+		for _, pos := range traderPositions {
+			if pos.MarketID != marketId || pos.Side != side || pos.UnrealizedPnlFair == nil || !pos.UnrealizedPnlFair.IsPositive() {
+				continue
+			}
+			winning = append(winning, pos)
+		}
+	}
+	return RankAdlQueue(winning, equities, atPrice)
+}
+
+func simProfile(profile *model.ProfileCache) *model.ProfileCache {
+	profileCopy := *profile
+	if profileCopy.ProfileType == nil {
+		profileType := model.PROFILE_TYPE_TRADER
+		profileCopy.ProfileType = &profileType
+	}
+	if profileCopy.Status == nil {
+		status := model.PROFILE_STATUS_ACTIVE
+		profileCopy.Status = &status
+	}
+	if profileCopy.LastLiqCheck == nil {
+		var lastLiqCheck int64
+		profileCopy.LastLiqCheck = &lastLiqCheck
+	}
+	return &profileCopy
+}
+
+func simAction(action model.Action) SimulatedAction {
+	return SimulatedAction{
+		Kind:     action.Kind.Description(),
+		TraderId: action.TraderId,
+		MarketId: action.MarketId,
+		Size:     action.Size.InexactFloat64(),
+		Price:    action.Price.InexactFloat64(),
+	}
+}
+
+func simDecimal(value float64) *tdecimal.Decimal {
+	return tdecimal.NewDecimal(decimal.NewFromFloat(value))
+}
+
+func decimalOrZero(value *tdecimal.Decimal) *tdecimal.Decimal {
+	if value == nil {
+		return tdecimal.NewDecimal(decimal.Zero)
+	}
+	return value
+}
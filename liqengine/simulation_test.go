@@ -0,0 +1,122 @@
+package liqengine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestParsePriceShocks(t *testing.T) {
+	logrus.Warn(".......TestParsePriceShocks")
+	shocks, err := ParsePriceShocks("BTC-USD=-0.1, ETH-USD=0.05")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(shocks) != 2 || shocks["BTC-USD"] != -0.1 || shocks["ETH-USD"] != 0.05 {
+		t.Fatalf("Unexpected shocks %v", shocks)
+	}
+	if _, err = ParsePriceShocks("BTC-USD"); err == nil {
+		t.Fatalf("Expected error for a shock without value")
+	}
+}
+
+func TestSimulateWithoutShock(t *testing.T) {
+	logrus.Warn(".......TestSimulateWithoutShock")
+	snapshot, err := LoadSnapshotFile("testdata/snapshot.json")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	report, err := Simulate(snapshot, PriceShocks{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(report.Profiles) != 0 || len(report.Actions) != 0 || len(report.Clawbacks) != 0 {
+		t.Fatalf("Expected no liquidations but got %+v", report)
+	}
+	if report.Insurance.Drawdown != 0 || report.Insurance.Clawback {
+		t.Fatalf("Expected untouched insurance but got %+v", report.Insurance)
+	}
+}
+
+func TestSimulatePriceShock(t *testing.T) {
+	logrus.Warn(".......TestSimulatePriceShock")
+	snapshot, err := LoadSnapshotFile("testdata/snapshot.json")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	report, err := Simulate(snapshot, PriceShocks{"BTC-USD": -0.1}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// 10 is bankrupt and taken over, 11 is sold on the market, 20 and 21 are healthy
+	if len(report.Profiles) != 2 {
+		t.Fatalf("Expected 2 liquidated profiles but got %+v", report.Profiles)
+	}
+	if report.Profiles[0].ProfileId != 10 || report.Profiles[0].Outcome != SIM_OUTCOME_WATERFALL3 {
+		t.Fatalf("Expected profile 10 in waterfall3 but got %+v", report.Profiles[0])
+	}
+	if report.Profiles[1].ProfileId != 11 || report.Profiles[1].Outcome != SIM_OUTCOME_WATERFALL1 {
+		t.Fatalf("Expected profile 11 in waterfall1 but got %+v", report.Profiles[1])
+	}
+
+	var takeovers, sellOrders int
+	for _, action := range report.Actions {
+		switch action.Kind {
+		case model.AInsTakeover.Description():
+			takeovers++
+			// zero price of equity -1000 on 27000 notional
+			if action.TraderId != 10 || action.Size != 1.0 || !almostEqual(action.Price, 28000.0) {
+				t.Fatalf("Unexpected takeover %+v", action)
+			}
+		case model.APlaceSellOrders.Description():
+			sellOrders++
+			if action.TraderId != 11 || action.MarketId != "BTC-USD" {
+				t.Fatalf("Unexpected sell order %+v", action)
+			}
+		}
+	}
+	if takeovers != 1 || sellOrders != 4 {
+		t.Fatalf("Expected 1 takeover and 4 sell orders but got %+v", report.Actions)
+	}
+
+	if report.Insurance.EquityBefore != 1000.0 || !almostEqual(report.Insurance.EquityAfter, 0.0) || !almostEqual(report.Insurance.Drawdown, 1000.0) {
+		t.Fatalf("Expected insurance drawdown 1000 but got %+v", report.Insurance)
+	}
+	if !report.Insurance.Clawback {
+		t.Fatalf("Expected clawback of the insurance but got %+v", report.Insurance)
+	}
+
+	if len(report.Clawbacks) != 1 {
+		t.Fatalf("Expected a single clawback but got %+v", report.Clawbacks)
+	}
+	clawback := report.Clawbacks[0]
+	if clawback.TraderId != 20 || clawback.Size != 1.0 || !almostEqual(clawback.Price, 27000.0) || !almostEqual(clawback.Pnl, 3000.0) {
+		t.Fatalf("Unexpected clawback %+v", clawback)
+	}
+
+	// the snapshot is left untouched for the next run
+	if snapshot.Positions[0].FairPrice != nil || snapshot.Profiles[0].AccountEquity != nil {
+		t.Fatalf("Expected the snapshot not to be modified")
+	}
+}
+
+func TestSimulateUnknownMarket(t *testing.T) {
+	logrus.Warn(".......TestSimulateUnknownMarket")
+	snapshot, err := LoadSnapshotFile("testdata/snapshot.json")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err = Simulate(snapshot, PriceShocks{"SOL-USD": -0.1}, nil); err == nil {
+		t.Fatalf("Expected error for a shock of an unknown market")
+	}
+}
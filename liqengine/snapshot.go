@@ -0,0 +1,246 @@
+package liqengine
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+func LoadSnapshotFile(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read snapshot error")
+	}
+	snapshot := &Snapshot{}
+	if err = json.Unmarshal(data, snapshot); err != nil {
+		return nil, errors.Wrap(err, "parse snapshot error")
+	}
+	return snapshot, nil
+}
+
+// LoadTimescaleSnapshot builds the snapshot archived at or before timestamp (microseconds):
+// the last market and position snapshots of every shard and the last cache of the profiles
+// holding positions and of the insurance
+func LoadTimescaleSnapshot(ctx context.Context, db *pgxpool.Pool, timestamp int64) (*Snapshot, error) {
+	snapshot := &Snapshot{Timestamp: timestamp}
+
+	var err error
+	snapshot.Markets, err = loadArchivedMarkets(ctx, db, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Positions, err = loadArchivedPositions(ctx, db, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	profileIds := make([]int64, 0)
+	seen := make(map[uint]bool)
+	for _, pos := range snapshot.Positions {
+		if !seen[pos.ProfileID] {
+			seen[pos.ProfileID] = true
+			profileIds = append(profileIds, int64(pos.ProfileID))
+		}
+	}
+	snapshot.Profiles, err = loadArchivedProfiles(ctx, db, timestamp, profileIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range snapshot.Profiles {
+		if *profile.ProfileType == model.PROFILE_TYPE_INSURANCE {
+			snapshot.InsuranceId = profile.ProfileID
+		}
+	}
+	return snapshot, nil
+}
+
+func loadArchivedMarkets(ctx context.Context, db *pgxpool.Pool, timestamp int64) ([]*model.MarketData, error) {
+	q := `SELECT DISTINCT ON (m.id)
+			m.id,
+			m.status,
+			m.min_initial_margin,
+			m.forced_margin,
+			m.liquidation_margin,
+			m.min_tick,
+			m.min_order,
+			m.best_bid,
+			m.best_ask,
+			m.market_price,
+			m.index_price,
+			m.last_trade_price,
+			m.fair_price,
+			m.average_daily_volume_q,
+			m.mark_price,
+			m.mark_price_usage,
+			m.price_degraded
+			FROM app_market as m
+			WHERE m.archive_timestamp <= @timestamp
+			ORDER BY m.id, m.archive_timestamp DESC;`
+
+	rows, err := db.Query(ctx, q, pgx.NamedArgs{"timestamp": timestamp})
+	if err != nil {
+		return nil, errors.Wrap(err, "query markets error")
+	}
+	defer rows.Close()
+
+	markets := make([]*model.MarketData, 0)
+	for rows.Next() {
+		var status string
+		var prices [12]decimal.Decimal
+		var markPrice decimal.NullDecimal
+		var markPriceUsage []string
+		var priceDegraded *bool
+		market := &model.MarketData{}
+		err = rows.Scan(
+			&market.MarketID,
+			&status,
+			&prices[0], &prices[1], &prices[2], &prices[3], &prices[4],
+			&prices[5], &prices[6], &prices[7], &prices[8], &prices[9], &prices[10], &prices[11],
+			&markPrice,
+			&markPriceUsage,
+			&priceDegraded)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan market error")
+		}
+
+		market.Status = &status
+		for i, field := range []**tdecimal.Decimal{
+			&market.MinInitialMargin, &market.ForcedMargin, &market.LiquidationMargin, &market.MinTick, &market.MinOrder,
+			&market.BestBid, &market.BestAsk, &market.MarketPrice, &market.IndexPrice, &market.LastTradePrice, &market.FairPrice,
+			&market.AverageDailyVolumeQ,
+		} {
+			*field = tdecimal.NewDecimal(prices[i])
+		}
+		if markPrice.Valid {
+			market.MarkPrice = tdecimal.NewDecimal(markPrice.Decimal)
+		}
+		market.MarkPriceUsage = markPriceUsage
+		market.PriceDegraded = priceDegraded != nil && *priceDegraded
+		markets = append(markets, market)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows markets error")
+	}
+	return markets, nil
+}
+
+// a shard without positions archives no rows, its older snapshot is then used
+func loadArchivedPositions(ctx context.Context, db *pgxpool.Pool, timestamp int64) ([]*model.PositionData, error) {
+	q := `SELECT
+			p.id,
+			p.market_id,
+			p.profile_id,
+			p.size,
+			p.side,
+			p.entry_price,
+			p.fair_price
+			FROM app_position as p
+			JOIN (
+				SELECT shard_id, max(archive_timestamp) as archive_timestamp
+				FROM app_position
+				WHERE archive_timestamp <= @timestamp
+				GROUP BY shard_id
+			) as s ON s.shard_id = p.shard_id AND s.archive_timestamp = p.archive_timestamp
+			ORDER BY p.profile_id, p.market_id;`
+
+	rows, err := db.Query(ctx, q, pgx.NamedArgs{"timestamp": timestamp})
+	if err != nil {
+		return nil, errors.Wrap(err, "query positions error")
+	}
+	defer rows.Close()
+
+	positions := make([]*model.PositionData, 0)
+	for rows.Next() {
+		var profileId int64
+		var size, entryPrice, fairPrice decimal.Decimal
+		pos := &model.PositionData{}
+		err = rows.Scan(
+			&pos.PositionID,
+			&pos.MarketID,
+			&profileId,
+			&size,
+			&pos.Side,
+			&entryPrice,
+			&fairPrice)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan position error")
+		}
+		pos.ProfileID = uint(profileId)
+		pos.Size = *tdecimal.NewDecimal(size)
+		pos.EntryPrice = *tdecimal.NewDecimal(entryPrice)
+		pos.FairPrice = tdecimal.NewDecimal(fairPrice)
+		positions = append(positions, pos)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows positions error")
+	}
+	return positions, nil
+}
+
+func loadArchivedProfiles(ctx context.Context, db *pgxpool.Pool, timestamp int64, profileIds []int64) ([]*model.ProfileCache, error) {
+	q := `SELECT DISTINCT ON (c.id)
+			c.id,
+			c.profile_type,
+			c.status,
+			c.balance,
+			c.account_equity,
+			c.total_notional,
+			c.account_margin,
+			c.last_liq_check
+			FROM app_profile_cache as c
+			WHERE c.archive_timestamp <= @timestamp
+			AND (c.id = ANY(@ids) OR c.profile_type = @insurance)
+			ORDER BY c.id, c.archive_timestamp DESC;`
+
+	args := pgx.NamedArgs{
+		"timestamp": timestamp,
+		"ids":       profileIds,
+		"insurance": model.PROFILE_TYPE_INSURANCE,
+	}
+	rows, err := db.Query(ctx, q, args)
+	if err != nil {
+		return nil, errors.Wrap(err, "query profiles error")
+	}
+	defer rows.Close()
+
+	profiles := make([]*model.ProfileCache, 0)
+	for rows.Next() {
+		var profileId, lastLiqCheck int64
+		var profileType, status string
+		var balance, accountEquity, totalNotional, accountMargin decimal.Decimal
+		err = rows.Scan(
+			&profileId,
+			&profileType,
+			&status,
+			&balance,
+			&accountEquity,
+			&totalNotional,
+			&accountMargin,
+			&lastLiqCheck)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan profile error")
+		}
+		profiles = append(profiles, &model.ProfileCache{
+			ProfileID:     uint(profileId),
+			ProfileType:   &profileType,
+			Status:        &status,
+			Balance:       tdecimal.NewDecimal(balance),
+			AccountEquity: tdecimal.NewDecimal(accountEquity),
+			TotalNotional: tdecimal.NewDecimal(totalNotional),
+			AccountMargin: tdecimal.NewDecimal(accountMargin),
+			LastLiqCheck:  &lastLiqCheck,
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows profiles error")
+	}
+	return profiles, nil
+}
@@ -84,6 +84,17 @@ func (ta *TntAssistant) GetAccountData(ctx context.Context, profile *model.Profi
 	data.Positions = positions
 	data.Markets = make(map[string]*model.MarketData)
 
+	isolatedMargins, err := ta.apiModel.GetIsolatedMargins(ctx, profile.ProfileID)
+	if err != nil {
+		return nil, err
+	}
+	if len(isolatedMargins) > 0 {
+		data.Isolated = make(map[string]*model.IsolatedMargin)
+		for _, isolated := range isolatedMargins {
+			data.Isolated[isolated.MarketID] = isolated
+		}
+	}
+
 	for _, pos := range positions {
 		marketData, err := ta.apiModel.GetMarketData(ctx, pos.MarketID)
 		if err != nil {
@@ -120,30 +131,38 @@ func (ta *TntAssistant) ClawbackRequired(ctx context.Context) bool {
 	return true
 }
 
-func (ta *TntAssistant) GetWinningTraderPostns(ctx context.Context,
+// ADL queue of the positions on side that are profitable at atPrice
+func (ta *TntAssistant) GetAdlQueue(ctx context.Context,
 	marketId string,
 	side string,
 	atPrice float64,
-	insuranceId uint) (map[uint]*model.PositionData, error) {
+	insuranceId uint) ([]*AdlEntry, error) {
 
 	winPositions, err := ta.apiModel.GetWinningPositions(ctx, marketId, side)
 	if err != nil {
 		return nil, err
 	}
-	winningPositions := make(map[uint]*model.PositionData)
+
+	positions := make([]*model.PositionData, 0, len(winPositions))
+	equities := make(map[uint]float64)
 	for _, modelPos := range winPositions {
-		traderId := uint(modelPos.ProfileID)
-		if traderId == insuranceId {
+		if modelPos.ProfileID == insuranceId || modelPos.MarketID != marketId {
 			continue
 		}
-
-		pnl := calcUnrealizedPnl(modelPos.Size.InexactFloat64(), modelPos.EntryPrice.InexactFloat64(), atPrice, modelPos.Side)
-		if pnl <= 0 {
+		if calcUnrealizedPnl(modelPos.Size.InexactFloat64(), modelPos.EntryPrice.InexactFloat64(), atPrice, modelPos.Side) <= 0 {
 			continue
 		}
-		winningPositions[traderId] = modelPos
+
+		if _, ok := equities[modelPos.ProfileID]; !ok {
+			cache, err := ta.apiModel.GetProfileCache(ctx, modelPos.ProfileID)
+			if err != nil {
+				return nil, err
+			}
+			equities[modelPos.ProfileID] = cache.AccountEquity.InexactFloat64()
+		}
+		positions = append(positions, modelPos)
 	}
-	return winningPositions, nil
+	return RankAdlQueue(positions, equities, atPrice), nil
 }
 
 func (ta *TntAssistant) GetNextLiquidationServiceId() ServiceId {
@@ -179,6 +198,53 @@ func (ta *TntAssistant) WaitForCancellAllAccepted(ctx context.Context, traderId
 	}
 }
 
+func (ta *TntAssistant) GetIsolatedLiqBatch(ctx context.Context, limit int) ([]*model.IsolatedMargin, error) {
+	return ta.apiModel.IsolatedLiquidationBatch(ctx, limit)
+}
+
+func (ta *TntAssistant) GetIsolatedAccountData(ctx context.Context, isolated *model.IsolatedMargin) (*AccountData, error) {
+	cache, err := ta.apiModel.GetProfileCache(ctx, isolated.ProfileID)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := ta.GetAccountData(ctx, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	// the fresher margin, read with the positions
+	if current, ok := account.Isolated[isolated.MarketID]; ok {
+		isolated = current
+	}
+
+	return account.IsolatedAccount(isolated), nil
+}
+
+func (ta *TntAssistant) WaitForMarketCancelAccepted(ctx context.Context, traderId uint, marketId string) error {
+	err := ta.apiModel.HighPriorityCancelMarket(ctx, traderId, marketId, true)
+	if err != nil {
+		return err
+	}
+
+	attempts := 0
+	for {
+		is_accepted, err := ta.apiModel.IsMarketCancelAccepted(ctx, traderId, marketId)
+		if err != nil {
+			logrus.WithField(log.AlertTag, log.AlertCrit).Error(err)
+		} else {
+			if is_accepted {
+				return nil
+			}
+		}
+		attempts += 1
+		if attempts > 20 {
+			return errors.New("WaitForMarketCancelAccepted exceed 20 attempts")
+		}
+		time.Sleep(WAIT_CANCEL_ALL_INTERVAL)
+	}
+}
+
 // TODO: done it for prod use case
 func (ta *TntAssistant) GetOrCreateInsurance(ctx context.Context) (uint, error) {
 
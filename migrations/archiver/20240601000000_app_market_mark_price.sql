@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE app_market ADD COLUMN IF NOT EXISTS mark_price NUMERIC;
+ALTER TABLE app_market ADD COLUMN IF NOT EXISTS mark_price_usage JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE app_market DROP COLUMN IF EXISTS mark_price;
+ALTER TABLE app_market DROP COLUMN IF EXISTS mark_price_usage;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- insurance fund inflows/outflows, deposits come from the profile shard,
+-- liquidation fees, takeover pnl and clawbacks from the market shards
+CREATE TABLE IF NOT EXISTS app_insurance_ledger (
+  id                   TEXT      NOT NULL,
+  insurance_id         BIGINT    NOT NULL,
+  profile_id           BIGINT    NOT NULL,
+  market_id            TEXT      NOT NULL,
+  kind                 TEXT      NOT NULL,
+  amount               NUMERIC   NOT NULL,
+  ref_id               TEXT      NOT NULL,
+  timestamp            BIGINT    NOT NULL,
+  shard_id             TEXT      NOT NULL,
+  archive_id           BIGINT    NOT NULL,
+  archive_timestamp    BIGINT    NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS app_insurance_ledger_id_idx
+  ON app_insurance_ledger(id, timestamp);
+
+CREATE INDEX IF NOT EXISTS app_insurance_ledger_market_id_kind_idx
+  ON app_insurance_ledger(market_id, kind, timestamp);
+
+CREATE INDEX IF NOT EXISTS app_insurance_ledger_profile_id_idx
+  ON app_insurance_ledger(profile_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS app_insurance_ledger_shard_id_archive_id_idx
+  ON app_insurance_ledger(shard_id, archive_id, timestamp);
+
+SELECT create_hypertable('app_insurance_ledger', 'timestamp',
+  chunk_time_interval => 86400000000,
+  if_not_exists       => TRUE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS app_insurance_ledger;
+-- +goose StatementEnd
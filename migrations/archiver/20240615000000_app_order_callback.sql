@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- trailing stop callback, nullable as in order_fields
+ALTER TABLE app_order
+    ADD COLUMN IF NOT EXISTS callback_value   NUMERIC,
+    ADD COLUMN IF NOT EXISTS callback_percent NUMERIC;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE app_order
+    DROP COLUMN IF EXISTS callback_value,
+    DROP COLUMN IF EXISTS callback_percent;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- oco/bracket membership, empty for standalone orders
+ALTER TABLE app_order
+    ADD COLUMN IF NOT EXISTS group_id   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS group_type TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS app_order_group_id_idx ON app_order (group_id) WHERE group_id <> '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS app_order_group_id_idx;
+ALTER TABLE app_order
+    DROP COLUMN IF EXISTS group_id,
+    DROP COLUMN IF EXISTS group_type;
+-- +goose StatementEnd
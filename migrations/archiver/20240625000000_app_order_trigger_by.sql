@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- price stream of conditional orders (mark, last, index), empty is mark
+ALTER TABLE app_order
+    ADD COLUMN IF NOT EXISTS trigger_by TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE app_order
+    DROP COLUMN IF EXISTS trigger_by;
+-- +goose StatementEnd
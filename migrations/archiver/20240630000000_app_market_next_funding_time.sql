@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE app_market ADD COLUMN IF NOT EXISTS next_funding_time BIGINT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE app_market DROP COLUMN IF EXISTS next_funding_time;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- funding debits (negative amount) and credits of the positions,
+-- one per profile for each funding_time the rate was paid for
+CREATE TABLE IF NOT EXISTS app_funding_payment (
+  id                   TEXT      NOT NULL,
+  profile_id           BIGINT    NOT NULL,
+  market_id            TEXT      NOT NULL,
+  side                 TEXT      NOT NULL,
+  size                 NUMERIC   NOT NULL,
+  price                NUMERIC   NOT NULL,
+  rate                 NUMERIC   NOT NULL,
+  amount               NUMERIC   NOT NULL,
+  funding_time         BIGINT    NOT NULL,
+  timestamp            BIGINT    NOT NULL,
+  shard_id             TEXT      NOT NULL,
+  archive_id           BIGINT    NOT NULL,
+  archive_timestamp    BIGINT    NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS app_funding_payment_id_idx
+  ON app_funding_payment(id, timestamp);
+
+CREATE INDEX IF NOT EXISTS app_funding_payment_profile_id_market_id_idx
+  ON app_funding_payment(profile_id, market_id, timestamp);
+
+CREATE UNIQUE INDEX IF NOT EXISTS app_funding_payment_shard_id_archive_id_idx
+  ON app_funding_payment(shard_id, archive_id, timestamp);
+
+SELECT create_hypertable('app_funding_payment', 'timestamp',
+  chunk_time_interval => 86400000000,
+  if_not_exists       => TRUE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS app_funding_payment;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- fills of liquidated profiles from the market shards, side is the side of
+-- the liquidated profile fill, kind is orderbook or takeover
+CREATE TABLE IF NOT EXISTS app_liquidation (
+  id                   TEXT      NOT NULL,
+  market_id            TEXT      NOT NULL,
+  profile_id           BIGINT    NOT NULL,
+  timestamp            BIGINT    NOT NULL,
+  price                NUMERIC   NOT NULL,
+  size                 NUMERIC   NOT NULL,
+  side                 TEXT      NOT NULL,
+  kind                 TEXT      NOT NULL,
+  shard_id             TEXT      NOT NULL,
+  archive_id           BIGINT    NOT NULL,
+  archive_timestamp    BIGINT    NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS app_liquidation_id_idx
+  ON app_liquidation(id, timestamp);
+
+CREATE INDEX IF NOT EXISTS app_liquidation_market_id_idx
+  ON app_liquidation(market_id, timestamp);
+
+CREATE INDEX IF NOT EXISTS app_liquidation_profile_id_idx
+  ON app_liquidation(profile_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS app_liquidation_shard_id_archive_id_idx
+  ON app_liquidation(shard_id, archive_id, timestamp);
+
+SELECT create_hypertable('app_liquidation', 'timestamp',
+  chunk_time_interval => 86400000000,
+  if_not_exists       => TRUE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS app_liquidation;
+-- +goose StatementEnd
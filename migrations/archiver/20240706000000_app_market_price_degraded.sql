@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE app_market ADD COLUMN IF NOT EXISTS price_degraded BOOLEAN;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE app_market DROP COLUMN IF EXISTS price_degraded;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE app_insurance_ledger SET kind = 'trading_fee' WHERE kind = 'liquidation_fee';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE app_insurance_ledger SET kind = 'liquidation_fee' WHERE kind = 'trading_fee';
+-- +goose StatementEnd
@@ -26,6 +26,9 @@ const (
 
 	GET_LAST_PROCESSED_BLOCK_NUMBER = "balance.get_last_processed_block_number"
 	SET_LAST_PROCESSED_BLOCK_NUMBER = "balance.set_last_processed_block_number"
+	SET_PROCESSED_BLOCK             = "balance.set_processed_block"
+	GET_PROCESSED_BLOCKS            = "balance.get_processed_blocks"
+	ROLLBACK_PROCESSED_BLOCKS       = "balance.rollback_processed_blocks"
 
 	GET_SETTLEMENT_STATE = "balance.get_settlement_state"
 	GET_PROCESSING_OPS   = "balance.get_processing_ops"
@@ -63,6 +66,11 @@ const (
 	COMPLETED_WITHDRAWALS        = "balance.completed_withdrawals"
 	GET_WITHDRAWALS_SUSPENDED    = "balance.get_withdrawals_suspended"
 	SUSPEND_WITHDRAWALS          = "balance.suspend_withdrawals"
+	GET_WITHDRAWAL_USAGE         = "balance.get_withdrawal_usage"
+	ADMIT_WITHDRAWAL             = "balance.admit_withdrawal"
+	HOLD_WITHDRAWAL              = "balance.hold_withdrawal"
+	REVIEW_WITHDRAWAL            = "balance.review_withdrawal"
+	GET_REVIEW_WITHDRAWALS       = "balance.get_review_withdrawals"
 )
 
 var (
@@ -181,6 +189,25 @@ type SettlementState struct {
 	DepositState  *DepositData  `msgpack:"deposit_state" json:"deposit_state"`
 }
 
+// Hash of the last block of a processed block range and the ids (ops_id2) of
+// the deposits and stakes found in the range
+type ProcessedBlock struct {
+	ContractAddress string   `msgpack:"contract_address"`
+	ChainId         uint     `msgpack:"chain_id"`
+	EventType       string   `msgpack:"event_type"`
+	BlockNumber     uint64   `msgpack:"block_number"`
+	BlockHash       string   `msgpack:"block_hash"`
+	Ops             []string `msgpack:"ops"`
+}
+
+// Withdrawn volume of the last 24 hours on a chain checked by the settlement
+// withdrawal policy
+type WithdrawalUsage struct {
+	ChainVolume      tdecimal.Decimal `msgpack:"chain_volume"`
+	ProfileVolume    tdecimal.Decimal `msgpack:"profile_volume"`
+	ProfileCreatedAt int64            `msgpack:"profile_created_at"`
+}
+
 type WithdrawalTxInfo struct {
 	Id     string `msgpack:"id"`
 	TxHash string `msgpack:"txhash"`
@@ -784,6 +811,63 @@ func (api *ApiModel) SuspendWithdrawals(ctx context.Context) error {
 	return err
 }
 
+// GetWithdrawalUsage returns the volume of the withdrawals let through by the
+// withdrawal policy in the last 24 hours on the chain and for the profile
+func (api *ApiModel) GetWithdrawalUsage(ctx context.Context, exchangeId string, chainId uint, profileId uint) (*WithdrawalUsage, error) {
+	return DataResponse[*WithdrawalUsage]{}.Request(
+		ctx,
+		PROFILE_INSTANCE,
+		api.broker,
+		GET_WITHDRAWAL_USAGE,
+		[]interface{}{strings.ToLower(exchangeId), chainId, profileId},
+	)
+}
+
+// AdmitWithdrawal marks a new pending withdrawal as checked by the withdrawal
+// policy and adds it to the withdrawal usage
+func (api *ApiModel) AdmitWithdrawal(ctx context.Context, bopsId string) (*BalanceOps, error) {
+	return DataResponse[*BalanceOps]{}.Request(
+		ctx,
+		PROFILE_INSTANCE,
+		api.broker,
+		ADMIT_WITHDRAWAL,
+		[]interface{}{bopsId},
+	)
+}
+
+// HoldWithdrawal moves a new pending withdrawal to review with the reason
+func (api *ApiModel) HoldWithdrawal(ctx context.Context, bopsId string, reason string) (*BalanceOps, error) {
+	return DataResponse[*BalanceOps]{}.Request(
+		ctx,
+		PROFILE_INSTANCE,
+		api.broker,
+		HOLD_WITHDRAWAL,
+		[]interface{}{bopsId, reason},
+	)
+}
+
+// ReviewWithdrawal approves a withdrawal in review, it's pending again, or
+// rejects it, it's canceled and refunded
+func (api *ApiModel) ReviewWithdrawal(ctx context.Context, bopsId string, approve bool) (*BalanceOps, error) {
+	return DataResponse[*BalanceOps]{}.Request(
+		ctx,
+		PROFILE_INSTANCE,
+		api.broker,
+		REVIEW_WITHDRAWAL,
+		[]interface{}{bopsId, approve},
+	)
+}
+
+func (api *ApiModel) GetReviewWithdrawals(ctx context.Context) ([]*BalanceOps, error) {
+	return DataResponse[[]*BalanceOps]{}.Request(
+		ctx,
+		PROFILE_INSTANCE,
+		api.broker,
+		GET_REVIEW_WITHDRAWALS,
+		[]interface{}{},
+	)
+}
+
 func (api *ApiModel) UpdatePendingWithdrawals(ctx context.Context, currentBlock *big.Int, future_block *big.Int, for_contract string) error {
 	for_contract = strings.ToLower(for_contract)
 	_, err := DataResponse[string]{}.Request(
@@ -844,6 +928,59 @@ func (api *ApiModel) SetLastProcessedBlockNumber(ctx context.Context, lastProces
 	return err
 }
 
+// SetProcessedBlock sets the last processed block number and stores its hash
+// with the ops found in the processed range
+func (api *ApiModel) SetProcessedBlock(ctx context.Context, block *ProcessedBlock) error {
+	ops := block.Ops
+	if ops == nil {
+		ops = []string{}
+	}
+
+	_, err := DataResponse[interface{}]{}.Request(
+		ctx,
+		PROFILE_INSTANCE,
+		api.broker,
+		SET_PROCESSED_BLOCK,
+		[]interface{}{
+			block.BlockNumber,
+			block.BlockHash,
+			ops,
+			strings.ToLower(block.ContractAddress),
+			block.ChainId,
+			strings.ToLower(block.EventType),
+		},
+	)
+	return err
+}
+
+// GetProcessedBlocks returns the stored processed blocks newest first
+func (api *ApiModel) GetProcessedBlocks(ctx context.Context, forContract string, chainId uint, eventType string, limit uint) ([]*ProcessedBlock, error) {
+	return DataResponse[[]*ProcessedBlock]{}.Request(
+		ctx,
+		PROFILE_INSTANCE,
+		api.broker,
+		GET_PROCESSED_BLOCKS,
+		[]interface{}{strings.ToLower(forContract), chainId, strings.ToLower(eventType), limit},
+	)
+}
+
+// RollbackProcessedBlocks sets the last processed block back to forkBlock,
+// drops the hashes of the blocks after it and reverses the credited ops whose
+// logs vanished, it returns the reversed ops
+func (api *ApiModel) RollbackProcessedBlocks(ctx context.Context, forkBlock uint64, vanished []string, forContract string, chainId uint, eventType string) ([]*BalanceOps, error) {
+	if vanished == nil {
+		vanished = []string{}
+	}
+
+	return DataResponse[[]*BalanceOps]{}.Request(
+		ctx,
+		PROFILE_INSTANCE,
+		api.broker,
+		ROLLBACK_PROCESSED_BLOCKS,
+		[]interface{}{forkBlock, vanished, strings.ToLower(forContract), chainId, strings.ToLower(eventType)},
+	)
+}
+
 // Only for debug purpose: never use in prod
 
 func (api *ApiModel) GetSettlementState(ctx context.Context) (bool, error) {
@@ -16,6 +16,9 @@ const (
 	IS_INV3_VALID               = "getters.is_inv3_valid"
 	CACHED_IS_INV3_VALID        = "getters.cached_is_inv3_valid"
 	GET_WINNING_POSITIONS       = "position.get_winning_positions"
+	UPDATE_ADL_QUANTILES        = "position.update_adl_quantiles"
+	GET_ADL_QUANTILE            = "position.get_adl_quantile"
+	GET_ADL_QUANTILES           = "getters.get_adl_quantiles"
 	HIGH_PRIORITY_CANCEL_ALL    = "internal.high_priority_cancell_all"
 	IS_CANCEL_ALL_ACCEPTED      = "internal.is_cancel_all_accepted"
 )
@@ -36,6 +39,20 @@ type Action struct {
 	Price    tdecimal.Decimal `msgpack:"price"`
 }
 
+// position place in the ADL queue of its market, 1..5 with 5 deleveraged first
+type AdlQuantile struct {
+	ProfileID uint             `msgpack:"profile_id" json:"profile_id"`
+	Side      string           `msgpack:"side" json:"side"`
+	Quantile  uint             `msgpack:"quantile" json:"quantile"`
+	Score     tdecimal.Decimal `msgpack:"score" json:"score"`
+}
+
+// ADL quantile of a profile in one market, 0 if not in the queue
+type MarketAdlQuantile struct {
+	MarketID string `msgpack:"market_id" json:"market_id"`
+	Quantile uint   `msgpack:"quantile" json:"quantile"`
+}
+
 func (a ActionType) Description() string {
 	switch a {
 	case APlaceSellOrders:
@@ -89,6 +106,26 @@ func (api *ApiModel) HighPriorityCancelAll(ctx context.Context, profile_id uint,
 	return err
 }
 
+// HighPriorityCancelMarket is HighPriorityCancelAll restricted to one market
+func (api *ApiModel) HighPriorityCancelMarket(ctx context.Context, profile_id uint, market_id string, is_liquidation bool) error {
+	_, err := DataResponse[interface{}]{}.Request(ctx, API_INSTANCE, api.broker, HIGH_PRIORITY_CANCEL_ALL, []interface{}{
+		profile_id,
+		is_liquidation,
+		market_id,
+	})
+
+	return err
+}
+
+func (api *ApiModel) IsMarketCancelAccepted(ctx context.Context, profile_id uint, market_id string) (bool, error) {
+	accepted, err := DataResponse[bool]{}.Request(ctx, API_INSTANCE, api.broker, IS_CANCEL_ALL_ACCEPTED, []interface{}{
+		profile_id,
+		market_id,
+	})
+
+	return accepted, err
+}
+
 func (api *ApiModel) IsCancellAllAccepted(ctx context.Context, profile_id uint) (bool, error) {
 	accepted, err := DataResponse[bool]{}.Request(ctx, API_INSTANCE, api.broker, IS_CANCEL_ALL_ACCEPTED, []interface{}{
 		profile_id,
@@ -112,6 +149,37 @@ func (api *ApiModel) GetWinningPositions(ctx context.Context, market_id, side st
 
 }
 
+func (api *ApiModel) UpdateAdlQuantiles(ctx context.Context, market_id string, quantiles []*AdlQuantile) error {
+	instance, err := GetInstance().ByMarketID(market_id)
+	if err != nil {
+		return err
+	}
+
+	_, err = DataResponse[interface{}]{}.Request(ctx, instance.Title, api.broker, UPDATE_ADL_QUANTILES, []interface{}{
+		quantiles,
+	})
+
+	return err
+}
+
+func (api *ApiModel) GetAdlQuantile(ctx context.Context, market_id string, profile_id uint) (uint, error) {
+	instance, err := GetInstance().ByMarketID(market_id)
+	if err != nil {
+		return 0, err
+	}
+
+	return DataResponse[uint]{}.Request(ctx, instance.Title, api.broker, GET_ADL_QUANTILE, []interface{}{
+		profile_id,
+	})
+}
+
+// quantiles of the profile in all markets with one call
+func (api *ApiModel) GetAdlQuantiles(ctx context.Context, profile_id uint) ([]*MarketAdlQuantile, error) {
+	return DataResponse[[]*MarketAdlQuantile]{}.Request(ctx, PROFILE_INSTANCE, api.broker, GET_ADL_QUANTILES, []interface{}{
+		profile_id,
+	})
+}
+
 func (api *ApiModel) CachedIsInv3Valid(ctx context.Context, inv3Buffer float64) (bool, error) {
 	res, err := DataResponse[bool]{}.Request(ctx, PROFILE_INSTANCE, api.broker, CACHED_IS_INV3_VALID, []interface{}{
 		inv3Buffer,
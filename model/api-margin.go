@@ -0,0 +1,62 @@
+package model
+
+import (
+	"context"
+
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+const (
+	SET_MARGIN_MODE            = "profile.set_margin_mode"
+	UPDATE_ISOLATED_MARGIN     = "profile.update_isolated_margin"
+	GET_ISOLATED_MARGINS       = "cache.get_isolated_margins"
+	ISOLATED_LIQUIDATION_BATCH = "cache.isolated_liquidation_batch"
+)
+
+// market of a profile in isolated margin mode, its position is margined and
+// liquidated on the isolated margin only
+type IsolatedMargin struct {
+	ProfileID           uint              `msgpack:"profile_id" json:"profile_id"`
+	MarketID            string            `msgpack:"market_id" json:"market_id"`
+	MarginMode          string            `msgpack:"margin_mode" json:"margin_mode"`
+	Status              string            `msgpack:"status" json:"status"`
+	Margin              *tdecimal.Decimal `msgpack:"margin" json:"margin"`
+	Balance             *tdecimal.Decimal `msgpack:"balance" json:"balance"`
+	Equity              *tdecimal.Decimal `msgpack:"equity" json:"equity"`
+	CumUnrealizedPnl    *tdecimal.Decimal `msgpack:"cum_unrealized_pnl" json:"cum_unrealized_pnl"`
+	TotalNotional       *tdecimal.Decimal `msgpack:"total_notional" json:"total_notional"`
+	TotalPositionMargin *tdecimal.Decimal `msgpack:"total_position_margin" json:"total_position_margin"`
+	TotalOrderMargin    *tdecimal.Decimal `msgpack:"total_order_margin" json:"total_order_margin"`
+	AccountMargin       *tdecimal.Decimal `msgpack:"account_margin" json:"account_margin"`
+	RemovableMargin     *tdecimal.Decimal `msgpack:"removable_margin" json:"removable_margin"`
+}
+
+func (api *ApiModel) SetMarginMode(ctx context.Context, profile_id uint, market_id, margin_mode string) (string, error) {
+	return DataResponse[string]{}.Request(ctx, PROFILE_INSTANCE, api.broker, SET_MARGIN_MODE, []interface{}{
+		profile_id,
+		market_id,
+		margin_mode,
+	})
+}
+
+// UpdateIsolatedMargin adds the amount to the isolated margin of the market,
+// a negative amount gives it back to the cross account
+func (api *ApiModel) UpdateIsolatedMargin(ctx context.Context, profile_id uint, market_id string, amount *tdecimal.Decimal) (*IsolatedMargin, error) {
+	return DataResponse[*IsolatedMargin]{}.Request(ctx, PROFILE_INSTANCE, api.broker, UPDATE_ISOLATED_MARGIN, []interface{}{
+		profile_id,
+		market_id,
+		amount,
+	})
+}
+
+func (api *ApiModel) GetIsolatedMargins(ctx context.Context, profile_id uint) ([]*IsolatedMargin, error) {
+	return DataResponse[[]*IsolatedMargin]{}.Request(ctx, PROFILE_INSTANCE, api.broker, GET_ISOLATED_MARGINS, []interface{}{
+		profile_id,
+	})
+}
+
+func (api *ApiModel) IsolatedLiquidationBatch(ctx context.Context, limit int) ([]*IsolatedMargin, error) {
+	return DataResponse[[]*IsolatedMargin]{}.Request(ctx, PROFILE_INSTANCE, api.broker, ISOLATED_LIQUIDATION_BATCH, []interface{}{
+		limit,
+	})
+}
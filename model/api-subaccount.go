@@ -0,0 +1,43 @@
+package model
+
+import (
+	"context"
+
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+const (
+	CREATE_SUBACCOUNT   = "profile.create_subaccount"
+	GET_SUBACCOUNTS     = "profile.get_subaccounts"
+	IS_SUBACCOUNT_OF    = "profile.is_subaccount_of"
+	SUBACCOUNT_TRANSFER = "profile.subaccount_transfer"
+)
+
+func (api *ApiModel) CreateSubaccount(ctx context.Context, master_id uint) (*Profile, error) {
+	return DataResponse[*Profile]{}.Request(ctx, PROFILE_INSTANCE, api.broker, CREATE_SUBACCOUNT, []interface{}{
+		master_id,
+	})
+}
+
+func (api *ApiModel) GetSubaccounts(ctx context.Context, master_id uint) ([]*Profile, error) {
+	return DataResponse[[]*Profile]{}.Request(ctx, PROFILE_INSTANCE, api.broker, GET_SUBACCOUNTS, []interface{}{
+		master_id,
+	})
+}
+
+func (api *ApiModel) IsSubaccountOf(ctx context.Context, profile_id, master_id uint) (bool, error) {
+	return DataResponse[bool]{}.Request(ctx, PROFILE_INSTANCE, api.broker, IS_SUBACCOUNT_OF, []interface{}{
+		profile_id,
+		master_id,
+	})
+}
+
+// SubaccountTransfer returns the outgoing and the incoming operations
+func (api *ApiModel) SubaccountTransfer(ctx context.Context, master_id, from_id, to_id uint, amount *tdecimal.Decimal) ([]*BalanceOps, error) {
+	return DataResponse[[]*BalanceOps]{}.Request(ctx, PROFILE_INSTANCE, api.broker, SUBACCOUNT_TRANSFER, []interface{}{
+		master_id,
+		from_id,
+		to_id,
+		amount,
+	})
+}
@@ -24,6 +24,7 @@ const (
 
 	TEST_STATS_SHOW_ALL = "stats.show_all"
 	DEPOSIT_CREDIT      = "balance.deposit_credit"
+	DEPOSIT_INSURANCE   = "balance.deposit_insurance"
 	WITHDRAW_CREDIT     = "profile.withdraw_credit"
 	TEST_REPLACE_OPS    = "balance.test_replace_ops"
 )
@@ -230,6 +231,16 @@ func (api *ApiModel) DepositCredit(ctx context.Context, profileId uint, amount f
 	return ops, err
 }
 
+// credits the insurance profile and records the deposit in the insurance ledger
+func (api *ApiModel) DepositInsurance(ctx context.Context, amount float64) (*BalanceOps, error) {
+	d_amount := tdecimal.NewDecimal(decimal.NewFromFloat(amount))
+	ops, err := DataResponse[*BalanceOps]{}.Request(ctx, PROFILE_INSTANCE, api.broker, DEPOSIT_INSURANCE, []interface{}{
+		d_amount,
+	})
+
+	return ops, err
+}
+
 func (api *ApiModel) WithdrawCredit(ctx context.Context, profileId uint, amount float64) (*BalanceOps, error) {
 	d_amount := tdecimal.NewDecimal(decimal.NewFromFloat(amount))
 
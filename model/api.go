@@ -18,6 +18,9 @@ const (
 	PAY_FUNDING                           = "engine.pay_funding"
 
 	UPDATE_INDEX_PRICE        = "market.update_index_price"
+	SET_PRICE_DEGRADED        = "market.set_price_degraded"
+	UPDATE_MARK_PRICE         = "market.update_mark_price"
+	UPDATE_TRAILING_TRIGGER   = "engine.update_trailing_trigger"
 	GET_PROFILE_DATA          = "getters.get_profile_data"
 	GET_EXTENDED_PROFILE_DATA = "getters.get_extended_profile_data"
 	GET_EXTENDED_PROFILES     = "getters.get_extended_profiles"
@@ -29,21 +32,31 @@ const (
 	GET_ALL_ORDERS  = "order.get_all_orders"
 	GET_ALL_ORDERS2 = "order.get_all_orders2"
 
-	GET_OPEN_ORDERS = "getters.get_open_orders"
-	UPDATE_LEVERGAE = "profile.update_leverage"
+	GET_OPEN_ORDERS     = "getters.get_open_orders"
+	GET_ORDERS_SNAPSHOT = "notif.get_orders_snapshot"
+	GET_FILLS_SNAPSHOT  = "notif.get_fills_snapshot"
+	UPDATE_LEVERGAE     = "profile.update_leverage"
 
 	GET_PROFILES_META_AFTER_TS = "profile.get_profiles_meta_after_ts"
 
 	GET_MARKET_DATA  = "market.get_market_data"
 	GET_FUNDING_META = "market.get_funding_meta"
 
+	ADD_PREMIUM_SAMPLE  = "market.add_premium_sample"
+	GET_PREMIUM_SAMPLES = "market.get_premium_samples"
+	SET_FUNDING_RATE    = "market.set_funding_rate"
+	GET_FUNDING_RATE    = "market.get_funding_rate"
+
 	GET_ORDERBOOK_DATA = "engine.get_orderbook_data"
 	GET_TRADE_DATA     = "trade.get_trade_data"
+	GET_LIQUIDATIONS   = "trade.get_liquidations"
 
 	ORDER_CREATE  = "public.new_order"
 	ORDER_AMEND   = "public.amend_order"
 	ORDER_CANCEL  = "public.cancel_order"
 	ORDER_EXECUTE = "internal.execute_order"
+	ORDER_BATCH   = "public.batch_orders"
+	ORDER_GROUP   = "public.new_order_group"
 
 	GET_CANDLES       = "candles.get_candles"
 	GET_EXCHANGE_DATA = "getters.get_exchange_data"
@@ -78,10 +91,36 @@ type FundingMeta struct {
 	TotalShort *tdecimal.Decimal `msgpack:"total_short"`
 }
 
+// (impact mid - index) / index sampled by the funding service, timestamp in microseconds
+type PremiumSample struct {
+	MarketId   string            `msgpack:"market_id" json:"market_id"`
+	Timestamp  int64             `msgpack:"timestamp" json:"timestamp"`
+	IndexPrice *tdecimal.Decimal `msgpack:"index_price" json:"index_price"`
+	ImpactBid  *tdecimal.Decimal `msgpack:"impact_bid" json:"impact_bid"`
+	ImpactAsk  *tdecimal.Decimal `msgpack:"impact_ask" json:"impact_ask"`
+	Premium    *tdecimal.Decimal `msgpack:"premium" json:"premium"`
+}
+
+// funding rate of the interval ending at FundingTime (microseconds) with the params it was computed with
+type FundingRate struct {
+	MarketId     string            `msgpack:"market_id" json:"market_id"`
+	FundingTime  int64             `msgpack:"funding_time" json:"funding_time"`
+	Rate         *tdecimal.Decimal `msgpack:"rate" json:"rate"`
+	Premium      *tdecimal.Decimal `msgpack:"premium" json:"premium"`
+	InterestRate *tdecimal.Decimal `msgpack:"interest_rate" json:"interest_rate"`
+	Dampener     *tdecimal.Decimal `msgpack:"dampener" json:"dampener"`
+	Cap          *tdecimal.Decimal `msgpack:"cap" json:"cap"`
+	Samples      uint              `msgpack:"samples" json:"samples"`
+}
+
 type FundingPayment struct {
 	MarketId      string
 	ProfileId     uint
 	FundingAmount *tdecimal.Decimal
+	Side          string
+	Size          *tdecimal.Decimal
+	Price         *tdecimal.Decimal
+	Rate          *tdecimal.Decimal
 }
 
 type ApiModel struct {
@@ -163,37 +202,39 @@ func (api *ApiModel) OrderAmend(ctx context.Context, profile_id uint, market_id,
 }
 
 func (api *ApiModel) OrderCreate(ctx context.Context, profile_id uint, market_id, order_type, side string, price, size *float64, client_order_id *string, trigger_price, size_percent *float64, time_in_force *string, meta *MatchingMeta) (OrderCreateRes, error) {
-	var d_price *tdecimal.Decimal
-	if price != nil {
-		d_price = tdecimal.NewDecimal(decimal.NewFromFloat(*price))
-	}
-	var d_size *tdecimal.Decimal
-	if size != nil {
-		d_size = tdecimal.NewDecimal(decimal.NewFromFloat(*size))
-	}
-	var d_trigger_price *tdecimal.Decimal
-	if trigger_price != nil {
-		d_trigger_price = tdecimal.NewDecimal(decimal.NewFromFloat(*trigger_price))
-	}
-	var d_size_percent *tdecimal.Decimal
-	if size_percent != nil {
-		d_size_percent = tdecimal.NewDecimal(decimal.NewFromFloat(*size_percent))
-	}
+	return api.orderCreate(ctx, profile_id, market_id, order_type, side, price, size, client_order_id, trigger_price, size_percent, time_in_force, nil, nil, nil, meta)
+}
+
+// same as OrderCreate, the conditional order is triggered by the given price
+// stream (TRIGGER_BY_*), nil is TRIGGER_BY_MARK
+func (api *ApiModel) OrderCreateTriggerBy(ctx context.Context, profile_id uint, market_id, order_type, side string, price, size *float64, client_order_id *string, trigger_price, size_percent *float64, time_in_force, trigger_by *string, meta *MatchingMeta) (OrderCreateRes, error) {
+	return api.orderCreate(ctx, profile_id, market_id, order_type, side, price, size, client_order_id, trigger_price, size_percent, time_in_force, nil, nil, trigger_by, meta)
+}
+
+// trailing_stop with one of callback_value/callback_percent, the trigger is
+// optional and computed from the trigger_by price when missing
+func (api *ApiModel) TrailingStopCreate(ctx context.Context, profile_id uint, market_id, side string, size *float64, client_order_id *string, trigger_price, callback_value, callback_percent *float64, trigger_by *string, meta *MatchingMeta) (OrderCreateRes, error) {
+	return api.orderCreate(ctx, profile_id, market_id, TRAILING_STOP, side, nil, size, client_order_id, trigger_price, nil, nil, callback_value, callback_percent, trigger_by, meta)
+}
 
+func (api *ApiModel) orderCreate(ctx context.Context, profile_id uint, market_id, order_type, side string, price, size *float64, client_order_id *string, trigger_price, size_percent *float64, time_in_force *string, callback_value, callback_percent *float64, trigger_by *string, meta *MatchingMeta) (OrderCreateRes, error) {
 	_, res, err := OrderResponse[OrderCreateRes]{}.request(ctx, API_INSTANCE, api.broker, ORDER_CREATE, []interface{}{
 		profile_id,
 		market_id,
 		order_type,
 		side,
-		d_price,
-		d_size,
+		optionalDecimal(price),
+		optionalDecimal(size),
 		client_order_id,
-		d_trigger_price,
-		d_size_percent,
+		optionalDecimal(trigger_price),
+		optionalDecimal(size_percent),
 		time_in_force,
 		nil, // custom_order_id
 
 		meta,
+		optionalDecimal(callback_value),
+		optionalDecimal(callback_percent),
+		trigger_by,
 	})
 
 	return res, err
@@ -209,6 +250,32 @@ func (api *ApiModel) OrderExecute(ctx context.Context, profile_id uint, market_i
 	return res, err
 }
 
+// oco pair or bracket, legs[0] is the first oco order or the bracket entry,
+// the group is created by the engine as a whole
+func (api *ApiModel) OrderGroupCreate(ctx context.Context, profile_id uint, market_id, group_type string, legs []OrderGroupLeg, meta *MatchingMeta) ([]OrderCreateRes, error) {
+	_, res, err := OrderGroupResponse{}.request(ctx, API_INSTANCE, api.broker, ORDER_GROUP, []interface{}{
+		profile_id,
+		market_id,
+		group_type,
+		legs,
+
+		meta,
+	})
+
+	return res, err
+}
+
+// All items belong to one market and are processed by tarantool in one call
+func (api *ApiModel) OrdersBatch(ctx context.Context, profile_id uint, market_id string, items []OrderBatchItem, meta *MatchingMeta) ([]OrderBatchRes, error) {
+	return DataResponse[[]OrderBatchRes]{}.Request(ctx, API_INSTANCE, api.broker, ORDER_BATCH, []interface{}{
+		profile_id,
+		market_id,
+		items,
+
+		meta,
+	})
+}
+
 func (api *ApiModel) CreateProfile(ctx context.Context, profile_type, wallet, exchange_id string) (*Profile, error) {
 	if !slices.Contains(supportedProfileTypes, profile_type) {
 		return nil, fmt.Errorf("unsupported profile type = %s", profile_type)
@@ -257,6 +324,60 @@ func (api *ApiModel) UpdateIndexPrice(ctx context.Context, market_id string, ind
 
 	return err
 }
+
+func (api *ApiModel) UpdateMarkPrice(ctx context.Context, market_id string, mark_price float64, usage []string) error {
+	d_mark_price := tdecimal.NewDecimal(decimal.NewFromFloat(mark_price))
+	if usage == nil {
+		usage = []string{}
+	}
+
+	instance, err := GetInstance().ByMarketID(market_id)
+	if err != nil {
+		text := fmt.Sprintf("GetInstance err=%s for market_id=%s", err.Error(), market_id)
+		return errors.New(text)
+	}
+
+	_, err = DataResponse[*tdecimal.Decimal]{}.Request(ctx, instance.Title, api.broker, UPDATE_MARK_PRICE, []interface{}{
+		market_id,
+		d_mark_price,
+		usage,
+	})
+
+	return err
+}
+
+// sets or clears the price_degraded flag of the market, the market status is left untouched
+func (api *ApiModel) SetPriceDegraded(ctx context.Context, market_id string, degraded bool) error {
+	instance, err := GetInstance().ByMarketID(market_id)
+	if err != nil {
+		text := fmt.Sprintf("GetInstance err=%s for market_id=%s", err.Error(), market_id)
+		return errors.New(text)
+	}
+
+	_, err = DataResponse[bool]{}.Request(ctx, instance.Title, api.broker, SET_PRICE_DEGRADED, []interface{}{
+		market_id,
+		degraded,
+	})
+
+	return err
+}
+
+// moves the trigger of a placed trailing stop, the engine keeps the trigger
+// when it would move against the order and returns the stored one
+func (api *ApiModel) UpdateTrailingTrigger(ctx context.Context, market_id, order_id string, trigger_price decimal.Decimal) (*OrderData, error) {
+	instance, err := GetInstance().ByMarketID(market_id)
+	if err != nil {
+		text := fmt.Sprintf("GetInstance err=%s for market_id=%s", err.Error(), market_id)
+		return nil, errors.New(text)
+	}
+
+	return DataResponse[*OrderData]{}.Request(ctx, instance.Title, api.broker, UPDATE_TRAILING_TRIGGER, []interface{}{
+		market_id,
+		order_id,
+		tdecimal.NewDecimal(trigger_price),
+	})
+}
+
 func (api *ApiModel) GetMarketData(ctx context.Context, market_id string) (*MarketData, error) {
 	instance, err := GetInstance().ByMarketID(market_id)
 	if err != nil {
@@ -289,24 +410,89 @@ func (api *ApiModel) GetFundingMeta(ctx context.Context, market_id string) (*Fun
 	return data, nil
 }
 
+func (api *ApiModel) AddPremiumSample(ctx context.Context, sample *PremiumSample, instant_rate decimal.Decimal, next_funding_time int64) error {
+	instance, err := GetInstance().ByMarketID(sample.MarketId)
+	if err != nil {
+		return err
+	}
+
+	_, err = DataResponse[interface{}]{}.Request(ctx, instance.Title, api.broker, ADD_PREMIUM_SAMPLE, []interface{}{
+		sample.MarketId,
+		sample.Timestamp,
+		sample.IndexPrice,
+		sample.ImpactBid,
+		sample.ImpactAsk,
+		sample.Premium,
+		tdecimal.NewDecimal(instant_rate),
+		next_funding_time,
+	})
+
+	return err
+}
+
+// samples with from <= timestamp < to, microseconds
+func (api *ApiModel) GetPremiumSamples(ctx context.Context, market_id string, from, to int64) ([]*PremiumSample, error) {
+	instance, err := GetInstance().ByMarketID(market_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return DataResponse[[]*PremiumSample]{}.Request(ctx, instance.Title, api.broker, GET_PREMIUM_SAMPLES, []interface{}{
+		market_id,
+		from,
+		to,
+	})
+}
+
+func (api *ApiModel) SetFundingRate(ctx context.Context, rate *FundingRate) error {
+	instance, err := GetInstance().ByMarketID(rate.MarketId)
+	if err != nil {
+		return err
+	}
+
+	_, err = DataResponse[*tdecimal.Decimal]{}.Request(ctx, instance.Title, api.broker, SET_FUNDING_RATE, []interface{}{
+		rate.MarketId,
+		rate.FundingTime,
+		rate.Rate,
+		rate.Premium,
+		rate.InterestRate,
+		rate.Dampener,
+		rate.Cap,
+		rate.Samples,
+	})
+
+	return err
+}
+
+func (api *ApiModel) GetFundingRate(ctx context.Context, market_id string, funding_time int64) (*FundingRate, error) {
+	instance, err := GetInstance().ByMarketID(market_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return DataResponse[*FundingRate]{}.Request(ctx, instance.Title, api.broker, GET_FUNDING_RATE, []interface{}{
+		market_id,
+		funding_time,
+	})
+}
+
 func (api *ApiModel) PayFunding(ctx context.Context,
 	market_id string,
 	fundingPayments []FundingPayment,
 	LastFundingUpdateTime int64,
-	totalLong, totalShort float64) error {
+	totalLong, totalShort, residual decimal.Decimal) error {
 	instance, err := GetInstance().ByMarketID(market_id)
 	if err != nil {
 		return err
 	}
 
-	d_total_long := tdecimal.NewDecimal(decimal.NewFromFloat(totalLong))
-	d_total_short := tdecimal.NewDecimal(decimal.NewFromFloat(totalShort))
 	_, err = DataResponse[interface{}]{}.Request(ctx, instance.Title, api.broker, PAY_FUNDING, []interface{}{
 		market_id,
 		fundingPayments,
 		LastFundingUpdateTime,
-		d_total_long,
-		d_total_short,
+		tdecimal.NewDecimal(totalLong),
+		tdecimal.NewDecimal(totalShort),
+		tdecimal.NewDecimal(residual),
 	})
 
 	return err
@@ -354,6 +540,18 @@ func (api *ApiModel) GetTrades(ctx context.Context, marketId string, limit int64
 	return data, err
 }
 
+// GetLiquidations returns the last liquidation fills of the market, newest first
+func (api *ApiModel) GetLiquidations(ctx context.Context, marketId string, limit int64) ([]*LiquidationData, error) {
+	instance, err := GetInstance().ByMarketID(marketId)
+	if err != nil {
+		return nil, err
+	}
+
+	return DataResponse[[]*LiquidationData]{}.Request(ctx, instance.Title, api.broker, GET_LIQUIDATIONS, []interface{}{
+		limit,
+	})
+}
+
 func (api *ApiModel) GetAllActivePositions(ctx context.Context, market_id string, offset, limit uint) ([]*PositionData, error) {
 	instance, err := GetInstance().ByMarketID(market_id)
 	if err != nil {
@@ -413,6 +611,33 @@ func (api *ApiModel) GetOpenOrders(ctx context.Context, marketId string, profile
 	return data, err
 }
 
+// GetOrdersSnapshot returns the open and placed orders of the profile in the
+// market with the last sequence published on orders:<market>@<profile>
+func (api *ApiModel) GetOrdersSnapshot(ctx context.Context, marketId string, profileId uint) (*OrdersSnapshot, error) {
+	instance, err := GetInstance().ByMarketID(marketId)
+	if err != nil {
+		return nil, err
+	}
+
+	return DataResponse[*OrdersSnapshot]{}.Request(ctx, instance.Title, api.broker, GET_ORDERS_SNAPSHOT, []interface{}{
+		profileId,
+	})
+}
+
+// GetFillsSnapshot returns the last fills of the profile in the market, newest
+// first, with the last sequence published on fills:<market>@<profile>
+func (api *ApiModel) GetFillsSnapshot(ctx context.Context, marketId string, profileId uint, limit uint) (*FillsSnapshot, error) {
+	instance, err := GetInstance().ByMarketID(marketId)
+	if err != nil {
+		return nil, err
+	}
+
+	return DataResponse[*FillsSnapshot]{}.Request(ctx, instance.Title, api.broker, GET_FILLS_SNAPSHOT, []interface{}{
+		profileId,
+		limit,
+	})
+}
+
 func (api *ApiModel) GetPlacedOrders(ctx context.Context, marketID string, profileID *uint) ([]*OrderData, error) {
 	instance, err := GetInstance().ByMarketID(marketID)
 	if err != nil {
@@ -38,14 +38,51 @@ is that market maker uses Secret to sign payload he sends in POST, PUT, DELETE
 request. And Key is actually public, and it can be passed through headers, it's
 used just to find associated Secret key to verify signature. Api keys supposed
 to be used by technically experienced users.
+
+Scopes limit what the key can do, a key without scopes has full access like
+the keys created before the scopes. Markets limit the orders the key can
+place, amend and cancel, a key without markets can trade all of them.
 */
 type APISecret struct {
-	Key        string `msgpack:"key" json:"Key"`
-	ProfileID  uint   `msgpack:"profile_id" json:"ProfileID"`
-	Secret     string `msgpack:"secret" json:"Secret"`
-	Tag        string `msgpack:"tag" json:"Tag"`
-	Expiration uint   `msgpack:"expiration" json:"Expiration"`
-	Status     string `msgpack:"status" json:"Status"`
+	Key        string   `msgpack:"key" json:"Key"`
+	ProfileID  uint     `msgpack:"profile_id" json:"ProfileID"`
+	Secret     string   `msgpack:"secret" json:"Secret"`
+	Tag        string   `msgpack:"tag" json:"Tag"`
+	Expiration uint     `msgpack:"expiration" json:"Expiration"`
+	Status     string   `msgpack:"status" json:"Status"`
+	Scopes     []string `msgpack:"scopes" json:"Scopes"`
+	Markets    []string `msgpack:"markets" json:"Markets"`
+}
+
+// HasScope tells if the key is allowed to call the routes of the scope, the
+// routes without a scope need a key with full access. Trade implies read and
+// cancel only, a trading key needs its orders and positions.
+func (s *APISecret) HasScope(scope string) bool {
+	if len(s.Scopes) == 0 {
+		return true
+	}
+
+	for _, granted := range s.Scopes {
+		if granted == scope || (granted == API_SCOPE_TRADE && (scope == API_SCOPE_READ || scope == API_SCOPE_CANCEL_ONLY)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *APISecret) AllowsMarket(marketId string) bool {
+	if len(s.Markets) == 0 {
+		return true
+	}
+
+	for _, market := range s.Markets {
+		if market == marketId {
+			return true
+		}
+	}
+
+	return false
 }
 
 type Secret struct {
@@ -96,7 +133,7 @@ type ApiSecretModel struct {
 	broker *Broker
 }
 
-func generateSecret(profileID uint, expiredAt int64, tag string) (*APISecret, error) {
+func generateSecret(profileID uint, expiredAt int64, tag string, scopes, markets []string) (*APISecret, error) {
 	key := make([]byte, 32)
 	secret := make([]byte, 32)
 
@@ -116,6 +153,16 @@ func generateSecret(profileID uint, expiredAt int64, tag string) (*APISecret, er
 		Secret:     hexutil.Encode(secret),
 		Expiration: uint(expiredAt),
 		Tag:        tag,
+		Scopes:     scopes,
+		Markets:    markets,
+	}
+
+	// stored as arrays, not nil
+	if apiSecret.Scopes == nil {
+		apiSecret.Scopes = make([]string, 0)
+	}
+	if apiSecret.Markets == nil {
+		apiSecret.Markets = make([]string, 0)
 	}
 
 	return apiSecret, nil
@@ -230,14 +277,14 @@ func (s ApiSecretModel) DeletePairForProfile(ctx context.Context, profileID uint
 	return nil
 }
 
-func (s ApiSecretModel) CreatePairFromProfileID(ctx context.Context, tag string, profileID uint, expiration *int64, jwt, refresh_token string, ips []string) (*APISecret, error) {
+func (s ApiSecretModel) CreatePairFromProfileID(ctx context.Context, tag string, profileID uint, expiration *int64, jwt, refresh_token string, ips, scopes, markets []string) (*APISecret, error) {
 	// By default market maker api key expires in 6 months
 	expiredAt := time.Now().Add(time.Hour * 24 * 30 * 6).Unix()
 	if expiration != nil {
 		expiredAt = *expiration
 	}
 
-	apiSecret, err := generateSecret(profileID, expiredAt, tag)
+	apiSecret, err := generateSecret(profileID, expiredAt, tag, scopes, markets)
 
 	if err != nil {
 		return nil, err
@@ -278,7 +325,7 @@ func (s ApiSecretModel) GetOrRefreshSecretByProfileID(ctx context.Context, profi
 
 	// By default market maker api key expires in 6 months
 	expiredAt := time.Now().Add(time.Hour * 24 * 30 * 6).Unix()
-	newApiSecret, err := generateSecret(profileID, expiredAt, "")
+	newApiSecret, err := generateSecret(profileID, expiredAt, "", nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -8,6 +8,7 @@ const (
 	PROFILE_TYPE_TRADER            = "trader"
 	PROFILE_TYPE_VAULT             = "vault"
 	PROFILE_TYPE_INSURANCE         = "insurance"
+	PROFILE_TYPE_SUBACCOUNT        = "subaccount"
 	PROFILE_NOT_FOUND_ERROR        = "PROFILE_NOT_FOUND"
 	LONG                           = "long"
 	SHORT                          = "short"
@@ -19,6 +20,7 @@ const (
 	TAKE_PROFIT_LIMIT              = "take_profit_limit"
 	STOP_LIMIT                     = "stop_limit"
 	STOP_MARKET                    = "stop_market"
+	TRAILING_STOP                  = "trailing_stop"
 	PING_LIMIT                     = "ping_limit"
 	ACCOUNT_PREFIX                 = "account@"
 	BALANCE_OPS_STATUS_PENDING     = "pending"
@@ -26,11 +28,16 @@ const (
 	BALANCE_OPS_STATUS_FAILED      = "failed"
 	BALANCE_OPS_STATUS_TRANSFERING = "transferring"
 	BALANCE_OPS_STATUS_UNKNOWN     = "unknown"
+	BALANCE_OPS_STATUS_REORGED     = "reorged"
+	BALANCE_OPS_STATUS_REVIEW      = "review"
 	BALANCE_OPS_TYPE_DEPOSIT       = "deposit"
 	BALANCE_OPS_TYPE_WITHDRAW      = "withdraw"
 	BALANCE_OPS_TYPE_STAKE         = "stake"
 	BALANCE_OPS_TYPE_UNSTAKE       = "unstake"
 
+	BALANCE_OPS_TYPE_SUBACCOUNT_TRANSFER_OUT = "subaccount_transfer_out"
+	BALANCE_OPS_TYPE_SUBACCOUNT_TRANSFER_IN  = "subaccount_transfer_in"
+
 	ERR_REFERRAL_PAYOUT_ID_DUPLICATE        = "ERR_REFERRAL_PAYOUT_ID_DUPLICATE"
 	ERR_REFERRAL_PAYOUT_AMOUNT_NOT_POSITIVE = "ERR_REFERRAL_PAYOUT_AMOUNT_NOT_POSITIVE"
 
@@ -44,12 +51,46 @@ const (
 
 var supportedProfileTypes = []string{PROFILE_TYPE_TRADER, PROFILE_TYPE_VAULT, PROFILE_TYPE_INSURANCE, PROFILE_TYPE_INSURANCE}
 
+// market status
+const (
+	MARKET_STATUS_ACTIVE = "active"
+	MARKET_STATUS_PAUSED = "paused"
+)
+
+// consumers which can use the mark price instead of the fair price
+const (
+	MARK_PRICE_USAGE_LIQUIDATION = "liquidation"
+	MARK_PRICE_USAGE_SLIPSTOPPER = "slipstopper"
+	MARK_PRICE_USAGE_FUNDING     = "funding"
+)
+
+// order actions
+const (
+	ORDER_ACTION_CREATE = "create"
+	ORDER_ACTION_AMEND  = "amend"
+	ORDER_ACTION_CANCEL = "cancel"
+)
+
 // order status
 const (
 	PLACED   = "placed"
 	OPEN     = "open"
 	CANCELED = "canceled"
 	CLOSED   = "closed"
+	PENDING  = "pending"
+)
+
+// order group types
+const (
+	ORDER_GROUP_OCO     = "oco"
+	ORDER_GROUP_BRACKET = "bracket"
+)
+
+// price stream a conditional order is triggered by
+const (
+	TRIGGER_BY_MARK  = "mark"
+	TRIGGER_BY_LAST  = "last"
+	TRIGGER_BY_INDEX = "index"
 )
 
 // airdrop status
@@ -73,6 +114,19 @@ const (
 	API_SECRET_GEN_STATUS = "API_GEN"
 )
 
+// api key scopes, a key without scopes has full access
+const (
+	API_SCOPE_READ        = "read"
+	API_SCOPE_TRADE       = "trade"
+	API_SCOPE_CANCEL_ONLY = "cancel_only"
+)
+
+// margin mode of a market, cross unless set otherwise
+const (
+	MARGIN_MODE_CROSS    = "cross"
+	MARGIN_MODE_ISOLATED = "isolated"
+)
+
 const DEFAULT_INSTRUMENT_PRODUCT_TYPE = "perpetual"
 
 // exchange ids
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/shopspring/decimal"
 	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
 )
 
@@ -33,6 +34,14 @@ type OrderCreateRes struct {
 	TriggerPrice  *tdecimal.Decimal `msgpack:"trigger_price"  json:"trigger_price"`
 	SizePercent   *tdecimal.Decimal `msgpack:"size_percent"  json:"size_percent"`
 	TimeInForce   *string           `msgpack:"time_in_force"  json:"time_in_force"`
+	// trailing_stop only
+	CallbackValue   *tdecimal.Decimal `msgpack:"callback_value"  json:"callback_value,omitempty"`
+	CallbackPercent *tdecimal.Decimal `msgpack:"callback_percent"  json:"callback_percent,omitempty"`
+	// oco/bracket members only
+	GroupId   *string `msgpack:"group_id"  json:"group_id,omitempty"`
+	GroupType *string `msgpack:"group_type"  json:"group_type,omitempty"`
+	// conditional orders only, empty is TRIGGER_BY_MARK
+	TriggerBy *string `msgpack:"trigger_by"  json:"trigger_by,omitempty"`
 }
 
 type OrderExecuteRes struct {
@@ -66,6 +75,103 @@ type CancellAllRes struct {
 	Status    string `msgpack:"status"  json:"status"`
 }
 
+// One item of a batch, sent to tarantool as a positional tuple,
+// fields order must match <public.batch_orders>
+type OrderBatchItem struct {
+	Action          string            `msgpack:"action"`
+	OrderType       string            `msgpack:"order_type"`
+	Side            string            `msgpack:"side"`
+	Price           *tdecimal.Decimal `msgpack:"price"`
+	Size            *tdecimal.Decimal `msgpack:"size"`
+	ClientOrderId   *string           `msgpack:"client_order_id"`
+	TriggerPrice    *tdecimal.Decimal `msgpack:"trigger_price"`
+	SizePercent     *tdecimal.Decimal `msgpack:"size_percent"`
+	TimeInForce     *string           `msgpack:"time_in_force"`
+	OrderId         *string           `msgpack:"order_id"`
+	TriggerBy       *string           `msgpack:"trigger_by"`
+	CallbackValue   *tdecimal.Decimal `msgpack:"callback_value"`
+	CallbackPercent *tdecimal.Decimal `msgpack:"callback_percent"`
+}
+
+// Result of one batch item, Order is filled for the successful items only
+type OrderBatchRes struct {
+	Action string          `msgpack:"action"  json:"action"`
+	Order  *OrderCreateRes `msgpack:"order"  json:"order,omitempty"`
+	Error  string          `msgpack:"error"  json:"error,omitempty"`
+}
+
+func NewOrderBatchCreate(order_type, side string, price, size *float64, client_order_id *string, trigger_price, size_percent *float64, time_in_force *string, callback_value, callback_percent *float64, trigger_by *string) OrderBatchItem {
+	return OrderBatchItem{
+		Action:          ORDER_ACTION_CREATE,
+		OrderType:       order_type,
+		Side:            side,
+		Price:           optionalDecimal(price),
+		Size:            optionalDecimal(size),
+		ClientOrderId:   client_order_id,
+		TriggerPrice:    optionalDecimal(trigger_price),
+		SizePercent:     optionalDecimal(size_percent),
+		TimeInForce:     time_in_force,
+		TriggerBy:       trigger_by,
+		CallbackValue:   optionalDecimal(callback_value),
+		CallbackPercent: optionalDecimal(callback_percent),
+	}
+}
+
+func NewOrderBatchAmend(order_id string, new_price, new_size, new_trigger_price, new_size_percent *float64) OrderBatchItem {
+	return OrderBatchItem{
+		Action:       ORDER_ACTION_AMEND,
+		Price:        optionalDecimal(new_price),
+		Size:         optionalDecimal(new_size),
+		TriggerPrice: optionalDecimal(new_trigger_price),
+		SizePercent:  optionalDecimal(new_size_percent),
+		OrderId:      &order_id,
+	}
+}
+
+func NewOrderBatchCancel(order_id, client_order_id string) OrderBatchItem {
+	return OrderBatchItem{
+		Action:        ORDER_ACTION_CANCEL,
+		ClientOrderId: &client_order_id,
+		OrderId:       &order_id,
+	}
+}
+
+// One order of an oco/bracket group, sent to tarantool as a positional tuple,
+// fields order must match <public.new_order_group>
+type OrderGroupLeg struct {
+	OrderType     string            `msgpack:"order_type"`
+	Side          string            `msgpack:"side"`
+	Price         *tdecimal.Decimal `msgpack:"price"`
+	Size          *tdecimal.Decimal `msgpack:"size"`
+	ClientOrderId *string           `msgpack:"client_order_id"`
+	TriggerPrice  *tdecimal.Decimal `msgpack:"trigger_price"`
+	SizePercent   *tdecimal.Decimal `msgpack:"size_percent"`
+	TimeInForce   *string           `msgpack:"time_in_force"`
+	TriggerBy     *string           `msgpack:"trigger_by"`
+}
+
+func NewOrderGroupLeg(order_type, side string, price, size *float64, client_order_id *string, trigger_price, size_percent *float64, time_in_force, trigger_by *string) OrderGroupLeg {
+	return OrderGroupLeg{
+		OrderType:     order_type,
+		Side:          side,
+		Price:         optionalDecimal(price),
+		Size:          optionalDecimal(size),
+		ClientOrderId: client_order_id,
+		TriggerPrice:  optionalDecimal(trigger_price),
+		SizePercent:   optionalDecimal(size_percent),
+		TimeInForce:   time_in_force,
+		TriggerBy:     trigger_by,
+	}
+}
+
+func optionalDecimal(value *float64) *tdecimal.Decimal {
+	if value == nil {
+		return nil
+	}
+
+	return tdecimal.NewDecimal(decimal.NewFromFloat(*value))
+}
+
 type OrderResponse[T any] struct {
 	Task  *Task  `msgpack:"task"`
 	Order T      `msgpack:"order"`
@@ -88,3 +194,27 @@ func (r OrderResponse[C]) request(ctx context.Context, instance string, broker *
 
 	return res[0].Task, res[0].Order, nil
 }
+
+// All orders of a group are queued by one task
+type OrderGroupResponse struct {
+	Task   *Task            `msgpack:"task"`
+	Orders []OrderCreateRes `msgpack:"orders"`
+	Error  string           `msgpack:"error"`
+}
+
+func (r OrderGroupResponse) request(ctx context.Context, instance string, broker *Broker, fn string, params []interface{}) (*Task, []OrderCreateRes, error) {
+	var res []OrderGroupResponse
+	err := broker.Execute(instance, ctx, fn, params, &res)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(res) == 0 {
+		return nil, nil, errors.New("UNKNOWN ERROR")
+	}
+
+	if res[0].Error != "" {
+		return nil, nil, errors.New(res[0].Error)
+	}
+
+	return res[0].Task, res[0].Orders, nil
+}
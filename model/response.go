@@ -54,9 +54,10 @@ type ProfileCache struct {
 
 type ProfileData struct {
 	ProfileCache
-	Positions     []*PositionData        `msgpack:"positions" json:"positions,omitempty"`
-	Orders        []*OrderData           `msgpack:"orders" json:"orders,omitempty"`
-	Notifications []*ProfileNotification `msgpack:"notifications" json:"profile_notifications,omitempty"`
+	Positions       []*PositionData        `msgpack:"positions" json:"positions,omitempty"`
+	Orders          []*OrderData           `msgpack:"orders" json:"orders,omitempty"`
+	Notifications   []*ProfileNotification `msgpack:"notifications" json:"profile_notifications,omitempty"`
+	IsolatedMargins []*IsolatedMargin      `msgpack:"isolated_margins" json:"isolated_margins,omitempty"`
 }
 
 type ProfileCacheMetas struct {
@@ -78,9 +79,10 @@ type TierStatusData struct {
 
 type ExtendedProfileData struct {
 	ProfileCache
-	Positions     []*ExtendedPositionData `msgpack:"positions" json:"positions,omitempty"`
-	Orders        []*OrderData            `msgpack:"orders" json:"orders,omitempty"`
-	Notifications []*ProfileNotification  `msgpack:"notifications" json:"profile_notifications,omitempty"`
+	Positions       []*ExtendedPositionData `msgpack:"positions" json:"positions,omitempty"`
+	Orders          []*OrderData            `msgpack:"orders" json:"orders,omitempty"`
+	Notifications   []*ProfileNotification  `msgpack:"notifications" json:"profile_notifications,omitempty"`
+	IsolatedMargins []*IsolatedMargin       `msgpack:"isolated_margins" json:"isolated_margins,omitempty"`
 }
 
 type ExtendedProfileTierStatusData struct {
@@ -107,6 +109,11 @@ type OrderData struct {
 	TimeInForce     string            `msgpack:"time_in_force" json:"time_in_force"`
 	CreatedAt       int64             `msgpack:"created_at" json:"created_at"`
 	UpdatedAt       int64             `msgpack:"updated_at" json:"updated_at"`
+	CallbackValue   *tdecimal.Decimal `msgpack:"callback_value" json:"callback_value,omitempty"`
+	CallbackPercent *tdecimal.Decimal `msgpack:"callback_percent" json:"callback_percent,omitempty"`
+	GroupId         string            `msgpack:"group_id" json:"group_id,omitempty"`
+	GroupType       string            `msgpack:"group_type" json:"group_type,omitempty"`
+	TriggerBy       string            `msgpack:"trigger_by" json:"trigger_by,omitempty"`
 	ShardId         string            `msgpack:"shard_id" json:"-"`
 	ArchiveId       int               `msgpack:"archive_id" json:"-"`
 }
@@ -125,6 +132,11 @@ type PositionData struct {
 	FairPrice         *tdecimal.Decimal `msgpack:"fair_price" json:"fair_price,omitempty"`
 	ShardId           string            `msgpack:"shard_id" json:"-"`
 	ArchiveId         int               `msgpack:"archive_id" json:"-"`
+	// set by the api from the isolated margins of the profile
+	MarginMode     string            `msgpack:"-" json:"margin_mode,omitempty"`
+	IsolatedMargin *tdecimal.Decimal `msgpack:"-" json:"isolated_margin,omitempty"`
+	// set by the api from the ADL queue of the markets
+	AdlQuantile *uint `msgpack:"-" json:"adl_quantile,omitempty"`
 }
 
 type ExtendedPositionData struct {
@@ -158,10 +170,44 @@ type MarketData struct {
 	IconUrl               string            `msgpack:"icon_url" json:"icon_url"`
 	MarketTitle           string            `msgpack:"market_title" json:"market_title"`
 
+	MarkPrice      *tdecimal.Decimal `msgpack:"mark_price" json:"mark_price,omitempty"`
+	MarkPriceUsage []string          `msgpack:"mark_price_usage" json:"mark_price_usage,omitempty"`
+
+	// microseconds, 0 until the periodics or the funding service set it
+	NextFundingTime int64 `msgpack:"next_funding_time" json:"next_funding_time,omitempty"`
+
+	// set by the pricing service circuit breaker while the index price is frozen
+	PriceDegraded bool `msgpack:"price_degraded" json:"price_degraded"`
+
 	ShardId   string `msgpack:"shard_id" json:"-"`
 	ArchiveId int    `msgpack:"archive_id" json:"-"`
 }
 
+func (m *MarketData) IsPriceDegraded() bool {
+	return m.PriceDegraded
+}
+
+// true if the consumer (MARK_PRICE_USAGE_*) of this market uses the mark price instead of the fair price
+func (m *MarketData) UsesMarkPrice(usage string) bool {
+	if m.MarkPrice == nil || !m.MarkPrice.IsPositive() {
+		return false
+	}
+	for _, u := range m.MarkPriceUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// mark price or fair price, depending on the usage configured for the market
+func (m *MarketData) ReferencePrice(usage string) *tdecimal.Decimal {
+	if m.UsesMarkPrice(usage) {
+		return m.MarkPrice
+	}
+	return m.FairPrice
+}
+
 type TradeData struct {
 	TradeId     string           `msgpack:"id" json:"id"`
 	MarketId    string           `msgpack:"market_id" json:"market_id"`
@@ -174,6 +220,17 @@ type TradeData struct {
 	ArchiveId   uint64           `msgpack:"archive_id" json:"-"`
 }
 
+// fill of a liquidated profile, kind is orderbook or takeover by the insurance
+type LiquidationData struct {
+	Id        string           `msgpack:"id" json:"id"`
+	MarketId  string           `msgpack:"market_id" json:"market_id"`
+	Timestamp int64            `msgpack:"timestamp" json:"timestamp"`
+	Price     tdecimal.Decimal `msgpack:"price" json:"price"`
+	Size      tdecimal.Decimal `msgpack:"size" json:"size"`
+	Side      string           `msgpack:"side" json:"side"`
+	Kind      string           `msgpack:"kind" json:"kind"`
+}
+
 type FillData struct {
 	Id            string           `msgpack:"id" json:"id"`
 	ProfileId     uint             `msgpack:"profile_id" json:"profile_id"`
@@ -193,6 +250,37 @@ type FillData struct {
 	ArchiveId int    `msgpack:"archive_id" json:"-"`
 }
 
+// event is create, open, amend, fill, cancel or reject
+type OrderEvent struct {
+	Event string     `json:"event"`
+	Order *OrderData `json:"order"`
+}
+
+// update published on orders:<market>@<profile>, the sequence increases by one
+// with every update
+type OrderEventsData struct {
+	MarketId string        `json:"market_id"`
+	Sequence uint64        `json:"sequence"`
+	Events   []*OrderEvent `json:"events"`
+}
+
+// update published on fills:<market>@<profile>
+type FillEventsData struct {
+	MarketId string      `json:"market_id"`
+	Sequence uint64      `json:"sequence"`
+	Fills    []*FillData `json:"fills"`
+}
+
+type OrdersSnapshot struct {
+	Orders   []*OrderData `msgpack:"orders" json:"orders"`
+	Sequence uint64       `msgpack:"sequence" json:"sequence"`
+}
+
+type FillsSnapshot struct {
+	Fills    []*FillData `msgpack:"fills" json:"fills"`
+	Sequence uint64      `msgpack:"sequence" json:"sequence"`
+}
+
 type OrderbookData struct {
 	MarketID  string               `msgpack:"market_id" json:"market_id"`
 	Bids      [][]tdecimal.Decimal `msgpack:"bids" json:"bids,omitempty"`
@@ -53,9 +53,13 @@ function action.pack_create(
     size_percent,
     time_in_force,
 
-    matching_meta
+    matching_meta,
+    callback_value,
+    callback_percent,
+    trigger_by
 )
-    checks('number', 'string', 'string', 'boolean', 'string', 'string', '?decimal', '?decimal', '?string', '?decimal', '?decimal', 'string', '?table|matching_meta')
+    checks('number', 'string', 'string', 'boolean', 'string', 'string', '?decimal', '?decimal', '?string', '?decimal', '?decimal', 'string', '?table|matching_meta',
+        '?decimal', '?decimal', '?string')
 
     -- order in response format
     local order = {
@@ -72,6 +76,9 @@ function action.pack_create(
         trigger_price = trigger_price,
         size_percent = size_percent,
         time_in_force = time_in_force,
+        callback_value = callback_value,
+        callback_percent = callback_percent,
+        trigger_by = trigger_by,
     }
 
     local task_data = {
@@ -83,6 +90,31 @@ function action.pack_create(
     return order, task_data
 end
 
+-- orders are packed by <pack_create> before, the first one is the task order
+-- and gives its id to the group
+function action.pack_create_group(group_type, orders, matching_meta)
+    checks('string', 'table', '?table|matching_meta')
+
+    local group_id = orders[1].order_id
+    local legs = {}
+    for i, order in ipairs(orders) do
+        order.group_id = group_id
+        order.group_type = group_type
+        if i > 1 then
+            table.insert(legs, order)
+        end
+    end
+
+    local task_data = {
+        action = config.params.ORDER_ACTION.CREATE_GROUP,
+        order = orders[1],
+        legs = legs,
+        matching_meta = action.wrap_meta(matching_meta),
+    }
+
+    return orders, task_data
+end
+
 function action.pack_cancel(profile_id, market_id, order_id, client_order_id)
     checks('number', 'string', '?string', '?string')
 
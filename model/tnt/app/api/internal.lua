@@ -107,11 +107,13 @@ function i.white_list(profile_id)
 end
 
 
+-- cancels the orders in all the markets, or only in only_market_id when it's set
 function i.high_priority_cancell_all(
     profile_id,
-    is_liquidation
+    is_liquidation,
+    only_market_id
 )
-    checks('number', 'boolean')
+    checks('number', 'boolean', '?string')
 
     local res, e, profile, market, task, qname
 
@@ -122,6 +124,9 @@ function i.high_priority_cancell_all(
 
     for _, market in pairs(config.markets) do
         local market_id = market.id
+        if only_market_id ~= nil and market_id ~= only_market_id then
+            goto continue
+        end
 
         res = equeue.which_qname(market_id, config.sys.QUEUE_TYPE.MARKET)
         if res["error"] ~= nil then
@@ -140,6 +145,8 @@ function i.high_priority_cancell_all(
                 return {task = nil, order = nil, error = res["error"]}
             end
         end
+
+        ::continue::
     end
 
     equeue.inc_count(profile_id)
@@ -205,8 +212,8 @@ function i.queue_liq_actions(actions)
 end
 
 
-function i.is_cancel_all_accepted(profile_id)
-    checks('number')
+function i.is_cancel_all_accepted(profile_id, only_market_id)
+    checks('number', '?string')
 
     local is_accepted, res, qname
 
@@ -215,6 +222,9 @@ function i.is_cancel_all_accepted(profile_id)
     -- If any cancelall order still in the queue then it's not accepted
     for _, market in pairs(config.markets) do
         local market_id = market.id
+        if only_market_id ~= nil and market_id ~= only_market_id then
+            goto continue
+        end
 
         res = equeue.which_qname(market_id, config.sys.QUEUE_TYPE.MARKET)
         if res["error"] ~= nil then
@@ -227,6 +237,8 @@ function i.is_cancel_all_accepted(profile_id)
         if res["res"] ~= nil then
             is_accepted = false
         end
+
+        ::continue::
     end
 
     return {res=is_accepted, error=nil}
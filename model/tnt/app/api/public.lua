@@ -16,6 +16,7 @@ local rpc = require('app.rpc')
 local notif = require('app.api.notif')
 local deadman = require('app.api.deadman')
 
+require('app.errcodes')
 
 local PublicAPIError = errors.new_class("PUBLIC_API")
 
@@ -68,6 +69,29 @@ function save_client_order_id(profile_id, client_order_id, order_id, market_id)
     return nil
 end
 
+local function order_response(order)
+    return {
+        order_id = order.order_id,
+        market_id = order.market_id,
+        profile_id = order.profile_id,
+        status = order.status,
+        order_size = order.size,
+        order_price = order.price,
+        order_side = order.side,
+        order_type = order.order_type,
+        is_liquidation = order.is_liquidation,
+        client_order_id = order.client_order_id,
+        trigger_price = order.trigger_price,
+        size_percent = order.size_percent,
+        time_in_force = order.time_in_force,
+        callback_value = order.callback_value,
+        callback_percent = order.callback_percent,
+        group_id = order.group_id,
+        group_type = order.group_type,
+        trigger_by = order.trigger_by,
+    }
+end
+
 --[[
     1. Generate new order_id
     2. order.status = PROCESSING
@@ -75,7 +99,7 @@ end
     
     return: {task, order, err}
 --]]
-function p.new_order(
+local function create_order(
     profile_id,
     market_id,
     order_type,
@@ -88,18 +112,13 @@ function p.new_order(
     time_in_force,
     custom_order_id,
 
-    matching_meta
+    matching_meta,
+    callback_value,
+    callback_percent,
+    trigger_by
 )
-    checks('number', 'string', 'string', 'string', '?decimal', '?decimal', '?string', '?decimal', '?decimal', '?string', '?string', '?table|matching_meta')
     local res, err, profile, market
 
-    deadman.touch(profile_id)
-
-    res = equeue.check_limit(profile_id)
-    if res["error"] ~= nil then
-        return {task = nil, order = nil, error = tostring(res["error"])}
-    end
-
     rpc.callrw_profile("ensure_cache", {profile_id})
 
     profile, market, err = getters.load_profile_and_market(profile_id, market_id)
@@ -133,6 +152,9 @@ function p.new_order(
         trigger_price = trigger_price,
         size_percent = size_percent,
         time_in_force = time_in_force,
+        callback_value = callback_value,
+        callback_percent = callback_percent,
+        trigger_by = trigger_by,
     }
     err = risk.pre_create_order(order_req, market)
     if err ~= nil then
@@ -173,7 +195,10 @@ function p.new_order(
         order_req.size_percent,
         order_req.time_in_force,
 
-        matching_meta
+        matching_meta,
+        order_req.callback_value,
+        order_req.callback_percent,
+        order_req.trigger_by
     )
 
     res = equeue.put(qname, task_data, profile_id, order.order_id, tostring(order.order_type))
@@ -181,30 +206,244 @@ function p.new_order(
         log.error(PublicAPIError:new(res["error"]))
         return {task = nil, order = nil, error = tostring(res["error"])}
     end
-    equeue.inc_count(profile_id)
 
     save_client_order_id(profile_id, client_order_id, order_id, market_id)
 
     local c = metrics.counter('rabbitx_new_order_counter', 'Count the number of incomming orders')
     c:inc(1)
 
-    local order_res = {
-        order_id = order.order_id,
-        market_id = order.market_id,
-        profile_id = order.profile_id,
-        status = order.status,
-        order_size = order.size,
-        order_price = order.price,
-        order_side = order.side,
-        order_type = order.order_type,
-        is_liquidation = order.is_liquidation,
-        client_order_id = order.client_order_id,
-        trigger_price = order.trigger_price,
-        size_percent = order.size_percent,
-        time_in_force = order.time_in_force,
-    }
+    return {task = res["res"], order = order_response(order), error = nil}
+end
 
-    return {task = res["res"], order = order_res, error = nil}
+function p.new_order(
+    profile_id,
+    market_id,
+    order_type,
+    order_side,
+    order_price,
+    order_size,
+    client_order_id,
+    trigger_price,
+    size_percent,
+    time_in_force,
+    custom_order_id,
+
+    matching_meta,
+    callback_value,
+    callback_percent,
+    trigger_by
+)
+    checks('number', 'string', 'string', 'string', '?decimal', '?decimal', '?string', '?decimal', '?decimal', '?string', '?string', '?table|matching_meta',
+        '?decimal', '?decimal', '?string')
+
+    deadman.touch(profile_id)
+
+    local res = equeue.check_limit(profile_id)
+    if res["error"] ~= nil then
+        return {task = nil, order = nil, error = tostring(res["error"])}
+    end
+
+    res = create_order(
+        profile_id,
+        market_id,
+        order_type,
+        order_side,
+        order_price,
+        order_size,
+        client_order_id,
+        trigger_price,
+        size_percent,
+        time_in_force,
+        custom_order_id,
+
+        matching_meta,
+        callback_value,
+        callback_percent,
+        trigger_by
+    )
+    if res.task ~= nil then
+        equeue.inc_count(profile_id)
+    end
+
+    return res
+end
+
+
+--[[
+    OCO pair or bracket (limit entry with its take profit and stop loss),
+    all orders go to the engine in one task and are created there together.
+    Items are positional:
+      {order_type, side, price, size, client_order_id,
+       trigger_price, size_percent, time_in_force, trigger_by}
+
+    return: {task, orders, err}
+--]]
+local function create_order_group(
+    profile_id,
+    market_id,
+    group_type,
+    items,
+
+    matching_meta
+)
+    local res, err, profile, market
+
+    rpc.callrw_profile("ensure_cache", {profile_id})
+
+    profile, market, err = getters.load_profile_and_market(profile_id, market_id)
+    if err ~= nil then
+        return {task = nil, orders = nil, error = tostring(err)}
+    end
+
+    err = risk.check_profile(profile)
+    if err ~= nil then
+        return {task = nil, orders = nil, error = tostring(err)}
+    end
+
+    err = risk.check_market(market)
+    if err ~= nil then
+        return {task = nil, orders = nil, error = tostring(err)}
+    end
+
+    local order_types = {}
+    for i, item in ipairs(items) do
+        order_types[i] = item[1]
+    end
+    err = risk.check_order_group(group_type, order_types)
+    if err ~= nil then
+        return {task = nil, orders = nil, error = tostring(err)}
+    end
+
+    local order_reqs = {}
+    local used_client_order_ids = {}
+    for i, item in ipairs(items) do
+        local client_order_id = item[5]
+        if is_client_order_id_available(profile_id, client_order_id) == false or
+            (client_order_id ~= nil and used_client_order_ids[client_order_id] ~= nil) then
+            return {task = nil, orders = nil, error = ERR_CLIENT_ORDER_ID_DUPLICATE}
+        end
+        if client_order_id ~= nil and client_order_id ~= "" then
+            used_client_order_ids[client_order_id] = true
+        end
+
+        local order_req = {
+            profile_id = profile_id,
+            market_id = market_id,
+            order_type = item[1],
+            side = item[2],
+            price = item[3],
+            size = item[4],
+            client_order_id = client_order_id,
+            trigger_price = item[6],
+            size_percent = item[7],
+            time_in_force = item[8],
+            trigger_by = item[9],
+        }
+
+        -- bracket children close the entry, the side is refined by the position on activation
+        if group_type == config.params.ORDER_GROUP_TYPE.BRACKET and i > 1 then
+            order_req.side = order_reqs[1].side == config.params.LONG and config.params.SHORT or config.params.LONG
+        end
+        if order_req.side == nil then
+            order_req.side = ""
+        end
+
+        err = risk.pre_create_order(order_req, market)
+        if err ~= nil then
+            log.error(PublicAPIError:new('%s: slog=%s', err, json.encode(order_req)))
+            return {task = nil, orders = nil, error = tostring(err)}
+        end
+        order_reqs[i] = order_req
+    end
+
+    -- PUT GROUP TO THE QUEUE --
+
+    res = equeue.which_qname(market_id, config.sys.QUEUE_TYPE.MARKET)
+    if res["error"] ~= nil then
+        log.error(PublicAPIError:new(res["error"]))
+        return {task = nil, orders = nil, error = tostring(res["error"])}
+    end
+    local qname = res["res"]
+
+    res = equeue.check_queue_limit(qname)
+    if res["error"] ~= nil then
+        return {task = nil, orders = nil, error = tostring(res["error"])}
+    end
+
+    local orders = {}
+    for i, order_req in ipairs(order_reqs) do
+        orders[i] = action.pack_create(
+            order_req.profile_id,
+            order_req.market_id,
+            setters.next_order_id(market_id),
+            false,
+            order_req.side,
+            order_req.order_type,
+            order_req.size,
+            order_req.price,
+            order_req.client_order_id,
+            order_req.trigger_price,
+            order_req.size_percent,
+            order_req.time_in_force,
+
+            nil,
+            nil,
+            nil,
+            order_req.trigger_by
+        )
+    end
+
+    local task_data
+    orders, task_data = action.pack_create_group(group_type, orders, matching_meta)
+
+    res = equeue.put(qname, task_data, profile_id, orders[1].order_id, tostring(orders[1].order_type))
+    if res["error"] ~= nil then
+        log.error(PublicAPIError:new(res["error"]))
+        return {task = nil, orders = nil, error = tostring(res["error"])}
+    end
+
+    local orders_res = {}
+    for i, order in ipairs(orders) do
+        save_client_order_id(profile_id, order.client_order_id, order.order_id, market_id)
+        orders_res[i] = order_response(order)
+    end
+
+    local c = metrics.counter('rabbitx_new_order_counter', 'Count the number of incomming orders')
+    c:inc(#orders)
+
+    return {task = res["res"], orders = orders_res, error = nil}
+end
+
+function p.new_order_group(
+    profile_id,
+    market_id,
+    group_type,
+    items,
+
+    matching_meta
+)
+    checks('number', 'string', 'string', 'table', '?table|matching_meta')
+
+    deadman.touch(profile_id)
+
+    local res = equeue.check_limit(profile_id)
+    if res["error"] ~= nil then
+        return {task = nil, orders = nil, error = tostring(res["error"])}
+    end
+
+    res = create_order_group(
+        profile_id,
+        market_id,
+        group_type,
+        items,
+
+        matching_meta
+    )
+    if res.task ~= nil then
+        equeue.inc_count(profile_id)
+    end
+
+    return res
 end
 
 
@@ -215,16 +454,12 @@ end
     
     return: {task, order, err}
 --]]
-function p.cancel_order(
+local function cancel_order(
     profile_id,
     market_id,
     order_id,
     client_order_id
 )
-    checks('number', 'string', '?string', '?string')
-    
-    deadman.touch(profile_id)
-
     if (order_id == nil or order_id == "") and 
         (client_order_id == nil or client_order_id == "") then
             return {task = nil, order = nil, error = "ORDER_ID_OR_CLIENT_ORDER_ID_REQUIRED"}
@@ -232,11 +467,6 @@ function p.cancel_order(
 
     local res, e, profile, market, task, qname
 
-    res = equeue.check_limit(profile_id)
-    if res["error"] ~= nil then
-        return {task = nil, order = nil, error = res["error"]}
-    end
-
     rpc.callrw_profile("ensure_cache", {profile_id})
 
     profile, market, e = getters.load_profile_and_market(profile_id, market_id)
@@ -340,10 +570,32 @@ function p.cancel_order(
     local c = metrics.counter('rabbitx_cancel_order_counter')
     c:inc(1)
 
-    equeue.inc_count(profile_id)
     return {task = res["res"], order = order, error = nil}
 end
 
+function p.cancel_order(
+    profile_id,
+    market_id,
+    order_id,
+    client_order_id
+)
+    checks('number', 'string', '?string', '?string')
+    
+    deadman.touch(profile_id)
+
+    local res = equeue.check_limit(profile_id)
+    if res["error"] ~= nil then
+        return {task = nil, order = nil, error = res["error"]}
+    end
+
+    res = cancel_order(profile_id, market_id, order_id, client_order_id)
+    if res.task ~= nil then
+        equeue.inc_count(profile_id)
+    end
+
+    return res
+end
+
 --[[
     1. If order_id in queue error
     2. Amend action duplicates check 
@@ -351,7 +603,7 @@ end
     
     return: {task, order, error}
 --]]
-function p.amend_order(
+local function amend_order(
     profile_id,
     market_id,
     order_id,
@@ -360,17 +612,8 @@ function p.amend_order(
     new_trigger_price,
     new_size_percent
 )
-    checks('number', 'string', 'string', '?decimal', '?decimal', '?decimal', '?decimal')
-
-    deadman.touch(profile_id)
-
     local res, err, profile, market
 
-    res = equeue.check_limit(profile_id)
-    if res["error"] ~= nil then
-        return {task = nil, order = nil, error = tostring(res["error"])}
-    end
-
     rpc.callrw_profile("ensure_cache", {profile_id})
 
     profile, market, err = getters.load_profile_and_market(profile_id, market_id)
@@ -457,7 +700,6 @@ function p.amend_order(
     if res["error"] ~= nil then
         return {task = nil, order = nil, error = tostring(res["error"])}
     end
-    equeue.inc_count(profile_id)
 
     local c = metrics.counter('rabbitx_amend_order_counter')
     c:inc(1)
@@ -475,6 +717,156 @@ function p.amend_order(
     return {task = res["res"], order = order_res, error = nil}
 end
 
+function p.amend_order(
+    profile_id,
+    market_id,
+    order_id,
+    new_price,
+    new_size,
+    new_trigger_price,
+    new_size_percent
+)
+    checks('number', 'string', 'string', '?decimal', '?decimal', '?decimal', '?decimal')
+
+    deadman.touch(profile_id)
+
+    local res = equeue.check_limit(profile_id)
+    if res["error"] ~= nil then
+        return {task = nil, order = nil, error = tostring(res["error"])}
+    end
+
+    res = amend_order(
+        profile_id,
+        market_id,
+        order_id,
+        new_price,
+        new_size,
+        new_trigger_price,
+        new_size_percent
+    )
+    if res.task ~= nil then
+        equeue.inc_count(profile_id)
+    end
+
+    return res
+end
+
+--[[
+    Batch of create/amend/cancel actions for ONE market.
+
+    Each item is a positional tuple (see model.OrderBatchItem):
+      {action, order_type, side, price, size, client_order_id,
+       trigger_price, size_percent, time_in_force, order_id, trigger_by,
+       callback_value, callback_percent}
+
+    The whole batch is counted as one request by the rate limiter,
+    every item gets its own result, a failed item doesn't stop the rest.
+
+    return: {res = {{action, order, error}, ...}, error}
+--]]
+local function batch_item(profile_id, market_id, item, matching_meta)
+    local item_action = item[1]
+
+    if item_action == config.params.ORDER_ACTION.CREATE then
+        return create_order(
+            profile_id,
+            market_id,
+            item[2],
+            item[3],
+            item[4],
+            item[5],
+            item[6],
+            item[7],
+            item[8],
+            item[9],
+            nil,
+
+            matching_meta,
+            item[12],
+            item[13],
+            item[11]
+        )
+    elseif item_action == config.params.ORDER_ACTION.AMEND then
+        return amend_order(
+            profile_id,
+            market_id,
+            item[10],
+            item[4],
+            item[5],
+            item[7],
+            item[8]
+        )
+    elseif item_action == config.params.ORDER_ACTION.CANCEL then
+        return cancel_order(
+            profile_id,
+            market_id,
+            item[10],
+            item[6]
+        )
+    end
+
+    return {task = nil, order = nil, error = ERR_BATCH_UNKNOWN_ACTION}
+end
+
+function p.batch_orders(
+    profile_id,
+    market_id,
+    items,
+
+    matching_meta
+)
+    checks('number', 'string', 'table', '?table|matching_meta')
+
+    if #items == 0 then
+        return {res = nil, error = ERR_BATCH_EMPTY}
+    end
+
+    if #items > config.params.MAX_BATCH_ORDERS then
+        return {res = nil, error = ERR_BATCH_TOO_LARGE}
+    end
+
+    deadman.touch(profile_id)
+
+    local res = equeue.check_limit(profile_id)
+    if res["error"] ~= nil then
+        return {res = nil, error = tostring(res["error"])}
+    end
+
+    local results = {}
+    local queued = false
+    for i, item in ipairs(items) do
+        local ok, item_res = pcall(batch_item, profile_id, market_id, item, matching_meta)
+        if ok == false then
+            log.error(PublicAPIError:new('batch item %d: %s', i, tostring(item_res)))
+            item_res = {task = nil, order = nil, error = tostring(item_res)}
+        end
+
+        if item_res.task ~= nil then
+            queued = true
+        end
+
+        local item_err = nil
+        if item_res.error ~= nil then
+            item_err = tostring(item_res.error)
+        end
+
+        results[i] = {
+            action = item[1],
+            order = item_res.order,
+            error = item_err,
+        }
+    end
+
+    if queued == true then
+        equeue.inc_count(profile_id)
+    end
+
+    local c = metrics.counter('rabbitx_batch_order_counter', 'Count the number of incomming order batches')
+    c:inc(1)
+
+    return {res = results, error = nil}
+end
+
 --[[
     --Dumb implementation of CANCEL ALL
     - Remove all orders from all queues for each market
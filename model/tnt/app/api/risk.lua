@@ -2,6 +2,7 @@ local checks = require('checks')
 local log = require('log')
 
 local config = require('app.config')
+local m = require('app.engine.market')
 local errors = require('app.lib.errors')
 local tick = require('app.lib.tick')
 local util = require('app.util')
@@ -609,7 +610,7 @@ function stop_limit_order.pre_create(order, market, market_config)
         return text
     end
 
-    local fair_price = market.fair_price
+    local source_price = m.trigger_price(market, order.trigger_by)
 
     if order.side == config.params.LONG then
         local max_price = order.trigger_price * config.params.LIMIT_BUY_RATIO
@@ -617,10 +618,10 @@ function stop_limit_order.pre_create(order, market, market_config)
             --ERR_ORDER_PRICE_OVERFLOW
             return string.format("RiskManager CheckOrderParams: price=%s should be less/equal than=%s", order.price, max_price)
         end
-        if  order.trigger_price <= fair_price then
+        if  order.trigger_price <= source_price then
             -- immediate buying is forbidden
             --ERR_ORDER_IMMEDIATE_EXECUTION
-            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be greater than=%s", order.trigger_price, fair_price)
+            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be greater than=%s", order.trigger_price, source_price)
         end
     else
         local min_price = order.trigger_price * config.params.LIMIT_SELL_RATIO
@@ -628,10 +629,10 @@ function stop_limit_order.pre_create(order, market, market_config)
             --ERR_ORDER_PRICE_OVERFLOW
             return string.format("RiskManager CheckOrderParams: price=%s should be greater/equal than=%s", order.price, min_price)
         end
-        if  order.trigger_price >= fair_price then
+        if  order.trigger_price >= source_price then
             -- immediate selling is forbidden
             --ERR_ORDER_IMMEDIATE_EXECUTION
-            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be less than=%s", order.trigger_price, fair_price)
+            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be less than=%s", order.trigger_price, source_price)
         end
     end
 
@@ -690,7 +691,7 @@ function stop_limit_order.pre_amend(amend_order, order, market, market_config)
             return text
         end
 
-        local fair_price = market.fair_price
+        local source_price = m.trigger_price(market, order.trigger_by)
 
         if order.side == config.params.LONG then
             local max_price = order.trigger_price * config.params.LIMIT_BUY_RATIO
@@ -698,10 +699,10 @@ function stop_limit_order.pre_amend(amend_order, order, market, market_config)
                 --ERR_ORDER_PRICE_OVERFLOW
                 return string.format("RiskManager CheckOrderParams: price=%s should be less/equal than=%s", amend_order.price, max_price)
             end
-            if  order.trigger_price <= fair_price then
+            if  order.trigger_price <= source_price then
                 -- immediate buying is forbidden
                 --ERR_ORDER_IMMEDIATE_EXECUTION
-                return string.format("RiskManager CheckOrderParams: trigger-price=%s should be greater than=%s", order.trigger_price, fair_price)
+                return string.format("RiskManager CheckOrderParams: trigger-price=%s should be greater than=%s", order.trigger_price, source_price)
             end
         else
             local min_price = order.trigger_price * config.params.LIMIT_SELL_RATIO
@@ -709,10 +710,10 @@ function stop_limit_order.pre_amend(amend_order, order, market, market_config)
                 --ERR_ORDER_PRICE_OVERFLOW
                 return string.format("RiskManager CheckOrderParams: price=%s should be greater/equal than=%s", amend_order.price, min_price)
             end
-            if  order.trigger_price >= fair_price then
+            if  order.trigger_price >= source_price then
                 -- immediate selling is forbidden
                 --ERR_ORDER_IMMEDIATE_EXECUTION
-                return string.format("RiskManager CheckOrderParams: trigger-price=%s should be less than=%s", order.trigger_price, fair_price)
+                return string.format("RiskManager CheckOrderParams: trigger-price=%s should be less than=%s", order.trigger_price, source_price)
             end
         end
 
@@ -729,20 +730,11 @@ function stop_limit_order.pre_amend(amend_order, order, market, market_config)
     return nil
 end
 
-local stop_market_order = {}
+local stop_market_common = {}
 
-function stop_market_order.pre_create(order, market, market_config)
+function stop_market_common.pre_create(order, market, market_config)
     checks('table|api_create_order', 'table|engine_market', 'table')
 
-    if order.order_type ~= config.params.ORDER_TYPE.STOP_MARKET then
-        local err = RiskError:new(ERR_INTEGRITY_ERROR)
-        log.error({
-            message = err:backtrace(),
-            [ALERT_TAG] = ALERT_CRIT,
-        })
-        return err
-    end
-
     if order.time_in_force ~= config.params.TIME_IN_FORCE.GTC then
         --ERR_WRONG_TIME_IN_FORCE
         return string.format("RiskManager CheckOrderParams: invalid time-in-force=%s", order.time_in_force)
@@ -766,19 +758,19 @@ function stop_market_order.pre_create(order, market, market_config)
         return text
     end
 
-    local fair_price = market.fair_price
+    local source_price = m.trigger_price(market, order.trigger_by)
 
     if order.side == config.params.LONG then
-        if  order.trigger_price <= fair_price then
+        if  order.trigger_price <= source_price then
             -- immediate buying is forbidden
             --ERR_ORDER_IMMEDIATE_EXECUTION
-            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be greater than=%s", order.trigger_price, fair_price)
+            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be greater than=%s", order.trigger_price, source_price)
         end
     else
-        if  order.trigger_price >= fair_price then
+        if  order.trigger_price >= source_price then
             -- immediate selling is forbidden
             --ERR_ORDER_IMMEDIATE_EXECUTION
-            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be less than=%s", order.trigger_price, fair_price)
+            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be less than=%s", order.trigger_price, source_price)
         end
     end
     local ratio = (order.side == config.params.LONG)
@@ -798,18 +790,9 @@ function stop_market_order.pre_create(order, market, market_config)
     return nil
 end
 
-function stop_market_order.pre_amend(amend_order, order, market, market_config)
+function stop_market_common.pre_amend(amend_order, order, market, market_config)
     checks('table|api_amend_order', 'table|engine_order', 'table|engine_market', 'table')
 
-    if order.order_type ~= config.params.ORDER_TYPE.STOP_MARKET then
-        local err = RiskError:new(ERR_INTEGRITY_ERROR)
-        log.error({
-            message = err:backtrace(),
-            [ALERT_TAG] = ALERT_CRIT,
-        })
-        return err
-    end
-
     if order.status ~= config.params.ORDER_STATUS.PLACED then
         return pre_amend_as_limit_order(amend_order, order, market, market_config)
     else
@@ -833,25 +816,129 @@ function stop_market_order.pre_amend(amend_order, order, market, market_config)
         end
     end
 
-    local fair_price = market.fair_price
+    local source_price = m.trigger_price(market, order.trigger_by)
 
     if order.side == config.params.LONG then
-        if  order.trigger_price <= fair_price then
+        if  order.trigger_price <= source_price then
             -- immediate buying is forbidden
             --ERR_ORDER_IMMEDIATE_EXECUTION
-            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be greater than=%s", order.trigger_price, fair_price)
+            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be greater than=%s", order.trigger_price, source_price)
         end
     else
-        if  order.trigger_price >= fair_price then
+        if  order.trigger_price >= source_price then
             -- immediate selling is forbidden
             --ERR_ORDER_IMMEDIATE_EXECUTION
-            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be less than=%s", order.trigger_price, fair_price)
+            return string.format("RiskManager CheckOrderParams: trigger-price=%s should be less than=%s", order.trigger_price, source_price)
+        end
+    end
+
+    return nil
+end
+
+local stop_market_order = {}
+
+function stop_market_order.pre_create(order, market, market_config)
+    checks('table|api_create_order', 'table|engine_market', 'table')
+
+    if order.order_type ~= config.params.ORDER_TYPE.STOP_MARKET then
+        local err = RiskError:new(ERR_INTEGRITY_ERROR)
+        log.error({
+            message = err:backtrace(),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return err
+    end
+
+    return stop_market_common.pre_create(order, market, market_config)
+end
+
+function stop_market_order.pre_amend(amend_order, order, market, market_config)
+    checks('table|api_amend_order', 'table|engine_order', 'table|engine_market', 'table')
+
+    if order.order_type ~= config.params.ORDER_TYPE.STOP_MARKET then
+        local err = RiskError:new(ERR_INTEGRITY_ERROR)
+        log.error({
+            message = err:backtrace(),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return err
+    end
+
+    return stop_market_common.pre_amend(amend_order, order, market, market_config)
+end
+
+-- validates the callback and puts the initial trigger at the callback
+-- distance from the trigger source price when it's not given
+local function trailing_stop_callback(order, market)
+    local has_value = order.callback_value ~= nil and order.callback_value > 0
+    local has_percent = order.callback_percent ~= nil and order.callback_percent > 0
+    if has_value == has_percent then
+        return string.format("%s: exactly one of callback_value and callback_percent is required", ERR_WRONG_TRAILING_CALLBACK)
+    end
+
+    local source_price = m.trigger_price(market, order.trigger_by)
+    local distance
+    if has_value then
+        local near_value = tick.round_to_nearest_tick(order.callback_value, market.min_tick)
+        if near_value ~= order.callback_value then
+            return "bad_callback_value has=" .. tostring(order.callback_value) .. " required=" .. tostring(near_value)
+        end
+        distance = order.callback_value
+    else
+        if order.callback_percent >= 1 then
+            return string.format("%s: callback_percent=%s should be less than 1", ERR_WRONG_TRAILING_CALLBACK, order.callback_percent)
+        end
+        distance = source_price * order.callback_percent
+    end
+
+    if order.trigger_price == nil or order.trigger_price <= 0 then
+        if order.side == config.params.LONG then
+            order.trigger_price = tick.round_to_nearest_tick(source_price + distance, market.min_tick)
+        else
+            order.trigger_price = tick.round_to_nearest_tick(source_price - distance, market.min_tick)
         end
     end
 
     return nil
 end
 
+local trailing_stop_order = {}
+
+function trailing_stop_order.pre_create(order, market, market_config)
+    checks('table|api_create_order', 'table|engine_market', 'table')
+
+    if order.order_type ~= config.params.ORDER_TYPE.TRAILING_STOP then
+        local err = RiskError:new(ERR_INTEGRITY_ERROR)
+        log.error({
+            message = err:backtrace(),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return err
+    end
+
+    local err = trailing_stop_callback(order, market)
+    if err ~= nil then
+        return err
+    end
+
+    return stop_market_common.pre_create(order, market, market_config)
+end
+
+function trailing_stop_order.pre_amend(amend_order, order, market, market_config)
+    checks('table|api_amend_order', 'table|engine_order', 'table|engine_market', 'table')
+
+    if order.order_type ~= config.params.ORDER_TYPE.TRAILING_STOP then
+        local err = RiskError:new(ERR_INTEGRITY_ERROR)
+        log.error({
+            message = err:backtrace(),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return err
+    end
+
+    return stop_market_common.pre_amend(amend_order, order, market, market_config)
+end
+
 local ping_limit_order = {}
 
 function ping_limit_order.pre_create(order, market, market_config)
@@ -941,6 +1028,7 @@ local risk = {
         take_profit_limit = take_profit_limit_order,
         stop_limit = stop_limit_order,
         stop_market = stop_market_order,
+        trailing_stop = trailing_stop_order,
         ping_limit = ping_limit_order,
     },
 }
@@ -986,6 +1074,13 @@ function risk.pre_create_order(order, market)
         end
     end
 
+    if order.trigger_by ~= nil and order.trigger_by ~= '' then
+        local tb = config.params.TRIGGER_BY
+        if not util.is_value_in(order.trigger_by, {tb.MARK, tb.LAST, tb.INDEX}) then
+            return string.format('%s: trigger_by=%s', ERR_WRONG_TRIGGER_BY, order.trigger_by)
+        end
+    end
+
     local order_mtype = risk._order_metatypes[order.order_type]
     if order_mtype == nil then
         log.error("order handler not found: order_id=%s, order_type=%s", order.id, order.order_type)
@@ -1001,6 +1096,70 @@ function risk.pre_create_order(order, market)
     return nil
 end
 
+local oco_order_types = {
+    config.params.ORDER_TYPE.STOP_LOSS,
+    config.params.ORDER_TYPE.TAKE_PROFIT,
+    config.params.ORDER_TYPE.STOP_LOSS_LIMIT,
+    config.params.ORDER_TYPE.TAKE_PROFIT_LIMIT,
+    config.params.ORDER_TYPE.STOP_LIMIT,
+    config.params.ORDER_TYPE.STOP_MARKET,
+}
+
+local bracket_stop_loss_types = {
+    config.params.ORDER_TYPE.STOP_LOSS,
+    config.params.ORDER_TYPE.STOP_LOSS_LIMIT,
+}
+
+local bracket_take_profit_types = {
+    config.params.ORDER_TYPE.TAKE_PROFIT,
+    config.params.ORDER_TYPE.TAKE_PROFIT_LIMIT,
+}
+
+-- shape of the group only, every order is checked by its own type later
+function risk.check_order_group(group_type, order_types)
+    checks('string', 'table')
+
+    if group_type == config.params.ORDER_GROUP_TYPE.OCO then
+        if #order_types ~= 2 then
+            return string.format('%s: oco requires 2 orders', ERR_WRONG_ORDER_GROUP)
+        end
+        for _, order_type in ipairs(order_types) do
+            if not util.is_value_in(order_type, oco_order_types) then
+                return string.format('%s: order_type=%s not allowed in oco', ERR_WRONG_ORDER_GROUP, order_type)
+            end
+        end
+
+        return nil
+    end
+
+    if group_type == config.params.ORDER_GROUP_TYPE.BRACKET then
+        if #order_types < 2 or #order_types > 3 then
+            return string.format('%s: bracket requires an entry and 1 or 2 children', ERR_WRONG_ORDER_GROUP)
+        end
+        if order_types[1] ~= config.params.ORDER_TYPE.LIMIT then
+            return string.format('%s: bracket entry must be limit', ERR_WRONG_ORDER_GROUP)
+        end
+
+        local stop_loss, take_profit = 0, 0
+        for i = 2, #order_types do
+            if util.is_value_in(order_types[i], bracket_stop_loss_types) then
+                stop_loss = stop_loss + 1
+            elseif util.is_value_in(order_types[i], bracket_take_profit_types) then
+                take_profit = take_profit + 1
+            else
+                return string.format('%s: order_type=%s not allowed in bracket', ERR_WRONG_ORDER_GROUP, order_types[i])
+            end
+        end
+        if stop_loss > 1 or take_profit > 1 then
+            return string.format('%s: bracket allows one stop loss and one take profit', ERR_WRONG_ORDER_GROUP)
+        end
+
+        return nil
+    end
+
+    return string.format('%s: unknown group_type=%s', ERR_WRONG_ORDER_GROUP, group_type)
+end
+
 function risk.pre_amend_order(amend_order, order, market)
     checks('table|api_amend_order', 'table|engine_order', 'table|engine_market')
 
@@ -24,6 +24,11 @@ local VaultError = errors.new_class("VAULT")
 
 local SETTLEMENT_STATUS_ID = 0
 local SETTLEMENT_STATUS_DUMMY_CONTRACT = ""
+local PROCESSED_BLOCK_HASHES_LIMIT = 256
+-- reasons of the withdrawals seen by the settlement withdrawal policy
+local WITHDRAWAL_CHECKED = "checked"
+local WITHDRAWAL_APPROVED = "approved"
+local WITHDRAWAL_REJECTED = "rejected"
 local balance = {
     _shard_num = 0
 }
@@ -258,6 +263,24 @@ function balance.init_spaces(shard_num)
         if_not_exists = true
     })
 
+    -- hash of the last block of each processed block range and the ids (ops_id2)
+    -- of the deposits and stakes found in the range, to detect chain reorgs
+    local processed_block_hashes = box.schema.space.create('processed_block_hashes', { if_not_exists = true })
+    processed_block_hashes:format({
+        { name = 'contract_address', type = 'string' },
+        { name = 'chain_id',         type = 'unsigned' },
+        { name = 'event_type',       type = 'string' },
+        { name = 'block_number',     type = 'unsigned' },
+        { name = 'block_hash',       type = 'string' },
+        { name = 'ops',              type = 'array' },
+    })
+
+    processed_block_hashes:create_index('primary', {
+        unique = true,
+        parts = { { field = 'contract_address' }, { field = 'chain_id' }, { field = 'event_type' }, { field = 'block_number' } },
+        if_not_exists = true
+    })
+
     local vaults
     vaults, err = archiver.create('vaults', { if_not_exists = true }, {
         { name = 'vault_profile_id',     type = 'unsigned' },
@@ -337,9 +360,109 @@ function balance.init_spaces(shard_num)
     create_lock_space('stake_lock')
     create_lock_space('unstake_lock')
 
+    -- every insurance fund inflow/outflow tied to the profile that triggered it,
+    -- deposits live on the profile instance, liquidations on the market instances
+    local insurance_ledger
+    insurance_ledger, err = archiver.create('insurance_ledger', { if_not_exists = true }, {
+        { name = 'id',           type = 'string' },
+        { name = 'insurance_id', type = 'unsigned' },
+        { name = 'profile_id',   type = 'unsigned' },
+        { name = 'market_id',    type = 'string' },
+        { name = 'kind',         type = 'string' },
+        { name = 'amount',       type = 'decimal' },
+        { name = 'ref_id',       type = 'string' }, -- trade or balance operation id
+        { name = 'timestamp',    type = 'number' },
+    }, {
+        unique = true,
+        parts = { { field = 'id' } },
+        if_not_exists = true,
+    })
+    if err ~= nil then
+        log.error(BalanceError:new(err))
+        error(err)
+    end
+
+    insurance_ledger:create_index('market_kind_timestamp', {
+        parts = { { field = 'market_id' }, { field = 'kind' }, { field = 'timestamp' } },
+        unique = false,
+        if_not_exists = true
+    })
+
+    -- profile the fills of an insurance selloff order are attributed to,
+    -- pinned when the order is placed
+    local insurance_order = box.schema.space.create('insurance_order', { if_not_exists = true })
+    insurance_order:format({
+        { name = 'order_id',   type = 'string' },
+        { name = 'profile_id', type = 'unsigned' },
+    })
+    insurance_order:create_index('primary', {
+        unique = true,
+        parts = { { field = 'order_id' } },
+        if_not_exists = true
+    })
+
     return true
 end
 
+-- must be called inside the transaction of the balance change it records
+function balance.record_insurance(insurance_id, profile_id, market_id, kind, amount, ref_id)
+    checks('number', 'number', 'string', 'string', 'decimal', 'string')
+
+    local _, err = archiver.insert(box.space.insurance_ledger, {
+        uuid.str(),
+        insurance_id,
+        profile_id,
+        market_id,
+        kind,
+        amount,
+        ref_id,
+        time.now(),
+    })
+    if err ~= nil then
+        log.error(BalanceError:new(err))
+        return err
+    end
+
+    return nil
+end
+
+-- profile whose position was the last one taken over by the insurance in the market
+function balance.last_insurance_takeover(market_id)
+    checks('string')
+
+    local last = box.space.insurance_ledger.index.market_kind_timestamp:max(
+        { market_id, config.params.INSURANCE_LEDGER_KIND.TAKEOVER_PNL })
+    if last == nil then
+        return nil
+    end
+
+    return last.profile_id
+end
+
+function balance.pin_insurance_order(order_id, profile_id)
+    checks('string', 'number')
+
+    box.space.insurance_order:replace({order_id, profile_id})
+end
+
+function balance.unpin_insurance_order(order_id)
+    checks('string')
+
+    box.space.insurance_order:delete(order_id)
+end
+
+-- nil if the order was not placed by the insurance for a taken over position
+function balance.insurance_order_trigger(order_id)
+    checks('string')
+
+    local pin = box.space.insurance_order:get(order_id)
+    if pin == nil then
+        return nil
+    end
+
+    return pin.profile_id
+end
+
 function balance.max_withdraw_amount()
     local exist = box.space.max_withdraw_amount:get("default")
     if exist == nil then
@@ -488,6 +611,14 @@ function balance.check_withdraw_allowed(profile_id)
             return { res = nil, error = err }
         end
     end
+    if exist == nil then
+        exist, err = balance.find_bop(config.params.BALANCE_TYPE.WITHDRAWAL, profile_id,
+            config.params.BALANCE_STATUS.REVIEW)
+        if err ~= nil then
+            box.rollback()
+            return { res = nil, error = err }
+        end
+    end
 
     if exist ~= nil then
         box.rollback()
@@ -516,6 +647,7 @@ end
 -- We allow to cancel only:
 -- PENDING: means that transaction just created
 -- CLAIMABLE: means that 6 hours passed, but it was never signed
+-- REVIEW: means that it's held by the withdrawal policy
 function balance.cancel_withdrawal(profile_id, bops_id)
     checks('number', 'string')
 
@@ -537,6 +669,15 @@ function balance.cancel_withdrawal(profile_id, bops_id)
             return { res = nil, error = err }
         end
     end
+    if exist == nil then
+        exist, err = balance.find_bop(config.params.BALANCE_TYPE.WITHDRAWAL, profile_id,
+            config.params.BALANCE_STATUS.REVIEW,
+            bops_id)
+        if err ~= nil then
+            box.rollback()
+            return { res = nil, error = err }
+        end
+    end
     if exist == nil then
         box.rollback()
         return { res = nil, error = "NO_PENDING_WITHDRAWAL" }
@@ -1268,8 +1409,10 @@ function balance.process_deposit(profile_id, wallet, deposit_id, amount, txhash,
 
     box.begin()
 
+    -- a deposit reversed by a reorg is credited again when its log is back
+    -- in the canonical chain
     local exist = box.space.balance_operations.index.ops_id2:get(deposit_id)
-    if exist ~= nil then
+    if exist ~= nil and exist.status ~= config.params.BALANCE_STATUS.REORGED then
         local text = "DUPLICATE ID update attempt for ops_id2=" .. deposit_id
         box.rollback()
         return { res = nil, error = text }
@@ -1288,7 +1431,7 @@ function balance.process_deposit(profile_id, wallet, deposit_id, amount, txhash,
     -- is known at the time of balance op creation, so if the
     -- balance op existed we would have found it in the previous
     -- search by ops_id2.
-    if not isPoolDeposit then
+    if exist == nil and not isPoolDeposit then
         exist = box.space.balance_operations.index.txhash:min { txhash }
     end
 
@@ -1321,7 +1464,8 @@ function balance.process_deposit(profile_id, wallet, deposit_id, amount, txhash,
     --
     -- If it is neither pending nor canceled that's an error
 
-    if exist ~= nil and exist.status ~= config.params.BALANCE_STATUS.PENDING and exist.status ~= config.params.BALANCE_STATUS.CANCELED then
+    if exist ~= nil and exist.status ~= config.params.BALANCE_STATUS.PENDING and exist.status ~= config.params.BALANCE_STATUS.CANCELED
+        and exist.status ~= config.params.BALANCE_STATUS.REORGED then
         log.error({
             message = string.format("INTEGRITY_ERROR_STATUS: process_deposit: wrong status", exist.status),
             [ALERT_TAG] = ALERT_CRIT,
@@ -1464,6 +1608,20 @@ function balance.process_stake(staker_profile_id, vault_profile_id, vault_wallet
     else
         stake_type = config.params.BALANCE_TYPE.STAKE
         exist = box.space.balance_operations.index.ops_id2:get(stake_id)
+        if exist ~= nil and exist.status == config.params.BALANCE_STATUS.REORGED then
+            -- flagged by a reorg and back in the canonical chain, the shares
+            -- were never unwound
+            local res, err = archiver.update(box.space.balance_operations, exist.id, {
+                { '=', 'status', config.params.BALANCE_STATUS.SUCCESS } })
+            if err ~= nil then
+                box.rollback()
+                log.error(VaultError:new(err))
+                return { res = nil, error = err }
+            end
+            box.commit()
+            log.warn("process_stake: reorg flag cleared for stake ops_id2=%s", stake_id)
+            return { res = res, error = nil }
+        end
         if exist ~= nil then
             log.error({
                 message = string.format(
@@ -2044,6 +2202,146 @@ function balance.update_pending_withdrawals(current_block, future_block, for_con
     return { res = nil, error = nil }
 end
 
+-- The settlement service checks the new pending withdrawals of a chain against
+-- its withdrawal policy: a withdrawal is let through (checked) or held in
+-- review until it's approved or rejected by an admin. A held withdrawal gets
+-- BLOCK_NUM_NEVER so update_pending_withdrawals skips it.
+
+function balance.get_withdrawal_usage(exchange_id, chain_id, profile_id)
+    checks("string", "number", "number")
+
+    local exist = box.space.profile:get(profile_id)
+    if exist == nil then
+        return { res = nil, error = "PROFILE_NOT_FOUND" }
+    end
+
+    return {
+        res = {
+            chain_volume = wdm.chain_wds_per_24h(exchange_id, chain_id),
+            profile_volume = wdm.profile_wds_per_24h(exchange_id, chain_id, profile_id),
+            profile_created_at = exist.created_at,
+        },
+        error = nil
+    }
+end
+
+local function _unchecked_withdrawal(bops_id)
+    local exist = box.space.balance_operations:get(bops_id)
+    if exist == nil
+        or exist.ops_type ~= config.params.BALANCE_TYPE.WITHDRAWAL
+        or exist.status ~= config.params.BALANCE_STATUS.PENDING
+        or exist.due_block ~= 0
+        or exist.reason ~= "" then
+        return nil
+    end
+    return exist
+end
+
+function balance.admit_withdrawal(bops_id)
+    checks("string")
+
+    box.begin()
+
+    local exist = _unchecked_withdrawal(bops_id)
+    if exist == nil then
+        box.rollback()
+        return { res = nil, error = "NO_PENDING_WITHDRAWAL" }
+    end
+
+    local res, err = archiver.update(box.space.balance_operations, exist.id, {
+        { '=', 'reason', WITHDRAWAL_CHECKED } })
+    if err ~= nil then
+        box.rollback()
+        return { res = nil, error = err }
+    end
+
+    wdm.roll_chain_volume(exist.exchange_id, exist.chain_id, exist.profile_id, exist.amount)
+
+    box.commit()
+
+    return { res = res, error = nil }
+end
+
+function balance.hold_withdrawal(bops_id, reason)
+    checks("string", "string")
+
+    box.begin()
+
+    local exist = _unchecked_withdrawal(bops_id)
+    if exist == nil then
+        box.rollback()
+        return { res = nil, error = "NO_PENDING_WITHDRAWAL" }
+    end
+
+    local res, err = archiver.update(box.space.balance_operations, exist.id, {
+        { '=', 'status',    config.params.BALANCE_STATUS.REVIEW },
+        { '=', 'reason',    reason },
+        { '=', 'due_block', BLOCK_NUM_NEVER } })
+    if err ~= nil then
+        box.rollback()
+        return { res = nil, error = err }
+    end
+
+    box.commit()
+
+    notif_profile(res.profile_id, res:tomap({ names_only = true }))
+    return { res = res, error = nil }
+end
+
+-- an approved withdrawal is pending again and gets its due block with the
+-- next update_pending_withdrawals, a rejected one is canceled and refunded
+function balance.review_withdrawal(bops_id, approve)
+    checks("string", "boolean")
+
+    box.begin()
+
+    local exist = box.space.balance_operations:get(bops_id)
+    if exist == nil
+        or exist.ops_type ~= config.params.BALANCE_TYPE.WITHDRAWAL
+        or exist.status ~= config.params.BALANCE_STATUS.REVIEW then
+        box.rollback()
+        return { res = nil, error = "NO_WITHDRAWAL_IN_REVIEW" }
+    end
+
+    local res, err
+    if approve then
+        res, err = archiver.update(box.space.balance_operations, exist.id, {
+            { '=', 'status',    config.params.BALANCE_STATUS.PENDING },
+            { '=', 'reason',    WITHDRAWAL_APPROVED },
+            { '=', 'due_block', 0 } })
+        if err ~= nil then
+            box.rollback()
+            return { res = nil, error = err }
+        end
+
+        wdm.roll_chain_volume(exist.exchange_id, exist.chain_id, exist.profile_id, exist.amount)
+    else
+        res, err = archiver.update(box.space.balance_operations, exist.id, {
+            { '=', 'status', config.params.BALANCE_STATUS.CANCELED },
+            { '=', 'reason', WITHDRAWAL_REJECTED } })
+        if err ~= nil then
+            box.rollback()
+            return { res = nil, error = err }
+        end
+
+        err = balance.increase_balance_sum(exist.profile_id, exist.amount)
+        if err ~= nil then
+            box.rollback()
+            log.error(BalanceError:new(err))
+            return { res = nil, error = tostring(err) }
+        end
+    end
+
+    box.commit()
+
+    notif_profile(res.profile_id, res:tomap({ names_only = true }))
+    return { res = res, error = nil }
+end
+
+function balance.get_review_withdrawals()
+    return balance.get_balance_ops_in_state(config.params.BALANCE_TYPE.WITHDRAWAL, config.params.BALANCE_STATUS.REVIEW)
+end
+
 function balance.get_vault_manager_profile_id(vault_profile_id)
     checks('unsigned')
 
@@ -2622,6 +2920,136 @@ function balance.set_last_processed_block_number(block_number, for_contract, cha
     return { res = nil, error = nil }
 end
 
+-- sets the last processed block with its hash and the ops found in the range
+function balance.set_processed_block(block_number, block_hash, ops, for_contract, chain_id, event_type)
+    checks('number', 'string', 'table', 'string', 'number', 'string')
+
+    box.begin()
+    local status, res = pcall(
+        function()
+            box.space.processed_blocks:upsert(
+                { for_contract, chain_id, event_type, tostring(block_number) },
+                { { '=', 'last_processed_block', tostring(block_number) } })
+            return box.space.processed_block_hashes:replace(
+                { for_contract, chain_id, event_type, block_number, block_hash, ops })
+        end
+    )
+    if status == false then
+        box.rollback()
+        log.error(BalanceError:new(res))
+        return { res = nil, error = res }
+    end
+
+    -- only the recent ones are kept, a reorg deeper than that needs a manual fix
+    local expired = box.space.processed_block_hashes:select({ for_contract, chain_id, event_type }, {
+        iterator = 'REQ', offset = PROCESSED_BLOCK_HASHES_LIMIT })
+    for _, item in ipairs(expired) do
+        box.space.processed_block_hashes:delete({ for_contract, chain_id, event_type, item.block_number })
+    end
+
+    box.commit()
+    return { res = nil, error = nil }
+end
+
+-- processed blocks newest first
+function balance.get_processed_blocks(for_contract, chain_id, event_type, limit)
+    checks('string', 'number', 'string', 'number')
+
+    local res = {}
+    for _, item in box.space.processed_block_hashes:pairs({ for_contract, chain_id, event_type }, { iterator = 'REQ' }) do
+        if #res >= limit then
+            break
+        end
+        table.insert(res, item:tomap({ names_only = true }))
+    end
+
+    return { res = res, error = nil }
+end
+
+-- reverses a credited deposit whose log is not in the canonical chain anymore,
+-- a stake is only flagged: the vault shares need a manual unwind
+local function _reorg_balance_op(ops_id2)
+    local exist = box.space.balance_operations.index.ops_id2:get(ops_id2)
+    if exist == nil then
+        return nil, nil
+    end
+
+    if exist.ops_type == config.params.BALANCE_TYPE.DEPOSIT then
+        if exist.status == config.params.BALANCE_STATUS.SUCCESS then
+            local err = balance.decrease_balance_sum(exist.profile_id, exist.amount)
+            if err ~= nil then
+                return nil, err
+            end
+        elseif exist.status ~= config.params.BALANCE_STATUS.UNKNOWN then
+            return nil, nil
+        end
+    elseif exist.ops_type == config.params.BALANCE_TYPE.STAKE then
+        if exist.status ~= config.params.BALANCE_STATUS.SUCCESS then
+            return nil, nil
+        end
+        log.error({
+            message = string.format("REORGED_STAKE: stake ops_id2=%s profile_id=%d amount=%s not in the canonical chain, vault shares need a manual unwind",
+                ops_id2, exist.profile_id, tostring(exist.amount)),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+    else
+        return nil, nil
+    end
+
+    return archiver.update(box.space.balance_operations, exist.id, {
+        { '=', 'status', config.params.BALANCE_STATUS.REORGED } })
+end
+
+-- rolls the processed blocks back to the fork block and reverses the ops whose
+-- logs vanished with the reorg, returns the reversed ops
+function balance.rollback_processed_blocks(fork_block, vanished, for_contract, chain_id, event_type)
+    checks('number', 'table', 'string', 'number', 'string')
+
+    local reorged = {}
+
+    box.begin()
+
+    local status, res = pcall(
+        function()
+            local orphaned = box.space.processed_block_hashes:select({ for_contract, chain_id, event_type }, { iterator = 'REQ' })
+            for _, item in ipairs(orphaned) do
+                if item.block_number <= fork_block then
+                    break
+                end
+                box.space.processed_block_hashes:delete({ for_contract, chain_id, event_type, item.block_number })
+            end
+            box.space.processed_blocks:upsert(
+                { for_contract, chain_id, event_type, tostring(fork_block) },
+                { { '=', 'last_processed_block', tostring(fork_block) } })
+        end
+    )
+    if status == false then
+        box.rollback()
+        log.error(BalanceError:new(res))
+        return { res = nil, error = res }
+    end
+
+    for _, ops_id2 in ipairs(vanished) do
+        local op, err = _reorg_balance_op(ops_id2)
+        if err ~= nil then
+            box.rollback()
+            log.error(BalanceError:new(err))
+            return { res = nil, error = tostring(err) }
+        end
+        if op ~= nil then
+            table.insert(reorged, op:tomap({ names_only = true }))
+        end
+    end
+
+    box.commit()
+
+    for _, op in ipairs(reorged) do
+        notif_profile(op.profile_id, op)
+    end
+
+    return { res = reorged, error = nil }
+end
+
 function balance.completed_withdrawals(withdrawal_infos)
     checks('table')
 
@@ -2880,10 +3308,7 @@ function balance.process_referral_payout()
     return { res = profile_ids, error = nil }
 end
 
--- TODO: THIS PART should be removed later, it used only for testing
-function balance.deposit_credit(profile_id, amount)
-    checks('number', 'decimal')
-
+local function _deposit_credit(profile_id, amount, ledger_kind)
     if amount <= 0 then
         return { res = nil, error = "NEGATIVE_OR_ZERO_DEPOSIT_AMOUNT" }
     end
@@ -2924,11 +3349,38 @@ function balance.deposit_credit(profile_id, amount)
         return { res = nil, error = err }
     end
 
+    if ledger_kind ~= nil then
+        err = balance.record_insurance(profile_id, profile_id, "", ledger_kind, amount, id)
+        if err ~= nil then
+            box.rollback()
+            return { res = nil, error = err }
+        end
+    end
+
     box.commit()
 
     return { res = res, error = nil }
 end
 
+-- TODO: THIS PART should be removed later, it used only for testing
+function balance.deposit_credit(profile_id, amount)
+    checks('number', 'decimal')
+
+    return _deposit_credit(profile_id, amount, nil)
+end
+
+-- credits the insurance profile and records the deposit in the insurance ledger
+function balance.deposit_insurance(amount)
+    checks('decimal')
+
+    local insurance = box.space.profile.index.profile_type:min(config.params.PROFILE_TYPE.INSURANCE)
+    if insurance == nil then
+        return { res = nil, error = "INSURANCE_NOT_FOUND" }
+    end
+
+    return _deposit_credit(insurance.id, amount, config.params.INSURANCE_LEDGER_KIND.DEPOSIT)
+end
+
 function balance.withdraw_credit(profile_id, amount)
     checks('number', 'decimal')
 
@@ -2977,6 +3429,67 @@ function balance.withdraw_credit(profile_id, amount)
     return { res = res, error = nil }
 end
 
+-- the two operations of a transfer share their ops_id2, the exchange wallet
+-- is unaffected
+function balance.subaccount_transfer(from_id, to_id, amount)
+    checks('number', 'number', 'decimal')
+
+    if amount <= 0 then
+        return { res = nil, error = "NEGATIVE_OR_ZERO_TRANSFER_AMOUNT" }
+    end
+
+    local tm = time.now()
+    local id = uuid.str()
+
+    box.begin()
+
+    local err = balance.decrease_balance_sum(from_id, amount)
+    if err == nil then
+        err = balance.increase_balance_sum(to_id, amount)
+    end
+    if err ~= nil then
+        box.rollback()
+        log.error(string.format("SUBACCOUNT_TRANSFER_FAILED %s", tostring(err)))
+        return { res = nil, error = tostring(err) }
+    end
+
+    local ops = {}
+    for _, op in ipairs({
+        {"sto_" .. id, from_id, config.params.BALANCE_TYPE.SUBACCOUNT_TRANSFER_OUT},
+        {"sti_" .. id, to_id, config.params.BALANCE_TYPE.SUBACCOUNT_TRANSFER_IN},
+    }) do
+        local res
+        res, err = archiver.insert(box.space.balance_operations, {
+            op[1],
+            config.params.BALANCE_STATUS.SUCCESS,
+            "",
+            "",
+            op[2],
+            "",
+            op[3],
+            id,
+            amount,
+            tm,
+            0,
+
+            "",
+            0,
+            "",
+        })
+        if err ~= nil then
+            box.rollback()
+            log.error(BalanceError:new(err))
+            return { res = nil, error = err }
+        end
+
+        table.insert(ops, res)
+    end
+
+    box.commit()
+
+    return { res = ops, error = nil }
+end
+
 -- internal api only
 
 -- returns fee amount or error
@@ -3180,10 +3693,13 @@ end
 function balance.test_clear_spaces()
     box.space.withdraw_lock:drop()
     box.space.processed_blocks:drop()
+    box.space.processed_block_hashes:drop()
     box.space.balance_operations:drop()
     box.space.balance_sum:drop()
     box.space.global_settlement_status:drop()
     box.space.exchange_wallets:drop()
+    box.space.insurance_ledger:drop()
+    box.space.insurance_order:drop()
     box.sequence.withdrawal_id_sequence:drop()
     box.sequence.unstake_id_sequence:drop()
 end
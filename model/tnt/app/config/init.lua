@@ -69,7 +69,8 @@ local params = {
     PROFILE_TYPE = {
         TRADER = "trader",
         INSURANCE = "insurance",
-        VAULT = "vault"
+        VAULT = "vault",
+        SUBACCOUNT = "subaccount"
     },
 
     PROFILE_STATUS = {
@@ -78,6 +79,11 @@ local params = {
         LIQUIDATING = "liquidating"
     },
 
+    MARGIN_MODE = {
+        CROSS = "cross",
+        ISOLATED = "isolated"
+    },
+
     VAULT_STATUS = {
         ACTIVE = "active",
         SUSPENDED = "suspended",
@@ -149,7 +155,9 @@ local params = {
         CANCELED     = "canceled",
         CANCELING    = "canceling",
         AMENDING     = "amending",
-        CANCELINGALL = "cancelingall"
+        CANCELINGALL = "cancelingall",
+        -- bracket child waiting for the entry fill
+        PENDING      = "pending"
     },
 
     AIRDROP_CLAIM_STATUS = {
@@ -172,6 +180,7 @@ local params = {
         TAKE_PROFIT_LIMIT = "take_profit_limit",
         STOP_LIMIT = "stop_limit",
         STOP_MARKET = "stop_market",
+        TRAILING_STOP = "trailing_stop",
         PING_LIMIT = "ping_limit",
     },
 
@@ -189,6 +198,26 @@ local params = {
         CANCELALL = "cancelall",
         LIQUIDATE = "liquidate",
         EXECUTE = "execute",
+        CREATE_GROUP = "create_group",
+    },
+
+    ORDER_GROUP_TYPE = {
+        OCO = "oco",
+        BRACKET = "bracket",
+    },
+
+    -- price stream a conditional order is triggered by, empty is MARK
+    TRIGGER_BY = {
+        MARK = "mark",
+        LAST = "last",
+        INDEX = "index",
+    },
+
+    -- consumers of the market mark price, see market.update_mark_price
+    MARK_PRICE_USAGE = {
+        LIQUIDATION = "liquidation",
+        SLIPSTOPPER = "slipstopper",
+        FUNDING = "funding",
     },
 
     LIQUIDATE_KIND = {
@@ -197,6 +226,33 @@ local params = {
         AINSCLAWBACK = 2
     },
 
+    -- order updates published on orders:<market>@<profile>
+    ORDER_EVENT = {
+        CREATE = "create",
+        OPEN   = "open",
+        AMEND  = "amend",
+        FILL   = "fill",
+        CANCEL = "cancel",
+        REJECT = "reject",
+    },
+
+    -- how the position of a liquidated profile was closed, published on liquidations:<market>
+    LIQUIDATION_EVENT_KIND = {
+        ORDERBOOK = "orderbook",
+        TAKEOVER  = "takeover",
+    },
+
+    -- insurance fund balance changes recorded in insurance_ledger
+    INSURANCE_LEDGER_KIND = {
+        -- fees of the insurance order book fills when selling taken over positions
+        TRADING_FEE     = "trading_fee",
+        TAKEOVER_PNL    = "takeover_pnl",
+        CLAWBACK        = "clawback",
+        DEPOSIT         = "deposit",
+        -- rounding residual of a funding round
+        FUNDING_RESIDUAL = "funding_residual",
+    },
+
     BALANCE_STATUS = {
         PENDING    = "pending",
         REQUESTED  = "requested",
@@ -206,6 +262,8 @@ local params = {
         CLAIMABLE  = "claimable",  -- withdrawal once 6 hours passed
         CLAIMING   = "claiming",   -- once you requested the signature
         CANCELED   = "canceled",   -- possible only for pending or claimable
+        REORGED    = "reorged",    -- deposit or stake whose log vanished with a chain reorg
+        REVIEW     = "review",     -- withdrawal held by the settlement withdrawal policy
     },
 
     BALANCE_TYPE = {
@@ -245,6 +303,13 @@ local params = {
         -- is balanced by one of these:
         VAULT_UNSTAKE_VALUE = "vault_unstake_value", -- "vuv_" prefix, vault balance down
 
+
+        -- each of these:
+        SUBACCOUNT_TRANSFER_OUT = "subaccount_transfer_out", -- "sto_" prefix, sender balance down
+
+        -- is balanced by one of these:
+        SUBACCOUNT_TRANSFER_IN  = "subaccount_transfer_in",  -- "sti_" prefix, receiver balance up
+
     },
 
     NOTIF_TYPE = {
@@ -264,6 +329,7 @@ local params = {
 
     MAX_POSITION_DEPENDENT_ORDERS = 1,
     MAX_CONDITIONAL_ORDERS = 10,
+    MAX_BATCH_ORDERS = 100,
 
     LIMIT_BUY_RATIO = decimal.new("1.03"),
     LIMIT_SELL_RATIO = decimal.new("0.97"),
@@ -272,6 +338,7 @@ local params = {
     MARKET_UPDATE_RETRY_INTERVAL = 1,
 
     MAX_SECRETS_PER_ACCOUNT = 100,
+    MAX_SUBACCOUNTS = 20,
 }
 
 local errors = {
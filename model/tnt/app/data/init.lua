@@ -104,6 +104,12 @@ return {
     meta_market_leverage = 9,
     meta_balance = 10,
     meta_cum_trading_volume = 11,
+
+    isolated_profile_id = 1,
+    isolated_market_id = 2,
+    isolated_margin = 3,
+    isolated_balance_base = 4,
+    isolated_status = 5,
     
     liq_action_kind = 1,
     liq_action_trader_id = 2,
@@ -111,6 +117,11 @@ return {
     liq_action_size = 4,
     liq_action_price = 5,
 
+    adl_quantile_profile_id = 1,
+    adl_quantile_side = 2,
+    adl_quantile_quantile = 3,
+    adl_quantile_score = 4,
+
     withdrawal_tx_info_id = 1,
     withdrawal_tx_info_hash = 2
 }
\ No newline at end of file
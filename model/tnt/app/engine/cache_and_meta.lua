@@ -26,7 +26,8 @@ return {
             if d.profile_id == return_data_for_id then
                 profile_data = {
                     cache = d.cache,
-                    meta = d.meta
+                    meta = d.meta,
+                    isolated = d.isolated
                 }
                 break
             end
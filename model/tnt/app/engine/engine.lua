@@ -1,4 +1,5 @@
 local checks = require('checks')
+local decimal = require('decimal')
 local fiber = require('fiber')
 local json = require('json')
 local log = require('log')
@@ -110,7 +111,7 @@ local function _open_order(order_id, price, size)
     end
 
     local tm = time.now()
-    notif.add_private(engine._market_id, tostring(order.id), tm, order.profile_id, 'order', order)
+    notif.add_order(engine._market_id, tm, order, config.params.ORDER_EVENT.OPEN)
 
     return nil
 end
@@ -125,7 +126,7 @@ local function _amend_order(order_id, new_price, new_size, new_trigger_price, ne
     end
 
     local timestamp = time.now()
-    notif.add_private(engine._market_id, tostring(order.id), timestamp, order.profile_id, "order", order)
+    notif.add_order(engine._market_id, timestamp, order, config.params.ORDER_EVENT.AMEND)
 
     if util.is_value_in(order.order_type, position_dep_order_types) then
         local err = _notify_extended_position(order.profile_id)
@@ -193,7 +194,7 @@ local function _cancel_entry(entry, sequence)
     _update_bid_ask(entry.price, entry.side, sequence)
 
     local tm = time.now()
-    notif.add_private(engine._market_id, tostring(order.id), tm, order.profile_id, "order", order)
+    notif.add_order(engine._market_id, tm, order, config.params.ORDER_EVENT.CANCEL)
 
     return nil
 end
@@ -432,7 +433,7 @@ function stop_loss_common.pre_create(order, position, market_data)
     checks('table|api_create_order', '?table|engine_position', 'table|engine_market')
 
     local cp = config.params
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if position == nil or position.size == 0 then
         log.error('position not found: %s', util.tostring(order))
@@ -440,13 +441,13 @@ function stop_loss_common.pre_create(order, position, market_data)
     end
     if position.side == cp.LONG then
         order.side = cp.SHORT
-        if  order.trigger_price >= fair_price then
+        if  order.trigger_price >= source_price then
             -- immediate selling is forbidden
             return ERR_ORDER_IMMEDIATE_EXECUTION
         end
     else
         order.side = cp.LONG
-        if  order.trigger_price <= fair_price then
+        if  order.trigger_price <= source_price then
             -- immediate buying is forbidden
             return ERR_ORDER_IMMEDIATE_EXECUTION
         end
@@ -472,18 +473,18 @@ function stop_loss_common.pre_execute(order, position, market_data)
     checks('table|engine_order', '?table|engine_position', 'table|engine_market')
 
     local cp = config.params
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if order.status ~= cp.ORDER_STATUS.PLACED then
         return ERR_WRONG_ORDER_STATUS
     end
 
     if order.side == cp.LONG then
-        if order.trigger_price > fair_price then
+        if order.trigger_price > source_price then
             return ERR_NO_CONDITION_MET
         end
     else
-        if order.trigger_price < fair_price then
+        if order.trigger_price < source_price then
             return ERR_NO_CONDITION_MET
         end
     end
@@ -499,7 +500,7 @@ function stop_loss_common.amend(amend, entry, order, position, sequence, market_
     checks('table|api_amend_order', '?table|engine_ob_entry', 'table|engine_order', '?table|engine_position', 'number', 'table|engine_market')
 
     local cp = config.params
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
     local err
 
     if order.status == config.params.ORDER_STATUS.PLACED then
@@ -517,13 +518,13 @@ function stop_loss_common.amend(amend, entry, order, position, sequence, market_
             return nil, false, ERR_POSITION_NOT_FOUND
         end
         if position.side == cp.LONG then
-            if  amend.trigger_price >= fair_price then
+            if  amend.trigger_price >= source_price then
                 -- immediate selling is forbidden
                 log.error('%s: %s', ERR_ORDER_IMMEDIATE_EXECUTION, util.tostring(order))
                 return nil, false, ERR_ORDER_IMMEDIATE_EXECUTION
             end
         else
-            if  amend.trigger_price <= fair_price then
+            if  amend.trigger_price <= source_price then
                 -- immediate buying is forbidden
                 log.error('%s: %s', ERR_ORDER_IMMEDIATE_EXECUTION, util.tostring(order))
                 return nil, false, ERR_ORDER_IMMEDIATE_EXECUTION
@@ -788,7 +789,7 @@ function take_profit_common.pre_create(order, position, market_data)
     checks('table|api_create_order', '?table|engine_position', 'table|engine_market')
 
     local cp = config.params
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if position == nil or position.size == 0 then
         log.error('position not found: %s', util.tostring(order))
@@ -796,13 +797,13 @@ function take_profit_common.pre_create(order, position, market_data)
     end
     if position.side == cp.LONG then
         order.side = cp.SHORT
-        if  order.trigger_price <= fair_price then
+        if  order.trigger_price <= source_price then
             -- immediate selling is forbidden
             return ERR_ORDER_IMMEDIATE_EXECUTION
         end
     else
         order.side = cp.LONG
-        if  order.trigger_price >= fair_price then
+        if  order.trigger_price >= source_price then
             -- immediate buying is forbidden
             return ERR_ORDER_IMMEDIATE_EXECUTION
         end
@@ -827,18 +828,18 @@ function take_profit_common.pre_execute(order, position, market_data)
     checks('table|engine_order', '?table|engine_position', 'table|engine_market')
 
     local cp = config.params
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if order.status ~= cp.ORDER_STATUS.PLACED then
         return ERR_WRONG_ORDER_STATUS
     end
 
     if order.side == cp.LONG then
-        if order.trigger_price < fair_price then
+        if order.trigger_price < source_price then
             return ERR_NO_CONDITION_MET
         end
     else
-        if order.trigger_price > fair_price then
+        if order.trigger_price > source_price then
             return ERR_NO_CONDITION_MET
         end
     end
@@ -857,7 +858,7 @@ function take_profit_common.amend(amend, entry, order, position, sequence, marke
     checks('table|api_amend_order', '?table|engine_ob_entry', 'table|engine_order', '?table|engine_position', 'number', 'table|engine_market')
 
     local cp = config.params
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
     local err
 
     if order.status == config.params.ORDER_STATUS.PLACED then
@@ -875,13 +876,13 @@ function take_profit_common.amend(amend, entry, order, position, sequence, marke
             return nil, false, ERR_POSITION_NOT_FOUND
         end
         if position.side == cp.LONG then
-            if  amend.trigger_price <= fair_price then
+            if  amend.trigger_price <= source_price then
                 -- immediate selling is forbidden
                 log.error('%s: %s', ERR_ORDER_IMMEDIATE_EXECUTION, util.tostring(order))
                 return nil, false, ERR_ORDER_IMMEDIATE_EXECUTION
             end
         else
-            if  amend.trigger_price >= fair_price then
+            if  amend.trigger_price >= source_price then
                 -- immediate buying is forbidden
                 log.error('%s: %s', ERR_ORDER_IMMEDIATE_EXECUTION, util.tostring(order))
                 return nil, false, ERR_ORDER_IMMEDIATE_EXECUTION
@@ -1147,7 +1148,7 @@ function stop_limit_order.pre_create(order, position, market_data)
 
     local cp = config.params
     local order_type = order.order_type
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if order_type ~= cp.ORDER_TYPE.STOP_LIMIT then
         local err = EngineError:new(ERR_INTEGRITY_ERROR)
@@ -1164,7 +1165,7 @@ function stop_limit_order.pre_create(order, position, market_data)
             --ERR_ORDER_PRICE_OVERFLOW
             return string.format("RiskManager CheckOrderParams: price=%s should be less/equal than=%s", order.price, max_price)
         end
-        if  order.trigger_price <= fair_price then
+        if  order.trigger_price <= source_price then
             -- immediate buying is forbidden
             return ERR_ORDER_IMMEDIATE_EXECUTION
         end
@@ -1174,7 +1175,7 @@ function stop_limit_order.pre_create(order, position, market_data)
             --ERR_ORDER_PRICE_OVERFLOW
             return string.format("RiskManager CheckOrderParams: price=%s should be greater/equal than=%s", order.price, min_price)
         end
-        if  order.trigger_price >= fair_price then
+        if  order.trigger_price >= source_price then
             -- immediate selling is forbidden
             return ERR_ORDER_IMMEDIATE_EXECUTION
         end
@@ -1198,7 +1199,7 @@ function stop_limit_order.pre_execute(order, position, market_data)
 
     local err
     local cp = config.params
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if order.status == cp.ORDER_STATUS.OPEN then
         -- behaves like normal order
@@ -1209,11 +1210,11 @@ function stop_limit_order.pre_execute(order, position, market_data)
     end
 
     if order.side == cp.LONG then
-        if order.trigger_price > fair_price then
+        if order.trigger_price > source_price then
             return ERR_NO_CONDITION_MET
         end
     else
-        if order.trigger_price < fair_price then
+        if order.trigger_price < source_price then
             return ERR_NO_CONDITION_MET
         end
     end
@@ -1236,7 +1237,7 @@ function stop_limit_order.amend(amend, entry, order, position, sequence, market_
     checks('table|api_amend_order', '?table|engine_ob_entry', 'table|engine_order', '?table|engine_position', 'number', 'table|engine_market')
 
     local err
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if order.order_type ~= config.params.ORDER_TYPE.STOP_LIMIT then
         local err = EngineError:new(ERR_INTEGRITY_ERROR)
@@ -1260,13 +1261,13 @@ function stop_limit_order.amend(amend, entry, order, position, sequence, market_
         --TODO: add validation as in api
 
         if order.side == config.params.LONG then
-            if  amend.trigger_price <= fair_price then
+            if  amend.trigger_price <= source_price then
                 -- immediate buying is forbidden
                 log.error('%s: %s', ERR_ORDER_IMMEDIATE_EXECUTION, util.tostring(order))
                 return nil, false, ERR_ORDER_IMMEDIATE_EXECUTION
             end
         else
-            if  amend.trigger_price >= fair_price then
+            if  amend.trigger_price >= source_price then
                 -- immediate selling is forbidden
                 log.error('%s: %s', ERR_ORDER_IMMEDIATE_EXECUTION, util.tostring(order))
                 return nil, false, ERR_ORDER_IMMEDIATE_EXECUTION
@@ -1309,31 +1310,21 @@ function stop_limit_order.post_amend(profile_data, order, position_before)
     return nil
 end
 
-local stop_market_order = {}
+local stop_market_common = {}
 
-function stop_market_order.pre_create(order, position, market_data)
+function stop_market_common.pre_create(order, position, market_data)
     checks('table|api_create_order', '?table|engine_position', 'table|engine_market')
 
     local cp = config.params
-    local order_type = order.order_type
-    local fair_price = market_data.fair_price
-
-    if order_type ~= cp.ORDER_TYPE.STOP_MARKET then
-        local err = EngineError:new(ERR_INTEGRITY_ERROR)
-        log.error({
-            message = err:backtrace(),
-            [ALERT_TAG] = ALERT_CRIT,
-        })
-        return err
-    end
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if order.side == config.params.LONG then
-        if  order.trigger_price <= fair_price then
+        if  order.trigger_price <= source_price then
             -- immediate buying is forbidden
             return ERR_ORDER_IMMEDIATE_EXECUTION
         end
     else
-        if  order.trigger_price >= fair_price then
+        if  order.trigger_price >= source_price then
             -- immediate selling is forbidden
             return ERR_ORDER_IMMEDIATE_EXECUTION
         end
@@ -1353,12 +1344,12 @@ function stop_market_order.pre_create(order, position, market_data)
     return nil
 end
 
-function stop_market_order.pre_execute(order, position, market_data)
+function stop_market_common.pre_execute(order, position, market_data)
     checks('table|engine_order', '?table|engine_position', 'table|engine_market')
 
     local err
     local cp = config.params
-    local fair_price = market_data.fair_price
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if order.status == cp.ORDER_STATUS.OPEN then
         -- behaves like normal order
@@ -1369,11 +1360,11 @@ function stop_market_order.pre_execute(order, position, market_data)
     end
 
     if order.side == cp.LONG then
-        if order.trigger_price > fair_price then
+        if order.trigger_price > source_price then
             return ERR_NO_CONDITION_MET
         end
     else
-        if order.trigger_price < fair_price then
+        if order.trigger_price < source_price then
             return ERR_NO_CONDITION_MET
         end
     end
@@ -1405,23 +1396,11 @@ function stop_market_order.pre_execute(order, position, market_data)
     return nil
 end
 
-function stop_market_order.post_execute(order, left_size, sequence)
-end
-
-function stop_market_order.amend(amend, entry, order, position, sequence, market_data)
+function stop_market_common.amend(amend, entry, order, position, sequence, market_data)
     checks('table|api_amend_order', '?table|engine_ob_entry', 'table|engine_order', '?table|engine_position', 'number', 'table|engine_market')
 
     local err
-    local fair_price = market_data.fair_price
-
-    if order.order_type ~= config.params.ORDER_TYPE.STOP_MARKET then
-        local err = EngineError:new(ERR_INTEGRITY_ERROR)
-        log.error({
-            message = err:backtrace(),
-            [ALERT_TAG] = ALERT_CRIT,
-        })
-        return nil, false, err
-    end
+    local source_price = market.trigger_price(market_data, order.trigger_by)
 
     if order.status == config.params.ORDER_STATUS.PLACED then
         if entry ~= nil then
@@ -1436,13 +1415,13 @@ function stop_market_order.amend(amend, entry, order, position, sequence, market
         --TODO: add validation as in api
 
         if order.side == config.params.LONG then
-            if  amend.trigger_price <= fair_price then
+            if  amend.trigger_price <= source_price then
                 -- immediate buying is forbidden
                 log.error('%s: %s', ERR_ORDER_IMMEDIATE_EXECUTION, util.tostring(order))
                 return nil, false, ERR_ORDER_IMMEDIATE_EXECUTION
             end
         else
-            if  amend.trigger_price >= fair_price then
+            if  amend.trigger_price >= source_price then
                 -- immediate selling is forbidden
                 log.error('%s: %s', ERR_ORDER_IMMEDIATE_EXECUTION, util.tostring(order))
                 return nil, false, ERR_ORDER_IMMEDIATE_EXECUTION
@@ -1462,6 +1441,59 @@ function stop_market_order.amend(amend, entry, order, position, sequence, market
     return _amend_as_limit_order(entry, order, sequence, amend.price, amend.size)
 end
 
+function stop_market_common.post_amend(profile_data, order, position_before)
+    checks('table', 'table|engine_order', '?table|engine_position')
+
+    if order.status ~= config.params.ORDER_STATUS.PLACED then
+        local err = risk.post_match(order.market_id, profile_data, order.profile_id, position_before)
+        if err ~= nil then
+            log.error(EngineError:new(err))
+            return err
+        end
+    end
+
+    return nil
+end
+
+local stop_market_order = {}
+
+function stop_market_order.pre_create(order, position, market_data)
+    checks('table|api_create_order', '?table|engine_position', 'table|engine_market')
+
+    if order.order_type ~= config.params.ORDER_TYPE.STOP_MARKET then
+        local err = EngineError:new(ERR_INTEGRITY_ERROR)
+        log.error({
+            message = err:backtrace(),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return err
+    end
+
+    return stop_market_common.pre_create(order, position, market_data)
+end
+
+function stop_market_order.pre_execute(order, position, market_data)
+    return stop_market_common.pre_execute(order, position, market_data)
+end
+
+function stop_market_order.post_execute(order, left_size, sequence)
+end
+
+function stop_market_order.amend(amend, entry, order, position, sequence, market_data)
+    checks('table|api_amend_order', '?table|engine_ob_entry', 'table|engine_order', '?table|engine_position', 'number', 'table|engine_market')
+
+    if order.order_type ~= config.params.ORDER_TYPE.STOP_MARKET then
+        local err = EngineError:new(ERR_INTEGRITY_ERROR)
+        log.error({
+            message = err:backtrace(),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return nil, false, err
+    end
+
+    return stop_market_common.amend(amend, entry, order, position, sequence, market_data)
+end
+
 function stop_market_order.post_amend(profile_data, order, position_before)
     checks('table', 'table|engine_order', '?table|engine_position')
 
@@ -1474,15 +1506,72 @@ function stop_market_order.post_amend(profile_data, order, position_before)
         return err
     end
 
-    if order.status ~= config.params.ORDER_STATUS.PLACED then
-        local err = risk.post_match(order.market_id, profile_data, order.profile_id, position_before)
-        if err ~= nil then
-            log.error(EngineError:new(err))
-            return err
-        end
+    return stop_market_common.post_amend(profile_data, order, position_before)
+end
+
+--[[
+    Stop market order whose trigger follows the market, the slipstopper tracks
+    the running high (short side) or low (long side) and moves the trigger
+    with engine.update_trailing_trigger.
+--]]
+local trailing_stop_order = {}
+
+function trailing_stop_order.pre_create(order, position, market_data)
+    checks('table|api_create_order', '?table|engine_position', 'table|engine_market')
+
+    if order.order_type ~= config.params.ORDER_TYPE.TRAILING_STOP then
+        local err = EngineError:new(ERR_INTEGRITY_ERROR)
+        log.error({
+            message = err:backtrace(),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return err
     end
 
-    return nil
+    local has_value = order.callback_value ~= nil and order.callback_value > 0
+    local has_percent = order.callback_percent ~= nil and order.callback_percent > 0
+    if has_value == has_percent then
+        return ERR_WRONG_TRAILING_CALLBACK
+    end
+
+    return stop_market_common.pre_create(order, position, market_data)
+end
+
+function trailing_stop_order.pre_execute(order, position, market_data)
+    return stop_market_common.pre_execute(order, position, market_data)
+end
+
+function trailing_stop_order.post_execute(order, left_size, sequence)
+end
+
+function trailing_stop_order.amend(amend, entry, order, position, sequence, market_data)
+    checks('table|api_amend_order', '?table|engine_ob_entry', 'table|engine_order', '?table|engine_position', 'number', 'table|engine_market')
+
+    if order.order_type ~= config.params.ORDER_TYPE.TRAILING_STOP then
+        local err = EngineError:new(ERR_INTEGRITY_ERROR)
+        log.error({
+            message = err:backtrace(),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return nil, false, err
+    end
+
+    return stop_market_common.amend(amend, entry, order, position, sequence, market_data)
+end
+
+function trailing_stop_order.post_amend(profile_data, order, position_before)
+    checks('table', 'table|engine_order', '?table|engine_position')
+
+    if order.order_type ~= config.params.ORDER_TYPE.TRAILING_STOP then
+        local err = EngineError:new(ERR_INTEGRITY_ERROR)
+        log.error({
+            message = err:backtrace(),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return err
+    end
+
+    return stop_market_common.post_amend(profile_data, order, position_before)
 end
 
 local ping_limit_order = {}
@@ -1660,6 +1749,7 @@ engine._order_metatypes = {
     take_profit_limit = take_profit_limit_order,
     stop_limit = stop_limit_order,
     stop_market = stop_market_order,
+    trailing_stop = trailing_stop_order,
     ping_limit = ping_limit_order,
 }
 
@@ -1704,6 +1794,23 @@ local function _broadcast_changes()
     changed_ids = nil
 end
 
+-- realized pnl of a fill against the position, ZERO when the fill opens or increases it
+local function _realized_pnl(position, entry_side, fill_price, fill_size)
+    if position == nil or entry_side == position.side then
+        return ZERO
+    end
+
+    local mulSide = 1
+    if position.side == config.params.SHORT then
+        mulSide = -1
+    end
+
+    if fill_size < position.size then
+        return fill_size * (fill_price - position.entry_price) * mulSide
+    end
+    return position.size * (fill_price - position.entry_price) * mulSide
+end
+
 local function _update_position(trader_id, entry_side, fill_price, fill_size)
     local e, new_position
 
@@ -1732,21 +1839,14 @@ local function _update_position(trader_id, entry_side, fill_price, fill_size)
             return e
         end
     else
-        local mulSide = 1
-        if position.side == config.params.SHORT then
-            mulSide = -1
-        end
-
-        local realized_pnl = ZERO
+        local realized_pnl = _realized_pnl(position, entry_side, fill_price, fill_size)
         local new_size = position.size
         local new_side = position.side
         local new_price = position.entry_price
 
         if fill_size < position.size then
-            realized_pnl =  fill_size * (fill_price - position.entry_price) * mulSide
             new_size = position.size - fill_size
         else
-            realized_pnl = position.size * (fill_price - position.entry_price) * mulSide
             new_price = fill_price
             new_side = entry_side
             new_size = fill_size - position.size
@@ -1789,7 +1889,7 @@ function engine._reject_order(order_id, reason)
     end
 
     local tm = time.now()
-    notif.add_private(engine._market_id, tostring(order.id), tm, order.profile_id, "order", order)
+    notif.add_order(engine._market_id, tm, order, config.params.ORDER_EVENT.REJECT)
 
     if util.is_value_in(order.order_type, position_dep_order_types) then
         local err = _notify_extended_position(order.profile_id)
@@ -1814,10 +1914,16 @@ function engine._create_order(
     trigger_price,
     size_percent,
     time_in_force,
-    is_liquidation
+    is_liquidation,
+    callback_value,
+    callback_percent,
+    group_id,
+    group_type,
+    trigger_by
 )
     checks('string', 'number', 'string', '?decimal', '?decimal', '?decimal', 'string',
-        '?string', '?decimal', '?decimal', 'string', 'boolean')
+        '?string', '?decimal', '?decimal', 'string', 'boolean', '?decimal', '?decimal', '?string', '?string',
+        '?string')
 
     local order, err = o.create(
         order_id,
@@ -1832,7 +1938,12 @@ function engine._create_order(
         trigger_price,
         size_percent,
         time_in_force,
-        is_liquidation
+        is_liquidation,
+        callback_value,
+        callback_percent,
+        group_id,
+        group_type,
+        trigger_by
     )
     if err ~= nil then
         log.error(EngineError:new(err))
@@ -1840,7 +1951,7 @@ function engine._create_order(
     end
 
     local tm = time.now()
-    notif.add_private(engine._market_id, tostring(order.id), tm, order.profile_id, "order", order)
+    notif.add_order(engine._market_id, tm, order, config.params.ORDER_EVENT.CREATE)
 
     if util.is_value_in(order.order_type, position_dep_order_types) then
         local err = _notify_extended_position(order.profile_id)
@@ -1863,7 +1974,7 @@ local function _update_order(order_id, new_price, new_size)
     end
 
     local tm = time.now()
-    notif.add_private(engine._market_id, tostring(order.id), tm, order.profile_id, "order", order)
+    notif.add_order(engine._market_id, tm, order, config.params.ORDER_EVENT.FILL)
 
     if util.is_value_in(order.order_type, position_dep_order_types) then
         local err = _notify_extended_position(order.profile_id)
@@ -1885,7 +1996,7 @@ function engine._cancel_order(order_id)
     end
 
     local tm = time.now()
-    notif.add_private(engine._market_id, tostring(order.id), tm, order.profile_id, 'order', order)
+    notif.add_order(engine._market_id, tm, order, config.params.ORDER_EVENT.CANCEL)
 
     if util.is_value_in(order.order_type, position_dep_order_types) then
         local err = _notify_extended_position(order.profile_id)
@@ -1968,6 +2079,17 @@ local function _update_entry(entry_id, side, price, new_size, sequence, trader_i
     return nil
 end
 
+-- liquidation fills go to the liquidations:<market> channel and the liquidation archive
+local function _add_liquidation(fill, kind)
+    local liquidation, err = trade.add_liquidation(fill, kind)
+    if err ~= nil then
+        return err
+    end
+
+    notif.add_liquidation(engine._market_id, liquidation)
+    return nil
+end
+
 local function _fill_wf3(
     fill_size,
     fill_price,
@@ -1977,12 +2099,16 @@ local function _fill_wf3(
     trader_id,
     trade_id_prefix,
     is_liquidation_insurance,
-    is_liquidation_trader)
+    is_liquidation_trader,
+    ledger_kind)
 
     local e
 
     local notion = fill_price * fill_size
 
+    local insurance_position = box.space.position.index.pos_by_market_profile:get({engine._market_id, insurance_id})
+    local insurance_pnl = _realized_pnl(insurance_position, insurance_side, fill_price, fill_size)
+
     -- UPDATE POSITIONS for maker and taker ---
     if insurance_side == config.params.LONG then
         e = _update_position(insurance_id, insurance_side, fill_price, fill_size)
@@ -2057,6 +2183,47 @@ local function _fill_wf3(
         return EngineError:new(err)
     end
 
+    if is_liquidation_trader == true then
+        err = _add_liquidation(trader_fill, config.params.LIQUIDATION_EVENT_KIND.TAKEOVER)
+        if err ~= nil then
+            return EngineError:new(err)
+        end
+    end
+
+    -- recorded even when the insurance only opens a position, the takeover
+    -- entries attribute the later sales of the position to the trader
+    err = balance.record_insurance(insurance_id, trader_id, engine._market_id, ledger_kind, insurance_pnl, insurance_fill_id)
+    if err ~= nil then
+        return EngineError:new(err)
+    end
+
+    return nil
+end
+
+-- insurance ledger entries of an orderbook fill of the insurance, attributed to the
+-- profile pinned to the insurance order when it was placed or to the counterparty
+local function _record_insurance_fill(insurance_id, insurance_order_id, counterparty_id, realized_pnl, fee, fill_id)
+    local trigger_id = balance.insurance_order_trigger(insurance_order_id)
+    if trigger_id == nil then
+        trigger_id = counterparty_id
+    end
+
+    if realized_pnl ~= 0 then
+        local err = balance.record_insurance(insurance_id, trigger_id, engine._market_id,
+            config.params.INSURANCE_LEDGER_KIND.TAKEOVER_PNL, realized_pnl, fill_id)
+        if err ~= nil then
+            return err
+        end
+    end
+
+    if fee ~= 0 then
+        local err = balance.record_insurance(insurance_id, trigger_id, engine._market_id,
+            config.params.INSURANCE_LEDGER_KIND.TRADING_FEE, fee, fill_id)
+        if err ~= nil then
+            return err
+        end
+    end
+
     return nil
 end
 
@@ -2108,6 +2275,18 @@ local function _fill(
     local makerFee = notion * makerTier.maker_fee * -1
     local takerFee = notion * takerTier.taker_fee * -1
 
+    -- the insurance selling taken over positions on the book
+    local insurance_id = profile.get_insurance_id()
+    local insurance_pnl
+    if insurance_id ~= nil and (maker_id == insurance_id or taker_id == insurance_id) then
+        local insurance_side = taker_side
+        if maker_id == insurance_id then
+            insurance_side = maker_side
+        end
+        local insurance_position = box.space.position.index.pos_by_market_profile:get({engine._market_id, insurance_id})
+        insurance_pnl = _realized_pnl(insurance_position, insurance_side, fill_price, fill_size)
+    end
+
     -- UPDATE POSITIONS for maker and taker ---
     if taker_side == config.params.LONG then
         e = _update_position(taker_id, taker_side, fill_price, fill_size)
@@ -2196,6 +2375,20 @@ local function _fill(
         return err
     end
 
+    if is_liquidation == true then
+        err = _add_liquidation(taker_fill, config.params.LIQUIDATION_EVENT_KIND.ORDERBOOK)
+        if err ~= nil then
+            return err
+        end
+    end
+
+    if maker_is_liquidation == true then
+        err = _add_liquidation(maker_fill, config.params.LIQUIDATION_EVENT_KIND.ORDERBOOK)
+        if err ~= nil then
+            return err
+        end
+    end
+
     -- Create updates
     notif.add_trade(engine._market_id, trade_item)
     notif.add_private(engine._market_id, tostring(taker_fill_id), tm, taker_id, "fill", taker_fill)
@@ -2221,6 +2414,17 @@ local function _fill(
         end
     end
 
+    if insurance_pnl ~= nil then
+        if maker_id == insurance_id then
+            err = _record_insurance_fill(insurance_id, maker_order_id, taker_id, insurance_pnl, makerFee, maker_fill_id)
+        else
+            err = _record_insurance_fill(insurance_id, taker_order_id, maker_id, insurance_pnl, takerFee, taker_fill_id)
+        end
+        if err ~= nil then
+            return err
+        end
+    end
+
 
     -- UPDATE marketRT info
     local best_ask = ZERO
@@ -2407,6 +2611,150 @@ local function _pre_execute_order(order, position, market_data)
     return ERR_WRONG_ORDER_TYPE
 end
 
+-- ORDER GROUPS ---------
+-- group_id is the id of the first order of the group, for a bracket it's the entry
+local group_statuses = {
+    config.params.ORDER_STATUS.PLACED,
+    config.params.ORDER_STATUS.PENDING,
+}
+
+local function _is_group_entry(order)
+    return order.group_type == config.params.ORDER_GROUP_TYPE.BRACKET and order.id == order.group_id
+end
+
+-- every conditional member of a group cancels the rest of it when triggered
+local function _is_group_trigger(order)
+    if order.group_id == nil or order.group_id == '' then
+        return false
+    end
+
+    return not _is_group_entry(order)
+end
+
+local function _cancel_group_orders(order, statuses)
+    checks('table|engine_order', 'table')
+
+    for _, member in ipairs(o.get_group_orders(order.profile_id, order.group_id, statuses)) do
+        if member.id ~= order.id then
+            local err = engine._cancel_order(member.id)
+            if err ~= nil then
+                log.error(EngineError:new(err))
+                return err
+            end
+        end
+    end
+
+    return nil
+end
+
+function engine._create_pending_order(order)
+    checks('table|api_create_order')
+
+    local new_order, err = o.create(
+        order.order_id,
+        order.profile_id,
+        engine._market_id,
+        order.order_type,
+        order.price,
+        order.size,
+        order.size,
+        order.side,
+        order.client_order_id,
+        order.trigger_price,
+        order.size_percent,
+        order.time_in_force,
+        false,
+        nil,
+        nil,
+        order.group_id,
+        order.group_type,
+        order.trigger_by
+    )
+    if err ~= nil then
+        log.error(EngineError:new(err))
+        return nil, err
+    end
+
+    new_order, err = o.pending(new_order.id)
+    if err ~= nil then
+        log.error(EngineError:new(err))
+        return nil, err
+    end
+
+    local tm = time.now()
+    notif.add_order(engine._market_id, tm, new_order, config.params.ORDER_EVENT.CREATE)
+
+    return new_order, nil
+end
+
+-- bracket child becomes a normal position dependent order,
+-- rejected with reason if it can't be placed for the position now
+function engine._activate_order(order, position, market_data)
+    checks('table|engine_order', '?table|engine_position', 'table|engine_market')
+
+    local order_req = order:tomap({names_only = true})
+    local err = _pre_create_order(order_req, position, market_data)
+    if err ~= nil then
+        log.error(EngineError:new('activate order id=%s: %s', order.id, tostring(err)))
+        return engine._reject_order(order.id, tostring(err))
+    end
+
+    local activated
+    activated, err = o.activate(order.id, order_req.side)
+    if err ~= nil then
+        return err
+    end
+
+    local tm = time.now()
+    notif.add_order(engine._market_id, tm, activated, config.params.ORDER_EVENT.OPEN)
+
+    return _notify_extended_position(activated.profile_id)
+end
+
+-- pending children follow their entry: activated after the first fill,
+-- canceled when the entry is done without any fill
+local function _settle_pending_orders(profile_id)
+    checks('number')
+
+    local pending = {}
+    for _, child in o.iterator_by(profile_id, config.params.ORDER_STATUS.PENDING, nil) do
+        table.insert(pending, child)
+    end
+    if #pending == 0 then
+        return nil
+    end
+
+    local res = market.get_market(engine._market_id)
+    if res.error ~= nil then
+        log.error(EngineError:new(res.error))
+        return res.error
+    end
+    local market_data = res.res
+    local position = p.get_position(profile_id, engine._market_id)
+
+    local done_statuses = {
+        config.params.ORDER_STATUS.CLOSED,
+        config.params.ORDER_STATUS.CANCELED,
+        config.params.ORDER_STATUS.REJECTED,
+    }
+
+    for _, child in ipairs(pending) do
+        local err
+        local entry = box.space.order:get(child.group_id)
+        if entry ~= nil and entry.total_filled_size > 0 then
+            err = engine._activate_order(child, position, market_data)
+        elseif entry == nil or util.is_value_in(entry.status, done_statuses) then
+            err = engine._cancel_order(child.id)
+        end
+        if err ~= nil then
+            log.error(EngineError:new(err))
+            return err
+        end
+    end
+
+    return nil
+end
+
 local function _post_execute_order(order, left_size, sequence)
     checks('table|engine_order', 'decimal', 'number')
     local err
@@ -2422,6 +2770,14 @@ local function _post_execute_order(order, left_size, sequence)
         return err
     end
 
+    if _is_group_trigger(order) then
+        err = _cancel_group_orders(order, group_statuses)
+        if err ~= nil then
+            log.error(EngineError:new(err))
+            return err
+        end
+    end
+
     for _, profile in notif.changed_profiles_iterator() do
         local position = p.get_position(profile.profile_id, engine._market_id)
 
@@ -2436,6 +2792,12 @@ local function _post_execute_order(order, left_size, sequence)
                 end
             end
         end
+
+        err = _settle_pending_orders(profile.profile_id)
+        if err ~= nil then
+            log.error(EngineError:new(err))
+            return err
+        end
     end
 
     return nil
@@ -2546,6 +2908,13 @@ function engine._private_match(pm_counterparty, side, price, size, order_id, pro
         return err
     end
 
+    if is_liquidation == true then
+        err = _add_liquidation(taker_fill, config.params.LIQUIDATION_EVENT_KIND.ORDERBOOK)
+        if err ~= nil then
+            return err
+        end
+    end
+
     -- Create updates
     notif.add_private(engine._market_id, tostring(taker_fill_id), tm, profile_id, "fill", taker_fill)
     notif.add_private(engine._market_id, tostring(maker_fill_id), tm, pm_counterparty, "fill", maker_fill)
@@ -2725,11 +3094,13 @@ function engine._handle_cancelall(order)
         end
         notif.add_profile(order.profile_id)
 
-        for _, cond_order in o.iterator_by(order.profile_id, config.params.ORDER_STATUS.PLACED, nil) do
-            err = engine._cancel_order(cond_order.id)
-            if err ~= nil then
-                log.error(EngineError:new(err))
-                return nil, err
+        for _, order_status in ipairs(group_statuses) do
+            for _, cond_order in o.iterator_by(order.profile_id, order_status, nil) do
+                err = engine._cancel_order(cond_order.id)
+                if err ~= nil then
+                    log.error(EngineError:new(err))
+                    return nil, err
+                end
             end
         end
 
@@ -2861,7 +3232,7 @@ function engine._handle_cancel(api_order)
         end
         notif.add_profile(order.profile_id)
 
-        if order.status == config.params.ORDER_STATUS.PLACED then
+        if util.is_value_in(order.status, group_statuses) then
             if order.profile_id ~= api_order.profile_id then
                 return nil, ERR_NOT_YOUR_ORDER
             end
@@ -2887,6 +3258,17 @@ function engine._handle_cancel(api_order)
             end
         end
 
+        -- oco goes away as a whole, bracket entry takes the children not activated yet
+        if order.group_type == config.params.ORDER_GROUP_TYPE.OCO then
+            err = _cancel_group_orders(order, group_statuses)
+        elseif _is_group_entry(order) then
+            err = _cancel_group_orders(order, {config.params.ORDER_STATUS.PENDING})
+        end
+        if err ~= nil then
+            log.error(EngineError:new(err))
+            return nil, err
+        end
+
         return nil, nil
     end)
     if err == nil then
@@ -2943,7 +3325,12 @@ function engine._handle_create(order, profile_data, matching_meta)
         order.trigger_price,
         order.size_percent,
         order.time_in_force,
-        order.is_liquidation
+        order.is_liquidation,
+        order.callback_value,
+        order.callback_percent,
+        order.group_id,
+        order.group_type,
+        order.trigger_by
     )
     if err ~= nil then
         log.error(EngineError:new(err))
@@ -3060,6 +3447,185 @@ function engine._handle_create(order, profile_data, matching_meta)
     return nil
 end
 
+-- both legs are stored or rejected together, a leg triggered right away
+-- cancels the other one as on any later trigger
+local function _create_oco_group(orders, profile_data)
+    checks('table', 'table')
+
+    local err, res
+    res = market.get_market(engine._market_id)
+    if res.error ~= nil then
+        log.error(EngineError:new(res.error))
+        return res.error
+    end
+    local market_data = res.res
+
+    local profile_id = orders[1].profile_id
+    local position_before = p.get_position(profile_id, engine._market_id)
+
+    local pre_create_err
+    for _, order in ipairs(orders) do
+        pre_create_err = _pre_create_order(order, position_before, market_data)
+        if pre_create_err ~= nil then
+            log.error(EngineError:new('%s: slog=%s', tostring(pre_create_err), json.encode(order)))
+            break
+        end
+    end
+
+    box.begin()
+    err = profile.ensure_meta(profile_id, engine._market_id)
+    if err ~= nil then
+        log.error(EngineError:new(err))
+        box.rollback()
+        return err
+    end
+
+    local created = {}
+    for _, order in ipairs(orders) do
+        local new_order
+        new_order, err = engine._create_order(
+            order.order_id,
+            order.profile_id,
+            order.order_type,
+            order.price,
+            order.size,
+            order.size,
+            order.side,
+            order.client_order_id,
+            order.trigger_price,
+            order.size_percent,
+            order.time_in_force,
+            false,
+            nil,
+            nil,
+            order.group_id,
+            order.group_type,
+            order.trigger_by
+        )
+        if err ~= nil then
+            log.error(EngineError:new(err))
+            box.rollback()
+            return err
+        end
+        table.insert(created, new_order)
+    end
+
+    if pre_create_err ~= nil then
+        for _, new_order in ipairs(created) do
+            local rej_err = engine._reject_order(new_order.id, tostring(pre_create_err))
+            if rej_err ~= nil then
+                log.error(EngineError:new("reject order id=%s error: %s", new_order.id, EngineError:new(rej_err)))
+            end
+        end
+
+        box.commit()
+        notif.notify_account(engine._market_id)
+        return pre_create_err
+    end
+
+    notif.add_profile(profile_id)
+
+    local sequence = engine._next_sequence()
+    local svp = box.savepoint()
+    for _, new_order in ipairs(created) do
+        local leg = o.get_order_by_id(new_order.id).res
+        if leg ~= nil and leg.status == config.params.ORDER_STATUS.PLACED then
+            err = _execute_order(leg, false, false, profile_data, position_before, sequence, market_data)
+            if err ~= nil then
+                log.error(EngineError:new(err))
+                engine._rollback_with_sequence(svp)
+
+                for _, rej_order in ipairs(created) do
+                    local rej_err = engine._reject_order(rej_order.id, tostring(err))
+                    if rej_err ~= nil then
+                        log.error(EngineError:new("reject order id=%s error: %s", rej_order.id, EngineError:new(rej_err)))
+                    end
+                end
+                box.commit()
+                notif.notify_account(engine._market_id)
+
+                return err
+            end
+        end
+    end
+
+    box.commit()
+    notif.notify(engine._market_id, sequence) -- notify through pub/sub
+
+    return nil
+end
+
+-- children are stored pending before the entry is matched,
+-- so a fill of the entry in the same match activates them
+local function _create_bracket_group(orders, profile_data, matching_meta)
+    checks('table', 'table', '?table')
+
+    local err
+    local entry = orders[1]
+
+    box.begin()
+    err = profile.ensure_meta(entry.profile_id, engine._market_id)
+    if err ~= nil then
+        log.error(EngineError:new(err))
+        box.rollback()
+        return err
+    end
+
+    for i = 2, #orders do
+        local _, err = engine._create_pending_order(orders[i])
+        if err ~= nil then
+            log.error(EngineError:new(err))
+            box.rollback()
+            return err
+        end
+    end
+    box.commit()
+
+    err = engine._handle_create(entry, profile_data, matching_meta)
+    if err ~= nil then
+        box.begin()
+        for i = 2, #orders do
+            local rej_err = engine._reject_order(orders[i].order_id, tostring(err))
+            if rej_err ~= nil then
+                log.error(EngineError:new("reject order id=%s error: %s", orders[i].order_id, EngineError:new(rej_err)))
+            end
+        end
+        box.commit()
+        notif.notify_account(engine._market_id)
+
+        return err
+    end
+
+    return nil
+end
+
+function engine._handle_create_group(task_data, profile_data)
+    checks('table|api_task', 'table')
+
+    local orders = {task_data.order}
+    for _, leg in ipairs(task_data.legs or {}) do
+        table.insert(orders, leg)
+    end
+
+    for _, order in ipairs(orders) do
+        if o.get_order_by_id(order.order_id).res ~= nil then
+            local err = "exist order_id=" .. tostring(order.order_id)
+            log.error(EngineError:new(err))
+            return err
+        end
+    end
+
+    local group_type = task_data.order.group_type
+    if group_type == config.params.ORDER_GROUP_TYPE.OCO then
+        return _create_oco_group(orders, profile_data)
+    elseif group_type == config.params.ORDER_GROUP_TYPE.BRACKET then
+        return _create_bracket_group(orders, profile_data, task_data.matching_meta)
+    end
+
+    log.error(EngineError:new("unknown group_type=%s", tostring(group_type)))
+    return ERR_WRONG_ORDER_GROUP
+end
+
 function engine._handle_execute(order_data, profile_data)
     checks('table|api_execute_order', 'table')
     local err, res
@@ -3116,6 +3682,28 @@ function engine._handle_execute(order_data, profile_data)
     return nil
 end
 
+-- a selloff order of the insurance is attributed to the profile whose position
+-- was taken over last, the pins of the closed insurance orders are dropped
+local function _pin_insurance_order(order_id)
+    local closed = {}
+    for _, pin in box.space.insurance_order:pairs(nil, {iterator = box.index.ALL}) do
+        local order = box.space.order:get(pin.order_id)
+        if order == nil or order.status == config.params.ORDER_STATUS.CLOSED or
+            order.status == config.params.ORDER_STATUS.CANCELED or
+            order.status == config.params.ORDER_STATUS.REJECTED then
+            table.insert(closed, pin.order_id)
+        end
+    end
+    for _, id in ipairs(closed) do
+        balance.unpin_insurance_order(id)
+    end
+
+    local trigger_id = balance.last_insurance_takeover(engine._market_id)
+    if trigger_id ~= nil then
+        balance.pin_insurance_order(order_id, trigger_id)
+    end
+end
+
 function engine._handle_liquidate(task_data)
     checks('table|api_task')
 
@@ -3160,6 +3748,10 @@ function engine._handle_liquidate(task_data)
             side = config.params.LONG
         end
 
+        if trader_id == profile.get_insurance_id() then
+            _pin_insurance_order(order_id)
+        end
+
         local order, _ = action_creator.pack_create(
             liq_action[d.liq_action_trader_id],
             market_id,
@@ -3217,13 +3809,16 @@ function engine._handle_liquidate(task_data)
                 trader_id,
                 "wf3",
                 true,
-                true)
+                true,
+                config.params.INSURANCE_LEDGER_KIND.TAKEOVER_PNL)
             if res ~= nil then
                 box.rollback()
                 return res
             end
         box.commit()
 
+        notif.notify_liquidations(engine._market_id)
+
     elseif liquidate_kind == config.params.LIQUIDATE_KIND.AINSCLAWBACK then
 
         -- SKIP CLAWBACK order if market is active
@@ -3273,7 +3868,8 @@ function engine._handle_liquidate(task_data)
                 trader_id,
                 "clawback",
                 false,
-                false)
+                false,
+                config.params.INSURANCE_LEDGER_KIND.CLAWBACK)
             if res ~= nil then
                 box.rollback()
                 return res
@@ -3337,6 +3933,8 @@ function engine.handle_task(task)
 
     if which_action == config.params.ORDER_ACTION.CREATE then
         res = engine._handle_create(order, profile_data, task_data.matching_meta)
+    elseif which_action == config.params.ORDER_ACTION.CREATE_GROUP then
+        res = engine._handle_create_group(task_data, profile_data)
     elseif which_action == config.params.ORDER_ACTION.CANCEL then
         res = engine._handle_cancel(order)
     elseif which_action == config.params.ORDER_ACTION.AMEND then
@@ -3406,6 +4004,58 @@ end
 -- ONLY FOR admin usage
 -- Received original_fill as input (has profile_id, and taker_profile_id)
 -- Will generate reverted trade
+--[[
+    Called by the slipstopper when the running high/low of a trailing stop moves.
+    The trigger only moves towards the price, a stale update returns the stored order.
+
+    return: {res = order, error}
+--]]
+function engine.update_trailing_trigger(market_id, order_id, trigger_price)
+    checks('string', 'string', 'decimal')
+
+    if market_id ~= engine._market_id then
+        return {res = nil, error = ERR_WRONG_MARKET_ID}
+    end
+
+    local res = o.get_order_by_id(order_id)
+    if res.error ~= nil then
+        return {res = nil, error = res.error}
+    end
+    local order = res.res
+
+    if order.order_type ~= config.params.ORDER_TYPE.TRAILING_STOP then
+        return {res = nil, error = ERR_WRONG_ORDER_TYPE}
+    end
+    if order.status ~= config.params.ORDER_STATUS.PLACED then
+        return {res = nil, error = ERR_WRONG_ORDER_STATUS}
+    end
+
+    trigger_price = tick.round_to_nearest_tick(trigger_price, engine._min_tick)
+
+    local moved
+    if order.side == config.params.LONG then
+        moved = trigger_price < order.trigger_price
+    else
+        moved = trigger_price > order.trigger_price
+    end
+    if not moved or trigger_price <= 0 then
+        return {res = order, error = nil}
+    end
+
+    local updated, err = o.update_trigger(order_id, trigger_price)
+    if err ~= nil then
+        log.error(EngineError:new(err))
+        return {res = nil, error = err}
+    end
+
+    err = notif.notify_order(updated.profile_id, updated.id)
+    if err ~= nil then
+        log.error(EngineError:new(err))
+    end
+
+    return {res = updated, error = nil}
+end
+
 function engine.handle_revert(raw_fill)
     checks('table')
 
@@ -3646,16 +4296,64 @@ function engine._start_loop()
     engine._loop:set_joinable(true)
 end
 
+-- the rounding residual of the funding round is credited to the insurance
+-- fund (debited if negative), the funding payments net to zero with it
+local function _pay_funding_residual(market_id, funding_time, residual)
+    local insurance_id = profile.get_insurance_id()
+    if insurance_id == nil then
+        return nil, "NO_INSURANCE_FOR_FUNDING_RESIDUAL"
+    end
+
+    local balanceUpdate = balance.pay_funding(insurance_id, residual)
+    if balanceUpdate['error'] ~= nil then
+        return nil, balanceUpdate['error']
+    end
+
+    local err = balance.record_insurance(insurance_id, 0, market_id,
+        config.params.INSURANCE_LEDGER_KIND.FUNDING_RESIDUAL, residual,
+        string.format("%s-%d", market_id, funding_time))
+    if err ~= nil then
+        return nil, err
+    end
+
+    return insurance_id, nil
+end
+
 --[[
 type FundingPayment struct {
 	MarketId      string
 	ProfileId     uint
 	FundingAmount *tdecimal.Decimal
+	Side          string
+	Size          *tdecimal.Decimal
+	Price         *tdecimal.Decimal
+	Rate          *tdecimal.Decimal
 }
+
+Idempotent by last_update_time: a retried round that was already paid is
+skipped, a payment already recorded for the profile is not paid again.
 --]]
-function engine.pay_funding(market_id, funding_payments, last_update_time, total_long, total_short)
+function engine.pay_funding(market_id, funding_payments, last_update_time, total_long, total_short, residual)
     last_update_time = tonumber(last_update_time)
-    checks('string', 'table', 'number', 'decimal', 'decimal')
+    checks('string', 'table', 'number', 'decimal', 'decimal', 'decimal')
+
+    local meta = box.space.funding_meta:get(market_id)
+    if meta ~= nil and meta.last_update >= last_update_time then
+        log.warn("SKIP pay_funding market_id=%s last_update_time=%d already paid last_update=%d",
+            market_id, last_update_time, meta.last_update)
+        return {res = nil, error = nil}
+    end
+
+    local sum = decimal.new(0)
+    for _, f_payment in ipairs(funding_payments) do
+        sum = sum + f_payment[3]
+    end
+    if sum ~= total_long + total_short or sum + residual ~= 0 then
+        local text = string.format("ERROR pay_funding not zero-sum market_id=%s payments=%s total_long=%s total_short=%s residual=%s",
+            market_id, tostring(sum), tostring(total_long), tostring(total_short), tostring(residual))
+        log.error(text)
+        return {res = nil, error = text}
+    end
 
     local changed_ids = {}
 
@@ -3665,9 +4363,17 @@ function engine.pay_funding(market_id, funding_payments, last_update_time, total
     end
 
     local count = 0
+    local tm = time.now()
+    local z = decimal.new(0)
     for _, f_payment in ipairs(funding_payments) do
         local p_id = f_payment[2]
         local f_amount = f_payment[3]
+        local payment_id = market.funding_payment_id(market_id, last_update_time, p_id)
+
+        if box.space.funding_payment:get(payment_id) ~= nil then
+            log.warn("SKIP funding_payment id=%s already paid", payment_id)
+            goto continue
+        end
 
         local balanceUpdate = balance.pay_funding(p_id, f_amount)
         if balanceUpdate['error'] ~= nil then
@@ -3677,13 +4383,43 @@ function engine.pay_funding(market_id, funding_payments, last_update_time, total
             return {res = nil, error=text}
         end
 
+        local _, err = archiver.insert(box.space.funding_payment, {
+            payment_id,
+            p_id,
+            market_id,
+            util.return_not_nil(f_payment[4], ""),  -- side
+            util.return_not_nil(f_payment[5], z),   -- size
+            util.return_not_nil(f_payment[6], z),   -- price
+            util.return_not_nil(f_payment[7], z),   -- rate
+            f_amount,
+            last_update_time,
+            tm,
+        })
+        if err ~= nil then
+            local text = "ERROR insert funding_payment: " .. tostring(err)
+            log.error(text)
+            box.rollback()
+            return {res = nil, error=text}
+        end
+
         table.insert(changed_ids, p_id)
 
         -- WE don't do yield here: WAL log warn is ok
         -- CUZ we need to guarantee stability of the funding
         -- count = util.safe_yield(count, 0)
+        ::continue::
     end
 
+    if residual ~= 0 then
+        local insurance_id, err = _pay_funding_residual(market_id, last_update_time, residual)
+        if err ~= nil then
+            local text = "ERROR pay funding residual: " .. tostring(err)
+            log.error(text)
+            box.rollback()
+            return {res = nil, error=text}
+        end
+        table.insert(changed_ids, insurance_id)
+    end
 
     local status, res = pcall(function() return box.space.funding_meta:update(market_id, {
         {'=' , 'last_update', last_update_time},
@@ -33,10 +33,11 @@ return {
             sign = -1
         end
 
+        local margin_price = m.margin_price(market)
         position.fair_price = market.fair_price
-        position.unrealized_pnl = position.size * (market.fair_price - position.entry_price) * sign
-        position.notional = position.size * market.fair_price
-        position.margin = meta.initial_margin * position.size * market.fair_price
+        position.unrealized_pnl = position.size * (margin_price - position.entry_price) * sign
+        position.notional = position.size * margin_price
+        position.margin = meta.initial_margin * position.size * margin_price
         local den = (1 + sign * -1 * market.forced_margin)
         if den ~= 0 then
             position.liquidation_price = (1 + sign * -1 * meta.initial_margin) * position.entry_price / den
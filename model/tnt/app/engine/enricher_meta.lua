@@ -4,6 +4,7 @@ local log = require('log')
 local balance = require('app.balance')
 local config = require('app.config')
 local ag = require("app.engine.aggregate")
+local m = require('app.engine.market')
 local pos = require('app.engine.position')
 local errors = require('app.lib.errors')
 local time = require('app.lib.time')
@@ -20,6 +21,7 @@ return {
         local cum_unrealized_pnl = ZERO
         local total_position_margin = ZERO
         local total_notional = ZERO
+        local margin_price = m.margin_price(market)
 
         -- Calc metrics and update ALL positionRT fir this profile
         for _, position in box.space.position.index.profile_id:pairs(profile_id, {iterator = 'EQ'}) do
@@ -28,9 +30,9 @@ return {
                 sign = -1
             end
 
-            local unrealized_pnl_fair = position.size * (market.fair_price - position.entry_price) * sign
-            local notional_fair = position.size * market.fair_price
-            local position_margin = profile_meta.initial_margin * position.size * market.fair_price
+            local unrealized_pnl_fair = position.size * (margin_price - position.entry_price) * sign
+            local notional_fair = position.size * margin_price
+            local position_margin = profile_meta.initial_margin * position.size * margin_price
 
             local den = (1 + sign * -1 * market.forced_margin)
             local liquidation_price = ZERO
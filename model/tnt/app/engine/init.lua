@@ -42,6 +42,7 @@ return {
     engine = engine,
     market = market,
     methods = methods,
+    notif = notif,
     periodics = periodics,
     profile = profile,
     position = position,
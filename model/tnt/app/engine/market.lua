@@ -3,17 +3,26 @@ local decimal = require('decimal')
 local log = require('log')
 
 local archiver = require('app.archiver')
+local config = require('app.config')
+local ddl = require('app.ddl')
+local notif = require('app.engine.notif')
 local errors = require('app.lib.errors')
 local tick = require("app.lib.tick")
 local time = require('app.lib.time')
 local rolling = require('app.rolling')
 local tuple = require('app.tuple')
+local util = require('app.util')
 local tick = require('app.lib.tick')
 
 require("app.config.constants")
 
 local EngineError = errors.new_class("ENGINE_ERROR")
 
+local PREMIUM_SAMPLE_RETENTION = 7 * 24 * 3600000000 -- a week (microseconds)
+local PREMIUM_SAMPLE_TRIM_LIMIT = 100
+local PREMIUM_SAMPLER_TIMEOUT = 600000000 -- ten minutes (microseconds)
+local PREMIUM_SAMPLES_LIMIT = 100000
+
 local M = {
     format = {
         {name = 'id', type = 'string'},
@@ -41,8 +50,54 @@ local M = {
 
         {name = 'icon_url', type = 'string'},
         {name = 'market_title', type = 'string'},
+
+        {name = 'mark_price', type = 'decimal'},
+        {name = 'mark_price_usage', type = 'array'},
+
+        {name = 'next_funding_time', type = 'number'},
+
+        {name = 'price_degraded', type = 'boolean'},
     },
     strict_type = 'engine_market',
+
+    -- (impact mid - index) / index recorded by the funding service
+    premium_sample_format = {
+        {name = 'market_id', type = 'string'},
+        {name = 'timestamp', type = 'number'},
+        {name = 'index_price', type = 'decimal'},
+        {name = 'impact_bid', type = 'decimal'},
+        {name = 'impact_ask', type = 'decimal'},
+        {name = 'premium', type = 'decimal'},
+    },
+
+    -- funding rates set by the funding service with the params they were
+    -- computed with, the rate can be recomputed from the premium samples
+    -- of the interval ending at funding_time
+    funding_rate_format = {
+        {name = 'market_id', type = 'string'},
+        {name = 'funding_time', type = 'number'},
+        {name = 'rate', type = 'decimal'},
+        {name = 'premium', type = 'decimal'},
+        {name = 'interest_rate', type = 'decimal'},
+        {name = 'dampener', type = 'decimal'},
+        {name = 'cap', type = 'decimal'},
+        {name = 'samples', type = 'unsigned'},
+    },
+
+    -- funding debit (negative amount) or credit of a position, one per
+    -- profile for each funding_time (microseconds) the rate was paid for
+    funding_payment_format = {
+        {name = 'id', type = 'string'},
+        {name = 'profile_id', type = 'unsigned'},
+        {name = 'market_id', type = 'string'},
+        {name = 'side', type = 'string'},
+        {name = 'size', type = 'decimal'},
+        {name = 'price', type = 'decimal'},
+        {name = 'rate', type = 'decimal'},
+        {name = 'amount', type = 'decimal'},
+        {name = 'funding_time', type = 'number'},
+        {name = 'timestamp', type = 'number'},
+    },
 }
 
 local function new_market()
@@ -51,8 +106,52 @@ local function new_market()
     }
 end
 
+local function init_funding_spaces()
+    local _, err = ddl.create_space('premium_sample', {if_not_exists = true}, M.premium_sample_format, {
+        unique = true,
+        parts = {{field = 'market_id'}, {field = 'timestamp'}},
+        if_not_exists = true,
+    })
+    if err ~= nil then
+        log.error(EngineError:new(err))
+        error(err)
+    end
+
+    _, err = ddl.create_space('funding_rate', {if_not_exists = true}, M.funding_rate_format, {
+        unique = true,
+        parts = {{field = 'market_id'}, {field = 'funding_time'}},
+        if_not_exists = true,
+    })
+    if err ~= nil then
+        log.error(EngineError:new(err))
+        error(err)
+    end
+
+    local funding_payment
+    funding_payment, err = archiver.create('funding_payment', {if_not_exists = true}, M.funding_payment_format, {
+        unique = true,
+        parts = {{field = 'id'}},
+        if_not_exists = true,
+    })
+    if err ~= nil then
+        log.error(EngineError:new(err))
+        error(err)
+    end
+
+    funding_payment:create_index('profile_id', {
+        parts = {{field = 'profile_id'}, {field = 'timestamp'}},
+        unique = false,
+        if_not_exists = true,
+    })
+end
+
+function M.funding_payment_id(market_id, funding_time, profile_id)
+    return string.format("%s-%d-%d", market_id, funding_time, profile_id)
+end
+
 function M.init_spaces(market_config)
     rolling.init_spaces()
+    init_funding_spaces()
 
     -- CONSTANTS that rare change and status
     local market, err = archiver.create('market', {if_not_exists = true}, M.format, {
@@ -112,6 +211,12 @@ function M.init_spaces(market_config)
         0, 0, z, 0,
 
         "", "",     -- icon_url, market_title
+
+        z, {},      -- mark_price, mark_price_usage
+
+        0,          -- next_funding_time
+
+        false,      -- price_degraded
     })
     if err ~= nil then
         log.error(EngineError:new("**** can't create market error=%s", err))
@@ -265,6 +370,142 @@ function M.update_funding(market_id, instant_funding_rate, new_funding_rate, new
     return nil
 end
 
+-- time (microseconds) the next funding rate is expected to be set at
+function M.update_next_funding_time(market_id, next_funding_time)
+    checks("string", "number")
+
+    local market = box.space.market:get(market_id)
+    if market == nil then
+        return "market_not_found"
+    end
+    if market.next_funding_time == next_funding_time then
+        return nil
+    end
+
+    local _, err = archiver.update(box.space.market, market_id, {
+        {'=', 'next_funding_time', next_funding_time},
+    })
+    if err ~= nil then
+        log.error(EngineError:new("can't update next_funding_time error=%s", err))
+        return err
+    end
+
+    return nil
+end
+
+-- true while the funding service records premium samples for the market,
+-- the rate is then set by set_funding_rate instead of the periodics
+function M.premium_sampler_active(market_id, now)
+    checks("string", "number")
+
+    if box.space.premium_sample == nil then
+        return false
+    end
+
+    local last = box.space.premium_sample.index.primary:max({market_id})
+    if last == nil then
+        return false
+    end
+
+    return now - last.timestamp < PREMIUM_SAMPLER_TIMEOUT
+end
+
+-- stores a premium sample and the rate predicted from the samples of the
+-- current interval as the instant funding rate, next_funding_time is the end
+-- of the current interval
+function M.add_premium_sample(market_id, timestamp, index_price, impact_bid, impact_ask, premium, instant_rate, next_funding_time)
+    checks("string", "number", "decimal", "decimal", "decimal", "decimal", "decimal", "number")
+
+    local market = box.space.market:get(market_id)
+    if market == nil then
+        return {res = nil, error = ERR_MARKET_NOT_FOUND}
+    end
+
+    box.begin()
+    box.space.premium_sample:replace({market_id, timestamp, index_price, impact_bid, impact_ask, premium})
+
+    local _, err = archiver.update(box.space.market, market_id, {
+        {'=', 'instant_funding_rate', instant_rate},
+        {'=', 'next_funding_time', next_funding_time},
+    })
+    if err ~= nil then
+        box.rollback()
+        log.error(EngineError:new("can't update instant_funding_rate error=%s", err))
+        return {res = nil, error = err}
+    end
+
+    local expired = {}
+    for _, sample in box.space.premium_sample.index.primary:pairs({market_id}, {iterator = box.index.EQ}) do
+        if sample.timestamp >= timestamp - PREMIUM_SAMPLE_RETENTION or #expired >= PREMIUM_SAMPLE_TRIM_LIMIT then
+            break
+        end
+        table.insert(expired, sample.timestamp)
+    end
+    for _, ts in ipairs(expired) do
+        box.space.premium_sample:delete({market_id, ts})
+    end
+    box.commit()
+
+    return {res = nil, error = nil}
+end
+
+-- premium samples with from <= timestamp < to (microseconds)
+function M.get_premium_samples(market_id, from, to)
+    checks("string", "number", "number")
+
+    local res = {}
+    for _, sample in box.space.premium_sample.index.primary:pairs({market_id, from}, {iterator = box.index.GE}) do
+        if sample.market_id ~= market_id or sample.timestamp >= to then
+            break
+        end
+        if #res >= PREMIUM_SAMPLES_LIMIT then
+            return {res = nil, error = "too_many_premium_samples"}
+        end
+        table.insert(res, sample:tomap({names_only = true}))
+    end
+
+    return {res = res, error = nil}
+end
+
+-- sets the rate computed by the funding service for the interval ending at
+-- funding_time (microseconds), the funding service pays it on its next run
+function M.set_funding_rate(market_id, funding_time, rate, premium, interest_rate, dampener, cap, samples)
+    checks("string", "number", "decimal", "decimal", "decimal", "decimal", "decimal", "number")
+
+    local market = box.space.market:get(market_id)
+    if market == nil then
+        return {res = nil, error = ERR_MARKET_NOT_FOUND}
+    end
+    if funding_time <= market.last_funding_update_time then
+        return {res = nil, error = "funding_time_not_after_last_funding_update"}
+    end
+
+    box.begin()
+    box.space.funding_rate:replace({market_id, funding_time, rate, premium, interest_rate, dampener, cap, samples})
+
+    local err = M.update_funding(market_id, rate, rate, funding_time, true)
+    if err ~= nil then
+        box.rollback()
+        return {res = nil, error = err}
+    end
+    box.commit()
+
+    notif.notify_market(market_id)
+
+    return {res = rate, error = nil}
+end
+
+function M.get_funding_rate(market_id, funding_time)
+    checks("string", "number")
+
+    local record = box.space.funding_rate:get({market_id, funding_time})
+    if record == nil then
+        return {res = nil, error = "FUNDING_RATE_NOT_FOUND"}
+    end
+
+    return {res = record:tomap({names_only = true}), error = nil}
+end
+
 function M.update_fair_price(market_id, fair_price)
     checks("string", "decimal")
 
@@ -323,6 +564,73 @@ function M.update_index_price(market_id, index_price)
     return {res=nil, error=nil}
 end
 
+-- mark price is computed by the pricing service from the impact bid/ask,
+-- usage lists the consumers (liquidation, slipstopper, funding) using it instead of fair_price
+function M.update_mark_price(market_id, mark_price, usage)
+    checks("string", "decimal", "table")
+
+    if mark_price <= 0 then
+        return {res = nil, error = "zero_or_negative_mark_price"}
+    end
+
+    local market = box.space.market:get(market_id)
+    if market == nil then
+        return {res = nil, error = ERR_MARKET_NOT_FOUND}
+    end
+
+    mark_price = tick.round_to_nearest_tick(mark_price, market.min_tick)
+    if mark_price <= 0 then
+        return {res = nil, error = "zero_or_negative_mark_price_after_tick_rounding"}
+    end
+
+    local _, err = archiver.update(box.space.market, market_id, {
+        {'=', 'mark_price', mark_price},
+        {'=', 'mark_price_usage', usage},
+    })
+    if err ~= nil then
+        log.error(EngineError:new("can't update mark_price error=%s", err))
+        return {res = nil, error = err}
+    end
+
+    return {res = mark_price, error = nil}
+end
+
+-- price of the stream the conditional order is triggered by, the same one
+-- the slipstopper matches the order on. Falls back to the fair price until
+-- the stream has a value (no trades or index yet).
+function M.trigger_price(market, trigger_by)
+    checks('table|engine_market', '?string')
+
+    local price
+    if trigger_by == config.params.TRIGGER_BY.LAST then
+        price = market.last_trade_price
+    elseif trigger_by == config.params.TRIGGER_BY.INDEX then
+        price = market.index_price
+    elseif util.is_value_in(config.params.MARK_PRICE_USAGE.SLIPSTOPPER, market.mark_price_usage or {}) then
+        price = market.mark_price
+    end
+
+    if price == nil or price <= 0 then
+        return market.fair_price
+    end
+
+    return price
+end
+
+-- price the position pnl, notional and margin are valued at. The mark price
+-- when the market uses it for liquidations, so the post match checks and the
+-- liquidation service see the same margin, otherwise the fair price.
+function M.margin_price(market)
+    checks('cdata|table|engine_market')
+
+    if market.mark_price ~= nil and market.mark_price > 0 and
+        util.is_value_in(config.params.MARK_PRICE_USAGE.LIQUIDATION, market.mark_price_usage or {}) then
+        return market.mark_price
+    end
+
+    return market.fair_price
+end
+
 function M.update_roll_value(title, market_id, new_value, period_sec, max_values, is_replace)
     return rolling.update_roll_value(title, market_id, new_value, period_sec, max_values, is_replace)
 end
@@ -414,6 +722,34 @@ function M.change_status(market_id, new_status)
     return {res = true, error = nil}
 end
 
+-- Set by the pricing service circuit breaker. The status is left untouched,
+-- the flag is only read by the liquidation service and the slipstopper.
+function M.set_price_degraded(market_id, degraded)
+    checks("string", "boolean")
+
+    local market = box.space.market:get(market_id)
+    if market == nil then
+        return {res = nil, error = ERR_MARKET_NOT_FOUND}
+    end
+
+    if market.price_degraded == degraded then
+        return {res = degraded, error = nil}
+    end
+
+    local _, err = archiver.update(box.space.market, market_id, {
+        {'=' , 'price_degraded', degraded},
+    })
+    if err ~= nil then
+        log.error(EngineError:new(err))
+        return {res = nil, error = err}
+    end
+
+    log.warn("market_id=%s price_degraded changed to %s", market_id, tostring(degraded))
+    notif.notify_market(market_id)
+
+    return {res = degraded, error = nil}
+end
+
 function M.update_icon_url(market_id, new_url)
     checks("string", "string")
 
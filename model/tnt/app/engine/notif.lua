@@ -22,6 +22,7 @@ local conditional_orders = {
     config.params.ORDER_TYPE.TAKE_PROFIT_LIMIT,
     config.params.ORDER_TYPE.STOP_LIMIT,
     config.params.ORDER_TYPE.STOP_MARKET,
+    config.params.ORDER_TYPE.TRAILING_STOP,
 }
 
 local notif = {
@@ -89,6 +90,54 @@ function notif.init_spaces()
         if_not_exists = true })     
     
 
+    -- order events in the order they happened, published on orders:<market>@<profile>
+    local nf_order_events = box.schema.space.create('nf_order_events', {temporary = true, if_not_exists = true})
+    nf_order_events:format({
+        {name = 'id', type = 'unsigned'},
+        {name = 'profile_id', type = 'unsigned'},
+        {name = 'event', type = 'string'},
+        {name = 'data', type = '*'},
+    })
+    nf_order_events:create_index('primary', {
+        unique = true,
+        parts = {{field = 'id'}},
+        if_not_exists = true })
+
+    -- last sequence published on the orders: and fills: channels of a profile for the market
+    local private_sequence = box.schema.space.create('private_sequence', {if_not_exists = true})
+    private_sequence:format({
+        {name = 'profile_id', type = 'unsigned'},
+        {name = 'channel', type = 'string'},
+        {name = 'sequence', type = 'unsigned'},
+    })
+    private_sequence:create_index('primary', {
+        unique = true,
+        parts = {{field = 'profile_id'}, {field = 'channel'}},
+        if_not_exists = true })
+
+
+    local nf_liquidations = box.schema.space.create('nf_liquidations', {temporary = true, if_not_exists = true})
+    nf_liquidations:format({
+        {name = 'id', type = 'string'},
+        {name = 'market_id', type = 'string'},
+        {name = 'profile_id', type = 'unsigned'},
+        {name = 'timestamp', type = 'number'},
+        {name = 'price', type = 'decimal'},
+        {name = 'size', type = 'decimal'},
+        {name = 'side', type = 'string'},
+        {name = 'kind', type = 'string'},
+    })
+    nf_liquidations:create_index('primary', {
+        unique = true,
+        parts = {{field = 'id'}},
+        if_not_exists = true })
+
+    nf_liquidations:create_index('timestamp', {
+        unique = false,
+        parts = {{field = 'timestamp'}},
+        if_not_exists = true })
+
+
     local nf_bids = box.schema.space.create('nf_bids', {temporary = true, if_not_exists = true})
     nf_bids:format({
         {name = 'price', type = 'decimal'},
@@ -122,7 +171,9 @@ end
 function notif.clear()
     -- TEMPORARY SPACES that are used for notifications
     dml.truncate(box.space.nf_private)
+    dml.truncate(box.space.nf_order_events)
     dml.truncate(box.space.nf_trades)
+    dml.truncate(box.space.nf_liquidations)
     dml.truncate(box.space.nf_bids)
     dml.truncate(box.space.nf_asks)
     dml.truncate(box.space.nf_profiles_changed)
@@ -134,6 +185,12 @@ function notif.add_trade(market_id, trade)
     box.space.nf_trades:replace(trade)
 end
 
+function notif.add_liquidation(market_id, liquidation)
+    checks("string", "cdata")
+
+    box.space.nf_liquidations:replace(liquidation)
+end
+
 -- FOR any profiles whose order/entry/position we change, we add for updating meta
 function notif.add_profile(profile_id)
     box.space.nf_profiles_changed:replace({profile_id})
@@ -154,6 +211,46 @@ function notif.add_private(market_id, data_key, timestamp, profile_id, nf_type,
     box.space.nf_private:replace({id, timestamp, market_id, profile_id, nf_type, data:tomap({names_only=true})})
 end
 
+-- order update of the account channel and ORDER_EVENT of the orders channel
+function notif.add_order(market_id, timestamp, order, event)
+    checks("string", "number", "?", "string")
+
+    notif.add_private(market_id, tostring(order.id), timestamp, order.profile_id, "order", order)
+
+    local id = box.space.nf_order_events:len() + 1
+    box.space.nf_order_events:insert({id, order.profile_id, event, order:tomap({names_only=true})})
+end
+
+local function _private_sequence(profile_id, channel)
+    local res = box.space.private_sequence:get({profile_id, channel})
+    if res == nil then
+        return 0
+    end
+
+    return res.sequence
+end
+
+local function _next_private_sequence(profile_id, channel)
+    local res = box.space.private_sequence:update({profile_id, channel}, {{'+', 'sequence', 1}})
+    if res == nil then
+        res = box.space.private_sequence:insert({profile_id, channel, 1})
+    end
+
+    return res.sequence
+end
+
+-- the channels are per market as the engine of the market keeps the sequence,
+-- it increases by one with every update of the profile and a gap means a lost
+-- update and the channel should be resubscribed
+local function _publish_private(channel_name, profile_id, market_id, data)
+    data.market_id = market_id
+    data.sequence = _next_private_sequence(profile_id, channel_name)
+
+    local channel = channel_name .. ":" .. market_id .. "@" .. tostring(profile_id)
+    local json_update = json.encode({data=data})
+    rpc.callrw_pubsub_publish(channel, json_update, 0, 0, 0)
+end
+
 function notif.notify_market(market_id)
     local market = box.space.market:get(market_id)
     if market == nil then
@@ -163,7 +260,14 @@ function notif.notify_market(market_id)
     end
 
     local channel = "market:" .. tostring(market_id)
-    local json_update = json.encode({data=market:tomap({names_only=true})})
+    local data = market:tomap({names_only=true})
+    -- same as the /markets response
+    data.predicted_funding_rate = market.instant_funding_rate
+    if market.next_funding_time ~= nil and market.next_funding_time > 0 then
+        data.next_funding_rate_timestamp = math.floor(market.next_funding_time / 1000000)
+        data.next_funding_countdown = math.max(0, data.next_funding_rate_timestamp - time.now_sec())
+    end
+    local json_update = json.encode({data=data})
     
     rpc.callrw_pubsub_publish(channel, json_update, 0, 0, 0)
     
@@ -174,6 +278,7 @@ function notif.notify_account(market_id)
     checks('string')
 
     local id_to_data = {}
+    local id_to_fills = {}
     local conditional = {
         orders = {},
     }
@@ -198,6 +303,9 @@ function notif.notify_account(market_id)
         elseif update_type == "fill" then
             id_to_data[profile_id].fills = id_to_data[profile_id].fills or {}
             table.insert(id_to_data[profile_id].fills, item.data)
+
+            id_to_fills[item.profile_id] = id_to_fills[item.profile_id] or {}
+            table.insert(id_to_fills[item.profile_id], item.data)
         else
             log.error("notify: unknown type=%s", update_type)
         end
@@ -209,6 +317,20 @@ function notif.notify_account(market_id)
         rpc.callrw_pubsub_publish(channel, json_update, 0, 0, 0)
     end
 
+    local id_to_events = {}
+    for _, item in box.space.nf_order_events:pairs(nil, {iterator = box.index.ALL}) do
+        id_to_events[item.profile_id] = id_to_events[item.profile_id] or {}
+        table.insert(id_to_events[item.profile_id], {event = item.event, order = item.data})
+    end
+
+    for profile_id, events in pairs(id_to_events) do
+        _publish_private("orders", profile_id, market_id, {events = events})
+    end
+
+    for profile_id, fills in pairs(id_to_fills) do
+        _publish_private("fills", profile_id, market_id, {fills = fills})
+    end
+
     --TODO: move conditional part to some common part
     if #conditional.orders > 0 then
         local channel = "conditional:" .. market_id
@@ -232,6 +354,7 @@ function notif.notify_to_table(market_id, sequence)
             asks={},    
         },
         trades={},
+        liquidations={},
         market={},
     }
 
@@ -247,6 +370,10 @@ function notif.notify_to_table(market_id, sequence)
         table.insert(update.trades, trade:tomap({names_only=true}))
     end
 
+    for _, liquidation in box.space.nf_liquidations.index.timestamp:pairs(nil, {iterator="REQ"}) do
+        table.insert(update.liquidations, notif.public_liquidation(liquidation))
+    end
+
     -- Send market updates
     local market = box.space.market:get(market_id)
     if market ~= nil and market.last_update_sequence >= sequence then
@@ -284,6 +411,12 @@ function notif.notify_from_table(notifications, market_id)
             rpc.callrw_pubsub_publish(channel, json_update, 100, channel_size, 100)
         end
 
+        if nf.liquidations ~= nil and #nf.liquidations > 0 then
+            channel = "liquidations:" .. market_id
+            json_update = json.encode({data=nf.liquidations})
+            rpc.callrw_pubsub_publish(channel, json_update, 100, channel_size, 100)
+        end
+
         if nf.market ~= nil and next(nf.market) ~= nil then
             channel = "market:" .. market_id    
             json_update = json.encode({data=nf.market})
@@ -336,6 +469,8 @@ function notif.notify(market_id, sequence)
     end
     update = nil
 
+    notif.notify_liquidations(market_id)
+
     -- Send market updates
     local market = box.space.market:get(market_id)
     if market ~= nil and market.last_update_sequence >= sequence then
@@ -360,6 +495,30 @@ function notif.notify(market_id, sequence)
     notif.notify_account(market_id)
 end
 
+-- the liquidated profile is not disclosed on the public channel
+function notif.public_liquidation(liquidation)
+    local data = liquidation:tomap({names_only=true})
+    data.profile_id = nil
+    return data
+end
+
+-- liquidation fills are also published outside of the orderbook notify, the takeovers
+-- by the insurance do not go through the orderbook
+function notif.notify_liquidations(market_id)
+    checks('string')
+
+    local update = {}
+    for _, liquidation in box.space.nf_liquidations.index.timestamp:pairs(nil, {iterator="REQ"}) do
+        table.insert(update, notif.public_liquidation(liquidation))
+    end
+
+    if #update > 0 then
+        local channel = "liquidations:" .. market_id
+        local json_update = json.encode({data=update})
+        rpc.callrw_pubsub_publish(channel, json_update, 100, channel_size, 100)
+    end
+end
+
 function notif.notify_position(profile_id, position_id)
     local exist = box.space.position:get(position_id)
     if exist == nil then
@@ -405,6 +564,30 @@ function notif.notify_order(profile_id, order_id)
     return nil
 end
 
+-- initial state of orders:<market>@<profile> with the last published sequence
+function notif.get_orders_snapshot(profile_id)
+    checks('number')
+
+    local res = o.get_orders(profile_id, {config.params.ORDER_STATUS.OPEN, config.params.ORDER_STATUS.PLACED})
+    if res["error"] ~= nil then
+        return res
+    end
+
+    return {res = {orders = res.res, sequence = _private_sequence(profile_id, "orders")}, error = nil}
+end
+
+-- initial state of fills:<market>@<profile>, the last fills first
+function notif.get_fills_snapshot(profile_id, limit)
+    checks('number', 'number')
+
+    local fills = {}
+    for _, fill in box.space.fill.index.profile_id_timestamp:pairs({profile_id}, {iterator = box.index.REQ}):take_n(limit) do
+        table.insert(fills, fill:tomap({names_only=true}))
+    end
+
+    return {res = {fills = fills, sequence = _private_sequence(profile_id, "fills")}, error = nil}
+end
+
 function notif.bid(price, size)
     local res, e = box.space.nf_bids:replace{price, size}
     if e ~= nil then
@@ -463,7 +646,12 @@ function notif.send_profile_notification_with_order(profile_id, n_type, n_title,
             ZERO,
             '',
             timestamp,
-            timestamp
+            timestamp,
+            ZERO,
+            ZERO,
+            '',
+            '',
+            ''
         )
     end
 
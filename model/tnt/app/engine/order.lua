@@ -148,6 +148,19 @@ function stop_market_order.amend(amend)
     return nil
 end
 
+local trailing_stop_order = {}
+
+function trailing_stop_order.create(order)
+    checks('table|engine_order')
+    order.status = config.params.ORDER_STATUS.PLACED
+
+    return nil
+end
+
+function trailing_stop_order.amend(amend)
+    return stop_market_order.amend(amend)
+end
+
 local stop_limit_order = {}
 
 function stop_limit_order.create(order)
@@ -261,6 +274,11 @@ local O = {
         {name = 'time_in_force', type = 'string'},
         {name = 'created_at', type = 'number'},
         {name = 'updated_at', type = 'number'},
+        {name = 'callback_value', type = 'decimal'},
+        {name = 'callback_percent', type = 'decimal'},
+        {name = 'group_id', type = 'string'},
+        {name = 'group_type', type = 'string'},
+        {name = 'trigger_by', type = 'string'},
     },
     strict_type = 'engine_order',
     _metatypes = {
@@ -272,6 +290,7 @@ local O = {
         take_profit_limit = take_profit_limit_order,
         stop_limit = stop_limit_order,
         stop_market = stop_market_order,
+        trailing_stop = trailing_stop_order,
         ping_limit = ping_limit_order,
     },
 }
@@ -295,10 +314,16 @@ local function new_order(
     size_percent,
     time_in_force,
     created_at,
-    updated_at
+    updated_at,
+    callback_value,
+    callback_percent,
+    group_id,
+    group_type,
+    trigger_by
 )
     checks('string', 'number', 'string', 'string', 'string', 'decimal', 'decimal', 'decimal', 'decimal',
-     'string', 'number', 'string', 'string', 'decimal', 'decimal', 'string', 'number', 'number')
+     'string', 'number', 'string', 'string', 'decimal', 'decimal', 'string', 'number', 'number', 'decimal', 'decimal',
+     'string', 'string', 'string')
 
     return {
         order_id,
@@ -319,6 +344,11 @@ local function new_order(
         time_in_force,
         created_at,
         updated_at,
+        callback_value,
+        callback_percent,
+        group_id,
+        group_type,
+        trigger_by,
     }
 end
 
@@ -396,10 +426,16 @@ function O.create(
     trigger_price,
     size_percent,
     time_in_force,
-    is_liquidation
+    is_liquidation,
+    callback_value,
+    callback_percent,
+    group_id,
+    group_type,
+    trigger_by
 )
     checks('string', 'number', 'string', 'string', '?decimal', '?decimal', '?decimal',
-        'string', '?string', '?decimal', '?decimal', 'string', 'boolean')
+        'string', '?string', '?decimal', '?decimal', 'string', 'boolean', '?decimal', '?decimal',
+        '?string', '?string', '?string')
 
     local reason = is_liquidation and 'liquidation' or ''
     local timestamp = time.now()
@@ -413,6 +449,11 @@ function O.create(
     trigger_price = util.return_not_nil(trigger_price, ZERO)
     size_percent = util.return_not_nil(size_percent, ZERO)
     time_in_force = util.return_not_nil(time_in_force, config.params.TIME_IN_FORCE.GTC)
+    callback_value = util.return_not_nil(callback_value, ZERO)
+    callback_percent = util.return_not_nil(callback_percent, ZERO)
+    group_id = util.return_not_nil(group_id, '')
+    group_type = util.return_not_nil(group_type, '')
+    trigger_by = util.return_not_nil(trigger_by, '')
 
     local total_filled_size = initial_size - size
 
@@ -435,7 +476,12 @@ function O.create(
             size_percent,
             time_in_force,
             timestamp,
-            timestamp
+            timestamp,
+            callback_value,
+            callback_percent,
+            group_id,
+            group_type,
+            trigger_by
         )
     )
 
@@ -606,6 +652,63 @@ function O.amend(order_id, new_price, new_size, new_trigger_price, new_size_perc
     return O.bind(res), nil
 end
 
+function O.update_trigger(order_id, trigger_price)
+    checks('string', 'decimal')
+    local timestamp = time.now()
+
+    local res, err = archiver.update(box.space.order, order_id, {
+        {'=', 'trigger_price', trigger_price},
+        {'=', 'updated_at', timestamp},
+    })
+    if err ~= nil then
+        return nil, err
+    end
+    if res == nil then
+        return nil, ERR_ORDER_NOT_FOUND
+    end
+
+    return O.bind(res), nil
+end
+
+-- bracket child is kept aside until the entry gets its first fill
+function O.pending(order_id)
+    checks('string')
+    local timestamp = time.now()
+
+    local res, err = archiver.update(box.space.order, order_id, {
+        {'=', 'status', config.params.ORDER_STATUS.PENDING},
+        {'=', 'updated_at', timestamp},
+    })
+    if err ~= nil then
+        return nil, err
+    end
+    if res == nil then
+        return nil, ERR_ORDER_NOT_FOUND
+    end
+
+    return O.bind(res), nil
+end
+
+-- side of a position dependent order is known after the entry fill only
+function O.activate(order_id, side)
+    checks('string', 'string')
+    local timestamp = time.now()
+
+    local res, err = archiver.update(box.space.order, order_id, {
+        {'=', 'status', config.params.ORDER_STATUS.PLACED},
+        {'=', 'side', side},
+        {'=', 'updated_at', timestamp},
+    })
+    if err ~= nil then
+        return nil, err
+    end
+    if res == nil then
+        return nil, ERR_ORDER_NOT_FOUND
+    end
+
+    return O.bind(res), nil
+end
+
 function O.get_orders(profile_id, statuses, order_type, limit)
     checks('number', 'string|table', '?string', '?number')
     limit = limit or 40 --FIXME: why such const value?
@@ -731,6 +834,23 @@ function O.iterator_by(profile_id, order_status, order_type)
     iter_state
 end
 
+-- members of the group in one of the statuses, a group has a few orders of
+-- one profile so the profile orders are scanned instead of an extra index
+function O.get_group_orders(profile_id, group_id, statuses)
+    checks('number', 'string', 'table')
+
+    local res = {}
+    for _, order_status in ipairs(statuses) do
+        for _, order in O.iterator_by(profile_id, order_status, nil) do
+            if order.group_id == group_id then
+                table.insert(res, order)
+            end
+        end
+    end
+
+    return res
+end
+
 function O.get_all_orders2(profile_id, order_status, order_type)
     checks('?number', '?string', '?string')
 
@@ -788,7 +908,11 @@ function O.is_new_take_profit_allowed(profile_id)
     return true
 end
 
-local stop_orders_types = {config.params.ORDER_TYPE.STOP_LIMIT, config.params.ORDER_TYPE.STOP_MARKET}
+local stop_orders_types = {
+    config.params.ORDER_TYPE.STOP_LIMIT,
+    config.params.ORDER_TYPE.STOP_MARKET,
+    config.params.ORDER_TYPE.TRAILING_STOP,
+}
 function O.is_new_stop_order_allowed(profile_id)
     checks('number')
 
@@ -167,8 +167,10 @@ function periodics._do_market_periodics()
 
         --
         -- UPDATE funding rate
+        -- unless the funding service computes it from the premium samples
         --
         local tm = time.now()
+        local external_funding = m.premium_sampler_active(periodics._market_id, tm)
         local need_update_funding = false
         local funding_update_diff = tm - market.last_funding_update_time
 
@@ -186,11 +188,21 @@ function periodics._do_market_periodics()
 
         --we always update instant funding
 
-        e = m.update_funding(periodics._market_id, instant_funding_rate, instant_funding_rate, tm, need_update_funding)
-        if e ~= nil then
-            log.error("update_funding error=%s", PeriodicsError:new(e))
-            box.rollback()
-            return e
+        if external_funding == false then
+            e = m.update_funding(periodics._market_id, instant_funding_rate, instant_funding_rate, tm, need_update_funding)
+            if e ~= nil then
+                log.error("update_funding error=%s", PeriodicsError:new(e))
+                box.rollback()
+                return e
+            end
+
+            -- the rate is set in the first minutes of each hour
+            e = m.update_next_funding_time(periodics._market_id, tm - tm % FUNDING_UPDATE_DIFF + FUNDING_UPDATE_DIFF)
+            if e ~= nil then
+                log.error("update_next_funding_time error=%s", PeriodicsError:new(e))
+                box.rollback()
+                return e
+            end
         end
 
         if need_update_funding == true then
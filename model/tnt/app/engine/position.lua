@@ -2,7 +2,9 @@ local log = require('log')
 local checks = require('checks')
 
 local archiver = require('app.archiver')
+local d = require('app.data')
 local errors = require('app.lib.errors')
+local time = require('app.lib.time')
 local tuple = require('app.tuple')
 
 require("app.config.constants")
@@ -87,6 +89,20 @@ function P.init_spaces()
     position:create_index('pos_by_market_profile', {parts = {{field = 'market_id'}, {field = 'profile_id'}},
         unique = true,
         if_not_exists = true })
+
+    -- ADL queue ranking published by the liquidation engine, not archived
+    local adl_quantile = box.schema.space.create('adl_quantile', {if_not_exists = true})
+    adl_quantile:format({
+        {name = 'profile_id', type = 'unsigned'},
+        {name = 'side', type = 'string'},
+        {name = 'quantile', type = 'unsigned'},
+        {name = 'score', type = 'decimal'},
+        {name = 'last_update', type = 'number'},
+    })
+    adl_quantile:create_index('primary', {
+        unique = true,
+        parts = {{field = 'profile_id'}},
+        if_not_exists = true })
 end
 
 function P.create(market_id, trader_id, size, side, entry_price)
@@ -194,6 +210,58 @@ function P.get_winning_positions(side)
     return {res = res, error = nil}
 end
 
+-- replaces the whole ranking, entries are model.AdlQuantile encoded as
+-- arrays {profile_id, side, quantile, score}
+function P.update_adl_quantiles(entries)
+    checks('table')
+
+    local now = time.now()
+    local ranked = {}
+    local status, res = pcall(function()
+        box.begin()
+        for _, entry in ipairs(entries) do
+            local profile_id = entry[d.adl_quantile_profile_id]
+            ranked[profile_id] = true
+            box.space.adl_quantile:replace({
+                profile_id,
+                entry[d.adl_quantile_side],
+                entry[d.adl_quantile_quantile],
+                entry[d.adl_quantile_score],
+                now,
+            })
+        end
+        local stale = {}
+        for _, item in box.space.adl_quantile:pairs(nil, {iterator = box.index.ALL}) do
+            if ranked[item.profile_id] == nil then
+                table.insert(stale, item.profile_id)
+            end
+        end
+        for _, profile_id in ipairs(stale) do
+            box.space.adl_quantile:delete(profile_id)
+        end
+        box.commit()
+    end)
+    if status == false then
+        box.rollback()
+        log.error(PositionError:new(res))
+        return {res = nil, error = tostring(res)}
+    end
+
+    return {res = #entries, error = nil}
+end
+
+-- 0 if the position is not in the ADL queue
+function P.get_adl_quantile(profile_id)
+    checks('number')
+
+    local res = box.space.adl_quantile:get(profile_id)
+    if res == nil then
+        return {res = 0, error = nil}
+    end
+
+    return {res = res.quantile, error = nil}
+end
+
 function P.iterator_by_market_profile(market_id, profile_id)
     checks('string', '?number')
 
@@ -5,6 +5,7 @@ local balance = require('app.balance')
 local config = require('app.config')
 local d = require('app.data')
 local ag = require('app.engine.aggregate')
+local m = require('app.engine.market')
 local errors = require('app.lib.errors')
 local tick = require('app.lib.tick')
 
@@ -15,6 +16,44 @@ local RiskError = errors.new_class("ENGINE_RISK_ERROR")
 
 local risk = {}
 
+-- same checks as the cross account, on the isolated margin of the market
+local function _isolated_post_match(market_config, isolated, position_before, position_after,
+                                    new_balance, new_unrealized_pnl, new_notional, new_position_margin, new_order_margin)
+    local isolated_balance = isolated[d.isolated_margin] + new_balance - isolated[d.isolated_balance_base]
+    local isolated_equity = isolated_balance + new_unrealized_pnl
+    local isolated_account_margin = ONE
+
+    if new_notional ~= 0 then
+        isolated_account_margin = isolated_equity / new_notional
+    elseif isolated_equity <= 0 then
+        isolated_account_margin = ZERO
+    end
+
+    local available_margin = tick.min(isolated_equity, isolated_balance) - new_position_margin - new_order_margin
+
+    if position_before ~= nil then
+        if isolated_account_margin < market_config.forced_margin then
+            return string.format('POST_MATCH_ERROR_ISOLATED_MARGIN: isolated margin(%s) less than allowed margin(%s)', isolated_account_margin, market_config.forced_margin)
+        end
+
+        if position_after == nil or
+            (position_before.side == position_after.side and
+            position_before.size > position_after.size) then
+                return nil
+        end
+    end
+
+    if available_margin < 0 then
+        return string.format('POST_MATCH_ERROR_ISOLATED_WB: isolated available margin(%s) is negative', available_margin)
+    end
+
+    if isolated_account_margin < market_config.forced_margin then
+        return string.format('POST_MATCH_ERROR_ISOLATED_MARGIN: isolated margin(%s) less than allowed margin(%s)', isolated_account_margin, market_config.forced_margin)
+    end
+
+    return nil
+end
+
 -- AFTER create/amend order this check should be done
 -- CHECK passed only if:
 -- withdrawble_balance >= 0
@@ -48,16 +87,6 @@ function risk.post_match(market_id, profile_data, profile_id, position_before)
         return err
     end
 
-    -- WE NEED to substract previous value for this market from totals
-    local prev_meta = profile_data["meta"]
-    if prev_meta ~= nil then
-        profile_cache[d.cache_balance] = profile_cache[d.cache_balance] - prev_meta[d.meta_balance]
-        profile_cache[d.cache_cum_unrealized_pnl] = profile_cache[d.cache_cum_unrealized_pnl] - prev_meta[d.meta_cum_unrealized_pnl]
-        profile_cache[d.cache_total_notional] = profile_cache[d.cache_total_notional] - prev_meta[d.meta_total_notional]
-        profile_cache[d.cache_total_position_margin] = profile_cache[d.cache_total_position_margin] - prev_meta[d.meta_total_position_margin]
-        profile_cache[d.cache_total_order_margin] = profile_cache[d.cache_total_order_margin] - prev_meta[d.meta_total_order_margin]
-    end
-
     -- RECALC new values for:
     -- balance
     -- position_margin
@@ -69,6 +98,7 @@ function risk.post_match(market_id, profile_data, profile_id, position_before)
     local new_notional = ZERO
 
     local position_after = nil
+    local margin_price = m.margin_price(_market)
 
     for _, position in box.space.position.index.profile_id:pairs(profile_id, {iterator = 'EQ'}) do                     
         position_after = position
@@ -78,15 +108,31 @@ function risk.post_match(market_id, profile_data, profile_id, position_before)
             sign = -1
         end
 
-        new_unrealized_pnl = position.size * (_market.fair_price - position.entry_price) * sign
-        new_notional = position.size * _market.fair_price
-        new_position_margin = current_meta.initial_margin * position.size * _market.fair_price
+        new_unrealized_pnl = position.size * (margin_price - position.entry_price) * sign
+        new_notional = position.size * margin_price
+        new_position_margin = current_meta.initial_margin * position.size * margin_price
     end
 
     local total_order_notional = ag.get_order_total_notional(profile_id)
     local new_order_margin = current_meta.initial_margin * total_order_notional
 
-    
+    -- an isolated market is checked against its own margin, it's not in the cross totals
+    local isolated = profile_data["isolated"]
+    if isolated ~= nil then
+        return _isolated_post_match(market_config, isolated, position_before, position_after,
+            new_balance, new_unrealized_pnl, new_notional, new_position_margin, new_order_margin)
+    end
+
+    -- WE NEED to substract previous value for this market from totals
+    local prev_meta = profile_data["meta"]
+    if prev_meta ~= nil then
+        profile_cache[d.cache_balance] = profile_cache[d.cache_balance] - prev_meta[d.meta_balance]
+        profile_cache[d.cache_cum_unrealized_pnl] = profile_cache[d.cache_cum_unrealized_pnl] - prev_meta[d.meta_cum_unrealized_pnl]
+        profile_cache[d.cache_total_notional] = profile_cache[d.cache_total_notional] - prev_meta[d.meta_total_notional]
+        profile_cache[d.cache_total_position_margin] = profile_cache[d.cache_total_position_margin] - prev_meta[d.meta_total_position_margin]
+        profile_cache[d.cache_total_order_margin] = profile_cache[d.cache_total_order_margin] - prev_meta[d.meta_total_order_margin]
+    end
+
     -- UPDATE CACHE values with new data for this market
     profile_cache[d.cache_balance] = profile_cache[d.cache_balance] + new_balance
     profile_cache[d.cache_cum_unrealized_pnl] = profile_cache[d.cache_cum_unrealized_pnl] + new_unrealized_pnl
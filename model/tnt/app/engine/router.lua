@@ -320,7 +320,8 @@ function router.save_profile_data(profile_data_ids)
         table.insert(global_profile_data, {
             profile_id = item.profile_id,
             cache = item.cache,
-            meta = item.meta
+            meta = item.meta,
+            isolated = item.isolated
         })
     end
 end
@@ -334,7 +335,8 @@ function router.get_profile_data(profile_id)
         if item.profile_id == profile_id then
             res = {
                 cache = item.cache,
-                meta = item.meta
+                meta = item.meta,
+                isolated = item.isolated
             }
             break
         end
@@ -354,7 +356,8 @@ function router.test_add_profile_data(data)
     table.insert(global_profile_data, {
         profile_id = data.profile_id,
         cache = data.cache,
-        meta = data.meta
+        meta = data.meta,
+        isolated = data.isolated
     })
 end
 
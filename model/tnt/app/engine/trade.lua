@@ -90,7 +90,31 @@ function trade.init_spaces()
         unique = false,
         parts = {{field = 'timestamp'}},
         if_not_exists = true })  
-    
+
+    -- fills of liquidated profiles, side is the side of the liquidated profile fill
+    local liquidation, err = archiver.create('liquidation', {if_not_exists = true}, {
+        {name = 'id', type = 'string'},
+        {name = 'market_id', type = 'string'},
+        {name = 'profile_id', type = 'unsigned'},
+        {name = 'timestamp', type = 'number'},
+        {name = 'price', type = 'decimal'},
+        {name = 'size', type = 'decimal'},
+        {name = 'side', type = 'string'},
+        {name = 'kind', type = 'string'},
+    }, {
+        unique = true,
+        parts = {{field = 'id'}},
+        if_not_exists = true,
+    })
+    if err ~= nil then
+        log.error(TradeError:new(err))
+        error(err)
+    end
+
+    liquidation:create_index('timestamp', {
+        unique = false,
+        parts = {{field = 'timestamp'}},
+        if_not_exists = true })
 end
 
 function trade.next_trade_id(market_id)
@@ -108,6 +132,30 @@ function trade.get_trade_data(limit)
         return {res = res, error = nil}
 end
 
+function trade.add_liquidation(fill, kind)
+    return archiver.insert(box.space.liquidation, {
+        fill.id,
+        fill.market_id,
+        fill.profile_id,
+        fill.timestamp,
+        fill.price,
+        fill.size,
+        fill.side,
+        kind,
+    })
+end
+
+function trade.get_liquidations(limit)
+    local res = {}
+    for _, liquidation in box.space.liquidation.index.timestamp:pairs(nil, {iterator=box.index.REQ}):take_n(limit) do
+        local data = liquidation:tomap({names_only=true})
+        data.profile_id = nil
+        table.insert(res, data)
+    end
+
+    return {res = res, error = nil}
+end
+
 function trade.total_volume(profile_id, start_timestamp, end_timestamp)
     local total = decimal.new(0)
     local last_timestamp_found = start_timestamp
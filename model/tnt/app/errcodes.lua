@@ -84,3 +84,19 @@ ERR_REFERRAL_PAYOUT_NEGATIVE_FEE_WALLET = "ERR_REFERRAL_PAYOUT_NEGATIVE_FEE_WALL
 ERR_NO_CONTRACT_MAP = "ERR_NO_CONTRACT_MAP"
 ERR_DUPLICATE_STAKE_ID = "DUPLICATE_STAKE_ID"
 ERR_GET_CACHE = 'GET_CACHE_ERROR'
+ERR_BATCH_EMPTY = "BATCH_EMPTY"
+ERR_BATCH_TOO_LARGE = "BATCH_TOO_LARGE"
+ERR_BATCH_UNKNOWN_ACTION = "BATCH_UNKNOWN_ACTION"
+ERR_WRONG_TRAILING_CALLBACK = "WRONG_TRAILING_CALLBACK"
+ERR_WRONG_ORDER_GROUP = "WRONG_ORDER_GROUP"
+ERR_WRONG_TRIGGER_BY = "WRONG_TRIGGER_BY"
+ERR_SUBACCOUNT_NOT_ALLOWED = "SUBACCOUNT_NOT_ALLOWED"
+ERR_MAX_SUBACCOUNTS_EXCEED = "MAX_SUBACCOUNTS_EXCEED"
+ERR_NOT_YOUR_SUBACCOUNT = "NOT_YOUR_SUBACCOUNT"
+ERR_SUBACCOUNT_TRANSFER_SAME_PROFILE = "SUBACCOUNT_TRANSFER_SAME_PROFILE"
+ERR_PROFILE_ALREADY_EXIST = "PROFILE_ALREADY_EXIST"
+ERR_ISOLATED_NOT_ALLOWED = "ISOLATED_NOT_ALLOWED"
+ERR_MARGIN_MODE_NOT_CHANGED = "MARGIN_MODE_NOT_CHANGED"
+ERR_MARGIN_MODE_OPEN_EXPOSURE = "MARGIN_MODE_OPEN_EXPOSURE"
+ERR_NOT_ISOLATED_MARKET = "NOT_ISOLATED_MARKET"
+ERR_ISOLATED_MARGIN_EXCEED = "ISOLATED_MARGIN_EXCEED"
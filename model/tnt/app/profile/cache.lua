@@ -19,6 +19,45 @@ local ProfileError = errors.new_class("PROFILE")
 
 local cache = {}
 
+-- totals of a market in isolated margin mode, its balance is the margin plus
+-- the market balance change since the isolation began
+local function _isolated_totals(isolated, meta)
+    local totals = {
+        profile_id = isolated.profile_id,
+        market_id = isolated.market_id,
+        margin_mode = config.params.MARGIN_MODE.ISOLATED,
+        status = isolated.status,
+        margin = isolated.margin,
+        balance = isolated.margin,
+        equity = isolated.margin,
+        cum_unrealized_pnl = ZERO,
+        total_notional = ZERO,
+        total_position_margin = ZERO,
+        total_order_margin = ZERO,
+        account_margin = ONE,
+        removable_margin = ZERO,
+    }
+
+    if meta ~= nil then
+        totals.balance = isolated.margin + meta.balance - isolated.balance_base
+        totals.cum_unrealized_pnl = meta.cum_unrealized_pnl
+        totals.equity = totals.balance + meta.cum_unrealized_pnl
+        totals.total_notional = meta.total_notional
+        totals.total_position_margin = meta.total_position_margin
+        totals.total_order_margin = meta.total_order_margin
+    end
+
+    if totals.total_notional ~= 0 then
+        totals.account_margin = totals.equity / totals.total_notional
+    end
+
+    totals.removable_margin = tick.min(totals.equity, totals.balance)
+                                - totals.total_position_margin
+                                - totals.total_order_margin
+
+    return totals
+end
+
 function cache.update(profile_id)
     checks("number")
 
@@ -104,12 +143,33 @@ function cache.update(profile_id)
 
     for _, meta in box.space.profile_meta:pairs(profile_id, {iterator="EQ"}) do
         profile_totals.balance = profile_totals.balance + meta.balance
-        profile_totals.cum_unrealized_pnl = profile_totals.cum_unrealized_pnl + meta.cum_unrealized_pnl
-        profile_totals.total_notional = profile_totals.total_notional + meta.total_notional
-        profile_totals.total_position_margin = profile_totals.total_position_margin + meta.total_position_margin
-        profile_totals.total_order_margin = profile_totals.total_order_margin + meta.total_order_margin
         profile_totals.leverage[meta.market_id] = meta.market_leverage
         profile_totals.cum_trading_volume = profile_totals.cum_trading_volume + meta.cum_trading_volume
+
+        -- isolated markets don't count for the cross margin
+        if box.space.isolated_margin:get({profile_id, meta.market_id}) == nil then
+            profile_totals.cum_unrealized_pnl = profile_totals.cum_unrealized_pnl + meta.cum_unrealized_pnl
+            profile_totals.total_notional = profile_totals.total_notional + meta.total_notional
+            profile_totals.total_position_margin = profile_totals.total_position_margin + meta.total_position_margin
+            profile_totals.total_order_margin = profile_totals.total_order_margin + meta.total_order_margin
+        end
+    end
+
+    -- the isolated balances are taken out of the cross balance, an isolated
+    -- position is liquidated on its own margin
+    for _, isolated in box.space.isolated_margin:pairs(profile_id, {iterator="EQ"}) do
+        local totals = _isolated_totals(isolated, cache.get_meta(profile_id, isolated.market_id))
+        profile_totals.balance = profile_totals.balance - totals.balance
+
+        local new_isolated_status = config.params.PROFILE_STATUS.ACTIVE
+        if totals.total_notional ~= 0 and totals.account_margin < config.params.LIQUIDATION.FORCED_MARGIN then
+            new_isolated_status = config.params.PROFILE_STATUS.LIQUIDATING
+        end
+        if new_isolated_status ~= isolated.status then
+            box.space.isolated_margin:update({profile_id, isolated.market_id}, {
+                {"=", "status", new_isolated_status}
+            })
+        end
     end
 
     -- CALC aggregated value
@@ -201,6 +261,43 @@ function cache.update_all()
     end
 end
 
+function cache.get_isolated_margins(profile_id)
+    checks("number")
+
+    local res = {}
+    for _, isolated in box.space.isolated_margin:pairs(profile_id, {iterator="EQ"}) do
+        table.insert(res, _isolated_totals(isolated, cache.get_meta(profile_id, isolated.market_id)))
+    end
+
+    return {res = res, error = nil}
+end
+
+function cache.get_isolated_margin(profile_id, market_id)
+    checks("number", "string")
+
+    local isolated = box.space.isolated_margin:get({profile_id, market_id})
+    if isolated == nil then
+        return {res = nil, error = ERR_NOT_ISOLATED_MARKET}
+    end
+
+    return {res = _isolated_totals(isolated, cache.get_meta(profile_id, market_id)), error = nil}
+end
+
+function cache.isolated_liquidation_batch(limit)
+    checks("number")
+
+    local res = {}
+    local batch = box.space.isolated_margin.index.for_liquidation:select(
+        {config.params.PROFILE_STATUS.LIQUIDATING},
+        {iterator = 'EQ', limit = limit}
+    )
+    for _, isolated in ipairs(batch) do
+        table.insert(res, _isolated_totals(isolated, cache.get_meta(isolated.profile_id, isolated.market_id)))
+    end
+
+    return {res = res, error = nil}
+end
+
 function cache.ensure_cache(profile_id)
     local exist = box.space.profile_cache:get(profile_id)
 
@@ -247,7 +344,8 @@ function cache.get_cache_and_meta(profile_ids, market_id)
             table.insert(res, {
                 profile_id = pid,
                 cache = _cache,
-                meta = _meta
+                meta = _meta,
+                isolated = box.space.isolated_margin:get({pid, market_id})
             })
         else
             log.error({
@@ -61,6 +61,12 @@ function getters.get_profile_data(profile_id)
 
     res[23] = {}
 
+    res[24] = {}
+    local i_res = cache.get_isolated_margins(profile_id)
+    if i_res["error"] == nil and i_res.res ~= nil then
+        res[24] = i_res.res
+    end
+
     return {res = res, error = nil}
 end
 
@@ -95,6 +101,12 @@ function getters.get_extended_profile_data(profile_id)
 
     res[23] = {}
 
+    res[24] = {}
+    local i_res = cache.get_isolated_margins(profile_id)
+    if i_res["error"] == nil and i_res.res ~= nil then
+        res[24] = i_res.res
+    end
+
     return {res = res, error = nil}
 end
 
@@ -158,6 +170,24 @@ function getters.get_open_positions(profile_id, offset, limit)
     return {res = positions, error = nil}
 end
 
+-- ADL quantiles of the profile in all markets, as {market_id, quantile}
+-- with 0 if not in the queue, the markets which fail to answer are skipped
+function getters.get_adl_quantiles(profile_id)
+    checks('number')
+
+    local quantiles = {}
+    for _, market in pairs(config.markets) do
+        local market_id = market.id
+
+        local res = rpc.callro_engine(market_id, "get_adl_quantile", {profile_id})
+        if res["error"] == nil and res.res ~= nil then
+            table.insert(quantiles, {market_id, res.res})
+        end
+    end
+
+    return {res = quantiles, error = nil}
+end
+
 function getters.get_requested_unstakes(profile_id)
     checks('number')
 
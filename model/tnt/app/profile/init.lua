@@ -72,8 +72,9 @@ local function init_spaces(opts)
                 if_not_exists = true
             })
 
+            -- not unique, the subaccounts share the wallet of their master
             profile:create_index('exchange_id_wallet', {
-                unique = true,
+                unique = false,
                 parts = {{field = 'exchange_id'}, {field = 'wallet'}},
                 if_not_exists = true
             })
@@ -181,6 +182,48 @@ local function init_spaces(opts)
         parts = {{field = 'vault'}, {field = "wallet"}, {field = "role"}},
         if_not_exists = true })
 
+    -- the subaccounts of a master profile, the master acts on them and moves collateral between them,
+    -- index numbers the subaccounts of the master from 1
+    local subaccount = box.schema.space.create('subaccount', {if_not_exists = true})
+    subaccount:format({
+        {name = 'profile_id', type = 'unsigned'},
+        {name = 'master_id', type = 'unsigned'},
+        {name = 'index', type = 'unsigned'},
+        {name = 'created_at', type = 'number'},
+    })
+
+    subaccount:create_index('primary', {
+        unique = true,
+        parts = {{field = 'profile_id'}},
+        if_not_exists = true })
+
+    subaccount:create_index('master_id', {
+        unique = true,
+        parts = {{field = 'master_id'}, {field = 'index'}},
+        if_not_exists = true })
+
+    -- markets in isolated margin mode, margin is the collateral moved from the
+    -- cross account and balance_base the market balance when isolation began
+    local isolated_margin = box.schema.space.create('isolated_margin', {if_not_exists = true})
+    isolated_margin:format({
+        {name = 'profile_id', type = 'unsigned'},
+        {name = 'market_id', type = 'string'},
+        {name = 'margin', type = 'decimal'},
+        {name = 'balance_base', type = 'decimal'},
+        {name = 'status', type = 'string'},
+        {name = 'timestamp', type = 'number'},
+    })
+
+    isolated_margin:create_index('primary', {
+        unique = true,
+        parts = {{field = 'profile_id'}, {field = 'market_id'}},
+        if_not_exists = true })
+
+    isolated_margin:create_index('for_liquidation', {
+        unique = true,
+        parts = {{field = 'status'}, {field = 'profile_id'}, {field = 'market_id'}},
+        if_not_exists = true })
+
     p.create_insurance(DEFAULT_EXCHANGE_ID)
 end
 
@@ -24,6 +24,13 @@ function profile.create(profile_type, status, wallet, exchange_id)
 
     local l_wallet = string.lower(wallet)
     local l_exchange_id = string.lower(exchange_id)
+
+    -- the wallet index isn't unique, only the subaccounts share a wallet
+    local is_subaccount = profile_type == config.params.PROFILE_TYPE.SUBACCOUNT
+    if not is_subaccount and profile.get_by_wallet_for_exchange_id(l_wallet, l_exchange_id)["res"] ~= nil then
+        return { res = nil, error = ERR_PROFILE_ALREADY_EXIST }
+    end
+
     local res
     status, res = pcall(function() return archiver.insert(box.space.profile, {
         box.NULL,
@@ -45,6 +52,11 @@ function profile.create(profile_type, status, wallet, exchange_id)
         return { res = nil, error = "CANT_INSERT_PROFILE" }
     end
     
+    -- the deposits to the wallet belong to the master
+    if is_subaccount then
+        return { res = res, error = nil }
+    end
+
     local success, err = pcall(balance.resolve_all_unknown, res.id, l_wallet, l_exchange_id)
     if not success then
         log.error({
@@ -97,12 +109,14 @@ function profile.get_by_wallet_for_exchange_id(wallet, exchange_id)
     local l_wallet = string.lower(wallet)
     local l_exchange_id = string.lower(exchange_id)
 
-    local exist = box.space.profile.index.exchange_id_wallet:get({l_exchange_id, l_wallet})
-    if exist == nil then
-        return { res = nil, error = "PROFILE_NOT_FOUND" }
+    -- the subaccounts have the wallet of their master
+    for _, exist in box.space.profile.index.exchange_id_wallet:pairs({l_exchange_id, l_wallet}, {iterator = box.index.EQ}) do
+        if exist.profile_type ~= config.params.PROFILE_TYPE.SUBACCOUNT then
+            return { res = exist, error = nil }
+        end
     end
 
-    return { res = exist, error = nil }
+    return { res = nil, error = "PROFILE_NOT_FOUND" }
 end
 
 function profile.withdraw_credit(profile_id, amount)
@@ -312,6 +326,220 @@ function profile.add_permission(vault, wallet, required_role)
     return {res = res, error = nil}
 end
 
+-- a subaccount is a profile with the wallet of its master and its own index
+-- among the master subaccounts, it can't deposit or withdraw and gets its
+-- collateral from the master
+function profile.create_subaccount(master_id)
+    checks("number")
+
+    local master = box.space.profile:get(master_id)
+    if master == nil then
+        return { res = nil, error = "PROFILE_NOT_FOUND" }
+    end
+
+    if master.profile_type ~= config.params.PROFILE_TYPE.TRADER then
+        return { res = nil, error = ERR_SUBACCOUNT_NOT_ALLOWED }
+    end
+
+    local total = box.space.subaccount.index.master_id:count(master_id)
+    if total >= config.params.MAX_SUBACCOUNTS then
+        return { res = nil, error = ERR_MAX_SUBACCOUNTS_EXCEED }
+    end
+
+    local index = 1
+    local last = box.space.subaccount.index.master_id:max(master_id)
+    if last ~= nil then
+        index = last.index + 1
+    end
+
+    -- the profile is only created together with its link to the master
+    box.begin()
+
+    local res = profile.create(config.params.PROFILE_TYPE.SUBACCOUNT, config.params.PROFILE_STATUS.ACTIVE, master.wallet, master.exchange_id)
+    if res["error"] ~= nil then
+        box.rollback()
+        return res
+    end
+
+    local child = res["res"]
+    local status, err = pcall(function() return box.space.subaccount:insert({child.id, master_id, index, time.now()}) end)
+    if status == false then
+        box.rollback()
+        log.error({
+            message = string.format("subaccount profile_id=%d of master_id=%d not linked: %s", child.id, master_id, tostring(err)),
+            [ALERT_TAG] = ALERT_CRIT,
+        })
+        return { res = nil, error = tostring(err) }
+    end
+
+    box.commit()
+
+    return { res = child, error = nil }
+end
+
+function profile.get_subaccounts(master_id)
+    checks("number")
+
+    local res = {}
+    for _, sub in box.space.subaccount.index.master_id:pairs(master_id, {iterator = box.index.EQ}) do
+        local child = box.space.profile:get(sub.profile_id)
+        if child ~= nil then
+            table.insert(res, child)
+        end
+    end
+
+    return { res = res, error = nil }
+end
+
+local function _is_subaccount_of(profile_id, master_id)
+    local sub = box.space.subaccount:get(profile_id)
+    return sub ~= nil and sub.master_id == master_id
+end
+
+function profile.is_subaccount_of(profile_id, master_id)
+    checks("number", "number")
+
+    return { res = _is_subaccount_of(profile_id, master_id), error = nil }
+end
+
+-- moves collateral between the master and its subaccounts, the sender can
+-- give no more than its withdrawable balance
+function profile.subaccount_transfer(master_id, from_id, to_id, amount)
+    checks("number", "number", "number", "decimal")
+
+    if amount <= 0 then
+        return { res = nil, error = "WRONG_AMOUNT" }
+    end
+
+    if from_id == to_id then
+        return { res = nil, error = ERR_SUBACCOUNT_TRANSFER_SAME_PROFILE }
+    end
+
+    for _, profile_id in ipairs({from_id, to_id}) do
+        if profile_id ~= master_id and not _is_subaccount_of(profile_id, master_id) then
+            return { res = nil, error = ERR_NOT_YOUR_SUBACCOUNT }
+        end
+    end
+
+    local res = cache.get_cache(from_id)
+    if res["error"] ~= nil then
+        return { res = nil, error = res["error"] }
+    end
+
+    if res["res"][d.cache_withdrawable_balance] - amount < 0 then
+        return { res = nil, error = "NOT_ENOUGH_WB" }
+    end
+
+    return balance.subaccount_transfer(from_id, to_id, amount)
+end
+
+-- switches a market between cross and isolated margin, the market must have
+-- no position and no orders
+function profile.set_margin_mode(profile_id, market_id, margin_mode)
+    checks("number", "string", "string")
+
+    local p = box.space.profile:get(profile_id)
+    if p == nil then
+        return { res = nil, error = "PROFILE_NOT_FOUND" }
+    end
+
+    if p.profile_type ~= config.params.PROFILE_TYPE.TRADER and p.profile_type ~= config.params.PROFILE_TYPE.SUBACCOUNT then
+        return { res = nil, error = ERR_ISOLATED_NOT_ALLOWED }
+    end
+
+    if config.markets[market_id] == nil then
+        return { res = nil, error = ERR_MARKET_NOT_FOUND }
+    end
+
+    local is_isolated = margin_mode == config.params.MARGIN_MODE.ISOLATED
+    if not is_isolated and margin_mode ~= config.params.MARGIN_MODE.CROSS then
+        return { res = nil, error = "WRONG_MARGIN_MODE" }
+    end
+
+    local isolated = box.space.isolated_margin:get({profile_id, market_id})
+    if is_isolated == (isolated ~= nil) then
+        return { res = nil, error = ERR_MARGIN_MODE_NOT_CHANGED }
+    end
+
+    -- the metas must be fresh to know the market exposure
+    local res = cache.invalidate_cache(profile_id)
+    if res["error"] ~= nil then
+        return { res = nil, error = res["error"] }
+    end
+
+    local meta = cache.get_meta(profile_id, market_id)
+    if meta ~= nil and (meta.total_notional ~= 0 or meta.total_order_margin ~= 0) then
+        return { res = nil, error = ERR_MARGIN_MODE_OPEN_EXPOSURE }
+    end
+
+    if is_isolated then
+        local balance_base = ZERO
+        if meta ~= nil then
+            balance_base = meta.balance
+        end
+
+        box.space.isolated_margin:insert({
+            profile_id,
+            market_id,
+            ZERO,
+            balance_base,
+            config.params.PROFILE_STATUS.ACTIVE,
+            time.now(),
+        })
+    else
+        -- what is left of the isolated margin goes back to the cross account
+        box.space.isolated_margin:delete({profile_id, market_id})
+    end
+
+    local err = cache.update(profile_id)
+    if err ~= nil then
+        return { res = nil, error = err }
+    end
+
+    return { res = margin_mode, error = nil }
+end
+
+-- moves collateral from the cross account to an isolated market when amount
+-- is positive, back to the cross account when it's negative
+function profile.update_isolated_margin(profile_id, market_id, amount)
+    checks("number", "string", "decimal")
+
+    if amount == 0 then
+        return { res = nil, error = "WRONG_AMOUNT" }
+    end
+
+    local res = cache.get_isolated_margin(profile_id, market_id)
+    if res["error"] ~= nil then
+        return res
+    end
+    local isolated = res["res"]
+
+    if amount > 0 then
+        res = cache.get_cache(profile_id)
+        if res["error"] ~= nil then
+            return { res = nil, error = res["error"] }
+        end
+
+        if res["res"][d.cache_withdrawable_balance] - amount < 0 then
+            return { res = nil, error = "NOT_ENOUGH_WB" }
+        end
+    elseif isolated.removable_margin + amount < 0 then
+        return { res = nil, error = ERR_ISOLATED_MARGIN_EXCEED }
+    end
+
+    box.space.isolated_margin:update({profile_id, market_id}, {
+        {"+", "margin", amount},
+        {"=", "timestamp", time.now()},
+    })
+
+    local err = cache.update(profile_id)
+    if err ~= nil then
+        return { res = nil, error = err }
+    end
+
+    return cache.get_isolated_margin(profile_id, market_id)
+end
+
 function profile.wds_per_24h()
     local res = wdm.wds_per_24h()
     
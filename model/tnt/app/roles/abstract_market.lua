@@ -16,6 +16,7 @@ local trade = engine.trade
 local candles = engine.candles
 local fortest = engine.fortest
 local balance = engine.balance
+local notif = engine.notif
 
 local function stop()
     rawset(_G, 'engine', nil)
@@ -70,6 +71,7 @@ local function init(opts, market_config)
     rawset(_G, 'archiver', archiver)
     rawset(_G, 'mt', mt)
     rawset(_G, 'setters', setters)
+    rawset(_G, 'notif', notif)
 
     return true
 end
@@ -104,6 +106,7 @@ local function new(role_name, market_config)
         get_market_data = market.get_market_data,
         get_orderbook_data = matching.get_orderbook_data,
         get_positions = position.get_positions,
+        get_adl_quantile = position.get_adl_quantile,
         get_extended_position = engine.extended.get_extended_position,
         get_orders = order.get_orders,
         get_trade_data = trade.get_trade_data,
@@ -24,6 +24,20 @@ local function migrate_once()
     box.commit()
 end
 
+-- the keys created before the scopes get empty scopes and markets, full access
+local function migrate_scopes()
+    box.begin()
+    for _, api_secret in box.space.api_secret:pairs() do
+        if api_secret.markets == nil then
+            box.space.api_secret:update({api_secret.key}, {
+                {'=', 'scopes', api_secret.scopes or {}},
+                {'=', 'markets', {}}
+            })
+        end
+    end
+    box.commit()
+end
+
 local function init_space()
     archiver.init_sequencer("auth")
 
@@ -93,7 +107,9 @@ local function init_space()
         {name = 'secret', type = 'string'},
         {name = 'tag', type = 'string'},
         {name = 'expiration', type = 'unsigned'},
-        {name = 'status', type = 'string'} })
+        {name = 'status', type = 'string'},
+        {name = 'scopes', type = 'array', is_nullable = true},
+        {name = 'markets', type = 'array', is_nullable = true} })
 
     api_secret:create_index('api_secret_key', {
         unique = true,
@@ -143,6 +159,7 @@ local function init_space()
 
     --TODO: delete on the next release
     migrate_once()
+    migrate_scopes()
 end
 
 local function drop_spaces()
@@ -64,5 +64,7 @@ return {
     new_order = api.public.new_order,
     cancel_order = api.public.cancel_order,
     amend_order = api.public.amend_order,
+    batch_orders = api.public.batch_orders,
+    new_order_group = api.public.new_order_group,
     cancel_all = api.public.cancel_all
 }
\ No newline at end of file
@@ -180,6 +180,22 @@ function C.get_roll_sum(title, item_id)
     return sum
 end
 
+-- sum of the last max_values periods only, the periods before them are kept
+-- until the next update of the item
+function C.get_roll_sum_since(title, item_id, period_sec, max_values)
+    local first = math.ceil(time.now_sec() / period_sec) - max_values
+
+    local sum = ZERO
+    for _, item in box.space[SPACE_NAME]:pairs({title, item_id, first}, {iterator='GT'}) do
+        if item.title ~= title or item.item_id ~= item_id then
+            break
+        end
+        sum = sum + item.value
+    end
+
+    return sum
+end
+
 -- return diff: (premium, basis)
 function C.diff_roll_value(title, item_id)
     local count = box.space[SPACE_NAME]:count({title, item_id}, {iterator='EQ'})
@@ -159,3 +159,25 @@ g.test_auth_flow = function(cg)
 
 end
 
+
+g.test_api_secret_scopes = function(cg)
+    local secret = {"scoped", 1, "secret1", "tag1", 123, "status", {"read", "cancel_only"}, {"BTC-USD"}}
+    local res = auth.utils.api_secret_pair_create(secret, "jwt1", "refresh_token1", {})
+    t.assert_is(res["error"], "")
+
+    res = auth.utils.api_secret_by_key("scoped")
+    t.assert_equals(res["api_secret"].scopes, {"read", "cancel_only"})
+    t.assert_equals(res["api_secret"].markets, {"BTC-USD"})
+
+    -- a key created before the scopes has full access after the migration
+    box.space.api_secret:insert({"old", 1, "secret2", "tag2", 123, "status"})
+    auth.utils.init_space()
+
+    res = auth.utils.api_secret_by_key("old")
+    t.assert_equals(#res["api_secret"], 8)
+    t.assert_equals(res["api_secret"].scopes, {})
+    t.assert_equals(res["api_secret"].markets, {})
+
+    res = auth.utils.api_secret_by_key("scoped")
+    t.assert_equals(res["api_secret"].scopes, {"read", "cancel_only"})
+end
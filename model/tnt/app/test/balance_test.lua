@@ -471,6 +471,47 @@ function insert_tuple(i)
     })
 end
 
+g.test_insurance_ledger = function(cg)
+    local insurance = box.space.profile.index.profile_type:min(config.params.PROFILE_TYPE.INSURANCE)
+    t.assert_is_not(insurance, nil)
+
+    local balance_before = get_balance(insurance.id)
+    local res = balance.deposit_insurance(decimal.new(100))
+    assert_success(res)
+    t.assert_is(get_balance(insurance.id), balance_before + decimal.new(100))
+
+    local deposit = box.space.insurance_ledger.index.market_kind_timestamp:max(
+        { "", config.params.INSURANCE_LEDGER_KIND.DEPOSIT })
+    t.assert_is_not(deposit, nil)
+    t.assert_is(deposit.insurance_id, insurance.id)
+    t.assert_is(deposit.amount, decimal.new(100))
+    t.assert_is(deposit.ref_id, res.res.id)
+
+    res = balance.deposit_insurance(decimal.new(0))
+    assert_failure(res)
+
+    t.assert_is(balance.last_insurance_takeover("BTC-USD"), nil)
+    local err = balance.record_insurance(insurance.id, 7, "BTC-USD",
+        config.params.INSURANCE_LEDGER_KIND.TAKEOVER_PNL, z, "BTC-USD-1")
+    t.assert_is(err, nil)
+    err = balance.record_insurance(insurance.id, 7, "BTC-USD",
+        config.params.INSURANCE_LEDGER_KIND.CLAWBACK, decimal.new(-5), "BTC-USD-2")
+    t.assert_is(err, nil)
+    t.assert_is(balance.last_insurance_takeover("BTC-USD"), 7)
+    t.assert_is(balance.last_insurance_takeover("ETH-USD"), nil)
+
+    -- a later takeover doesn't move the fills of an order already placed
+    t.assert_is(balance.insurance_order_trigger("order-1"), nil)
+    balance.pin_insurance_order("order-1", 7)
+    err = balance.record_insurance(insurance.id, 8, "BTC-USD",
+        config.params.INSURANCE_LEDGER_KIND.TAKEOVER_PNL, z, "BTC-USD-3")
+    t.assert_is(err, nil)
+    t.assert_is(balance.insurance_order_trigger("order-1"), 7)
+
+    balance.unpin_insurance_order("order-1")
+    t.assert_is(balance.insurance_order_trigger("order-1"), nil)
+end
+
 g.test_last_processed = function(cg)
     local res = balance.set_last_processed_block_number("3", "", 0, "")
     assert_success(res)
@@ -479,6 +520,115 @@ g.test_last_processed = function(cg)
     t.assert_is(res["res"], "3")
 end
 
+g.test_reorg_rollback = function(cg)
+    local amount = decimal.new(10)
+    create_and_process_deposit(amount, 1, "0x123", "0x321", "d_1")
+    create_and_process_deposit(amount, 1, "0x123", "0x322", "d_2")
+
+    local res = balance.set_processed_block(5, "0xa5", { "d_1" }, "", 0, "deposit")
+    assert_success(res)
+    res = balance.set_processed_block(9, "0xa9", { "d_2" }, "", 0, "deposit")
+    assert_success(res)
+    res = balance.get_last_processed_block_number("", 0, "deposit")
+    t.assert_is(res["res"], "9")
+
+    res = balance.get_processed_blocks("", 0, "deposit", 10)
+    assert_success(res)
+    t.assert_equals(#res["res"], 2)
+    t.assert_is(res["res"][1].block_number, 9)
+    t.assert_is(res["res"][1].block_hash, "0xa9")
+
+    -- d_2 vanished with the blocks after 5
+    res = balance.rollback_processed_blocks(5, { "d_2", "d_404" }, "", 0, "deposit")
+    assert_success(res)
+    t.assert_equals(#res["res"], 1)
+    t.assert_is(res["res"][1].ops_id2, "d_2")
+    t.assert_is(get_balance(1), amount)
+    t.assert_is(box.space.balance_operations.index.ops_id2:get("d_2").status, config.params.BALANCE_STATUS.REORGED)
+    t.assert_is(box.space.balance_operations.index.ops_id2:get("d_1").status, config.params.BALANCE_STATUS.SUCCESS)
+    res = balance.get_last_processed_block_number("", 0, "deposit")
+    t.assert_is(res["res"], "5")
+    res = balance.get_processed_blocks("", 0, "deposit", 10)
+    t.assert_equals(#res["res"], 1)
+
+    -- back in the canonical chain
+    res = balance.process_deposit(1, "0x123", "d_2", amount, "0x322", false, DEFAULT_EXCHANGE_ID, 0, "")
+    assert_success(res)
+    t.assert_is(get_balance(1), amount + amount)
+    t.assert_is(box.space.balance_operations.index.ops_id2:get("d_2").status, config.params.BALANCE_STATUS.SUCCESS)
+    res = balance.process_deposit(1, "0x123", "d_2", amount, "0x322", false, DEFAULT_EXCHANGE_ID, 0, "")
+    assert_failure(res)
+end
+
+g.test_withdrawal_review = function(cg)
+    local amount = decimal.new(10)
+    local res = profile.profile.create("trader", "active", "0x123", DEFAULT_EXCHANGE_ID)
+    assert_success(res)
+    local profile_id = res["res"].id
+    create_and_process_deposit(amount * 3, profile_id, "0x123", "0x321", "d_1")
+
+    res = balance.get_withdrawal_usage(DEFAULT_EXCHANGE_ID, 0, profile_id)
+    assert_success(res)
+    local chain_volume = res["res"].chain_volume
+    t.assert_is(res["res"].profile_volume, z)
+    t.assert_is_not(res["res"].profile_created_at, 0)
+
+    -- checked withdrawal is rolled and scheduled as usual
+    local admitted = create_withdrawal(profile_id, "0x123", amount)
+    res = balance.admit_withdrawal(admitted.id)
+    assert_success(res)
+    t.assert_is(res["res"].reason, "checked")
+    res = balance.admit_withdrawal(admitted.id)
+    assert_failure(res)
+    res = balance.get_withdrawal_usage(DEFAULT_EXCHANGE_ID, 0, profile_id)
+    t.assert_is(res["res"].chain_volume, chain_volume + amount)
+    t.assert_is(res["res"].profile_volume, amount)
+
+    -- held withdrawals are not scheduled and block new ones
+    local held = create_withdrawal(profile_id, "0x123", amount)
+    res = balance.hold_withdrawal(held.id, "wallet_daily_cap")
+    assert_success(res)
+    balance.update_pending_withdrawals(1, 10, "")
+    held = box.space.balance_operations:get(held.id)
+    t.assert_is(held.status, config.params.BALANCE_STATUS.REVIEW)
+    t.assert_is(held.reason, "wallet_daily_cap")
+    t.assert_is(held.due_block, BLOCK_NUM_NEVER)
+    t.assert_is(box.space.balance_operations:get(admitted.id).due_block, 10)
+    res = balance.get_review_withdrawals()
+    t.assert_equals(#res["res"], 1)
+    res = balance.cancel_withdrawal(profile_id, admitted.id)
+    assert_success(res)
+    assert_failure(balance.check_withdraw_allowed(profile_id))
+
+    -- approved withdrawal is pending again and scheduled with the next update
+    res = balance.review_withdrawal(held.id, true)
+    assert_success(res)
+    held = box.space.balance_operations:get(held.id)
+    t.assert_is(held.status, config.params.BALANCE_STATUS.PENDING)
+    t.assert_is(held.reason, "approved")
+    t.assert_is(held.due_block, 0)
+    res = balance.review_withdrawal(held.id, true)
+    assert_failure(res)
+    balance.update_pending_withdrawals(10, 20, "")
+    t.assert_is(box.space.balance_operations:get(held.id).due_block, 20)
+    res = balance.get_withdrawal_usage(DEFAULT_EXCHANGE_ID, 0, profile_id)
+    t.assert_is(res["res"].profile_volume, amount + amount)
+
+    -- rejected withdrawal is canceled and refunded
+    local rejected = create_withdrawal(profile_id, "0x123", amount)
+    res = balance.hold_withdrawal(rejected.id, "approval_threshold")
+    assert_success(res)
+    local balance_before = get_balance(profile_id)
+    res = balance.review_withdrawal(rejected.id, false)
+    assert_success(res)
+    rejected = box.space.balance_operations:get(rejected.id)
+    t.assert_is(rejected.status, config.params.BALANCE_STATUS.CANCELED)
+    t.assert_is(rejected.reason, "rejected")
+    t.assert_is(get_balance(profile_id), balance_before + amount)
+    res = balance.get_withdrawal_usage(DEFAULT_EXCHANGE_ID, 0, profile_id)
+    t.assert_is(res["res"].profile_volume, amount + amount)
+end
+
 function get_balance(profile_id)
     local b_sum = box.space.balance_sum:get(profile_id)
     if b_sum == nil then
@@ -1,5 +1,6 @@
 local decimal = require('decimal')
 local fio = require('fio')
+local json = require('json')
 local t = require('luatest')
 
 local a = require('app.archiver')
@@ -172,25 +173,36 @@ g.test_notify = function(cg)
             '{"data":{"fills":[{"trade_id":"tr-1000","price":"1","size":"1","id":"tr-1002","market_id":"BTC-USD","client_order_id":"coid_2","profile_id":300,"timestamp":1681343466169600,"order_id":"order-101","side":"short","is_maker":false,"liquidation":false,"fee":"0","archive_id":5,"shard_id":"shard"}],"id":300}}',
         },
     }
-    t.assert_equals(#mock_rpc.call, #expected)
+    -- the fills also go to the private fills channels
+    t.assert_equals(#mock_rpc.call, #expected + 2)
     for i = 1, #expected do
         t.assert_equals(mock_rpc.call[i], expected[i])
     end
+
+    local fills = {}
+    for i = #expected + 1, #mock_rpc.call do
+        fills[mock_rpc.call[i][1]] = json.decode(mock_rpc.call[i][2]).data
+    end
+    t.assert_equals(fills['fills:BTC-USD@200'].market_id, market_id)
+    t.assert_equals(fills['fills:BTC-USD@200'].sequence, 1)
+    t.assert_equals(fills['fills:BTC-USD@200'].fills[1].id, maker_fill_id)
+    t.assert_equals(fills['fills:BTC-USD@300'].sequence, 1)
+    t.assert_equals(fills['fills:BTC-USD@300'].fills[1].id, taker_fill_id)
 end
 
 g.test_notify_with_order = function(cg)
     local expected = {
         {
             'account@123456',
-            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0","order_type":"","trigger_price":"0","profile_id":123456,"timestamp":1681343466169600,"total_filled_size":"0","price":"0","size":"0","status":"rejected","market_id":"BTC-USD","client_order_id":"","reason":"ORDER_NOT_FOUND","time_in_force":"","created_at":1681343466169600,"id":"ID-1","side":"","size_percent":"0"}],"profile_notifications":[{"type":"type","title":"title","description":"description"}],"id":123456}}',
+            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0","order_type":"","trigger_price":"0","profile_id":123456,"timestamp":1681343466169600,"total_filled_size":"0","price":"0","size":"0","status":"rejected","market_id":"BTC-USD","client_order_id":"","reason":"ORDER_NOT_FOUND","time_in_force":"","created_at":1681343466169600,"id":"ID-1","side":"","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":""}],"profile_notifications":[{"type":"type","title":"title","description":"description"}],"id":123456}}',
         },
         {
             'account@123456',
-            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"1","order_type":"limit","trigger_price":"0","profile_id":123456,"timestamp":1681343466169600,"total_filled_size":"0","price":"1","size":"1","status":"open","market_id":"BTC-USD","client_order_id":"","reason":"","time_in_force":"gtc","created_at":1681343466169600,"id":"BTC-100","side":"long","size_percent":"0"}],"profile_notifications":[{"type":"type","title":"title","description":"description"}],"id":123456}}',
+            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"1","order_type":"limit","trigger_price":"0","profile_id":123456,"timestamp":1681343466169600,"total_filled_size":"0","price":"1","size":"1","status":"open","market_id":"BTC-USD","client_order_id":"","reason":"","time_in_force":"gtc","created_at":1681343466169600,"id":"BTC-100","side":"long","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":""}],"profile_notifications":[{"type":"type","title":"title","description":"description"}],"id":123456}}',
         },
         {
             'account@123456',
-            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"1","order_type":"limit","trigger_price":"0","profile_id":123456,"timestamp":1681343466169600,"total_filled_size":"0","price":"1","size":"1","status":"open","market_id":"BTC-USD","client_order_id":"CUSTOM-100","reason":"","time_in_force":"gtc","created_at":1681343466169600,"id":"","side":"long","size_percent":"0"}],"profile_notifications":[{"type":"type","title":"title","description":"description"}],"id":123456}}',
+            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"1","order_type":"limit","trigger_price":"0","profile_id":123456,"timestamp":1681343466169600,"total_filled_size":"0","price":"1","size":"1","status":"open","market_id":"BTC-USD","client_order_id":"CUSTOM-100","reason":"","time_in_force":"gtc","created_at":1681343466169600,"id":"","side":"long","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":""}],"profile_notifications":[{"type":"type","title":"title","description":"description"}],"id":123456}}',
         },
     }
 
@@ -239,7 +251,152 @@ g.test_notify_with_order = function(cg)
 
     t.assert_equals(#mock_rpc.call, #expected)
     for i = 1, #expected do
-        t.assert_equals(mock_rpc.call[i], expected[i])
+        -- compare decoded, order keys follow the lua table order
+        t.assert_equals(mock_rpc.call[i][1], expected[i][1])
+        t.assert_equals(json.decode(mock_rpc.call[i][2]), json.decode(expected[i][2]))
     end
 
 end
+
+g.test_notify_liquidations = function(cg)
+    local market_id = 'BTC-USD'
+    local tm = mock_time.now()
+
+    local fill, err = a.insert(box.space.fill, {
+        'tr-2001',
+        300,
+        market_id,
+        'order-201',
+        tm,
+
+        'tr-2000',
+
+        decimal.new(100),
+        decimal.new(2),
+        'short',
+
+        false,
+        ZERO,
+        true,
+        ""
+    })
+    t.assert_is(err, nil)
+
+    local liquidation
+    liquidation, err = trade.add_liquidation(fill, 'takeover')
+    t.assert_is(err, nil)
+    notif.add_liquidation(market_id, liquidation)
+
+    notif.notify_liquidations(market_id)
+
+    t.assert_equals(#mock_rpc.call, 1)
+    t.assert_equals(mock_rpc.call[1][1], 'liquidations:BTC-USD')
+    -- the liquidated profile stays private
+    t.assert_equals(json.decode(mock_rpc.call[1][2]), {
+        data = {
+            {id = 'tr-2001', market_id = market_id, timestamp = tm, price = '100', size = '2', side = 'short', kind = 'takeover'},
+        },
+    })
+
+    local res = trade.get_liquidations(10)
+    t.assert_is(res.error, nil)
+    t.assert_equals(res.res[1].id, 'tr-2001')
+    t.assert_is(res.res[1].profile_id, nil)
+end
+
+g.test_notify_order_events = function(cg)
+    local market_id = 'BTC-USD'
+    local tm = mock_time.now()
+    local profile_id = 400
+
+    local order, err = o.create(
+        'BTC-400',
+        profile_id,
+        market_id,
+        'limit',
+        ONE,
+        ONE,
+        ONE,
+        'long',
+        '',
+        ZERO,
+        ZERO,
+        'gtc',
+        false
+    )
+    t.assert_is(err, nil)
+    notif.add_order(market_id, tm, order, 'create')
+
+    order, err = o.open(order.id, ONE, ONE)
+    t.assert_is(err, nil)
+    notif.add_order(market_id, tm, order, 'open')
+
+    notif.notify_account(market_id)
+
+    -- the account gets the last state, the orders channel every event
+    t.assert_equals(#mock_rpc.call, 2)
+    t.assert_equals(mock_rpc.call[1][1], 'account@400')
+    t.assert_equals(#json.decode(mock_rpc.call[1][2]).data.orders, 1)
+
+    t.assert_equals(mock_rpc.call[2][1], 'orders:BTC-USD@400')
+    local update = json.decode(mock_rpc.call[2][2]).data
+    t.assert_equals(update.market_id, market_id)
+    t.assert_equals(update.sequence, 1)
+    t.assert_equals(#update.events, 2)
+    t.assert_equals(update.events[1].event, 'create')
+    t.assert_equals(update.events[2].event, 'open')
+    t.assert_equals(update.events[2].order.status, 'open')
+
+    notif.clear()
+    order, err = o.cancel(order.id)
+    t.assert_is(err, nil)
+    notif.add_order(market_id, tm, order, 'cancel')
+    notif.notify_account(market_id)
+
+    update = json.decode(mock_rpc.call[4][2]).data
+    t.assert_equals(update.sequence, 2)
+    t.assert_equals(update.events[1].event, 'cancel')
+
+    local snapshot = notif.get_orders_snapshot(profile_id)
+    t.assert_is(snapshot.error, nil)
+    t.assert_equals(snapshot.res.sequence, 2)
+    t.assert_equals(#snapshot.res.orders, 0)
+
+    snapshot = notif.get_fills_snapshot(profile_id, 10)
+    t.assert_is(snapshot.error, nil)
+    t.assert_equals(snapshot.res.sequence, 0)
+    t.assert_equals(#snapshot.res.fills, 0)
+end
+
+g.test_set_price_degraded = function(cg)
+    local market_id = 'BTC-USD'
+
+    local res = market.set_price_degraded(market_id, true)
+    t.assert_is(res.error, nil)
+    t.assert_equals(res.res, true)
+
+    -- the status is kept so orders and clawbacks still see an active market
+    local m = box.space.market:get(market_id)
+    t.assert_equals(m.status, 'active')
+    t.assert_equals(m.price_degraded, true)
+
+    t.assert_equals(#mock_rpc.call, 1)
+    t.assert_equals(mock_rpc.call[1][1], 'market:BTC-USD')
+    local data = json.decode(mock_rpc.call[1][2]).data
+    t.assert_equals(data.status, 'active')
+    t.assert_equals(data.price_degraded, true)
+
+    -- same value is a no-op
+    res = market.set_price_degraded(market_id, true)
+    t.assert_is(res.error, nil)
+    t.assert_equals(#mock_rpc.call, 1)
+
+    res = market.set_price_degraded(market_id, false)
+    t.assert_is(res.error, nil)
+    t.assert_equals(res.res, false)
+
+    m = box.space.market:get(market_id)
+    t.assert_equals(m.status, 'active')
+    t.assert_equals(m.price_degraded, false)
+    t.assert_equals(#mock_rpc.call, 2)
+end
@@ -0,0 +1,193 @@
+-- Shared setup of the engine space migration tests. A test gives the space
+-- format before the migration with one row, the fields the migration adds and
+-- the values the row has after it, the helper checks the added fields come
+-- before the archiver ones and a second run is a no-op.
+local decimal = require('decimal')
+local fio = require('fio')
+local t = require('luatest')
+local archiver = require('app.archiver')
+
+require('app.config.constants')
+require('app.lib.table')
+
+local M = {
+    z = decimal.new(0),
+    num = decimal.new(111),
+}
+
+local z, num = M.z, M.num
+
+-- market format and row before the mark price
+function M.market_format(extra)
+    local format = {
+        {name = 'id', type = 'string'},
+        {name = 'status', type = 'string'},
+
+        {name = 'min_initial_margin', type = 'decimal'},
+        {name = 'forced_margin', type = 'decimal'},
+        {name = 'liquidation_margin', type = 'decimal'},
+        {name = 'min_tick', type = 'decimal'},
+        {name = 'min_order', type = 'decimal'},
+
+        {name = 'best_bid', type = 'decimal'},
+        {name = 'best_ask', type = 'decimal'},
+        {name = 'market_price', type = 'decimal'},
+        {name = 'index_price', type = 'decimal'},
+        {name = 'last_trade_price', type = 'decimal'},
+        {name = 'fair_price', type = 'decimal'},
+        {name = 'instant_funding_rate', type = 'decimal'},
+        {name = 'last_funding_rate_basis', type = 'decimal'},
+
+        {name = 'last_update_time', type = 'number'},
+        {name = 'last_update_sequence', type = 'number'},
+        {name = 'average_daily_volume_q', type = 'decimal'},
+        {name = 'last_funding_update_time', type = 'number'},
+
+        {name = 'icon_url', type = 'string'},
+        {name = 'market_title', type = 'string'},
+    }
+
+    table.extend(format, extra)
+    return format
+end
+
+function M.market_row(extra)
+    local row = {
+        "BTC-USD",
+        "active",
+
+        num, num, num, num, num,
+
+        z,z,z,z,z,num,z,z,
+
+        0, 0, z, 0,
+
+        "icon", "Bitcoin",
+    }
+
+    table.extend(row, extra)
+    return row
+end
+
+-- order format and row before the trailing stop callback
+function M.order_format(extra)
+    local format = {
+        {name = 'id', type = 'string'},
+        {name = 'profile_id', type = 'unsigned'},
+        {name = 'market_id', type = 'string'},
+        {name = 'order_type', type = 'string'},
+        {name = 'status', type = 'string'},
+        {name = 'price', type = 'decimal'},
+        {name = 'size', type = 'decimal'},
+        {name = 'initial_size', type = 'decimal'},
+        {name = 'total_filled_size', type = 'decimal'},
+        {name = 'side', type = 'string'},
+        {name = 'timestamp', type = 'number'},
+        {name = 'reason', type = 'string'},
+        {name = 'client_order_id', type = 'string'},
+        {name = 'trigger_price', type = 'decimal'},
+        {name = 'size_percent', type = 'decimal'},
+        {name = 'time_in_force', type = 'string'},
+        {name = 'created_at', type = 'number'},
+        {name = 'updated_at', type = 'number'},
+    }
+
+    table.extend(format, extra)
+    return format
+end
+
+function M.order_row(extra)
+    local row = {
+        "BTC-USD@1",
+        7,
+        "BTC-USD",
+        "stop_market",
+        "placed",
+
+        z, num, z, z,
+
+        "long",
+        0,
+        "",
+        "",
+
+        num, z,
+        "good_till_cancel",
+        0, 0,
+    }
+
+    table.extend(row, extra)
+    return row
+end
+
+-- opts are
+--   name      group name, also the test name
+--   migration the migration module
+--   space     space name
+--   key       primary key of the row
+--   format    space format before the migration, without the archiver fields
+--   row       the row inserted before the migration
+--   added     the fields the migration appends to the format
+--   values    field values of the row after the migration
+function M.test_migration(opts)
+    local work_dir = fio.tempdir()
+    t.before_suite(function()
+        box.cfg{
+            listen = 4301,
+            work_dir = work_dir,
+        }
+    end)
+
+    t.after_suite(function()
+        fio.rmtree(work_dir)
+    end)
+
+    local g = t.group(opts.name)
+    g.before_each(function(cg)
+        archiver.init_sequencer("BTC-USD")
+
+        local _, err = archiver.create(opts.space, {if_not_exists = true}, opts.format, {
+            unique = true,
+            parts = {{field = 'id'}},
+            if_not_exists = true,
+        })
+        t.assert_is(err, nil)
+
+        _, err = archiver.insert(box.space[opts.space], table.copy(opts.row))
+        t.assert_is(err, nil)
+    end)
+
+    g.after_each(function(cg)
+        box.space[opts.space]:drop()
+    end)
+
+    g['test_' .. opts.name] = function(cg)
+        opts.migration.up()
+
+        local sp = box.space[opts.space]
+        t.assert_is_not(sp, nil)
+
+        local fmt = sp:format()
+        local fieldno = #opts.format
+        for _, field in ipairs(opts.added) do
+            fieldno = fieldno + 1
+            t.assert_equals(fmt[fieldno].name, field.name)
+            t.assert_equals(fmt[fieldno].type, field.type)
+        end
+        t.assert_equals(fmt[fieldno + 1].name, 'shard_id')
+        t.assert_equals(fmt[fieldno + 2].name, 'archive_id')
+
+        local val = sp:get(opts.key)
+        for name, value in pairs(opts.values) do
+            t.assert_equals(val[name], value, name)
+        end
+
+        -- second run is a no-op
+        opts.migration.up()
+        t.assert_equals(#box.space[opts.space]:format(), fieldno + 2)
+    end
+
+    return g
+end
+
+return M
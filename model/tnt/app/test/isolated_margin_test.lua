@@ -0,0 +1,154 @@
+local decimal = require('decimal')
+local fio = require('fio')
+local t = require('luatest')
+local archiver = require('app.archiver')
+local balance = require('app.balance')
+local profile = require('app.profile')
+local config = require('app.config')
+local time = require('app.lib.time')
+
+require('app.config.constants')
+require('app.errcodes')
+
+local g = t.group('isolated_margin')
+local work_dir = fio.tempdir()
+
+t.before_suite(function()
+    box.cfg{
+        work_dir = work_dir,
+    }
+end)
+
+t.after_suite(function()
+    fio.rmtree(work_dir)
+end)
+
+g.before_each(function(cg)
+    archiver.init_sequencer('profile')
+    profile.init_spaces({})
+    balance.init_spaces(0)
+end)
+
+g.after_each(function(cg)
+    balance.test_clear_spaces()
+    box.space.profile:drop()
+    box.space.profile_cache:truncate()
+    box.space.profile_meta:truncate()
+    box.space.isolated_margin:drop()
+end)
+
+local function put_meta(profile_id, market_id, meta_balance, upnl, notional, position_margin)
+    box.space.profile_meta:replace({
+        profile_id,
+        market_id,
+        config.params.PROFILE_STATUS.ACTIVE,
+        upnl,
+        notional,
+        position_margin,
+        decimal.new(0),
+        decimal.new("0.01"),
+        decimal.new(100),
+        meta_balance,
+        decimal.new(0),
+        time.now(),
+    })
+end
+
+g.test_isolated_accounting = function(cg)
+    local p = profile.profile
+    local cache = profile.cache
+
+    local trader = p.create(config.params.PROFILE_TYPE.TRADER, "active", "0xTRADER", DEFAULT_EXCHANGE_ID)["res"]
+    balance.deposit_credit(trader.id, decimal.new(100))
+
+    put_meta(trader.id, "BTC-USD", decimal.new(-5), decimal.new(10), decimal.new(1000), decimal.new(10))
+    put_meta(trader.id, "ETH-USD", decimal.new(0), decimal.new(-2), decimal.new(200), decimal.new(20))
+
+    box.space.isolated_margin:insert({
+        trader.id, "BTC-USD", decimal.new(40), decimal.new(0), config.params.PROFILE_STATUS.ACTIVE, time.now(),
+    })
+    t.assert_is(cache.update(trader.id), nil)
+
+    -- the isolated market keeps its margin and pnl, the rest is cross
+    local isolated = cache.get_isolated_margin(trader.id, "BTC-USD")["res"]
+    t.assert_equals(isolated.margin_mode, config.params.MARGIN_MODE.ISOLATED)
+    t.assert_equals(isolated.balance, decimal.new(35))
+    t.assert_equals(isolated.equity, decimal.new(45))
+    t.assert_equals(isolated.account_margin, decimal.new("0.045"))
+    t.assert_equals(isolated.removable_margin, decimal.new(25))
+
+    local c = box.space.profile_cache:get(trader.id)
+    t.assert_equals(c.balance, decimal.new(60))
+    t.assert_equals(c.account_equity, decimal.new(58))
+    t.assert_equals(c.total_notional, decimal.new(200))
+    t.assert_equals(c.account_margin, decimal.new("0.29"))
+    t.assert_equals(c.withdrawable_balance, decimal.new(38))
+
+    t.assert_equals(#cache.get_isolated_margins(trader.id)["res"], 1)
+    t.assert_equals(cache.get_isolated_margin(trader.id, "ETH-USD")["error"], ERR_NOT_ISOLATED_MARKET)
+
+    -- the isolated position goes to liquidation alone
+    put_meta(trader.id, "BTC-USD", decimal.new(-5), decimal.new(-20), decimal.new(1000), decimal.new(10))
+    cache.update(trader.id)
+
+    t.assert_equals(box.space.isolated_margin:get({trader.id, "BTC-USD"}).status, config.params.PROFILE_STATUS.LIQUIDATING)
+    t.assert_equals(box.space.profile_cache:get(trader.id).status, config.params.PROFILE_STATUS.ACTIVE)
+
+    local batch = cache.isolated_liquidation_batch(10)["res"]
+    t.assert_equals(#batch, 1)
+    t.assert_equals(batch[1].profile_id, trader.id)
+    t.assert_equals(batch[1].market_id, "BTC-USD")
+    t.assert_equals(batch[1].account_margin, decimal.new("0.015"))
+
+    put_meta(trader.id, "BTC-USD", decimal.new(-5), decimal.new(10), decimal.new(1000), decimal.new(10))
+    cache.update(trader.id)
+    t.assert_equals(#cache.isolated_liquidation_batch(10)["res"], 0)
+end
+
+g.test_update_isolated_margin = function(cg)
+    local p = profile.profile
+
+    local trader = p.create(config.params.PROFILE_TYPE.TRADER, "active", "0xTRADER", DEFAULT_EXCHANGE_ID)["res"]
+    balance.deposit_credit(trader.id, decimal.new(100))
+
+    put_meta(trader.id, "BTC-USD", decimal.new(-5), decimal.new(10), decimal.new(1000), decimal.new(10))
+    put_meta(trader.id, "ETH-USD", decimal.new(0), decimal.new(-2), decimal.new(200), decimal.new(20))
+    box.space.isolated_margin:insert({
+        trader.id, "BTC-USD", decimal.new(40), decimal.new(0), config.params.PROFILE_STATUS.ACTIVE, time.now(),
+    })
+
+    t.assert_equals(p.update_isolated_margin(trader.id, "ETH-USD", decimal.new(1))["error"], ERR_NOT_ISOLATED_MARKET)
+    t.assert_equals(p.update_isolated_margin(trader.id, "BTC-USD", decimal.new(0))["error"], "WRONG_AMOUNT")
+
+    -- added from the cross withdrawable balance
+    t.assert_equals(p.update_isolated_margin(trader.id, "BTC-USD", decimal.new(39))["error"], "NOT_ENOUGH_WB")
+
+    local res = p.update_isolated_margin(trader.id, "BTC-USD", decimal.new(20))
+    t.assert_is(res["error"], nil)
+    t.assert_equals(res["res"].margin, decimal.new(60))
+    t.assert_equals(res["res"].removable_margin, decimal.new(45))
+    t.assert_equals(box.space.profile_cache:get(trader.id).withdrawable_balance, decimal.new(18))
+
+    -- removed down to the position margin
+    res = p.update_isolated_margin(trader.id, "BTC-USD", decimal.new(-45))
+    t.assert_is(res["error"], nil)
+    t.assert_equals(res["res"].margin, decimal.new(15))
+    t.assert_equals(box.space.profile_cache:get(trader.id).withdrawable_balance, decimal.new(63))
+
+    res = p.update_isolated_margin(trader.id, "BTC-USD", decimal.new(-1))
+    t.assert_equals(res["error"], ERR_ISOLATED_MARGIN_EXCEED)
+end
+
+g.test_set_margin_mode_errors = function(cg)
+    local p = profile.profile
+
+    local trader = p.create(config.params.PROFILE_TYPE.TRADER, "active", "0xTRADER", DEFAULT_EXCHANGE_ID)["res"]
+    local vault = p.create(config.params.PROFILE_TYPE.VAULT, "active", "0xVAULT", DEFAULT_EXCHANGE_ID)["res"]
+    local isolated = config.params.MARGIN_MODE.ISOLATED
+
+    t.assert_equals(p.set_margin_mode(1000, "BTC-USD", isolated)["error"], "PROFILE_NOT_FOUND")
+    t.assert_equals(p.set_margin_mode(vault.id, "BTC-USD", isolated)["error"], ERR_ISOLATED_NOT_ALLOWED)
+    t.assert_equals(p.set_margin_mode(trader.id, "XXX-USD", isolated)["error"], ERR_MARKET_NOT_FOUND)
+    t.assert_equals(p.set_margin_mode(trader.id, "BTC-USD", "portfolio")["error"], "WRONG_MARGIN_MODE")
+    t.assert_equals(p.set_margin_mode(trader.id, "BTC-USD", config.params.MARGIN_MODE.CROSS)["error"], ERR_MARGIN_MODE_NOT_CHANGED)
+end
@@ -0,0 +1,24 @@
+local helper = require('app.test.helper.migration')
+local migration = require('migrations.engine.20240601000000_engine_market_mark_price')
+
+local z, num = helper.z, helper.num
+
+helper.test_migration({
+    name = 'market_mark_price_migration',
+    migration = migration,
+    space = 'market',
+    key = 'BTC-USD',
+    -- market format before the mark price
+    format = helper.market_format(),
+    row = helper.market_row(),
+    added = {
+        {name = 'mark_price', type = 'decimal'},
+        {name = 'mark_price_usage', type = 'array'},
+    },
+    values = {
+        fair_price = num,
+        market_title = "Bitcoin",
+        mark_price = z,
+        mark_price_usage = {},
+    },
+})
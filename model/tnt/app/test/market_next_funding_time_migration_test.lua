@@ -0,0 +1,26 @@
+local helper = require('app.test.helper.migration')
+local migration = require('migrations.engine.20240630000000_engine_market_next_funding_time')
+
+local num = helper.num
+
+helper.test_migration({
+    name = 'market_next_funding_time_migration',
+    migration = migration,
+    space = 'market',
+    key = 'BTC-USD',
+    -- market format before the next funding time
+    format = helper.market_format({
+        {name = 'mark_price', type = 'decimal'},
+        {name = 'mark_price_usage', type = 'array'},
+    }),
+    row = helper.market_row({num, {"funding"}}),
+    added = {
+        {name = 'next_funding_time', type = 'number'},
+    },
+    values = {
+        fair_price = num,
+        mark_price = num,
+        mark_price_usage = {"funding"},
+        next_funding_time = 0,
+    },
+})
@@ -0,0 +1,27 @@
+local helper = require('app.test.helper.migration')
+local migration = require('migrations.engine.20240706000000_engine_market_price_degraded')
+
+local num = helper.num
+
+helper.test_migration({
+    name = 'market_price_degraded_migration',
+    migration = migration,
+    space = 'market',
+    key = 'BTC-USD',
+    -- market format before the price degraded flag
+    format = helper.market_format({
+        {name = 'mark_price', type = 'decimal'},
+        {name = 'mark_price_usage', type = 'array'},
+        {name = 'next_funding_time', type = 'number'},
+    }),
+    row = helper.market_row({num, {"funding"}, 123}),
+    added = {
+        {name = 'price_degraded', type = 'boolean'},
+    },
+    values = {
+        status = "active",
+        mark_price = num,
+        next_funding_time = 123,
+        price_degraded = false,
+    },
+})
@@ -0,0 +1,24 @@
+local helper = require('app.test.helper.migration')
+local migration = require('migrations.engine.20240615000000_engine_order_callback')
+
+local z, num = helper.z, helper.num
+
+helper.test_migration({
+    name = 'order_callback_migration',
+    migration = migration,
+    space = 'order',
+    key = 'BTC-USD@1',
+    -- order format before the trailing stop callback
+    format = helper.order_format(),
+    row = helper.order_row(),
+    added = {
+        {name = 'callback_value', type = 'decimal'},
+        {name = 'callback_percent', type = 'decimal'},
+    },
+    values = {
+        trigger_price = num,
+        time_in_force = "good_till_cancel",
+        callback_value = z,
+        callback_percent = z,
+    },
+})
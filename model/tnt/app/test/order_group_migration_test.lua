@@ -0,0 +1,27 @@
+local helper = require('app.test.helper.migration')
+local migration = require('migrations.engine.20240620000000_engine_order_group')
+
+local z, num = helper.z, helper.num
+
+helper.test_migration({
+    name = 'order_group_migration',
+    migration = migration,
+    space = 'order',
+    key = 'BTC-USD@1',
+    -- order format before the order groups
+    format = helper.order_format({
+        {name = 'callback_value', type = 'decimal'},
+        {name = 'callback_percent', type = 'decimal'},
+    }),
+    row = helper.order_row({z, z}),
+    added = {
+        {name = 'group_id', type = 'string'},
+        {name = 'group_type', type = 'string'},
+    },
+    values = {
+        trigger_price = num,
+        callback_value = z,
+        group_id = "",
+        group_type = "",
+    },
+})
@@ -0,0 +1,27 @@
+local helper = require('app.test.helper.migration')
+local migration = require('migrations.engine.20240625000000_engine_order_trigger_by')
+
+local z, num = helper.z, helper.num
+
+helper.test_migration({
+    name = 'order_trigger_by_migration',
+    migration = migration,
+    space = 'order',
+    key = 'BTC-USD@1',
+    -- order format before the trigger price source
+    format = helper.order_format({
+        {name = 'callback_value', type = 'decimal'},
+        {name = 'callback_percent', type = 'decimal'},
+        {name = 'group_id', type = 'string'},
+        {name = 'group_type', type = 'string'},
+    }),
+    row = helper.order_row({z, z, "", ""}),
+    added = {
+        {name = 'trigger_by', type = 'string'},
+    },
+    values = {
+        trigger_price = num,
+        group_id = "",
+        trigger_by = "",
+    },
+})
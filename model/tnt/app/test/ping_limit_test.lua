@@ -29,11 +29,53 @@ local g = t.group('order.ping_limit')
 
 local work_dir = fio.tempdir()
 
-local mock_rpc = {call={}}
+local mock_rpc = {call={}, private={}, sequences={}}
 function mock_rpc.callrw_pubsub_publish(channel, json_data, ttl, size, meta_ttl)
+    -- the private orders: and fills: channels are kept apart, the sequence of
+    -- each of them grows by one
+    if string.startswith(channel, 'orders:') or string.startswith(channel, 'fills:') then
+        local data = json.decode(json_data).data
+        t.assert_equals(data.market_id, 'BTC-USD')
+        if mock_rpc.sequences[channel] ~= nil then
+            t.assert_equals(data.sequence, mock_rpc.sequences[channel] + 1, channel)
+        end
+        mock_rpc.sequences[channel] = data.sequence
+        table.insert(mock_rpc.private, {channel, data})
+        return
+    end
     table.insert(mock_rpc.call, {channel, json_data})
 end
 
+-- every order and fill of the account@ updates is also published on the
+-- orders: and fills: channels of the profile
+local function assert_private_channels()
+    local published = {}
+    for _, call in ipairs(mock_rpc.private) do
+        local profile_id = string.match(call[1], '@(%d+)$')
+        for _, event in ipairs(call[2].events or {}) do
+            published[profile_id .. '/order/' .. event.order.id .. '/' .. event.order.status] = true
+        end
+        for _, fill in ipairs(call[2].fills or {}) do
+            published[profile_id .. '/fill/' .. fill.id] = true
+        end
+    end
+
+    for _, call in ipairs(mock_rpc.call) do
+        local profile_id = string.match(call[1], '^account@(%d+)$')
+        if profile_id ~= nil then
+            local data = json.decode(call[2]).data
+            for _, order in ipairs(data.orders or {}) do
+                local key = profile_id .. '/order/' .. order.id .. '/' .. order.status
+                t.assert(published[key], 'no orders: event for ' .. key)
+            end
+            for _, fill in ipairs(data.fills or {}) do
+                local key = profile_id .. '/fill/' .. fill.id
+                t.assert(published[key], 'no fills: update for ' .. key)
+            end
+        end
+    end
+end
+
 local function mock_handle_task(order)
     notif.clear()
     local res = engine._handle_create(order,{})
@@ -103,6 +145,7 @@ g.before_each(function(cg)
     engine.init(market_data.id, MIN_TICK, MIN_ORDER)
 
     mock_rpc.call = {}
+    mock_rpc.private = {}
     cg.params = {}
 end)
 
@@ -204,7 +247,7 @@ g.test_ping_limit = function(cg)
         },
         {
         'account@234',
-        '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"100","size":"0.1","status":"open","market_id":"BTC-USD","client_order_id":"","reason":"liquidation","time_in_force":"good_till_cancel","size_percent":"0","id":"BTC-USD@1","side":"long","created_at":1681343466169600}],"id":234}}',
+        '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"100","size":"0.1","status":"open","market_id":"BTC-USD","client_order_id":"","reason":"liquidation","time_in_force":"good_till_cancel","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":"","id":"BTC-USD@1","side":"long","created_at":1681343466169600}],"id":234}}',
         },
         {
         'orderbook:BTC-USD',
@@ -216,7 +259,7 @@ g.test_ping_limit = function(cg)
         },
         {
         'account@234',
-        '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"104","size":"0.1","status":"open","market_id":"BTC-USD","client_order_id":"","reason":"liquidation","time_in_force":"good_till_cancel","size_percent":"0","id":"BTC-USD@2","side":"short","created_at":1681343466169600}],"id":234}}',
+        '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"104","size":"0.1","status":"open","market_id":"BTC-USD","client_order_id":"","reason":"liquidation","time_in_force":"good_till_cancel","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":"","id":"BTC-USD@2","side":"short","created_at":1681343466169600}],"id":234}}',
         },
         {
         'orderbook:BTC-USD',
@@ -235,18 +278,25 @@ g.test_ping_limit = function(cg)
         '{"data":[{"timestamp":1681343466169600,"price":"103","size":"0.1","id":"BTC-USD-0","liquidation":true,"market_id":"BTC-USD","taker_side":"short"}]}',
         },
         {
+        'liquidations:BTC-USD',
+        '{"data":[{"timestamp":1681343466169600,"price":"103","size":"0.1","id":"BTC-USD-2","market_id":"BTC-USD","side":"short","kind":"orderbook"},{"timestamp":1681343466169600,"price":"103","size":"0.1","id":"BTC-USD-1","market_id":"BTC-USD","side":"long","kind":"orderbook"}]}',
+        },
+        {
         'market:BTC-USD',
         '{"data":{"id":"BTC-USD","last_trade_price":"103","index_price":"0","best_ask":"104","best_bid":"100","market_price":"102"}}',
         },
         {
         'account@234',
-        '{"data":{"fills":[{"trade_id":"BTC-USD-0","price":"103","size":"0.1","id":"BTC-USD-1","market_id":"BTC-USD","client_order_id":"","profile_id":234,"timestamp":1681343466169600,"order_id":"BTC-USD@111","side":"long","is_maker":true,"liquidation":true,"fee":"-0.0","archive_id":21,"shard_id":"shard"},{"trade_id":"BTC-USD-0","price":"103","size":"0.1","id":"BTC-USD-2","market_id":"BTC-USD","client_order_id":"","profile_id":234,"timestamp":1681343466169600,"order_id":"BTC-USD@111-pong","side":"short","is_maker":false,"liquidation":true,"fee":"-0.00721","archive_id":22,"shard_id":"shard"}],"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.1","price":"103","size":"0.0","status":"closed","market_id":"BTC-USD","client_order_id":"","reason":"liquidation","time_in_force":"good_till_cancel","size_percent":"0","id":"BTC-USD@111","side":"long","created_at":1681343466169600},{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.1","price":"103","size":"0","status":"closed","market_id":"BTC-USD","client_order_id":"","reason":"liquidation","time_in_force":"good_till_cancel","size_percent":"0","id":"BTC-USD@111-pong","side":"short","created_at":1681343466169600}],"positions":[{"size":"0","id":"pos-BTC-USD-tr-234","market_id":"BTC-USD","profile_id":234,"entry_price":"103","unrealized_pnl":"0","liquidation_price":"0","notional":"0","fair_price":"0","side":"long","margin":"0"}],"id":234}}',
+        '{"data":{"fills":[{"trade_id":"BTC-USD-0","price":"103","size":"0.1","id":"BTC-USD-1","market_id":"BTC-USD","client_order_id":"","profile_id":234,"timestamp":1681343466169600,"order_id":"BTC-USD@111","side":"long","is_maker":true,"liquidation":true,"fee":"-0.0","archive_id":21,"shard_id":"shard"},{"trade_id":"BTC-USD-0","price":"103","size":"0.1","id":"BTC-USD-2","market_id":"BTC-USD","client_order_id":"","profile_id":234,"timestamp":1681343466169600,"order_id":"BTC-USD@111-pong","side":"short","is_maker":false,"liquidation":true,"fee":"-0.00721","archive_id":22,"shard_id":"shard"}],"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.1","price":"103","size":"0.0","status":"closed","market_id":"BTC-USD","client_order_id":"","reason":"liquidation","time_in_force":"good_till_cancel","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":"","id":"BTC-USD@111","side":"long","created_at":1681343466169600},{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.1","price":"103","size":"0","status":"closed","market_id":"BTC-USD","client_order_id":"","reason":"liquidation","time_in_force":"good_till_cancel","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":"","id":"BTC-USD@111-pong","side":"short","created_at":1681343466169600}],"positions":[{"size":"0","id":"pos-BTC-USD-tr-234","market_id":"BTC-USD","profile_id":234,"entry_price":"103","unrealized_pnl":"0","liquidation_price":"0","notional":"0","fair_price":"0","side":"long","margin":"0"}],"id":234}}',
         },
     }
     t.assert_equals(#mock_rpc.call, #expected)
     for i = 1, #expected do
-        t.assert_equals(mock_rpc.call[i], expected[i])
+        -- compare decoded, order keys follow the lua table order
+        t.assert_equals(mock_rpc.call[i][1], expected[i][1])
+        t.assert_equals(json.decode(mock_rpc.call[i][2]), json.decode(expected[i][2]))
     end
+    assert_private_channels()
 
     mock_rpc.call = {}
 
@@ -274,13 +324,16 @@ g.test_ping_limit = function(cg)
     expected = {
         {
             'account@234',
-            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"103","size":"0.1","status":"rejected","market_id":"BTC-USD","client_order_id":"","reason":"FAKE_ERROR","time_in_force":"good_till_cancel","size_percent":"0","id":"BTC-USD@113","side":"long","created_at":1681343466169600}],"id":234}}'
+            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"103","size":"0.1","status":"rejected","market_id":"BTC-USD","client_order_id":"","reason":"FAKE_ERROR","time_in_force":"good_till_cancel","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":"","id":"BTC-USD@113","side":"long","created_at":1681343466169600}],"id":234}}'
         }
     }
     t.assert_equals(#mock_rpc.call, #expected)
     for i = 1, #expected do
-        t.assert_equals(mock_rpc.call[i], expected[i])
+        -- compare decoded, order keys follow the lua table order
+        t.assert_equals(mock_rpc.call[i][1], expected[i][1])
+        t.assert_equals(json.decode(mock_rpc.call[i][2]), json.decode(expected[i][2]))
     end
+    assert_private_channels()
     
     local sequence_after = tonumber(ob.sequence:current())
     t.assert_equals(sequence_before, sequence_after)
@@ -330,13 +383,16 @@ g.test_ping_limit = function(cg)
     expected = {
         {
             'account@234',
-            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"1000","size":"0.1","status":"rejected","market_id":"BTC-USD","client_order_id":"","reason":"BEST_ASK_ZERO","time_in_force":"good_till_cancel","size_percent":"0","id":"BTC-USD@112","side":"long","created_at":1681343466169600}],"id":234}}'
+            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"1000","size":"0.1","status":"rejected","market_id":"BTC-USD","client_order_id":"","reason":"BEST_ASK_ZERO","time_in_force":"good_till_cancel","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":"","id":"BTC-USD@112","side":"long","created_at":1681343466169600}],"id":234}}'
         }
     }
     t.assert_equals(#mock_rpc.call, #expected)
     for i = 1, #expected do
-        t.assert_equals(mock_rpc.call[i], expected[i])
+        -- compare decoded, order keys follow the lua table order
+        t.assert_equals(mock_rpc.call[i][1], expected[i][1])
+        t.assert_equals(json.decode(mock_rpc.call[i][2]), json.decode(expected[i][2]))
     end
+    assert_private_channels()
     
 
 
@@ -385,13 +441,16 @@ g.test_ping_limit = function(cg)
     expected = {
         {
             'account@234',
-            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"1000","size":"0.1","status":"rejected","market_id":"BTC-USD","client_order_id":"","reason":"RiskManager CheckOrderParams: price=109 should be less\\/equal than= 105","time_in_force":"good_till_cancel","size_percent":"0","id":"BTC-USD@115","side":"long","created_at":1681343466169600}],"id":234}}'
+            '{"data":{"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"ping_limit","trigger_price":"0","profile_id":234,"timestamp":1681343466169600,"total_filled_size":"0.0","price":"1000","size":"0.1","status":"rejected","market_id":"BTC-USD","client_order_id":"","reason":"RiskManager CheckOrderParams: price=109 should be less\\/equal than= 105","time_in_force":"good_till_cancel","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":"","id":"BTC-USD@115","side":"long","created_at":1681343466169600}],"id":234}}'
         }
     }
     t.assert_equals(#mock_rpc.call, #expected)
     for i = 1, #expected do
-        t.assert_equals(mock_rpc.call[i], expected[i])
+        -- compare decoded, order keys follow the lua table order
+        t.assert_equals(mock_rpc.call[i][1], expected[i][1])
+        t.assert_equals(json.decode(mock_rpc.call[i][2]), json.decode(expected[i][2]))
     end
+    assert_private_channels()
     
 
 
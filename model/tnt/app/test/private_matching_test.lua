@@ -34,11 +34,53 @@ local g = t.group('engine.private_matching')
 
 local work_dir = fio.tempdir()
 
-local mock_rpc = {call={}}
+local mock_rpc = {call={}, private={}, sequences={}}
 function mock_rpc.callrw_pubsub_publish(channel, json_data, ttl, size, meta_ttl)
+    -- the private orders: and fills: channels are kept apart, the sequence of
+    -- each of them grows by one
+    if string.startswith(channel, 'orders:') or string.startswith(channel, 'fills:') then
+        local data = json.decode(json_data).data
+        t.assert_equals(data.market_id, 'BTC-USD')
+        if mock_rpc.sequences[channel] ~= nil then
+            t.assert_equals(data.sequence, mock_rpc.sequences[channel] + 1, channel)
+        end
+        mock_rpc.sequences[channel] = data.sequence
+        table.insert(mock_rpc.private, {channel, data})
+        return
+    end
     table.insert(mock_rpc.call, {channel, json_data})
 end
 
+-- every order and fill of the account@ updates is also published on the
+-- orders: and fills: channels of the profile
+local function assert_private_channels()
+    local published = {}
+    for _, call in ipairs(mock_rpc.private) do
+        local profile_id = string.match(call[1], '@(%d+)$')
+        for _, event in ipairs(call[2].events or {}) do
+            published[profile_id .. '/order/' .. event.order.id .. '/' .. event.order.status] = true
+        end
+        for _, fill in ipairs(call[2].fills or {}) do
+            published[profile_id .. '/fill/' .. fill.id] = true
+        end
+    end
+
+    for _, call in ipairs(mock_rpc.call) do
+        local profile_id = string.match(call[1], '^account@(%d+)$')
+        if profile_id ~= nil then
+            local data = json.decode(call[2]).data
+            for _, order in ipairs(data.orders or {}) do
+                local key = profile_id .. '/order/' .. order.id .. '/' .. order.status
+                t.assert(published[key], 'no orders: event for ' .. key)
+            end
+            for _, fill in ipairs(data.fills or {}) do
+                local key = profile_id .. '/fill/' .. fill.id
+                t.assert(published[key], 'no fills: update for ' .. key)
+            end
+        end
+    end
+end
+
 function mock_rpc.callrw_profile(func_name, params)
     return cache.get_cache_and_meta(params[1], params[2])
 end
@@ -191,6 +233,7 @@ g.before_each(function(cg)
     engine.init(market_data.id, MIN_TICK, MIN_ORDER)
 
     mock_rpc.call = {}
+    mock_rpc.private = {}
     cg.params = {}
 end)
 
@@ -611,7 +654,7 @@ g.test_router = function(cg)
     local expected = {
         {
         'account@999',
-        '{"data":{"fills":[{"trade_id":"BTC-USD-0","price":"109","size":"0.1","id":"BTC-USD-2","market_id":"BTC-USD","client_order_id":"","profile_id":999,"timestamp":1681343466169600,"order_id":"BTC-USD@666","side":"long","is_maker":false,"liquidation":false,"fee":"-0.00763","archive_id":38,"shard_id":"shard"}],"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"limit","trigger_price":"0","profile_id":999,"timestamp":1681343466169600,"total_filled_size":"0.1","price":"110","size":"0","status":"closed","market_id":"BTC-USD","client_order_id":"","reason":"","time_in_force":"good_till_cancel","size_percent":"0","id":"BTC-USD@666","side":"long","created_at":1681343466169600}],"positions":[{"unrealized_pnl":"-0.9","size":"0.1","take_profit":null,"side":"long","stop_loss":null,"market_id":"BTC-USD","profile_id":999,"entry_price":"109","shard_id":"shard","margin":"10.0","liquidation_price":"0","notional":"10.0","fair_price":"100","archive_id":35,"id":"pos-BTC-USD-tr-999"}],"id":999}}',
+        '{"data":{"fills":[{"trade_id":"BTC-USD-0","price":"109","size":"0.1","id":"BTC-USD-2","market_id":"BTC-USD","client_order_id":"","profile_id":999,"timestamp":1681343466169600,"order_id":"BTC-USD@666","side":"long","is_maker":false,"liquidation":false,"fee":"-0.00763","archive_id":38,"shard_id":"shard"}],"orders":[{"updated_at":1681343466169600,"initial_size":"0.1","order_type":"limit","trigger_price":"0","profile_id":999,"timestamp":1681343466169600,"total_filled_size":"0.1","price":"110","size":"0","status":"closed","market_id":"BTC-USD","client_order_id":"","reason":"","time_in_force":"good_till_cancel","size_percent":"0","callback_value":"0","callback_percent":"0","group_id":"","group_type":"","trigger_by":"","id":"BTC-USD@666","side":"long","created_at":1681343466169600}],"positions":[{"unrealized_pnl":"-0.9","size":"0.1","take_profit":null,"side":"long","stop_loss":null,"market_id":"BTC-USD","profile_id":999,"entry_price":"109","shard_id":"shard","margin":"10.0","liquidation_price":"0","notional":"10.0","fair_price":"100","archive_id":35,"id":"pos-BTC-USD-tr-999"}],"id":999}}',
         },
         {
         'account@6',
@@ -620,8 +663,11 @@ g.test_router = function(cg)
     }
     t.assert_equals(#mock_rpc.call, #expected)
     for i = 1, #expected do
-        t.assert_equals(mock_rpc.call[i], expected[i])
+        -- compare decoded, order keys follow the lua table order
+        t.assert_equals(mock_rpc.call[i][1], expected[i][1])
+        t.assert_equals(json.decode(mock_rpc.call[i][2]), json.decode(expected[i][2]))
     end
+    assert_private_channels()
 end
 
 g.test_pm_sequence = function(cg)
@@ -0,0 +1,103 @@
+local decimal = require('decimal')
+local fio = require('fio')
+local t = require('luatest')
+
+local archiver = require('app.archiver')
+local config = require('app.config')
+local d = require('app.data')
+local engine = require('app.engine')
+local risk = require('app.engine.risk')
+local time = require('app.lib.time')
+
+require('app.config.constants')
+
+local g = t.group('risk.post_match')
+
+local work_dir = fio.tempdir()
+
+t.before_suite(function()
+    box.cfg{
+        work_dir = work_dir,
+    }
+end)
+
+t.after_suite(function()
+    fio.rmtree(work_dir)
+end)
+
+local market_id = 'BTC-USD'
+local profile_id = 1
+
+g.before_each(function(cg)
+    archiver.init_sequencer('test')
+    engine.init_spaces({
+        id = market_id,
+        status = 'active',
+        min_initial_margin = ONE,
+        forced_margin = ONE,
+        liquidation_margin = ONE,
+        min_tick = ONE,
+        min_order = ONE,
+    })
+
+    box.space.market:update(market_id, {
+        {'=', 'fair_price', decimal.new(100)},
+        {'=', 'mark_price', decimal.new(80)},
+    })
+
+    box.space.profile_meta:replace({
+        profile_id,
+        market_id,
+        config.params.PROFILE_STATUS.ACTIVE,
+        ZERO, ZERO, ZERO, ZERO,
+        decimal.new("0.1"),
+        decimal.new(10),
+        ZERO, ZERO,
+        time.now(),
+    })
+    box.space.balance_sum:replace({profile_id, decimal.new(15), time.now()})
+
+    -- long 1 @ 100
+    box.space.position:replace({
+        'pos-1', market_id, profile_id, ONE, config.params.LONG, decimal.new(100),
+        ZERO, ZERO, ZERO, ZERO, ZERO,
+    })
+end)
+
+g.after_each(function(cg)
+    box.space.position:truncate()
+    box.space.profile_meta:truncate()
+    box.space.balance_sum:truncate()
+end)
+
+local function profile_data()
+    local cache = {}
+    for _, field in ipairs({d.cache_balance, d.cache_cum_unrealized_pnl, d.cache_total_notional,
+                            d.cache_total_position_margin, d.cache_total_order_margin}) do
+        cache[field] = ZERO
+    end
+    return {cache = cache}
+end
+
+g.test_post_match_mark_price = function(cg)
+    -- valued at the fair price: equity 15, notional 100, position margin 10
+    box.space.market:update(market_id, {{'=', 'mark_price_usage', {}}})
+    t.assert_is(risk.post_match(market_id, profile_data(), profile_id, nil), nil)
+
+    -- valued at the mark price: pnl -20 makes the equity negative
+    box.space.market:update(market_id, {
+        {'=', 'mark_price_usage', {config.params.MARK_PRICE_USAGE.LIQUIDATION}},
+    })
+    local data = profile_data()
+    local err = risk.post_match(market_id, data, profile_id, nil)
+    t.assert_str_contains(err, 'POST_MATCH_ERROR_')
+    t.assert_equals(data.cache[d.cache_cum_unrealized_pnl], decimal.new(-20))
+    t.assert_equals(data.cache[d.cache_total_notional], decimal.new(80))
+    t.assert_equals(data.cache[d.cache_total_position_margin], decimal.new(8))
+
+    -- the mark price only for the slipstopper leaves the margin on the fair price
+    box.space.market:update(market_id, {
+        {'=', 'mark_price_usage', {config.params.MARK_PRICE_USAGE.SLIPSTOPPER}},
+    })
+    t.assert_is(risk.post_match(market_id, profile_data(), profile_id, nil), nil)
+end
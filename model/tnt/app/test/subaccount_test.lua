@@ -0,0 +1,125 @@
+local decimal = require('decimal')
+local fio = require('fio')
+local t = require('luatest')
+local archiver = require('app.archiver')
+local balance = require('app.balance')
+local profile = require('app.profile')
+local config = require('app.config')
+
+require('app.config.constants')
+require('app.errcodes')
+
+local g = t.group('subaccount')
+local work_dir = fio.tempdir()
+
+t.before_suite(function()
+    box.cfg{
+        work_dir = work_dir,
+    }
+end)
+
+t.after_suite(function()
+    fio.rmtree(work_dir)
+end)
+
+g.before_each(function(cg)
+    archiver.init_sequencer('profile')
+    profile.init_spaces({})
+    balance.init_spaces(0)
+end)
+
+g.after_each(function(cg)
+    balance.test_clear_spaces()
+    box.space.profile:drop()
+    box.space.subaccount:drop()
+end)
+
+g.test_create_subaccount = function(cg)
+    local p = profile.profile
+
+    local master = p.create(config.params.PROFILE_TYPE.TRADER, "active", "0xMASTER", DEFAULT_EXCHANGE_ID)["res"]
+    local other = p.create(config.params.PROFILE_TYPE.TRADER, "active", "0xOTHER", DEFAULT_EXCHANGE_ID)["res"]
+
+    local res = p.create_subaccount(master.id)
+    t.assert_is(res["error"], nil)
+    local child = res["res"]
+    t.assert_equals(child.profile_type, config.params.PROFILE_TYPE.SUBACCOUNT)
+    t.assert_equals(child.wallet, master.wallet)
+    t.assert_equals(child.exchange_id, master.exchange_id)
+    t.assert_equals(box.space.subaccount:get(child.id).index, 1)
+
+    res = p.create_subaccount(master.id)
+    t.assert_equals(res["res"].wallet, master.wallet)
+    t.assert_equals(box.space.subaccount:get(res["res"].id).index, 2)
+
+    -- the wallet still finds the master only
+    t.assert_equals(p.get_by_wallet_for_exchange_id("0xMASTER", DEFAULT_EXCHANGE_ID)["res"].id, master.id)
+    res = p.create(config.params.PROFILE_TYPE.TRADER, "active", "0xMASTER", DEFAULT_EXCHANGE_ID)
+    t.assert_equals(res["error"], ERR_PROFILE_ALREADY_EXIST)
+
+    t.assert_equals(#p.get_subaccounts(master.id)["res"], 2)
+    t.assert_equals(#p.get_subaccounts(other.id)["res"], 0)
+
+    t.assert_is(p.is_subaccount_of(child.id, master.id)["res"], true)
+    t.assert_is(p.is_subaccount_of(child.id, other.id)["res"], false)
+    t.assert_is(p.is_subaccount_of(master.id, master.id)["res"], false)
+
+    -- no subaccounts of subaccounts
+    res = p.create_subaccount(child.id)
+    t.assert_equals(res["error"], ERR_SUBACCOUNT_NOT_ALLOWED)
+
+    local max = config.params.MAX_SUBACCOUNTS
+    config.params.MAX_SUBACCOUNTS = 2
+    res = p.create_subaccount(master.id)
+    config.params.MAX_SUBACCOUNTS = max
+    t.assert_equals(res["error"], ERR_MAX_SUBACCOUNTS_EXCEED)
+
+    res = p.create_subaccount(1000)
+    t.assert_equals(res["error"], "PROFILE_NOT_FOUND")
+
+    -- the profile isn't left behind when it can't be linked to the master
+    local profiles = box.space.profile:count()
+    local fail_link = function() error("LINK_FAILED") end
+    box.space.subaccount:before_replace(fail_link)
+    res = p.create_subaccount(other.id)
+    box.space.subaccount:before_replace(nil, fail_link)
+    t.assert_str_contains(res["error"], "LINK_FAILED")
+    t.assert_equals(box.space.profile:count(), profiles)
+    t.assert_equals(#p.get_subaccounts(other.id)["res"], 0)
+end
+
+g.test_subaccount_transfer = function(cg)
+    local p = profile.profile
+
+    local master = p.create(config.params.PROFILE_TYPE.TRADER, "active", "0xMASTER", DEFAULT_EXCHANGE_ID)["res"]
+    local other = p.create(config.params.PROFILE_TYPE.TRADER, "active", "0xOTHER", DEFAULT_EXCHANGE_ID)["res"]
+    local child = p.create_subaccount(master.id)["res"]
+    local foreign = p.create_subaccount(other.id)["res"]
+
+    local amount = decimal.new(4)
+
+    t.assert_equals(p.subaccount_transfer(master.id, master.id, child.id, decimal.new(0))["error"], "WRONG_AMOUNT")
+    t.assert_equals(p.subaccount_transfer(master.id, child.id, child.id, amount)["error"], ERR_SUBACCOUNT_TRANSFER_SAME_PROFILE)
+    t.assert_equals(p.subaccount_transfer(master.id, master.id, foreign.id, amount)["error"], ERR_NOT_YOUR_SUBACCOUNT)
+    t.assert_equals(p.subaccount_transfer(master.id, other.id, child.id, amount)["error"], ERR_NOT_YOUR_SUBACCOUNT)
+
+    balance.deposit_credit(master.id, decimal.new(10))
+
+    local res = balance.subaccount_transfer(master.id, child.id, amount)
+    t.assert_is(res["error"], nil)
+    t.assert_equals(#res["res"], 2)
+
+    local out, into = res["res"][1], res["res"][2]
+    t.assert_equals(out.ops_type, config.params.BALANCE_TYPE.SUBACCOUNT_TRANSFER_OUT)
+    t.assert_equals(out.profile_id, master.id)
+    t.assert_equals(into.ops_type, config.params.BALANCE_TYPE.SUBACCOUNT_TRANSFER_IN)
+    t.assert_equals(into.profile_id, child.id)
+    t.assert_equals(out.ops_id2, into.ops_id2)
+    t.assert_equals(out.amount, amount)
+
+    t.assert_equals(box.space.balance_sum:get(master.id).balance, decimal.new(6))
+    t.assert_equals(box.space.balance_sum:get(child.id).balance, amount)
+
+    res = balance.subaccount_transfer(child.id, master.id, decimal.new(-1))
+    t.assert_equals(res["error"], "NEGATIVE_OR_ZERO_TRANSFER_AMOUNT")
+end
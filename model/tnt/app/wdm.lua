@@ -14,6 +14,8 @@ local WdmError = errors.new_class("WdmError")
 local wdm = {}
 local item_title = "24h_wds"
 local item_id = "total_wds"
+local chain_item_title = "24h_chain_wds"
+local profile_item_title = "24h_profile_wds"
 
 
 -- Create initial tiers for market if not exist
@@ -144,5 +146,50 @@ function wdm.wds_per_24h()
     return rolling.get_roll_sum(item_title, item_id)
 end
 
+local function _chain_item_id(exchange_id, chain_id)
+    return exchange_id .. ":" .. tostring(chain_id)
+end
+
+local function _profile_item_id(exchange_id, chain_id, profile_id)
+    return _chain_item_id(exchange_id, chain_id) .. ":" .. tostring(profile_id)
+end
+
+-- volume of the withdrawals let through by the withdrawal policy of a chain
+function wdm.roll_chain_volume(exchange_id, chain_id, profile_id, amount)
+    checks("string", "number", "number", "decimal")
+
+    local e = rolling.update_roll_value(chain_item_title,
+    _chain_item_id(exchange_id, chain_id),
+    amount,
+    3600,
+    24,
+    false)
+    if e ~= nil then
+        log.warn("wdm.roll_chain_volume 24h_chain_wds error=%s", e)
+    end
+
+    e = rolling.update_roll_value(profile_item_title,
+    _profile_item_id(exchange_id, chain_id, profile_id),
+    amount,
+    3600,
+    24,
+    false)
+    if e ~= nil then
+        log.warn("wdm.roll_chain_volume 24h_profile_wds error=%s", e)
+    end
+end
+
+function wdm.chain_wds_per_24h(exchange_id, chain_id)
+    checks("string", "number")
+
+    return rolling.get_roll_sum_since(chain_item_title, _chain_item_id(exchange_id, chain_id), 3600, 24)
+end
+
+function wdm.profile_wds_per_24h(exchange_id, chain_id, profile_id)
+    checks("string", "number", "number")
+
+    return rolling.get_roll_sum_since(profile_item_title, _profile_item_id(exchange_id, chain_id, profile_id), 3600, 24)
+end
+
 
 return wdm
\ No newline at end of file
@@ -0,0 +1,46 @@
+return {
+    up = function()
+        local archiver = require('app.archiver')
+        local ddl = require('app.ddl')
+        local decimal = require('decimal')
+
+        if box.space.order_tmp ~= nil then
+            box.space.order_tmp:drop()
+        end
+
+        local sp = box.space['order']
+        if sp == nil then
+            error('space `order` not found')
+        end
+
+        local fmt, err = archiver.format(sp)
+        if err ~= nil then
+            error(err)
+        end
+        if ddl.has_column(fmt.columns, 'callback_value') then
+            return
+        end
+
+        local last_field_no = #fmt.columns
+        table.extend(fmt.columns, {
+            {name = 'callback_value', type = 'decimal', is_nullable = true},
+            {name = 'callback_percent', type = 'decimal', is_nullable = true},
+        })
+
+        local tmp_sp, err = archiver.create('order_tmp', fmt.options, fmt.columns, fmt.indices)
+        if err ~= nil then
+            error(err)
+        end
+
+        for _, tuple in sp.index.primary:pairs(nil, {iterator = box.index.ALL}) do
+            -- raises error
+            tmp_sp:insert(tuple:transform(last_field_no + 1, 0, decimal.new(0), decimal.new(0)))
+        end
+
+        ddl.alter_column(tmp_sp, {name = 'callback_value', type = 'decimal', is_nullable = false})
+        ddl.alter_column(tmp_sp, {name = 'callback_percent', type = 'decimal', is_nullable = false})
+
+        sp:drop()
+        tmp_sp:rename(sp.name)
+    end
+}
@@ -0,0 +1,43 @@
+return {
+    up = function()
+        local archiver = require('app.archiver')
+        local ddl = require('app.ddl')
+
+        if box.space.market_tmp ~= nil then
+            box.space.market_tmp:drop()
+        end
+
+        local sp = box.space['market']
+        if sp == nil then
+            error('space `market` not found')
+        end
+
+        local fmt, err = archiver.format(sp)
+        if err ~= nil then
+            error(err)
+        end
+        if ddl.has_column(fmt.columns, 'price_degraded') then
+            return
+        end
+
+        local last_field_no = #fmt.columns
+        table.extend(fmt.columns, {
+            {name = 'price_degraded', type = 'boolean', is_nullable = true},
+        })
+
+        local tmp_sp, err = archiver.create('market_tmp', fmt.options, fmt.columns, fmt.indices)
+        if err ~= nil then
+            error(err)
+        end
+
+        for _, tuple in sp.index.primary:pairs(nil, {iterator = box.index.ALL}) do
+            -- raises error
+            tmp_sp:insert(tuple:transform(last_field_no + 1, 0, false))
+        end
+
+        ddl.alter_column(tmp_sp, {name = 'price_degraded', type = 'boolean', is_nullable = false})
+
+        sp:drop()
+        tmp_sp:rename(sp.name)
+    end
+}
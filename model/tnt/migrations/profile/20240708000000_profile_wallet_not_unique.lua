@@ -0,0 +1,16 @@
+return {
+    up = function()
+        local sp = box.space['profile']
+        if sp == nil then
+            error('space `profile` not found')
+        end
+
+        -- the subaccounts share the wallet of their master
+        local idx = sp.index['exchange_id_wallet']
+        if idx == nil or idx.unique == false then
+            return
+        end
+
+        idx:alter({unique = false})
+    end
+}
@@ -0,0 +1,103 @@
+package pricing
+
+/*
+Per market circuit breaker for the index price. Trips when no index price could
+be built for longer than max_stale_age, or when the index moves more than
+max_index_jump between two updates. While tripped the last good price stays
+frozen in tarantool and the market is marked as price_degraded.
+A jump is accepted as the new level once recovery_updates consecutive prices
+agree with it.
+*/
+
+import (
+	"time"
+)
+
+const (
+	DEFAULT_MAX_STALE_AGE    = 2 * time.Minute
+	DEFAULT_RECOVERY_UPDATES = 5
+
+	BREAKER_REASON_STALE = "stale"
+	BREAKER_REASON_JUMP  = "jump"
+)
+
+type CircuitBreakerConfig struct {
+	MaxJump         float64       // fraction of the last good price, 0 disables jump detection
+	MaxStale        time.Duration // 0 disables stale detection
+	RecoveryUpdates uint
+}
+
+type CircuitBreaker struct {
+	cfg          CircuitBreakerConfig
+	tripped      bool
+	reason       string
+	lastGood     float64
+	lastGoodTime time.Time
+	candidate    float64
+	stableRun    uint
+}
+
+func NewCircuitBreaker(cfg CircuitBreakerConfig, now time.Time) *CircuitBreaker {
+	if cfg.RecoveryUpdates == 0 {
+		cfg.RecoveryUpdates = DEFAULT_RECOVERY_UPDATES
+	}
+	return &CircuitBreaker{
+		cfg:          cfg,
+		lastGoodTime: now,
+	}
+}
+
+// checks a new index price, returns false while the last good price must stay frozen
+func (cb *CircuitBreaker) Check(price float64, now time.Time) bool {
+	if cb.lastGood == 0.0 || cb.cfg.MaxJump <= 0.0 || closeEnough(price, cb.lastGood, cb.cfg.MaxJump) {
+		cb.accept(price, now)
+		return true
+	}
+
+	if cb.candidate != 0.0 && closeEnough(price, cb.candidate, cb.cfg.MaxJump) {
+		cb.stableRun++
+	} else {
+		cb.candidate = price
+		cb.stableRun = 1
+	}
+	cb.trip(BREAKER_REASON_JUMP)
+
+	if cb.stableRun >= cb.cfg.RecoveryUpdates {
+		cb.accept(price, now)
+		return true
+	}
+	return false
+}
+
+// called when no index price could be built for an update
+func (cb *CircuitBreaker) CheckStale(now time.Time) {
+	if cb.cfg.MaxStale > 0 && now.Sub(cb.lastGoodTime) > cb.cfg.MaxStale {
+		cb.trip(BREAKER_REASON_STALE)
+	}
+}
+
+func (cb *CircuitBreaker) Tripped() bool {
+	return cb.tripped
+}
+
+func (cb *CircuitBreaker) Reason() string {
+	return cb.reason
+}
+
+func (cb *CircuitBreaker) LastGood() float64 {
+	return cb.lastGood
+}
+
+func (cb *CircuitBreaker) trip(reason string) {
+	cb.tripped = true
+	cb.reason = reason
+}
+
+func (cb *CircuitBreaker) accept(price float64, now time.Time) {
+	cb.tripped = false
+	cb.reason = ""
+	cb.lastGood = price
+	cb.lastGoodTime = now
+	cb.candidate = 0.0
+	cb.stableRun = 0
+}
@@ -0,0 +1,107 @@
+package pricing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/pricing/sources"
+)
+
+type DegradedRecorder struct {
+	prices   []float64
+	degraded []bool
+}
+
+func (dr *DegradedRecorder) UpdateIndexPrice(ctx context.Context, market_id string, index_price float64) error {
+	dr.prices = append(dr.prices, index_price)
+	return nil
+}
+
+func (dr *DegradedRecorder) SetPriceDegraded(ctx context.Context, market_id string, degraded bool) error {
+	dr.degraded = append(dr.degraded, degraded)
+	return nil
+}
+
+func TestCircuitBreakerJump(t *testing.T) {
+	logrus.Warn(".......TestCircuitBreakerJump")
+	now := time.Now()
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MaxJump: FIVE_PERCENT, RecoveryUpdates: 3}, now)
+
+	if !cb.Check(100.0, now) || !cb.Check(104.0, now) {
+		t.Fatalf("Expected prices within max jump to be accepted")
+	}
+	if cb.Check(120.0, now) || !cb.Tripped() || cb.Reason() != BREAKER_REASON_JUMP {
+		t.Fatalf("Expected jump to trip the breaker")
+	}
+	if cb.LastGood() != 104.0 {
+		t.Fatalf("Expected last good price 104.0 but got %v", cb.LastGood())
+	}
+	// a different level restarts the recovery run
+	if cb.Check(90.0, now) || cb.Check(121.0, now) || cb.Check(120.5, now) {
+		t.Fatalf("Expected breaker to stay tripped before recovery")
+	}
+	if !cb.Check(120.0, now) || cb.Tripped() || cb.LastGood() != 120.0 {
+		t.Fatalf("Expected new level to be accepted after 3 stable updates")
+	}
+}
+
+func TestCircuitBreakerStale(t *testing.T) {
+	logrus.Warn(".......TestCircuitBreakerStale")
+	now := time.Now()
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MaxStale: time.Minute}, now)
+
+	cb.CheckStale(now.Add(30 * time.Second))
+	if cb.Tripped() {
+		t.Fatalf("Expected breaker not to trip before max stale age")
+	}
+	cb.CheckStale(now.Add(2 * time.Minute))
+	if !cb.Tripped() || cb.Reason() != BREAKER_REASON_STALE {
+		t.Fatalf("Expected stale breaker to trip")
+	}
+	if !cb.Check(100.0, now.Add(3*time.Minute)) || cb.Tripped() {
+		t.Fatalf("Expected fresh price to reset the stale breaker")
+	}
+}
+
+func TestMarketPriceDegraded(t *testing.T) {
+	logrus.Warn(".......TestMarketPriceDegraded")
+	ctx := context.Background()
+	recorder := &DegradedRecorder{}
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{MaxJump: FIVE_PERCENT, RecoveryUpdates: 2}, time.Now())
+	mps := NewMarketPriceService("TEST", 1, nil, recorder, nil, breaker)
+
+	price := func(p float64) []sources.SourcePrice {
+		return []sources.SourcePrice{{ExchangeId: "binance", Price: p}}
+	}
+
+	mps.updateModelPrice(ctx, price(100.0))
+	mps.updateModelPrice(ctx, price(101.0))
+	if err := mps.updateModelPrice(ctx, price(150.0)); err == nil {
+		t.Fatalf("Expected jump to be rejected")
+	}
+	mps.updateModelPrice(ctx, price(150.5))
+
+	expectedPrices := []float64{100.0, 101.0, 150.5}
+	if len(recorder.prices) != len(expectedPrices) {
+		t.Fatalf("Expected prices %v but got %v", expectedPrices, recorder.prices)
+	}
+	for i, p := range expectedPrices {
+		if recorder.prices[i] != p {
+			t.Fatalf("Expected prices %v but got %v", expectedPrices, recorder.prices)
+		}
+	}
+
+	// cleared once on the first publish, set on the jump, cleared on recovery
+	expectedDegraded := []bool{false, true, false}
+	if len(recorder.degraded) != len(expectedDegraded) {
+		t.Fatalf("Expected degraded updates %v but got %v", expectedDegraded, recorder.degraded)
+	}
+	for i, d := range expectedDegraded {
+		if recorder.degraded[i] != d {
+			t.Fatalf("Expected degraded updates %v but got %v", expectedDegraded, recorder.degraded)
+		}
+	}
+}
@@ -14,12 +14,24 @@ const (
 )
 
 type ServiceConfig struct {
-	UpdateInterval   string         `yaml:"update_interval"`
-	DefaultMaxUseAge string         `yaml:"default_max_use_age"`
-	ReferenceCoin    string         `yaml:"reference_coin"`
-	CoinData         []CoinData     `yaml:"coin_data"`
-	ExchangeData     []ExchangeData `yaml:"exchange_data"`
-	MarketData       []MarketData   `yaml:"market_data"`
+	UpdateInterval   string          `yaml:"update_interval"`
+	DefaultMaxUseAge string          `yaml:"default_max_use_age"`
+	ReferenceCoin    string          `yaml:"reference_coin"`
+	MaxIndexJump     float64         `yaml:"max_index_jump"`   // fraction per update_interval, 0 disables it
+	MaxStaleAge      string          `yaml:"max_stale_age"`    // seconds without an index price before freezing
+	RecoveryUpdates  uint            `yaml:"recovery_updates"` // stable updates needed to accept a jump
+	MarkPrice        MarkPriceConfig `yaml:"mark_price"`
+	CoinData         []CoinData      `yaml:"coin_data"`
+	ExchangeData     []ExchangeData  `yaml:"exchange_data"`
+	MarketData       []MarketData    `yaml:"market_data"`
+}
+
+type MarkPriceConfig struct {
+	Enabled        bool    `yaml:"enabled"`
+	UpdateInterval string  `yaml:"update_interval"`
+	ImpactNotional float64 `yaml:"impact_notional"` // default 10000, can be set per market
+	MaxBasis       float64 `yaml:"max_basis"`       // fraction of the index, default 0.005
+	BasisWindow    int     `yaml:"basis_window"`    // number of basis samples averaged, default 60
 }
 
 type Config struct {
@@ -53,5 +53,10 @@ func (dpr *DummyPriceReceiver) UpdateIndexPrice(ctx context.Context, marketId st
 	return nil
 }
 
+func (dpr *DummyPriceReceiver) SetPriceDegraded(ctx context.Context, marketId string, degraded bool) error {
+	logrus.Warnf("DummyPriceReceiver: marketId: %s, price degraded: %v", marketId, degraded)
+	return nil
+}
+
 // compile-time check that DummyPriceReceiver implements PriceReceiver
 var _ PriceReceiver = (*DummyPriceReceiver)(nil)
@@ -0,0 +1,224 @@
+package pricing
+
+/*
+Combines the prices received from the sources of a market into an index price.
+The methodology is configured per market in pricing.yaml, each source can be
+given a weight, sources too far from the median are rejected and a minimum
+number of contributing sources (quorum) is required to publish a price.
+*/
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/pricing/sources"
+)
+
+const (
+	METHODOLOGY_MEDIAN                 = "median"
+	METHODOLOGY_VOLUME_WEIGHTED_MEDIAN = "volume_weighted_median"
+	METHODOLOGY_TRIMMED_MEAN           = "trimmed_mean"
+
+	DEFAULT_MAX_DEVIATION = FIVE_PERCENT
+	DEFAULT_QUORUM        = 1
+	DEFAULT_TRIM_FRACTION = 0.2
+	DEFAULT_SOURCE_WEIGHT = 1.0
+
+	REJECTED_NO_DATA      = "no_data"
+	REJECTED_STALE        = "stale"
+	REJECTED_DEVIATION    = "deviation_from_median"
+	REJECTED_INCONSISTENT = "inconsistent"
+	REJECTED_TRIMMED      = "trimmed"
+)
+
+type IndexMethodology struct {
+	Name         string
+	Weights      map[string]float64
+	MaxDeviation float64
+	Quorum       int
+	TrimFraction float64
+}
+
+type SourceContribution struct {
+	ExchangeId string  `json:"exchange_id"`
+	Price      float64 `json:"price"`
+	Weight     float64 `json:"weight"`
+}
+
+type SourceRejection struct {
+	ExchangeId string  `json:"exchange_id"`
+	Price      float64 `json:"price"`
+	Reason     string  `json:"reason"`
+}
+
+// IndexRecord describes how a single index price was built
+type IndexRecord struct {
+	MarketId     string               `json:"market_id"`
+	Price        float64              `json:"price"`
+	Methodology  string               `json:"methodology"`
+	Contributing []SourceContribution `json:"contributing"`
+	Rejected     []SourceRejection    `json:"rejected"`
+	Timestamp    time.Time            `json:"timestamp"`
+}
+
+func DefaultIndexMethodology() *IndexMethodology {
+	return &IndexMethodology{
+		Name:         METHODOLOGY_MEDIAN,
+		Weights:      map[string]float64{},
+		MaxDeviation: DEFAULT_MAX_DEVIATION,
+		Quorum:       DEFAULT_QUORUM,
+		TrimFraction: DEFAULT_TRIM_FRACTION,
+	}
+}
+
+// builds the methodology of a market from its pricing.yaml entry,
+// invalid values are logged and replaced by the defaults
+func NewIndexMethodology(data MarketData) *IndexMethodology {
+	m := DefaultIndexMethodology()
+
+	switch data.Methodology {
+	case "":
+	case METHODOLOGY_MEDIAN, METHODOLOGY_VOLUME_WEIGHTED_MEDIAN, METHODOLOGY_TRIMMED_MEAN:
+		m.Name = data.Methodology
+	default:
+		logrus.Warnf("unknown methodology %s for market_id=%s, using %s", data.Methodology, data.MarketId, m.Name)
+	}
+
+	if data.MaxDeviation > 0 {
+		m.MaxDeviation = data.MaxDeviation
+	} else if data.MaxDeviation < 0 {
+		logrus.Warnf("invalid max_deviation %v for market_id=%s, using %v", data.MaxDeviation, data.MarketId, m.MaxDeviation)
+	}
+
+	if data.Quorum > 0 {
+		m.Quorum = data.Quorum
+	} else if data.Quorum < 0 {
+		logrus.Warnf("invalid quorum %d for market_id=%s, using %d", data.Quorum, data.MarketId, m.Quorum)
+	}
+
+	if data.TrimFraction > 0 && data.TrimFraction < 0.5 {
+		m.TrimFraction = data.TrimFraction
+	} else if data.TrimFraction != 0 {
+		logrus.Warnf("invalid trim_fraction %v for market_id=%s, using %v", data.TrimFraction, data.MarketId, m.TrimFraction)
+	}
+
+	for _, ticker := range data.Sources {
+		if ticker.Weight < 0 {
+			logrus.Warnf("invalid weight %v for exchange_id=%s market_id=%s, using %v", ticker.Weight, ticker.ExchangeId, data.MarketId, DEFAULT_SOURCE_WEIGHT)
+			continue
+		}
+		if ticker.Weight > 0 {
+			m.Weights[ticker.ExchangeId] = ticker.Weight
+		}
+	}
+
+	if m.Quorum > len(data.Sources) && len(data.Sources) > 0 {
+		logrus.Warnf("quorum %d for market_id=%s is larger than the %d configured sources, index will never be published", m.Quorum, data.MarketId, len(data.Sources))
+	}
+
+	return m
+}
+
+func (m *IndexMethodology) weight(exchangeId string) float64 {
+	if w, ok := m.Weights[exchangeId]; ok {
+		return w
+	}
+	return DEFAULT_SOURCE_WEIGHT
+}
+
+// combines the contributing prices into the index price, sources
+// dropped by the methodology itself (trimmed mean) are returned as rejected
+func (m *IndexMethodology) combine(contributing []SourceContribution) (float64, []SourceContribution, []SourceRejection) {
+	sorted := make([]SourceContribution, len(contributing))
+	copy(sorted, contributing)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Price < sorted[j].Price })
+
+	switch m.Name {
+	case METHODOLOGY_VOLUME_WEIGHTED_MEDIAN:
+		return weightedMedian(sorted), contributing, nil
+	case METHODOLOGY_TRIMMED_MEAN:
+		trim := int(math.Floor(float64(len(sorted)) * m.TrimFraction))
+		if len(sorted)-2*trim <= 0 {
+			return weightedMedian(equalWeights(sorted)), contributing, nil
+		}
+		var rejected []SourceRejection
+		for i, c := range sorted {
+			if i < trim || i >= len(sorted)-trim {
+				rejected = append(rejected, SourceRejection{ExchangeId: c.ExchangeId, Price: c.Price, Reason: REJECTED_TRIMMED})
+			}
+		}
+		kept := sorted[trim : len(sorted)-trim]
+		return weightedMean(kept), kept, rejected
+	default:
+		return weightedMedian(equalWeights(sorted)), contributing, nil
+	}
+}
+
+func equalWeights(values []SourceContribution) []SourceContribution {
+	res := make([]SourceContribution, len(values))
+	for i, v := range values {
+		res[i] = SourceContribution{ExchangeId: v.ExchangeId, Price: v.Price, Weight: 1.0}
+	}
+	return res
+}
+
+// values must be sorted by price,
+// with equal weights the result is the plain median
+func weightedMedian(values []SourceContribution) float64 {
+	var total float64
+	for _, v := range values {
+		total += v.Weight
+	}
+	if len(values) == 0 || total <= 0 {
+		return 0
+	}
+
+	half := total / 2
+	var cumulative float64
+	for i, v := range values {
+		cumulative += v.Weight
+		if cumulative > half {
+			return v.Price
+		}
+		if cumulative == half && i+1 < len(values) {
+			return (v.Price + values[i+1].Price) / 2
+		}
+	}
+	return values[len(values)-1].Price
+}
+
+func weightedMean(values []SourceContribution) float64 {
+	var total, sum float64
+	for _, v := range values {
+		total += v.Weight
+		sum += v.Price * v.Weight
+	}
+	if total <= 0 {
+		return 0
+	}
+	return sum / total
+}
+
+func (r *IndexRecord) String() string {
+	contributing := make([]string, len(r.Contributing))
+	for i, c := range r.Contributing {
+		contributing[i] = fmt.Sprintf("%s=%v(w=%v)", c.ExchangeId, c.Price, c.Weight)
+	}
+	rejected := make([]string, len(r.Rejected))
+	for i, c := range r.Rejected {
+		rejected[i] = fmt.Sprintf("%s=%v(%s)", c.ExchangeId, c.Price, c.Reason)
+	}
+	return fmt.Sprintf("market_id=%s price=%f methodology=%s contributing=%v rejected=%v",
+		r.MarketId, r.Price, r.Methodology, contributing, rejected)
+}
+
+func rejectAll(rejected []SourceRejection, prices []sources.SourcePrice, reason string) []SourceRejection {
+	for _, p := range prices {
+		rejected = append(rejected, SourceRejection{ExchangeId: p.ExchangeId, Price: p.Price, Reason: reason})
+	}
+	return rejected
+}
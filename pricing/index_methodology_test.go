@@ -0,0 +1,154 @@
+package pricing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/pricing/sources"
+)
+
+func contributions(prices []float64, weights []float64) []SourceContribution {
+	res := make([]SourceContribution, len(prices))
+	for i, price := range prices {
+		res[i] = SourceContribution{ExchangeId: string(rune('a' + i)), Price: price, Weight: weights[i]}
+	}
+	return res
+}
+
+func TestWeightedMedian(t *testing.T) {
+	logrus.Warn(".......TestWeightedMedian")
+	res := weightedMedian(contributions([]float64{1.0, 2.0, 3.0}, []float64{1, 1, 1}))
+	if res != 2.0 {
+		t.Fatalf("Expected median of 2.0 but got %v", res)
+	}
+	res = weightedMedian(contributions([]float64{1.0, 2.0, 3.0, 4.0}, []float64{1, 1, 1, 1}))
+	if res != 2.5 {
+		t.Fatalf("Expected median of 2.5 but got %v", res)
+	}
+	res = weightedMedian(contributions([]float64{1.0, 2.0, 3.0, 4.0}, []float64{1, 1, 1, 5}))
+	if res != 4.0 {
+		t.Fatalf("Expected weighted median of 4.0 but got %v", res)
+	}
+	res = weightedMedian(contributions([]float64{1.0, 2.0, 3.0}, []float64{2, 2, 1}))
+	if res != 2.0 {
+		t.Fatalf("Expected weighted median of 2.0 but got %v", res)
+	}
+}
+
+func TestCombineMethodologies(t *testing.T) {
+	logrus.Warn(".......TestCombineMethodologies")
+	values := contributions([]float64{100.0, 101.0, 102.0, 103.0, 110.0}, []float64{1, 1, 1, 1, 6})
+
+	m := DefaultIndexMethodology()
+	price, used, rejected := m.combine(values)
+	if price != 102.0 || len(used) != 5 || len(rejected) != 0 {
+		t.Fatalf("Expected median 102.0 from 5 sources but got %v from %d, %d rejected", price, len(used), len(rejected))
+	}
+
+	m.Name = METHODOLOGY_VOLUME_WEIGHTED_MEDIAN
+	price, _, _ = m.combine(values)
+	if price != 110.0 {
+		t.Fatalf("Expected volume weighted median 110.0 but got %v", price)
+	}
+
+	m.Name = METHODOLOGY_TRIMMED_MEAN
+	m.Weights = map[string]float64{}
+	price, used, rejected = m.combine(equalWeights(values))
+	if price != 102.0 || len(used) != 3 || len(rejected) != 2 {
+		t.Fatalf("Expected trimmed mean 102.0 from 3 sources but got %v from %d, %d rejected", price, len(used), len(rejected))
+	}
+	for _, r := range rejected {
+		if r.Reason != REJECTED_TRIMMED || (r.Price != 100.0 && r.Price != 110.0) {
+			t.Fatalf("Unexpected trimmed source %v", r)
+		}
+	}
+}
+
+func TestIndexRecordRejections(t *testing.T) {
+	logrus.Warn(".......TestIndexRecordRejections")
+	mps := NewMarketPriceService("TEST", 5, nil, nil, DefaultIndexMethodology(), nil)
+	inputs := []sources.SourcePrice{
+		{ExchangeId: "binance", Price: 100.0},
+		{ExchangeId: "okx", Price: 101.0},
+		{ExchangeId: "kraken", Price: 102.0},
+		{ExchangeId: "coinbase", Price: 150.0},
+		{ExchangeId: "coingecko", Price: 99.0, Stale: true},
+		{ExchangeId: "bybit", Stale: true},
+	}
+	record, err := mps.getCombinedPrice(context.Background(), inputs)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if record.Price != 101.0 || len(record.Contributing) != 3 {
+		t.Fatalf("Expected price 101.0 from 3 sources but got %s", record)
+	}
+	expected := map[string]string{
+		"coinbase":  REJECTED_DEVIATION,
+		"coingecko": REJECTED_STALE,
+		"bybit":     REJECTED_NO_DATA,
+	}
+	if len(record.Rejected) != len(expected) {
+		t.Fatalf("Expected %d rejected sources but got %s", len(expected), record)
+	}
+	for _, r := range record.Rejected {
+		if expected[r.ExchangeId] != r.Reason {
+			t.Fatalf("Expected %s rejected as %s but got %s", r.ExchangeId, expected[r.ExchangeId], r.Reason)
+		}
+	}
+}
+
+func TestIndexQuorum(t *testing.T) {
+	logrus.Warn(".......TestIndexQuorum")
+	m := DefaultIndexMethodology()
+	m.Quorum = 3
+	mps := NewMarketPriceService("TEST", 3, nil, nil, m, nil)
+	inputs := []sources.SourcePrice{
+		{ExchangeId: "binance", Price: 100.0},
+		{ExchangeId: "okx", Price: 101.0},
+		{ExchangeId: "kraken", Price: 100.5, Stale: true},
+	}
+	if _, err := mps.getCombinedPrice(context.Background(), inputs); err == nil {
+		t.Fatalf("Expected quorum error with 2 fresh sources")
+	}
+
+	inputs[2].Stale = false
+	record, err := mps.getCombinedPrice(context.Background(), inputs)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if record.Price != 100.5 {
+		t.Fatalf("Expected price 100.5 but got %v", record.Price)
+	}
+}
+
+func TestNewIndexMethodology(t *testing.T) {
+	logrus.Warn(".......TestNewIndexMethodology")
+	m := NewIndexMethodology(MarketData{
+		MarketId:     "BTC-USD",
+		Methodology:  "unknown",
+		MaxDeviation: -1,
+		Sources: []sources.Ticker{
+			{ExchangeId: "binance", Weight: 3},
+			{ExchangeId: "okx"},
+		},
+	})
+	if m.Name != METHODOLOGY_MEDIAN || m.MaxDeviation != DEFAULT_MAX_DEVIATION || m.Quorum != DEFAULT_QUORUM {
+		t.Fatalf("Expected defaults but got %v", m)
+	}
+	if m.weight("binance") != 3 || m.weight("okx") != DEFAULT_SOURCE_WEIGHT {
+		t.Fatalf("Unexpected weights %v", m.Weights)
+	}
+
+	m = NewIndexMethodology(MarketData{
+		MarketId:     "ETH-USD",
+		Methodology:  METHODOLOGY_TRIMMED_MEAN,
+		MaxDeviation: 0.02,
+		Quorum:       2,
+		TrimFraction: 0.1,
+	})
+	if m.Name != METHODOLOGY_TRIMMED_MEAN || m.MaxDeviation != 0.02 || m.Quorum != 2 || m.TrimFraction != 0.1 {
+		t.Fatalf("Unexpected methodology %v", m)
+	}
+}
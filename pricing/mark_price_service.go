@@ -0,0 +1,246 @@
+package pricing
+
+/*
+Per market mark price built from the order book. The book is sampled every
+update_interval, the impact bid and ask are the average prices of selling and
+buying impact_notional. The basis of the impact mid to the index is averaged
+over basis_window samples and clamped to max_basis, the mark price is the median
+of index*(1+basis), the impact mid and the last trade price.
+Markets list in mark_price_usage the consumers (liquidation, slipstopper,
+funding) using the mark price instead of the fair price.
+*/
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/pkg/log"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+const (
+	DEFAULT_MARK_PRICE_INTERVAL = time.Second
+	DEFAULT_IMPACT_NOTIONAL     = 10000.0
+	DEFAULT_MAX_BASIS           = 0.005
+	DEFAULT_BASIS_WINDOW        = 60
+)
+
+type MarkPriceModel interface {
+	GetMarketData(ctx context.Context, market_id string) (*model.MarketData, error)
+	GetOrderbookData(ctx context.Context, market_id string) (*model.OrderbookData, error)
+	UpdateMarkPrice(ctx context.Context, market_id string, mark_price float64, usage []string) error
+}
+
+// compile-time check that model.ApiModel implements MarkPriceModel
+var _ MarkPriceModel = (*model.ApiModel)(nil)
+
+type MarkPriceParams struct {
+	ImpactNotional float64
+	MaxBasis       float64
+	BasisWindow    int
+	Usage          []string
+}
+
+// MarkPriceRecord describes how a single mark price was built
+type MarkPriceRecord struct {
+	MarketId   string    `json:"market_id"`
+	Price      float64   `json:"price"`
+	IndexPrice float64   `json:"index_price"`
+	ImpactBid  float64   `json:"impact_bid"`
+	ImpactAsk  float64   `json:"impact_ask"`
+	ImpactMid  float64   `json:"impact_mid"`
+	LastTrade  float64   `json:"last_trade"`
+	Basis      float64   `json:"basis"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type MarkPriceService struct {
+	marketId string
+	apiModel MarkPriceModel
+	params   MarkPriceParams
+	basis    []float64
+}
+
+type bookLevel struct {
+	price float64
+	size  float64
+}
+
+func NewMarkPriceService(marketId string, apiModel MarkPriceModel, params MarkPriceParams) *MarkPriceService {
+	if params.ImpactNotional <= 0 {
+		params.ImpactNotional = DEFAULT_IMPACT_NOTIONAL
+	}
+	if params.MaxBasis <= 0 {
+		params.MaxBasis = DEFAULT_MAX_BASIS
+	}
+	if params.BasisWindow <= 0 {
+		params.BasisWindow = DEFAULT_BASIS_WINDOW
+	}
+	return &MarkPriceService{
+		marketId: marketId,
+		apiModel: apiModel,
+		params:   params,
+		basis:    make([]float64, 0, params.BasisWindow),
+	}
+}
+
+func (s *MarkPriceService) start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := s.update(ctx)
+				if err != nil {
+					logrus.Warnf("%v in mark price update for market_id %s", err, s.marketId)
+				}
+			}
+		}
+	}()
+}
+
+func (s *MarkPriceService) update(ctx context.Context) error {
+	market, err := s.apiModel.GetMarketData(ctx, s.marketId)
+	if err != nil {
+		return err
+	}
+	book, err := s.apiModel.GetOrderbookData(ctx, s.marketId)
+	if err != nil {
+		return err
+	}
+
+	record, err := s.compute(market, book, time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = s.apiModel.UpdateMarkPrice(ctx, s.marketId, record.Price, s.params.Usage)
+	if err != nil {
+		logrus.WithField(log.AlertTag, log.AlertCrit).Errorf("error %v calling apiModel.UpdateMarkPrice", err)
+		return err
+	}
+
+	logrus.Infof("Mark price updated for market_id=%s price=%f index=%f impact_mid=%f last_trade=%f basis=%f",
+		s.marketId, record.Price, record.IndexPrice, record.ImpactMid, record.LastTrade, record.Basis)
+	return nil
+}
+
+func (s *MarkPriceService) compute(market *model.MarketData, book *model.OrderbookData, now time.Time) (*MarkPriceRecord, error) {
+	record := &MarkPriceRecord{
+		MarketId:   s.marketId,
+		IndexPrice: inexact(market.IndexPrice),
+		LastTrade:  inexact(market.LastTradePrice),
+		Timestamp:  now,
+	}
+	if record.IndexPrice <= 0 {
+		return record, fmt.Errorf("no index price in market %s", s.marketId)
+	}
+
+	var bidOk, askOk bool
+	record.ImpactBid, bidOk = ImpactPrice(book.Bids, s.params.ImpactNotional, true)
+	record.ImpactAsk, askOk = ImpactPrice(book.Asks, s.params.ImpactNotional, false)
+	// a thin book doesn't move the basis, the last samples keep being used
+	if bidOk && askOk {
+		record.ImpactMid = (record.ImpactBid + record.ImpactAsk) / 2
+		s.addBasis(record.ImpactMid/record.IndexPrice - 1)
+	}
+	record.Basis = s.clampedBasis()
+
+	components := []float64{record.IndexPrice * (1 + record.Basis)}
+	if record.ImpactMid > 0 {
+		components = append(components, record.ImpactMid)
+	}
+	if record.LastTrade > 0 {
+		components = append(components, record.LastTrade)
+	}
+	record.Price = median(components)
+	return record, nil
+}
+
+func (s *MarkPriceService) addBasis(basis float64) {
+	if len(s.basis) == s.params.BasisWindow {
+		copy(s.basis, s.basis[1:])
+		s.basis = s.basis[:len(s.basis)-1]
+	}
+	s.basis = append(s.basis, basis)
+}
+
+func (s *MarkPriceService) clampedBasis() float64 {
+	if len(s.basis) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, b := range s.basis {
+		sum += b
+	}
+	basis := sum / float64(len(s.basis))
+	if basis > s.params.MaxBasis {
+		return s.params.MaxBasis
+	} else if basis < -s.params.MaxBasis {
+		return -s.params.MaxBasis
+	}
+	return basis
+}
+
+// ImpactPrice is the average price of filling notional against the book side,
+// false if the side is too thin to fill it
+func ImpactPrice(side [][]tdecimal.Decimal, notional float64, bids bool) (float64, bool) {
+	levels := make([]bookLevel, 0, len(side))
+	for _, level := range side {
+		if len(level) < 2 {
+			continue
+		}
+		levels = append(levels, bookLevel{price: level[0].InexactFloat64(), size: level[1].InexactFloat64()})
+	}
+	// best price first, tarantool returns both sides in ascending order
+	sort.Slice(levels, func(i, j int) bool {
+		if bids {
+			return levels[i].price > levels[j].price
+		}
+		return levels[i].price < levels[j].price
+	})
+
+	remaining := notional
+	var filledSize float64
+	for _, level := range levels {
+		if level.price <= 0 || level.size <= 0 {
+			continue
+		}
+		levelNotional := level.price * level.size
+		if levelNotional >= remaining {
+			filledSize += remaining / level.price
+			return notional / filledSize, true
+		}
+		remaining -= levelNotional
+		filledSize += level.size
+	}
+	return 0, false
+}
+
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	l := len(sorted)
+	if l == 0 {
+		return 0
+	} else if l%2 == 0 {
+		return (sorted[l/2-1] + sorted[l/2]) / 2
+	}
+	return sorted[l/2]
+}
+
+func inexact(value *tdecimal.Decimal) float64 {
+	if value == nil {
+		return 0
+	}
+	return value.InexactFloat64()
+}
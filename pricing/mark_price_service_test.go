@@ -0,0 +1,121 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+func levels(values ...float64) [][]tdecimal.Decimal {
+	res := make([][]tdecimal.Decimal, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		res = append(res, []tdecimal.Decimal{
+			*tdecimal.NewDecimal(decimal.NewFromFloat(values[i])),
+			*tdecimal.NewDecimal(decimal.NewFromFloat(values[i+1])),
+		})
+	}
+	return res
+}
+
+func marketPrices(index float64, lastTrade float64) *model.MarketData {
+	return &model.MarketData{
+		MarketID:       "TEST",
+		IndexPrice:     tdecimal.NewDecimal(decimal.NewFromFloat(index)),
+		LastTradePrice: tdecimal.NewDecimal(decimal.NewFromFloat(lastTrade)),
+	}
+}
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestImpactPrice(t *testing.T) {
+	logrus.Warn(".......TestImpactPrice")
+	// ascending like tarantool returns them
+	bids := levels(98.0, 10.0, 99.0, 5.0, 100.0, 1.0)
+	asks := levels(101.0, 1.0, 102.0, 5.0, 103.0, 10.0)
+
+	price, ok := ImpactPrice(bids, 50.0, true)
+	if !ok || price != 100.0 {
+		t.Fatalf("Expected impact bid 100.0 within the best level but got %v %v", price, ok)
+	}
+
+	// 100 from the best level, 495 from the second, 5 from the third
+	price, ok = ImpactPrice(bids, 600.0, true)
+	expected := 600.0 / (1.0 + 5.0 + 5.0/98.0)
+	if !ok || !almostEqual(price, expected) {
+		t.Fatalf("Expected impact bid %v but got %v %v", expected, price, ok)
+	}
+
+	price, ok = ImpactPrice(asks, 1000.0, false)
+	expected = 1000.0 / (1.0 + 5.0 + (1000.0-101.0-510.0)/103.0)
+	if !ok || !almostEqual(price, expected) {
+		t.Fatalf("Expected impact ask %v but got %v %v", expected, price, ok)
+	}
+
+	if _, ok = ImpactPrice(asks, 100000.0, false); ok {
+		t.Fatalf("Expected thin book to give no impact price")
+	}
+}
+
+func TestMarkPriceCompute(t *testing.T) {
+	logrus.Warn(".......TestMarkPriceCompute")
+	s := NewMarkPriceService("TEST", nil, MarkPriceParams{ImpactNotional: 100.0, MaxBasis: 0.01, BasisWindow: 2})
+	book := &model.OrderbookData{
+		Bids: levels(100.0, 10.0),
+		Asks: levels(102.0, 10.0),
+	}
+
+	// impact mid 101, basis 1%, last trade far away
+	record, err := s.compute(marketPrices(100.0, 120.0), book, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if record.ImpactMid != 101.0 || !almostEqual(record.Basis, 0.01) || !almostEqual(record.Price, 101.0) {
+		t.Fatalf("Expected mark price 101.0 but got %+v", record)
+	}
+
+	// impact mid 5% above the index, the basis is clamped and the last trade breaks the tie
+	book.Bids = levels(104.0, 10.0)
+	book.Asks = levels(106.0, 10.0)
+	record, _ = s.compute(marketPrices(100.0, 101.5), book, time.Now())
+	if !almostEqual(record.Basis, 0.01) || record.Price != 101.5 {
+		t.Fatalf("Expected clamped basis 0.01 and mark price 101.5 but got %+v", record)
+	}
+
+	// an empty book keeps the averaged basis
+	book.Bids = nil
+	record, _ = s.compute(marketPrices(100.0, 0.0), book, time.Now())
+	if record.ImpactMid != 0.0 || !almostEqual(record.Price, 101.0) {
+		t.Fatalf("Expected mark price index*(1+basis) 101.0 but got %+v", record)
+	}
+
+	if _, err = s.compute(marketPrices(0.0, 100.0), book, time.Now()); err == nil {
+		t.Fatalf("Expected error without index price")
+	}
+}
+
+func TestReferencePrice(t *testing.T) {
+	logrus.Warn(".......TestReferencePrice")
+	market := marketPrices(100.0, 100.0)
+	market.FairPrice = tdecimal.NewDecimal(decimal.NewFromFloat(100.0))
+	market.MarkPrice = tdecimal.NewDecimal(decimal.NewFromFloat(101.0))
+	market.MarkPriceUsage = []string{model.MARK_PRICE_USAGE_FUNDING}
+
+	if market.ReferencePrice(model.MARK_PRICE_USAGE_FUNDING).InexactFloat64() != 101.0 {
+		t.Fatalf("Expected mark price for funding")
+	}
+	if market.ReferencePrice(model.MARK_PRICE_USAGE_LIQUIDATION).InexactFloat64() != 100.0 {
+		t.Fatalf("Expected fair price for liquidation")
+	}
+	market.MarkPrice = tdecimal.NewDecimal(decimal.Zero)
+	if market.ReferencePrice(model.MARK_PRICE_USAGE_FUNDING).InexactFloat64() != 100.0 {
+		t.Fatalf("Expected fair price without a mark price")
+	}
+}
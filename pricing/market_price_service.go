@@ -3,17 +3,20 @@ package pricing
 /*
 Calculates new prices for tarantool from values received on a channel.
 The new price is calculated from the individual prices from each source.
-Checks for consistency between the prices from the sources.
+Checks for consistency between the prices from the sources and combines
+them according to the market's index methodology.
 */
 
 import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/strips-finance/rabbit-dex-backend/pkg/log"
+	"github.com/strips-finance/rabbit-dex-backend/pricing/sources"
 )
 
 const (
@@ -25,22 +28,32 @@ const (
 type MarketPriceService struct {
 	marketId          string
 	mostRecentPrice   float64
-	priceChan         chan []float64
+	priceChan         chan []sources.SourcePrice
 	rejectedRunLength uint
 	allData           []float64
-	useableData       []float64
 	scratch           []float64
 	apiModel          PriceReceiver
+	methodology       *IndexMethodology
+	breaker           *CircuitBreaker
+	degraded          bool
+	degradedSynced    bool
 }
 
-func NewMarketPriceService(marketId string, numSources int, priceChan chan []float64, apiModel PriceReceiver) *MarketPriceService {
+func NewMarketPriceService(marketId string, numSources int, priceChan chan []sources.SourcePrice, apiModel PriceReceiver, methodology *IndexMethodology, breaker *CircuitBreaker) *MarketPriceService {
+	if methodology == nil {
+		methodology = DefaultIndexMethodology()
+	}
+	if breaker == nil {
+		breaker = NewCircuitBreaker(CircuitBreakerConfig{}, time.Now())
+	}
 	ps := MarketPriceService{
 		marketId:    marketId,
 		priceChan:   priceChan,
 		allData:     make([]float64, numSources+1),
-		useableData: make([]float64, 0, numSources),
 		scratch:     make([]float64, numSources+1),
 		apiModel:    apiModel,
+		methodology: methodology,
+		breaker:     breaker,
 	}
 	return &ps
 }
@@ -63,41 +76,113 @@ func (mps *MarketPriceService) priceUpdater(ctx context.Context) {
 	}
 }
 
-func (mps *MarketPriceService) updateModelPrice(ctx context.Context, inputPrices []float64) error {
-	price, numSources, err := mps.processInputs(ctx, inputPrices)
+func (mps *MarketPriceService) updateModelPrice(ctx context.Context, inputPrices []sources.SourcePrice) error {
+	record, err := mps.processInputs(ctx, inputPrices)
 	if err != nil {
 		logrus.Warnf("%v in processPrice for market_id %s", err, mps.marketId)
+		if record != nil {
+			logrus.Warnf("index not published: %s", record)
+		}
+		mps.syncDegraded(ctx, false)
 		return err
 	}
 
-	err = mps.apiModel.UpdateIndexPrice(ctx, mps.marketId, price)
+	err = mps.apiModel.UpdateIndexPrice(ctx, mps.marketId, record.Price)
 	if err != nil {
 		logrus.WithField(log.AlertTag, log.AlertCrit).Errorf("error %v calling apiModel.UpdatePriceIndex", err)
 		return err
 	}
 
-	logrus.Infof("Index price updated for market_id=%s price=%f based on %d sources", mps.marketId, price, numSources)
+	logrus.Infof("Index price updated for market_id=%s price=%f based on %d sources", mps.marketId, record.Price, len(record.Contributing))
+	if len(record.Rejected) > 0 {
+		logrus.Infof("Index price record %s", record)
+	}
+
+	mps.syncDegraded(ctx, true)
 
 	return nil
 }
 
-func (mps *MarketPriceService) processInputs(ctx context.Context, inputPrices []float64) (price float64, numSources int, err error) {
-	latest, numSources, err := mps.getCombinedPrice(ctx, inputPrices)
+// keeps the price_degraded flag in tarantool in line with the circuit breaker,
+// a failed update is retried on the next price batch
+func (mps *MarketPriceService) syncDegraded(ctx context.Context, published bool) {
+	tripped := mps.breaker.Tripped()
+	if mps.degradedSynced && tripped == mps.degraded {
+		return
+	}
+	// don't clear a status left by a previous run before a price was published
+	if !mps.degradedSynced && !tripped && !published {
+		return
+	}
+
+	if tripped {
+		logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("PRICE_DEGRADED market_id=%s reason=%s index frozen at %f",
+			mps.marketId, mps.breaker.Reason(), mps.breaker.LastGood())
+	} else if mps.degradedSynced {
+		logrus.Warnf("market_id=%s price feed recovered, index price %f", mps.marketId, mps.breaker.LastGood())
+	}
+
+	err := mps.apiModel.SetPriceDegraded(ctx, mps.marketId, tripped)
+	if err != nil {
+		logrus.WithField(log.AlertTag, log.AlertCrit).Errorf("error %v calling apiModel.SetPriceDegraded for market_id=%s", err, mps.marketId)
+		return
+	}
+	mps.degraded = tripped
+	mps.degradedSynced = true
+}
+
+func (mps *MarketPriceService) processInputs(ctx context.Context, inputPrices []sources.SourcePrice) (*IndexRecord, error) {
+	record, err := mps.getCombinedPrice(ctx, inputPrices)
 	if err != nil {
-		return 0.0, 0, err
-	} else if mps.mostRecentPrice == 0.0 || mps.rejectedRunLength > MAX_REJECTED_RUN_LENGTH || closeEnough(latest, mps.mostRecentPrice, TEN_PERCENT) {
+		mps.breaker.CheckStale(record.Timestamp)
+		return record, err
+	}
+	latest := record.Price
+
+	// with jump detection configured the circuit breaker replaces the run length check
+	if mps.breaker.cfg.MaxJump > 0.0 {
+		if !mps.breaker.Check(latest, record.Timestamp) {
+			return record, fmt.Errorf("circuit breaker %s in market %s, index frozen at %v, rejected %v",
+				mps.breaker.Reason(), mps.marketId, mps.breaker.LastGood(), latest)
+		}
+		mps.mostRecentPrice = latest
+		return record, nil
+	}
+
+	if mps.mostRecentPrice == 0.0 || mps.rejectedRunLength > MAX_REJECTED_RUN_LENGTH || closeEnough(latest, mps.mostRecentPrice, TEN_PERCENT) {
 		mps.mostRecentPrice = latest
 		mps.rejectedRunLength = 0
-		return latest, numSources, nil
+		mps.breaker.Check(latest, record.Timestamp)
+		return record, nil
 	} else {
 		mps.rejectedRunLength++
-		return latest, numSources,
+		mps.breaker.CheckStale(record.Timestamp)
+		return record,
 			fmt.Errorf("price jump in market %s, last accepted %v, rejected %v, run length %v",
 				mps.marketId, mps.mostRecentPrice, latest, mps.rejectedRunLength)
 	}
 }
 
-func (mps *MarketPriceService) getCombinedPrice(ctx context.Context, inputPrices []float64) (float64, int, error) {
+func (mps *MarketPriceService) getCombinedPrice(ctx context.Context, inputPrices []sources.SourcePrice) (*IndexRecord, error) {
+	record := &IndexRecord{
+		MarketId:    mps.marketId,
+		Methodology: mps.methodology.Name,
+		Timestamp:   time.Now(),
+	}
+
+	freshPrices := make([]sources.SourcePrice, 0, len(inputPrices))
+	for _, input := range inputPrices {
+		if input.Stale {
+			reason := REJECTED_STALE
+			if input.Price == 0.0 {
+				reason = REJECTED_NO_DATA
+			}
+			record.Rejected = append(record.Rejected, SourceRejection{ExchangeId: input.ExchangeId, Price: input.Price, Reason: reason})
+			continue
+		}
+		freshPrices = append(freshPrices, input)
+	}
+
 	var availableData []float64
 	if mps.mostRecentPrice == 0.0 {
 		availableData = mps.allData[1:1]
@@ -105,47 +190,61 @@ func (mps *MarketPriceService) getCombinedPrice(ctx context.Context, inputPrices
 		mps.allData[0] = mps.mostRecentPrice
 		availableData = mps.allData[:1]
 	}
-	availableData = append(availableData, inputPrices...)
+	for _, input := range freshPrices {
+		availableData = append(availableData, input.Price)
+	}
+	maxDeviation := mps.methodology.MaxDeviation
 	var median1 float64
-	numSources := len(inputPrices)
+	numSources := len(freshPrices)
 	if numSources > 1 {
 		var consistent bool
-		median1, consistent = mps.checkDataConsistency(availableData)
+		median1, consistent = mps.checkDataConsistency(availableData, maxDeviation)
 		if !consistent && mps.mostRecentPrice != 0.0 {
-			median1, consistent = mps.checkDataConsistency(availableData[1:])
+			median1, consistent = mps.checkDataConsistency(availableData[1:], maxDeviation)
 		}
 		if !consistent {
-			return 0.0, len(availableData), fmt.Errorf(
-				"market %s has inconsistent price data, fewer than 2 values within 5%% of median: %v",
-				mps.marketId, median1)
+			record.Rejected = rejectAll(record.Rejected, freshPrices, REJECTED_INCONSISTENT)
+			return record, fmt.Errorf(
+				"market %s has inconsistent price data, fewer than 2 values within %v%% of median: %v",
+				mps.marketId, maxDeviation*100, median1)
 		}
 	}
-	var rawData []float64
-	if mps.mostRecentPrice == 0.0 {
-		rawData = availableData
-	} else {
-		rawData = availableData[1:]
-	}
-	mps.useableData = mps.useableData[:0]
-	for _, price := range rawData {
-		if numSources == 1 || closeEnough(price, median1, FIVE_PERCENT) {
-			mps.useableData = append(mps.useableData, price)
+	contributing := make([]SourceContribution, 0, numSources)
+	for _, input := range freshPrices {
+		if numSources == 1 || closeEnough(input.Price, median1, maxDeviation) {
+			contributing = append(contributing, SourceContribution{
+				ExchangeId: input.ExchangeId,
+				Price:      input.Price,
+				Weight:     mps.methodology.weight(input.ExchangeId),
+			})
+		} else {
+			record.Rejected = append(record.Rejected, SourceRejection{ExchangeId: input.ExchangeId, Price: input.Price, Reason: REJECTED_DEVIATION})
 		}
 	}
-	if len(mps.useableData) == 0 {
-		return 0.0, 0, fmt.Errorf("found no useable data")
+	if len(contributing) == 0 {
+		return record, fmt.Errorf("found no useable data")
+	}
+	if len(contributing) < mps.methodology.Quorum {
+		return record, fmt.Errorf("market %s has %d useable sources, quorum is %d",
+			mps.marketId, len(contributing), mps.methodology.Quorum)
 	}
-	return mps.median(mps.useableData), len(mps.useableData), nil
+
+	price, used, trimmed := mps.methodology.combine(contributing)
+	record.Price = price
+	record.Contributing = used
+	record.Rejected = append(record.Rejected, trimmed...)
+
+	return record, nil
 }
 
-func (mps *MarketPriceService) checkDataConsistency(values []float64) (median1 float64, consistent bool) {
+func (mps *MarketPriceService) checkDataConsistency(values []float64, tolerance float64) (median1 float64, consistent bool) {
 	median1 = mps.median(values)
 	if len(values) < 2 {
 		return median1, true
 	}
 	var count uint
 	for _, value := range values {
-		if closeEnough(value, median1, FIVE_PERCENT) {
+		if closeEnough(value, median1, tolerance) {
 			count++
 			if count >= 2 {
 				return median1, true
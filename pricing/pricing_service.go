@@ -51,10 +51,23 @@ type MarketData struct {
 	Sources    []sources.Ticker `yaml:"sources"`
 	Multiplier float64          `yaml:"multiplier"`
 	MaxUseAge  string           `yaml:"max_use_age"`
+	// median (default), volume_weighted_median or trimmed_mean,
+	// weights of the sources are set with sources[].weight
+	Methodology  string  `yaml:"methodology"`
+	MaxDeviation float64 `yaml:"max_deviation"` // fraction of the median, default 0.05
+	Quorum       int     `yaml:"quorum"`        // min number of contributing sources, default 1
+	TrimFraction float64 `yaml:"trim_fraction"` // fraction cut from each side for trimmed_mean, default 0.2
+	// circuit breaker overrides of the service wide values
+	MaxIndexJump float64 `yaml:"max_index_jump"`
+	MaxStaleAge  string  `yaml:"max_stale_age"`
+	// mark price, usage lists the consumers using it instead of the fair price
+	ImpactNotional float64  `yaml:"impact_notional"`
+	MarkPriceUsage []string `yaml:"mark_price_usage"`
 }
 
 type PriceReceiver interface {
 	UpdateIndexPrice(ctx context.Context, market_id string, index_price float64) error
+	SetPriceDegraded(ctx context.Context, market_id string, degraded bool) error
 }
 
 // compile-time check that model.ApiModel implements PriceReceiver
@@ -73,6 +86,37 @@ func (ps *PricingService) Run(ctx context.Context, config *Config) {
 	}
 	apiModel := model.NewApiModel(broker)
 	ps.LoadConfig(ctx, apiModel, config)
+	ps.StartMarkPrices(ctx, apiModel, config)
+}
+
+// starts a mark price service for each market when enabled in the config
+func (ps *PricingService) StartMarkPrices(ctx context.Context, apiModel MarkPriceModel, config *Config) {
+	markConfig := config.Service.MarkPrice
+	if !markConfig.Enabled {
+		logrus.Info("mark price disabled")
+		return
+	}
+
+	interval, _ := timeFromStr(markConfig.UpdateInterval, "mark_price update_interval", DEFAULT_MARK_PRICE_INTERVAL)
+	for _, data := range config.Service.MarketData {
+		impactNotional := markConfig.ImpactNotional
+		if data.ImpactNotional > 0 {
+			impactNotional = data.ImpactNotional
+		}
+		for _, usage := range data.MarkPriceUsage {
+			if usage != model.MARK_PRICE_USAGE_LIQUIDATION && usage != model.MARK_PRICE_USAGE_SLIPSTOPPER && usage != model.MARK_PRICE_USAGE_FUNDING {
+				logrus.Warnf("unknown mark_price_usage %s for market_id=%s", usage, data.MarketId)
+			}
+		}
+		s := NewMarkPriceService(data.MarketId, apiModel, MarkPriceParams{
+			ImpactNotional: impactNotional,
+			MaxBasis:       markConfig.MaxBasis,
+			BasisWindow:    markConfig.BasisWindow,
+			Usage:          data.MarkPriceUsage,
+		})
+		s.start(ctx, interval)
+		logrus.Infof("created mark price service for market_id %s usage %v", data.MarketId, data.MarkPriceUsage)
+	}
 }
 
 func (ps *PricingService) LoadConfig(ctx context.Context, apiModel PriceReceiver, config *Config) {
@@ -81,6 +125,8 @@ func (ps *PricingService) LoadConfig(ctx context.Context, apiModel PriceReceiver
 
 	defaultMaxUseAge, _ := timeFromStr(config.Service.DefaultMaxUseAge, "default_max_use_Age", DEFAULT_MAX_USE_AGE)
 
+	defaultMaxStaleAge, _ := timeFromStr(config.Service.MaxStaleAge, "max_stale_age", DEFAULT_MAX_STALE_AGE)
+
 	// put exchange data into a map
 	exchanges := make(map[string]ExchangeData)
 	for _, data := range config.Service.ExchangeData {
@@ -109,8 +155,12 @@ func (ps *PricingService) LoadConfig(ctx context.Context, apiModel PriceReceiver
 	marketData := config.Service.MarketData
 	numMarkets := len(marketData)
 	markets := make([]string, numMarkets)
+	methodologies := make(map[string]*IndexMethodology, numMarkets)
+	breakers := make(map[string]CircuitBreakerConfig, numMarkets)
 	for i, data := range marketData {
 		markets[i] = data.MarketId
+		methodologies[data.MarketId] = NewIndexMethodology(data)
+		breakers[data.MarketId] = circuitBreakerConfig(data, config.Service, defaultMaxStaleAge)
 	}
 	logrus.Infof(
 		"running pricing service with update interval %ds, default max price delay %ds, and %d markets %v",
@@ -140,7 +190,7 @@ func (ps *PricingService) LoadConfig(ctx context.Context, apiModel PriceReceiver
 			if sourceMapEntry, exists = sourceMap[marketId]; !exists {
 				sourceMapEntry = sources.ChanWithSources{
 					Sources:  make([]*sources.SourceData, 0, 4),
-					Channel:  make(chan []float64, 1),
+					Channel:  make(chan []sources.SourcePrice, 1),
 					MaxDelay: maxUseAges[marketId],
 				}
 			}
@@ -154,7 +204,8 @@ func (ps *PricingService) LoadConfig(ctx context.Context, apiModel PriceReceiver
 	// produce a market price, and send the market price to tarantool
 	for marketId, cws := range sourceMap {
 		mps := NewMarketPriceService(marketId, len(cws.Sources),
-			cws.Channel, apiModel)
+			cws.Channel, apiModel, methodologies[marketId],
+			NewCircuitBreaker(breakers[marketId], time.Now()))
 		mps.start(ctx)
 		logrus.Infof("created price service for market_id %s", marketId)
 	}
@@ -210,6 +261,25 @@ func createExchangeSources(ctx context.Context, marketData []MarketData,
 	return sourceData, maxUseAges
 }
 
+// circuit breaker config of a market, values set on the market
+// take precedence over the service wide ones
+func circuitBreakerConfig(data MarketData, service ServiceConfig, defaultMaxStaleAge time.Duration) CircuitBreakerConfig {
+	maxJump := service.MaxIndexJump
+	if data.MaxIndexJump > 0 {
+		maxJump = data.MaxIndexJump
+	}
+	maxStaleAge, err := timeFromStr(data.MaxStaleAge, fmt.Sprintf("%s max_stale_age", data.MarketId), defaultMaxStaleAge)
+	if err != nil {
+		logrus.Warnf("can't parse max_stale_age %s for market_id=%s, err=%s, using default %ds", data.MaxStaleAge, data.MarketId, err.Error(), int64(defaultMaxStaleAge.Seconds()))
+		maxStaleAge = defaultMaxStaleAge
+	}
+	return CircuitBreakerConfig{
+		MaxJump:         maxJump,
+		MaxStale:        maxStaleAge,
+		RecoveryUpdates: service.RecoveryUpdates,
+	}
+}
+
 // `marketId` -> `exchangeId` -> `instId` is used as the config file
 // format because grouping by market makes it easy to see the sources
 // used for each market.
@@ -234,23 +304,27 @@ func buildExchangeSource(ctx context.Context, exchangeId string,
 	coinTickers map[string]map[string][]sources.Ticker, refCoin string) *sources.SourceData {
 
 	// look for a web socket source factory first
+	var srcData *sources.SourceData
 	wsFact := sources.LoadWSSourceFactory(exchangeId)
 	if wsFact != nil {
-		return wsFact.NewWSSource(ctx, marketTickers, maxUseAges, multipliers)
+		srcData = wsFact.NewWSSource(ctx, marketTickers, maxUseAges, multipliers)
+	} else if restFact := sources.LoadRestSourceFactory(exchangeId); restFact != nil {
+		// didn't find a web socket factory, use the rest factory instead
+		// creating a rest factory requires a bit of additional information
+		readInterval, readTimeout, refCoinTickers, apiKey := gatherAdditionalRestSrcInfo(exchangeId, exchanges, coinTickers, refCoin)
+		srcData = restFact.NewRestSource(ctx, marketTickers, refCoin,
+			refCoinTickers, maxUseAges, readInterval, readTimeout, multipliers,
+			apiKey)
 	} else {
-		// didn't find a web socket factory, look for a rest factory instead
-		restFact := sources.LoadRestSourceFactory(exchangeId)
-		if restFact != nil {
-			// creating a rest factory requires a bit of additional information
-			readInterval, readTimeout, refCoinTickers, apiKey := gatherAdditionalRestSrcInfo(exchangeId, exchanges, coinTickers, refCoin)
-			return restFact.NewRestSource(ctx, marketTickers, refCoin,
-				refCoinTickers, maxUseAges, readInterval, readTimeout, multipliers,
-				apiKey)
-		}
+		// couldn't find a source factory for this exchange
+		logrus.Warnf("can't find factory for exchange_id=%s", exchangeId)
+		return nil
+	}
+	// the exchange id identifies the source in the index records
+	if srcData != nil {
+		srcData.ExchangeId = exchangeId
 	}
-	// couldn't find a source factory for this exchange
-	logrus.Warnf("can't find factory for exchange_id=%s", exchangeId)
-	return nil
+	return srcData
 }
 
 func gatherAdditionalRestSrcInfo(exchangeId string,
@@ -2,6 +2,7 @@ package pricing
 
 import (
 	"context"
+	"fmt"
 	// "os"
 	"sync"
 	"testing"
@@ -9,6 +10,8 @@ import (
 
 	// "github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/pricing/sources"
 )
 
 const (
@@ -18,7 +21,7 @@ const (
 
 func TestMedian(t *testing.T) {
 	logrus.Warn(".......TestMedian")
-	pf := NewMarketPriceService("", 7, nil, nil)
+	pf := NewMarketPriceService("", 7, nil, nil, nil, nil)
 	values := []float64{1.0, 2.0, 3.0, 0.5, -9.0, -8.0, 2.0}
 	res := pf.median(values)
 	if res != 1.0 {
@@ -72,14 +75,14 @@ func TestCloseEnough(t *testing.T) {
 
 func TestConsistencyCheck(t *testing.T) {
 	logrus.Warn(".......TestConsistencyCheck")
-	pf := NewMarketPriceService("", 7, nil, nil)
+	pf := NewMarketPriceService("", 7, nil, nil, nil, nil)
 	values := []float64{1.0, 2.0, 3.0, 0.5, -9.0, -8.0, 2.0}
-	median1, consistent := pf.checkDataConsistency(values)
+	median1, consistent := pf.checkDataConsistency(values, FIVE_PERCENT)
 	if consistent {
 		t.Fatalf("Should be reported as inconsistent, but found to be consistent, median is %v", median1)
 	}
 	values = []float64{1.0, 2.0, 3.0, 0.5, -9.0, -8.0, 2.0, 1.04}
-	median1, consistent = pf.checkDataConsistency(values)
+	median1, consistent = pf.checkDataConsistency(values, FIVE_PERCENT)
 	if !consistent {
 		t.Fatalf("Should be reported as consistent, but found to be inconsistent, median is %v", median1)
 	}
@@ -87,7 +90,7 @@ func TestConsistencyCheck(t *testing.T) {
 
 type DummyAggregator struct {
 	values [][]float64
-	ch     chan []float64
+	ch     chan []sources.SourcePrice
 }
 
 func (da *DummyAggregator) start(ctx context.Context, wg *sync.WaitGroup) {
@@ -98,15 +101,23 @@ func (da *DummyAggregator) start(ctx context.Context, wg *sync.WaitGroup) {
 
 func (da *DummyAggregator) streamPrices(ctx context.Context) {
 	for _, value := range da.values {
-		da.ch <- value
+		da.ch <- toSourcePrices(value)
 	}
 }
 
 func NewDummyAggregator(values [][]float64) *DummyAggregator {
 	return &DummyAggregator{
 		values: values,
-		ch:     make(chan []float64),
+		ch:     make(chan []sources.SourcePrice),
+	}
+}
+
+func toSourcePrices(values []float64) []sources.SourcePrice {
+	prices := make([]sources.SourcePrice, len(values))
+	for i, value := range values {
+		prices[i] = sources.SourcePrice{ExchangeId: fmt.Sprintf("source%d", i), Price: value}
 	}
+	return prices
 }
 
 type PriceChecker struct {
@@ -131,6 +142,10 @@ func (pc *PriceChecker) UpdateIndexPrice(ctx context.Context, market_id string,
 	return nil
 }
 
+func (pc *PriceChecker) SetPriceDegraded(ctx context.Context, market_id string, degraded bool) error {
+	return nil
+}
+
 func TestMarketPriceJumpHandling(t *testing.T) {
 	logrus.Warn(".......TestMarketPriceJumpHandling")
 	values := [][]float64{{1345.6}, {1345.7}, {1098.3}, {918.2}, {892.3},
@@ -174,7 +189,7 @@ func testMarketPriceWithDummyData(t *testing.T, values [][]float64,
 	ctx := context.Background()
 	ag := NewDummyAggregator(values)
 	checker := NewPriceChecker(t, expected)
-	mps := NewMarketPriceService("TEST", len(values[0]), ag.ch, checker)
+	mps := NewMarketPriceService("TEST", len(values[0]), ag.ch, checker, nil, nil)
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -13,13 +13,22 @@ const (
 )
 
 type SourceData struct {
+	ExchangeId   string
 	Markets      map[string]bool
 	LatestPrices *sync.Map
 	Urls         []string
 }
 
+// price of a market as last seen by one source, stale prices are
+// still sent so the market price service can report them as rejected
+type SourcePrice struct {
+	ExchangeId string
+	Price      float64
+	Stale      bool
+}
+
 type ChanWithSources struct {
-	Channel  chan []float64
+	Channel  chan []SourcePrice
 	Sources  []*SourceData
 	MaxDelay time.Duration
 }
@@ -56,13 +65,17 @@ func (a *Aggregator) streamPrices(ctx context.Context) {
 
 func (a *Aggregator) sendPriceBatches(ctx context.Context) {
 	for market, cws := range a.SourceMap {
-		prices := make([]float64, 0, len(cws.Sources))
+		prices := make([]SourcePrice, 0, len(cws.Sources))
 		for _, srcData := range cws.Sources {
 			pt := load(market, srcData.LatestPrices)
-			if (pt != PriceTime{}) && time.Since(pt.time) <= cws.MaxDelay {
-				prices = append(prices, pt.price)
-			}
+			prices = append(prices, SourcePrice{
+				ExchangeId: srcData.ExchangeId,
+				Price:      pt.price,
+				Stale:      (pt == PriceTime{}) || time.Since(pt.time) > cws.MaxDelay,
+			})
 		}
+		// batches are sent even when every source is stale,
+		// the market price service needs them to detect stale feeds
 		if len(prices) > 0 {
 			select {
 			case cws.Channel <- prices:
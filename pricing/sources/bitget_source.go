@@ -0,0 +1,135 @@
+package sources
+
+// see https://www.bitget.com/api-doc/contract/websocket/public/Candlesticks-Channel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	BITGET_URL       = "wss://ws.bitget.com/v2/ws/public"
+	BITGET_INST_TYPE = "USDT-FUTURES"
+	BITGET_CHANNEL   = "candle1m"
+	BITGET_BTC_USDT  = "BTCUSDT"
+	BITGET_ETH_USDT  = "ETHUSDT"
+	BITGET_SOL_USDT  = "SOLUSDT"
+)
+
+type BitgetArg struct {
+	InstType string `json:"instType"`
+	Channel  string `json:"channel"`
+	InstId   string `json:"instId"`
+}
+
+type BitgetSubscription struct {
+	Op   string      `json:"op"`
+	Args []BitgetArg `json:"args"`
+}
+
+type BitgetPriceData struct {
+	Event  string          `json:"event"`
+	Action string          `json:"action"`
+	Arg    BitgetArg       `json:"arg"`
+	Data   [][]json.Number `json:"data"`
+	Ts     int64           `json:"ts"`
+}
+
+type bitgetSourceFactory struct{}
+
+func init() {
+	RegisterWSFactory("bitget", func() WSSourceFactory {
+		return &bitgetSourceFactory{}
+	})
+}
+
+func (bsf *bitgetSourceFactory) NewWSSource(ctx context.Context, coinTickers map[string]Ticker, maxUseAge map[string]time.Duration, multipliers map[string]float64) *SourceData {
+	source := newBitgetSource(BITGET_URL, coinTickers, maxUseAge, multipliers)
+	source.start(ctx)
+	sourceData := SourceData{
+		Markets:      source.listMarkets(),
+		LatestPrices: source.latestPrices,
+		Urls:         []string{source.url},
+	}
+	return &sourceData
+}
+
+func newBitgetSource(url string, coinTickers map[string]Ticker, maxUseAge map[string]time.Duration, multipliers map[string]float64) *GobwasSource {
+	source := NewGobwasSource()
+	source.url = url
+	source.shortUrl = url
+	source.coinTickers = coinTickers
+	source.markets = reverseInstrumentMap(coinTickers)
+	source.maxUseAge = maxUseAge
+	source.multipliers = multipliers
+	source.extractPrice = func(priceResponse []byte, multiplier float64) (PriceTime, error) {
+		res := BitgetPriceData{}
+		err := json.Unmarshal(priceResponse, &res)
+		if err != nil {
+			return PriceTime{}, err
+		}
+		if len(res.Data) < 1 {
+			return PriceTime{}, fmt.Errorf("no candle data in response \"%s\" from %s", priceResponse, source.url)
+		}
+		// the latest candle comes last in snapshots
+		candle := res.Data[len(res.Data)-1]
+		if len(candle) < 5 {
+			return PriceTime{}, fmt.Errorf("unexpected candle data %s in response from %s", candle, source.url)
+		}
+		price, err := candle[4].Float64()
+		if err != nil {
+			return PriceTime{}, err
+		}
+		closeTime := time.Unix(0, res.Ts*int64(time.Millisecond))
+		now := time.Now()
+		if res.Ts == 0 || closeTime.After(now) {
+			closeTime = now
+		}
+		return PriceTime{price * multiplier, closeTime}, nil
+	}
+
+	source.subscriptionBytes = func(coinTickers map[string]Ticker) []byte {
+		args := make([]BitgetArg, 0, len(coinTickers))
+		for _, ticker := range coinTickers {
+			args = append(args, BitgetArg{
+				InstType: BITGET_INST_TYPE,
+				Channel:  BITGET_CHANNEL,
+				InstId:   ticker.InstId,
+			})
+		}
+		bytes, err := json.Marshal(BitgetSubscription{Op: "subscribe", Args: args})
+		if err != nil {
+			logrus.Warnf("Error marshalling Bitget subscription request %v, err: %s", coinTickers, err)
+		}
+		return bytes
+	}
+
+	// bitget expects a text "ping" at least every 30 seconds and answers "pong"
+	source.pingAlways = true
+	source.pingOp = ws.OpText
+	source.pingBytes = func() []byte {
+		return []byte("ping")
+	}
+
+	source.isPriceData = func(byteResponse []byte, op ws.OpCode) (bool, string) {
+		if op != ws.OpText {
+			return false, ""
+		}
+		res := BitgetPriceData{}
+		err := json.Unmarshal(byteResponse, &res)
+		isPrice := err == nil &&
+			res.Event == "" &&
+			len(res.Data) > 0 &&
+			res.Arg.Channel == BITGET_CHANNEL
+		if !isPrice {
+			return false, ""
+		}
+		return true, res.Arg.InstId
+	}
+	return source
+}
@@ -0,0 +1,145 @@
+package sources
+
+// see https://bybit-exchange.github.io/docs/v5/websocket/public/kline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	BYBIT_URL          = "wss://stream.bybit.com/v5/public/linear"
+	BYBIT_KLINE_PREFIX = "kline.1."
+	BYBIT_BTC_USDT     = "BTCUSDT"
+	BYBIT_ETH_USDT     = "ETHUSDT"
+	BYBIT_SOL_USDT     = "SOLUSDT"
+)
+
+type BybitRequest struct {
+	Op   string   `json:"op"`
+	Args []string `json:"args,omitempty"`
+}
+
+type BybitKlineData struct {
+	Topic string       `json:"topic"`
+	Type  string       `json:"type"`
+	Ts    int64        `json:"ts"`
+	Data  []BybitKline `json:"data"`
+}
+
+type BybitKline struct {
+	Start     int64  `json:"start"`
+	End       int64  `json:"end"`
+	Interval  string `json:"interval"`
+	Open      string `json:"open"`
+	Close     string `json:"close"`
+	High      string `json:"high"`
+	Low       string `json:"low"`
+	Volume    string `json:"volume"`
+	Turnover  string `json:"turnover"`
+	Confirm   bool   `json:"confirm"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type BybitResponse struct {
+	Success bool   `json:"success"`
+	RetMsg  string `json:"ret_msg"`
+	Op      string `json:"op"`
+}
+
+type bybitSourceFactory struct{}
+
+func init() {
+	RegisterWSFactory("bybit", func() WSSourceFactory {
+		return &bybitSourceFactory{}
+	})
+}
+
+func (bsf *bybitSourceFactory) NewWSSource(ctx context.Context, coinTickers map[string]Ticker, maxUseAge map[string]time.Duration, multipliers map[string]float64) *SourceData {
+	source := newBybitSource(BYBIT_URL, coinTickers, maxUseAge, multipliers)
+	source.start(ctx)
+	sourceData := SourceData{
+		Markets:      source.listMarkets(),
+		LatestPrices: source.latestPrices,
+		Urls:         []string{source.url},
+	}
+	return &sourceData
+}
+
+func newBybitSource(url string, coinTickers map[string]Ticker, maxUseAge map[string]time.Duration, multipliers map[string]float64) *GobwasSource {
+	source := NewGobwasSource()
+	source.url = url
+	source.shortUrl = url
+	source.coinTickers = coinTickers
+	source.markets = reverseInstrumentMap(coinTickers)
+	source.maxUseAge = maxUseAge
+	source.multipliers = multipliers
+	source.extractPrice = func(priceResponse []byte, multiplier float64) (PriceTime, error) {
+		res := BybitKlineData{}
+		err := json.Unmarshal(priceResponse, &res)
+		if err != nil {
+			return PriceTime{}, err
+		}
+		if len(res.Data) < 1 {
+			return PriceTime{}, fmt.Errorf("no kline data in response \"%s\" from %s", priceResponse, source.url)
+		}
+		kline := res.Data[len(res.Data)-1]
+		price, err := strconv.ParseFloat(kline.Close, 64)
+		if err != nil {
+			return PriceTime{}, err
+		}
+		closeTime := time.Unix(0, kline.Timestamp*int64(time.Millisecond))
+		now := time.Now()
+		if kline.Timestamp == 0 || closeTime.After(now) {
+			closeTime = now
+		}
+		return PriceTime{price * multiplier, closeTime}, nil
+	}
+
+	source.subscriptionBytes = func(coinTickers map[string]Ticker) []byte {
+		args := make([]string, 0, len(coinTickers))
+		for _, ticker := range coinTickers {
+			args = append(args, BYBIT_KLINE_PREFIX+ticker.InstId)
+		}
+		bytes, err := json.Marshal(BybitRequest{Op: "subscribe", Args: args})
+		if err != nil {
+			logrus.Warnf("Error marshalling Bybit subscription request %v, err: %s", coinTickers, err)
+		}
+		return bytes
+	}
+
+	// bybit drops connections without an application level ping every 20 seconds
+	source.pingAlways = true
+	source.pingOp = ws.OpText
+	source.pingBytes = func() []byte {
+		return []byte(`{"op":"ping"}`)
+	}
+	source.isPongData = func(byteResponse []byte, op ws.OpCode) bool {
+		if op == ws.OpPong {
+			return true
+		}
+		res := BybitResponse{}
+		err := json.Unmarshal(byteResponse, &res)
+		return err == nil && (res.Op == "pong" || res.RetMsg == "pong")
+	}
+
+	source.isPriceData = func(byteResponse []byte, op ws.OpCode) (bool, string) {
+		if op != ws.OpText {
+			return false, ""
+		}
+		res := BybitKlineData{}
+		err := json.Unmarshal(byteResponse, &res)
+		if err != nil || len(res.Data) == 0 || !strings.HasPrefix(res.Topic, BYBIT_KLINE_PREFIX) {
+			return false, ""
+		}
+		return true, strings.TrimPrefix(res.Topic, BYBIT_KLINE_PREFIX)
+	}
+	return source
+}
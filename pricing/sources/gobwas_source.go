@@ -5,7 +5,7 @@ Responsibilities: handles a web socket server to receive prices for markets. Mak
 
 Use the gobwas library for the web socket connection.
 
-Used by binance_source.go, okx_source.go, etc. These each implement aspects specific
+Used by binance_source.go, okx_source.go, bybit_source.go, etc. These each implement aspects specific
 to their particular exchange, such as the format of the ticker, subscription messages, pings and the data repsonses.
 */
 import (
@@ -52,7 +52,9 @@ type GobwasSource struct {
 	multipliers        map[string]float64
 	extractPrice       func([]byte, float64) (PriceTime, error)
 	subscriptionBytes  func(markets map[string]Ticker) []byte
+	subscriptionList   func(markets map[string]Ticker) [][]byte // optional, one subscription message per entry
 	pingAlways         bool
+	pingOp             ws.OpCode // ws.OpText for servers expecting an application level ping
 	pingBytes          func() []byte
 	pongBytes          func() []byte
 	isPriceData        func([]byte, ws.OpCode) (bool, string)
@@ -74,6 +76,7 @@ func NewGobwasSource() *GobwasSource {
 		dialer:            ws.Dialer{Timeout: 20 * time.Second},
 		latestPrices:      &sync.Map{},
 		subscriptionBytes: func(markets map[string]Ticker) []byte { return nil },
+		pingOp:            ws.OpPing,
 		pingBytes:         func() []byte { return nil },
 		pongBytes:         func() []byte { return nil },
 		isPriceData: func([]byte, ws.OpCode) (bool, string) {
@@ -145,19 +148,11 @@ func (gs *GobwasSource) reconnect(ctx context.Context, reason string) bool {
 		}
 		gs.conn = conn
 
-		// send subscription message to server
-		subscriptionBytes := gs.subscriptionBytes(gs.coinTickers)
-		if len(subscriptionBytes) != 0 {
-			err = gs.conn.SetWriteDeadline(time.Now().Add(IO_TIMEOUT))
-			if err != nil {
-				logrus.Warnf("error setting write deadline for %s: %s", gs.url, err.Error())
-				continue
-			}
-			err = wsutil.WriteClientMessage(gs.conn, ws.OpText, subscriptionBytes)
-			if err != nil {
-				logrus.Warnf("error subscribing to %s: %s", gs.url, err.Error())
-				continue
-			}
+		// send subscription messages to server
+		err = gs.subscribe()
+		if err != nil {
+			logrus.Warnf("error subscribing to %s: %s", gs.url, err.Error())
+			continue
 		}
 		logrus.Warnf("connected to %s", gs.url)
 		break
@@ -169,6 +164,27 @@ func (gs *GobwasSource) reconnect(ctx context.Context, reason string) bool {
 	return true
 }
 
+func (gs *GobwasSource) subscribe() error {
+	subscriptions := [][]byte{gs.subscriptionBytes(gs.coinTickers)}
+	if gs.subscriptionList != nil {
+		subscriptions = gs.subscriptionList(gs.coinTickers)
+	}
+	for _, subscriptionBytes := range subscriptions {
+		if len(subscriptionBytes) == 0 {
+			continue
+		}
+		err := gs.conn.SetWriteDeadline(time.Now().Add(IO_TIMEOUT))
+		if err != nil {
+			return err
+		}
+		err = wsutil.WriteClientMessage(gs.conn, ws.OpText, subscriptionBytes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Enters the connecting state if we are not already in it and
 // sufficient time has elapsed since the last connection attempt.
 // Returns true if we have entered the connecting state and false
@@ -249,7 +265,7 @@ func (gs *GobwasSource) handlePingsAndTimeouts(ctx context.Context) {
 
 		// check if we need to send a ping
 		if gs.pingAlways || elapsed > PING_INTERVAL {
-			gs.writeWSData(ctx, ws.OpPing, pingBytes)
+			gs.writeWSData(ctx, gs.pingOp, pingBytes)
 		}
 	}
 
@@ -0,0 +1,148 @@
+package sources
+
+// see https://hyperliquid.gitbook.io/hyperliquid-docs/for-developers/api/websocket/subscriptions
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	HYPERLIQUID_URL = "wss://api.hyperliquid.xyz/ws"
+	HL_BTC          = "BTC"
+	HL_ETH          = "ETH"
+	HL_SOL          = "SOL"
+)
+
+type HLSubscription struct {
+	Type     string `json:"type"`
+	Coin     string `json:"coin"`
+	Interval string `json:"interval"`
+}
+
+type HLRequest struct {
+	Method       string          `json:"method"`
+	Subscription *HLSubscription `json:"subscription,omitempty"`
+}
+
+type HLCandleData struct {
+	Channel string   `json:"channel"`
+	Data    HLCandle `json:"data"`
+}
+
+type HLCandle struct {
+	T  int64  `json:"t"` // open time
+	Tc int64  `json:"T"` // close time
+	S  string `json:"s"` // coin
+	I  string `json:"i"` // interval
+	O  string `json:"o"`
+	C  string `json:"c"`
+	H  string `json:"h"`
+	L  string `json:"l"`
+	V  string `json:"v"`
+	N  int64  `json:"n"`
+}
+
+type HLChannel struct {
+	Channel string `json:"channel"`
+}
+
+type hyperliquidSourceFactory struct{}
+
+func init() {
+	RegisterWSFactory("hyperliquid", func() WSSourceFactory {
+		return &hyperliquidSourceFactory{}
+	})
+}
+
+func (hsf *hyperliquidSourceFactory) NewWSSource(ctx context.Context, coinTickers map[string]Ticker, maxUseAge map[string]time.Duration, multipliers map[string]float64) *SourceData {
+	source := newHyperliquidSource(HYPERLIQUID_URL, coinTickers, maxUseAge, multipliers)
+	source.start(ctx)
+	sourceData := SourceData{
+		Markets:      source.listMarkets(),
+		LatestPrices: source.latestPrices,
+		Urls:         []string{source.url},
+	}
+	return &sourceData
+}
+
+func newHyperliquidSource(url string, coinTickers map[string]Ticker, maxUseAge map[string]time.Duration, multipliers map[string]float64) *GobwasSource {
+	source := NewGobwasSource()
+	source.url = url
+	source.shortUrl = url
+	source.coinTickers = coinTickers
+	source.markets = reverseInstrumentMap(coinTickers)
+	source.maxUseAge = maxUseAge
+	source.multipliers = multipliers
+	source.extractPrice = func(priceResponse []byte, multiplier float64) (PriceTime, error) {
+		res := HLCandleData{}
+		err := json.Unmarshal(priceResponse, &res)
+		if err != nil {
+			return PriceTime{}, err
+		}
+		price, err := strconv.ParseFloat(res.Data.C, 64)
+		if err != nil {
+			return PriceTime{}, err
+		}
+		// the close time of the open candle is in the future
+		closeTime := time.Unix(0, res.Data.Tc*int64(time.Millisecond))
+		now := time.Now()
+		if closeTime.After(now) {
+			closeTime = now
+		}
+		return PriceTime{price * multiplier, closeTime}, nil
+	}
+
+	// hyperliquid takes a single coin per subscription
+	source.subscriptionList = func(coinTickers map[string]Ticker) [][]byte {
+		subscriptions := make([][]byte, 0, len(coinTickers))
+		for _, ticker := range coinTickers {
+			bytes, err := json.Marshal(HLRequest{
+				Method: "subscribe",
+				Subscription: &HLSubscription{
+					Type:     "candle",
+					Coin:     ticker.InstId,
+					Interval: "1m",
+				},
+			})
+			if err != nil {
+				logrus.Warnf("Error marshalling Hyperliquid subscription request %v, err: %s", ticker, err)
+				continue
+			}
+			subscriptions = append(subscriptions, bytes)
+		}
+		return subscriptions
+	}
+
+	// hyperliquid closes connections idle for 60 seconds
+	source.pingOp = ws.OpText
+	source.pingBytes = func() []byte {
+		return []byte(`{"method":"ping"}`)
+	}
+	source.isPongData = func(byteResponse []byte, op ws.OpCode) bool {
+		if op == ws.OpPong {
+			return true
+		}
+		res := HLChannel{}
+		err := json.Unmarshal(byteResponse, &res)
+		return err == nil && res.Channel == "pong"
+	}
+
+	source.isPriceData = func(byteResponse []byte, op ws.OpCode) (bool, string) {
+		if op != ws.OpText {
+			return false, ""
+		}
+		res := HLCandleData{}
+		err := json.Unmarshal(byteResponse, &res)
+		if err != nil || res.Channel != "candle" || res.Data.S == "" {
+			return false, ""
+		}
+		return true, res.Data.S
+	}
+	return source
+}
@@ -12,7 +12,7 @@ type RestSourceFactory interface {
 }
 
 // interface containing a single func for creating new web socket sources
-// (binance, okx, coinbase, kraken)
+// (binance, okx, coinbase, kraken, bybit, bitget, hyperliquid)
 type WSSourceFactory interface {
 	NewWSSource(ctx context.Context, coinTickers map[string]Ticker, maxDelays map[string]time.Duration, multipliers map[string]float64) *SourceData
 }
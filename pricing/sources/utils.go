@@ -17,11 +17,12 @@ const (
 )
 
 type Ticker struct {
-	ExchangeId   string `yaml:"exchange_id"`
-	InstId       string `yaml:"inst_id"`
-	Network      string `yaml:"network"`
-	MaxUseAge    string `yaml:"max_use_age"`
-	ReconnectAge string `yaml:"reconnect_age"`
+	ExchangeId   string  `yaml:"exchange_id"`
+	InstId       string  `yaml:"inst_id"`
+	Network      string  `yaml:"network"`
+	MaxUseAge    string  `yaml:"max_use_age"`
+	ReconnectAge string  `yaml:"reconnect_age"`
+	Weight       float64 `yaml:"weight"`
 }
 
 type PriceTime struct {
@@ -0,0 +1,243 @@
+package sources
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/sirupsen/logrus"
+)
+
+// fake exchange replaying recorded frames once the client subscribed,
+// pings are answered with the recorded pong frame
+type replayServer struct {
+	server        *httptest.Server
+	frames        [][]byte
+	numSubs       int
+	ping          string
+	pong          []byte
+	subscriptions chan string
+}
+
+func newReplayServer(t *testing.T, framesFile string, numSubs int, ping string, pong string) *replayServer {
+	file, err := os.Open(framesFile)
+	if err != nil {
+		t.Fatalf("can't open %s: %v", framesFile, err)
+	}
+	defer file.Close()
+
+	rs := &replayServer{
+		numSubs:       numSubs,
+		ping:          ping,
+		pong:          []byte(pong),
+		subscriptions: make(chan string, numSubs),
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			rs.frames = append(rs.frames, []byte(line))
+		}
+	}
+	rs.server = httptest.NewServer(http.HandlerFunc(rs.handle))
+	return rs
+}
+
+func (rs *replayServer) url() string {
+	return "ws" + strings.TrimPrefix(rs.server.URL, "http")
+}
+
+func (rs *replayServer) handle(w http.ResponseWriter, r *http.Request) {
+	conn, _, _, err := ws.UpgradeHTTP(r, w)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for i := 0; i < rs.numSubs; i++ {
+		msg, _, err := wsutil.ReadClientData(conn)
+		if err != nil {
+			return
+		}
+		rs.subscriptions <- string(msg)
+	}
+	for _, frame := range rs.frames {
+		if err := wsutil.WriteServerText(conn, frame); err != nil {
+			return
+		}
+	}
+	for {
+		msg, _, err := wsutil.ReadClientData(conn)
+		if err != nil {
+			return
+		}
+		if string(msg) == rs.ping {
+			if err := wsutil.WriteServerText(conn, rs.pong); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (rs *replayServer) close() {
+	rs.server.CloseClientConnections()
+	rs.server.Close()
+}
+
+func replayTickers(instIds map[string]string) (map[string]Ticker, map[string]time.Duration, map[string]float64) {
+	tickers := make(map[string]Ticker, len(instIds))
+	maxUseAge := make(map[string]time.Duration, len(instIds))
+	multipliers := make(map[string]float64, len(instIds))
+	for market, instId := range instIds {
+		tickers[market] = Ticker{InstId: instId}
+		maxUseAge[market] = time.Minute
+		multipliers[market] = 1.0
+	}
+	return tickers, maxUseAge, multipliers
+}
+
+func waitForPrices(t *testing.T, source *GobwasSource, expected map[string]float64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		matched := true
+		for market, price := range expected {
+			if load(market, source.latestPrices).price != price {
+				matched = false
+			}
+		}
+		if matched {
+			return
+		}
+		if time.Now().After(deadline) {
+			for market, price := range expected {
+				t.Errorf("Expected %s price %v but got %v", market, price, load(market, source.latestPrices).price)
+			}
+			t.FailNow()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitForPong(t *testing.T, ctx context.Context, source *GobwasSource) {
+	source.writeWSData(ctx, source.pingOp, source.pingBytes())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		source.muLastPong.Lock()
+		received := !source.lastPongReceived.IsZero()
+		source.muLastPong.Unlock()
+		if received {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected pong from %s", source.url)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func replaySubscriptions(t *testing.T, rs *replayServer) []string {
+	subscriptions := make([]string, 0, rs.numSubs)
+	for i := 0; i < rs.numSubs; i++ {
+		select {
+		case msg := <-rs.subscriptions:
+			subscriptions = append(subscriptions, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %d subscriptions but got %d", rs.numSubs, i)
+		}
+	}
+	return subscriptions
+}
+
+func TestBybitReplay(t *testing.T) {
+	logrus.Warn(".......TestBybitReplay")
+	rs := newReplayServer(t, "testdata/bybit_frames.jsonl", 1,
+		`{"op":"ping"}`, `{"success":true,"ret_msg":"pong","conn_id":"cjgm3tv1ha8rkqsl7a6g-4yl2","req_id":"","op":"ping"}`)
+	defer rs.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tickers, maxUseAge, multipliers := replayTickers(map[string]string{"BTC-USD": BYBIT_BTC_USDT, "ETH-USD": BYBIT_ETH_USDT})
+	source := newBybitSource(rs.url(), tickers, maxUseAge, multipliers)
+	source.start(ctx)
+
+	request := BybitRequest{}
+	if err := json.Unmarshal([]byte(replaySubscriptions(t, rs)[0]), &request); err != nil {
+		t.Fatalf("Unexpected subscription error %v", err)
+	}
+	if request.Op != "subscribe" || len(request.Args) != 2 {
+		t.Fatalf("Unexpected subscription %v", request)
+	}
+	for _, arg := range request.Args {
+		if arg != "kline.1.BTCUSDT" && arg != "kline.1.ETHUSDT" {
+			t.Fatalf("Unexpected subscription topic %s", arg)
+		}
+	}
+
+	waitForPrices(t, source, map[string]float64{"BTC-USD": 36720.4, "ETH-USD": 2118.95})
+	waitForPong(t, ctx, source)
+}
+
+func TestBitgetReplay(t *testing.T) {
+	logrus.Warn(".......TestBitgetReplay")
+	rs := newReplayServer(t, "testdata/bitget_frames.jsonl", 1, "ping", "pong")
+	defer rs.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tickers, maxUseAge, multipliers := replayTickers(map[string]string{"BTC-USD": BITGET_BTC_USDT, "ETH-USD": BITGET_ETH_USDT})
+	source := newBitgetSource(rs.url(), tickers, maxUseAge, multipliers)
+	source.start(ctx)
+
+	request := BitgetSubscription{}
+	if err := json.Unmarshal([]byte(replaySubscriptions(t, rs)[0]), &request); err != nil {
+		t.Fatalf("Unexpected subscription error %v", err)
+	}
+	if request.Op != "subscribe" || len(request.Args) != 2 {
+		t.Fatalf("Unexpected subscription %v", request)
+	}
+	for _, arg := range request.Args {
+		if arg.InstType != BITGET_INST_TYPE || arg.Channel != BITGET_CHANNEL {
+			t.Fatalf("Unexpected subscription arg %v", arg)
+		}
+	}
+
+	waitForPrices(t, source, map[string]float64{"BTC-USD": 36719.9, "ETH-USD": 2118.88})
+	waitForPong(t, ctx, source)
+}
+
+func TestHyperliquidReplay(t *testing.T) {
+	logrus.Warn(".......TestHyperliquidReplay")
+	rs := newReplayServer(t, "testdata/hyperliquid_frames.jsonl", 2, `{"method":"ping"}`, `{"channel":"pong"}`)
+	defer rs.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tickers, maxUseAge, multipliers := replayTickers(map[string]string{"BTC-USD": HL_BTC, "ETH-USD": HL_ETH})
+	source := newHyperliquidSource(rs.url(), tickers, maxUseAge, multipliers)
+	source.start(ctx)
+
+	coins := make(map[string]bool)
+	for _, msg := range replaySubscriptions(t, rs) {
+		request := HLRequest{}
+		if err := json.Unmarshal([]byte(msg), &request); err != nil {
+			t.Fatalf("Unexpected subscription error %v", err)
+		}
+		if request.Method != "subscribe" || request.Subscription == nil || request.Subscription.Type != "candle" {
+			t.Fatalf("Unexpected subscription %s", msg)
+		}
+		coins[request.Subscription.Coin] = true
+	}
+	if !coins[HL_BTC] || !coins[HL_ETH] {
+		t.Fatalf("Expected subscriptions for BTC and ETH but got %v", coins)
+	}
+
+	waitForPrices(t, source, map[string]float64{"BTC-USD": 36718.0, "ETH-USD": 2118.7})
+	waitForPong(t, ctx, source)
+}
@@ -35,6 +35,17 @@ type EthHandlerCfg struct {
 	ClaimerPk            string   `yaml:"claimer_pk" env-default:""`
 	Vaults               []string `yaml:"vaults"`
 	Decimals             int32    `yaml:"decimals"`
+
+	WithdrawalPolicy WithdrawalPolicyCfg `yaml:"withdrawal_policy"`
+}
+
+// Withdrawal limits of the chain in token units, a zero disables the check.
+// A withdrawal breaching one of them is held for a manual review.
+type WithdrawalPolicyCfg struct {
+	Rolling24hCap      string `yaml:"rolling_24h_cap" env-default:"4000000"`
+	WalletDailyCap     string `yaml:"wallet_daily_cap" env-default:"0"`
+	ApprovalThreshold  string `yaml:"approval_threshold" env-default:"0"`
+	NewAccountCooldown string `yaml:"new_account_cooldown" env-default:"0"` // seconds since the profile was created
 }
 
 type Config struct {
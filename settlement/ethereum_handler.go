@@ -50,6 +50,12 @@ var (
 	TWO        = big.NewInt(2)
 )
 
+// Chain access of the handler: an *ethclient.Client, a simulated backend in tests
+type EthClient interface {
+	bind.ContractBackend
+	ethereum.TransactionReader
+}
+
 type EthereumHandler struct {
 	deposit_address      common.Address
 	exchange_address     common.Address
@@ -57,7 +63,7 @@ type EthereumHandler struct {
 	vaults               []common.Address
 	providerUrl          string
 	pkStr                string
-	ethClient            *ethclient.Client
+	ethClient            EthClient
 	bfxInstance          *bfx.Bfx
 	privateKey           *ecdsa.PrivateKey
 	walletAddress        common.Address
@@ -79,6 +85,7 @@ type EthereumHandler struct {
 	claimYield           bool
 	exchangeId           string
 	chainId              uint
+	withdrawalPolicy     WithdrawalPolicy
 }
 
 func stripPrefix(input string, charsToRemove int) string {
@@ -274,6 +281,22 @@ func (eh *EthereumHandler) processDepositsAndStaking(ctx context.Context) {
 			err.Error())
 		return
 	}
+
+	reorged, err := eh.checkReorg(ctx, lastBlock, DEPOSIT_AND_STAKING_EVENT)
+	if err != nil {
+		logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("Settlement service, exchangeId=%s chain_id=%d error checking reorg: %s",
+			eh.exchangeId, eh.chainId, err.Error())
+		return
+	}
+	if reorged {
+		lastBlock, err = eh.apiModel.GetLastProcessedBlockNumber(ctx, eh.exchange_address.String(), eh.chainId, DEPOSIT_AND_STAKING_EVENT)
+		if err != nil {
+			logrus.Errorf("Settlement service, ethereumHandler.processDeposits, error reading last processed deposit block: %s",
+				err.Error())
+			return
+		}
+	}
+
 	fromBlock, toBlock, err := eh.getL1BlockNumbers(ctx, lastBlock)
 	if err != nil {
 		logrus.Errorf("Settlement service, error reading block numbers: %s", err.Error())
@@ -284,19 +307,35 @@ func (eh *EthereumHandler) processDepositsAndStaking(ctx context.Context) {
 	for fromBlock.Cmp(toBlock) != 1 {
 		logrus.Infof("ethereum_handler processing deposits in block range %v to %v", fromBlock, toBlock)
 
-		success := eh.processDepositEvents(ctx, fromBlock, toBlock)
+		// taken before the scan, if the range is reorged after it the next
+		// checkReorg finds the hash is not canonical anymore
+		toHash, err := eh.blockHash(ctx, toBlock)
+		if err != nil {
+			logrus.Errorf("Settlement service, error reading block hash: %s", err.Error())
+			return
+		}
+
+		ops := make([]string, 0)
+		success := eh.processDepositEvents(ctx, fromBlock, toBlock, &ops)
 		if !success {
 			logrus.Errorf("processDepositEvents failed")
 			return
 		}
 
-		success = eh.processStakeEvents(ctx, fromBlock, toBlock)
+		success = eh.processStakeEvents(ctx, fromBlock, toBlock, &ops)
 		if !success {
 			logrus.Errorf("processStakeEvents failed")
 			return
 		}
 
-		err = eh.apiModel.SetLastProcessedBlockNumber(ctx, toBlock, eh.exchange_address.String(), eh.chainId, DEPOSIT_AND_STAKING_EVENT)
+		err = eh.apiModel.SetProcessedBlock(ctx, &model.ProcessedBlock{
+			ContractAddress: eh.exchange_address.String(),
+			ChainId:         eh.chainId,
+			EventType:       DEPOSIT_AND_STAKING_EVENT,
+			BlockNumber:     toBlock.Uint64(),
+			BlockHash:       toHash.Hex(),
+			Ops:             ops,
+		})
 		if err != nil {
 			logrus.Errorf("Error setting last processed deposit block number: %s", err.Error())
 			return
@@ -550,20 +589,29 @@ type EventHandler func(eh *EthereumHandler, ctx context.Context, vLog types.Log,
 
 type BatchHandler func(eh *EthereumHandler, ctx context.Context, accumulator interface{}, endedEarly bool) (success bool)
 
-func (eh *EthereumHandler) processDepositEvents(ctx context.Context, fromBlock *big.Int, toBlock *big.Int) (success bool) {
+// The ids of the deposits and stakes found are appended to ops
+func (eh *EthereumHandler) processDepositEvents(ctx context.Context, fromBlock *big.Int, toBlock *big.Int, ops *[]string) (success bool) {
+	return eh.scanDepositEvents(ctx, fromBlock, toBlock, depositHandler, ops)
+}
+
+func (eh *EthereumHandler) processStakeEvents(ctx context.Context, fromBlock *big.Int, toBlock *big.Int, ops *[]string) (success bool) {
+	return eh.scanStakeEvents(ctx, fromBlock, toBlock, stakeHandler, ops)
+}
+
+func (eh *EthereumHandler) scanDepositEvents(ctx context.Context, fromBlock *big.Int, toBlock *big.Int, handler EventHandler, ops *[]string) (success bool) {
 	addresses := make([]common.Address, 0, 2)
 	addresses = append(addresses, eh.exchange_address)
 	addresses = append(addresses, eh.deposit_address)
 	eventTypes := make(map[common.Hash]string, 2)
 	eventTypes[eh.rabbitDepositID] = "Deposit"
 	eventTypes[eh.proxyDepositID] = "Deposit"
-	return eh.processEvents(ctx, fromBlock, toBlock, addresses, eventTypes, depositHandler, nil, nil)
+	return eh.processEvents(ctx, fromBlock, toBlock, addresses, eventTypes, handler, ops, nil)
 }
 
-func (eh *EthereumHandler) processStakeEvents(ctx context.Context, fromBlock *big.Int, toBlock *big.Int) (success bool) {
+func (eh *EthereumHandler) scanStakeEvents(ctx context.Context, fromBlock *big.Int, toBlock *big.Int, handler EventHandler, ops *[]string) (success bool) {
 	eventTypes := make(map[common.Hash]string, 1)
 	eventTypes[eh.vaultStakeID] = "Stake"
-	return eh.processEvents(ctx, fromBlock, toBlock, eh.vaults, eventTypes, stakeHandler, nil, nil)
+	return eh.processEvents(ctx, fromBlock, toBlock, eh.vaults, eventTypes, handler, ops, nil)
 }
 
 func (eh *EthereumHandler) ProcessYieldEvents(ctx context.Context, fromBlock *big.Int, toBlock *big.Int) (success bool) {
@@ -703,15 +751,30 @@ func (eh *EthereumHandler) processEvents(ctx context.Context, fromBlock *big.Int
 	return
 }
 
-func depositHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, values []interface{}, accumulator interface{}) (newAccumulator interface{}, keepGoing bool) {
+// appends the id of the deposit or stake to the ops accumulator
+func recordOp(accumulator interface{}, id string) {
+	if ops, ok := accumulator.(*[]string); ok && ops != nil {
+		*ops = append(*ops, id)
+	}
+}
 
-	deposit_id := new(big.Int)
+// ignored is set for the rabbit contract deposit events of the deposit
+// contract address
+func (eh *EthereumHandler) depositLog(vLog types.Log) (deposit_id *big.Int, walletAddr common.Address, isFromDepositPool, ignored bool) {
+	deposit_id = new(big.Int)
 	deposit_id.SetBytes(vLog.Topics[1].Bytes())
-	walletAddr := common.HexToAddress(vLog.Topics[2].String())
+	walletAddr = common.HexToAddress(vLog.Topics[2].String())
+	isFromDepositPool = vLog.Address == eh.deposit_address
+	ignored = walletAddr == eh.deposit_address && !isFromDepositPool
+	return
+}
+
+func depositHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, values []interface{}, accumulator interface{}) (newAccumulator interface{}, keepGoing bool) {
+
+	deposit_id, walletAddr, isFromDepositPool, ignored := eh.depositLog(vLog)
 	// for pooled deposits a single USDT transfer covers multiple user
 	// deposits, pooled deposits can only come from the deposit pool contract
 	isPooledDeposit := false
-	isFromDepositPool := vLog.Address == eh.deposit_address
 	if isFromDepositPool {
 		// we know this  deposit came from the pool contract, so we can
 		// decode the pool id from the event - if the poolId is zero then
@@ -721,16 +784,17 @@ func depositHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, va
 		isPooledDeposit = poolId.Cmp(ZERO) != 0
 	}
 	// ignore rabbit contract deposit events for the deposit contract address
-	if walletAddr == eh.deposit_address && !isFromDepositPool {
-		return nil, true
+	if ignored {
+		return accumulator, true
 	}
+	recordOp(accumulator, fmt.Sprintf("d_%d", deposit_id.Uint64()))
 
 	wallet := model.GetWalletStringInRabbitTntStandardFormat(walletAddr.String())
 
 	amount := tdecimal.TokenDecimalsToTDecimal(values[0].(*big.Int), eh.decimals)
 	if amount.LessThanOrEqual(decimal.Zero) {
 		logrus.Errorf("Wrong deposit amount %v found for wallet %s", amount, wallet)
-		return nil, true
+		return accumulator, true
 	}
 
 	profile, err := eh.apiModel.GetProfileByWalletForExchangeId(ctx, wallet, eh.exchangeId)
@@ -763,7 +827,7 @@ func depositHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, va
 			err.Error(),
 		)
 	}
-	return nil, true
+	return accumulator, true
 }
 
 func stakeHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, values []interface{}, accumulator interface{}) (newAccumulator interface{}, keepGoing bool) {
@@ -774,41 +838,42 @@ func stakeHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, valu
 	stake_id.SetBytes(vLog.Topics[1].Bytes())
 	stakerAddr := common.HexToAddress(vLog.Topics[2].String())
 	stakerWallet := model.GetWalletStringInRabbitTntStandardFormat(stakerAddr.String())
+	recordOp(accumulator, fmt.Sprintf("s_%d", stake_id.Uint64()))
 
 	amount := tdecimal.TokenDecimalsToTDecimal(values[0].(*big.Int), eh.decimals)
 	if amount.LessThanOrEqual(decimal.Zero) {
 		logrus.Errorf("Wrong unstake amount %v found for staker %s on vault %s", amount, stakerWallet, vaultWallet)
-		return nil, true
+		return accumulator, true
 	}
 
 	vaultProfile, err := eh.apiModel.GetProfileByWalletForExchangeId(ctx, vaultWallet, eh.exchangeId)
 	if err != nil {
 		logrus.Errorf("Error retrieving vault profile for stake %d wallet %s: %s", stake_id.Uint64(), vaultWallet, err.Error())
-		return nil, true
+		return accumulator, true
 	}
 	if vaultProfile == nil {
 		logrus.Errorf("Vault profile not found for stake %d wallet %s", stake_id.Uint64(), vaultWallet)
-		return nil, true
+		return accumulator, true
 	}
 	if vaultProfile.Type != model.PROFILE_TYPE_VAULT {
 		logrus.Errorf("Profile is not a vault, stake %d wallet %s", stake_id.Uint64(), vaultWallet)
-		return nil, true
+		return accumulator, true
 	}
 
 	stakerProfile, err := eh.apiModel.GetProfileByWalletForExchangeId(ctx, stakerWallet, eh.exchangeId)
 	if err != nil {
 		logrus.Errorf("Error retrieving staker profile for stake %d wallet %s: %s", stake_id.Uint64(), stakerWallet, err.Error())
-		return nil, true
+		return accumulator, true
 	}
 	if stakerProfile == nil {
 		logrus.Errorf("Staker profile not found for stake %d wallet %s", stake_id.Uint64(), stakerWallet)
-		return nil, true
+		return accumulator, true
 	}
 
 	vaultCache, err := eh.apiModel.InvalidateCache(ctx, vaultProfile.ProfileId)
 	if err != nil {
 		logrus.Errorf("Cache error for stake %d vault profile_id %d", stake_id.Uint64(), vaultProfile.ProfileId)
-		return nil, true
+		return accumulator, true
 	}
 
 	stake := model.Stake{
@@ -835,7 +900,7 @@ func stakeHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, valu
 			err.Error(),
 		)
 	}
-	return nil, true
+	return accumulator, true
 }
 
 func yieldHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, values []interface{}, accumulator interface{}) (newAccumulator interface{}, keepGoing bool) {
@@ -919,7 +984,8 @@ func (eh *EthereumHandler) getCurrentBlockNumber(ctx context.Context) (*big.Int,
 		logrus.Errorf("Error retrieving current block number: %s", err.Error())
 		return nil, fmt.Errorf("error retrieving current block number: %s", err.Error())
 	}
-	return header.Number, nil
+	// callers modify it, the header can be shared by the client
+	return new(big.Int).Set(header.Number), nil
 }
 
 // alternative code for calling the claimYield (or any other) function
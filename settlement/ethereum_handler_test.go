@@ -16,9 +16,11 @@ func TestYieldClaim(t *testing.T) {
 	logrus.Printf("TestYieldClaim")
 	ctx := context.Background()
 
+	// runs against the live RPC of the config, the simulated chain tests
+	// don't need one
 	config, err := ReadConfig()
 	if err != nil {
-		logrus.Fatal(err)
+		t.Skipf("no settlement config: %s", err.Error())
 	}
 
 	apiModel := &MockApiModel{}
@@ -54,9 +56,11 @@ func TestYieldDistribution(t *testing.T) {
 	logrus.Printf("TestYieldDistribution")
 	ctx := context.Background()
 
+	// runs against the live RPC of the config, the simulated chain tests
+	// don't need one
 	config, err := ReadConfig()
 	if err != nil {
-		logrus.Fatal(err)
+		t.Skipf("no settlement config: %s", err.Error())
 	}
 
 	apiModel := &MockApiModel{}
@@ -0,0 +1,652 @@
+package settlement
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+const (
+	FAKE_UNKNOWN_PROFILE_ID = 0
+
+	// balance operation type and statuses of the tarantool balance module
+	// without a model constant
+	fakeWithdrawalType  = "withdrawal"
+	fakeCanceledStatus  = "canceled"
+	fakeClaimableStatus = "claimable"
+	fakeCheckedReason   = "checked"
+	fakeBlockNumNever   = 1000000000000000
+)
+
+// withdrawal let through by the withdrawal policy
+type fakeWithdrawalVolume struct {
+	exchangeId string
+	chainId    uint
+	profileId  uint
+	amount     decimal.Decimal
+	at         time.Time
+}
+
+// In-memory IApiModel for tests. Unlike MockApiModel it keeps the profiles,
+// balances, balance operations and processed blocks, and follows the rules
+// of the tarantool balance module: a deposit or stake id is credited once
+// (again only after a reorg reversed it), withdrawals complete by id,
+// unknown wallets get an unknown deposit and only the withdrawals let through
+// by the withdrawal policy count in the withdrawal usage.
+type FakeApiModel struct {
+	mu sync.Mutex
+
+	suspended     bool
+	nextProfileId uint
+	profiles      map[uint]*model.Profile
+	balances      map[uint]decimal.Decimal
+	// by id
+	ops        map[string]*model.BalanceOps
+	lastBlocks map[string]*big.Int
+	// newest first
+	blocks    map[string][]*model.ProcessedBlock
+	contracts map[string]*model.ContractMap
+	yields    []model.Yield
+	notified  map[uint]int
+	volumes   []fakeWithdrawalVolume
+	// withdrawals whose admit or hold fails
+	failChecks map[string]bool
+}
+
+func NewFakeApiModel() *FakeApiModel {
+	return &FakeApiModel{
+		nextProfileId: 1,
+		profiles:      make(map[uint]*model.Profile),
+		balances:      make(map[uint]decimal.Decimal),
+		ops:           make(map[string]*model.BalanceOps),
+		lastBlocks:    make(map[string]*big.Int),
+		blocks:        make(map[string][]*model.ProcessedBlock),
+		contracts:     make(map[string]*model.ContractMap),
+		notified:      make(map[uint]int),
+		failChecks:    make(map[string]bool),
+	}
+}
+
+func processedKey(forContract string, chainId uint, eventType string) string {
+	return fmt.Sprintf("%s:%d:%s", strings.ToLower(forContract), chainId, strings.ToLower(eventType))
+}
+
+func (m *FakeApiModel) AddProfile(wallet, profileType, exchangeId string) *model.Profile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	profile := &model.Profile{
+		ProfileId:  m.nextProfileId,
+		Type:       profileType,
+		Status:     "active",
+		Wallet:     model.GetWalletStringInRabbitTntStandardFormat(wallet),
+		ExchangeId: exchangeId,
+	}
+	m.profiles[profile.ProfileId] = profile
+	m.balances[profile.ProfileId] = decimal.Zero
+	m.nextProfileId++
+	return profile
+}
+
+// AddPendingDeposit adds the deposit the front end creates before the
+// deposit id is known
+func (m *FakeApiModel) AddPendingDeposit(id string, profileId uint, txhash string, amount decimal.Decimal, exchangeId string, chainId uint) *model.BalanceOps {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op := &model.BalanceOps{
+		OpsId:      id,
+		Status:     model.BALANCE_OPS_STATUS_PENDING,
+		Txhash:     txhash,
+		ProfileId:  profileId,
+		Type:       model.BALANCE_OPS_TYPE_DEPOSIT,
+		Amount:     *tdecimal.NewDecimal(amount),
+		ExchangeId: exchangeId,
+		ChainId:    chainId,
+	}
+	m.ops[id] = op
+	return op
+}
+
+// AddWithdrawal adds a withdrawal of the profile waiting for its receipt,
+// the amount is taken from the balance
+func (m *FakeApiModel) AddWithdrawal(id string, profileId uint, amount decimal.Decimal, exchangeId string, chainId uint, contractAddress string) *model.BalanceOps {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op := &model.BalanceOps{
+		OpsId:           id,
+		Status:          fakeClaimableStatus,
+		ProfileId:       profileId,
+		Type:            fakeWithdrawalType,
+		Id2:             id,
+		Amount:          *tdecimal.NewDecimal(amount),
+		ExchangeId:      exchangeId,
+		ChainId:         chainId,
+		ContractAddress: strings.ToLower(contractAddress),
+	}
+	m.ops[id] = op
+	m.balances[profileId] = m.balances[profileId].Sub(amount)
+	return op
+}
+
+// AddPendingWithdrawal adds a new withdrawal of the profile the withdrawal
+// policy didn't check yet, the amount is taken from the balance
+func (m *FakeApiModel) AddPendingWithdrawal(id string, profileId uint, amount decimal.Decimal, exchangeId string, chainId uint, contractAddress string) *model.BalanceOps {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op := &model.BalanceOps{
+		OpsId:           id,
+		Status:          model.BALANCE_OPS_STATUS_PENDING,
+		ProfileId:       profileId,
+		Type:            fakeWithdrawalType,
+		Id2:             id,
+		Amount:          *tdecimal.NewDecimal(amount),
+		Timestamp:       time.Now().UnixMicro(),
+		ExchangeId:      exchangeId,
+		ChainId:         chainId,
+		ContractAddress: strings.ToLower(contractAddress),
+	}
+	m.ops[id] = op
+	m.balances[profileId] = m.balances[profileId].Sub(amount)
+	return op
+}
+
+// AddWithdrawalVolume adds the volume of a withdrawal let through at the time
+func (m *FakeApiModel) AddWithdrawalVolume(exchangeId string, chainId uint, profileId uint, amount decimal.Decimal, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.volumes = append(m.volumes, fakeWithdrawalVolume{exchangeId, chainId, profileId, amount, at})
+}
+
+// ReviewWithdrawal approves or rejects a withdrawal in review like the admin
+// endpoint does
+func (m *FakeApiModel) ReviewWithdrawal(id string, approve bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, ok := m.ops[id]
+	if !ok || op.Type != fakeWithdrawalType || op.Status != model.BALANCE_OPS_STATUS_REVIEW {
+		return fmt.Errorf("NO_WITHDRAWAL_IN_REVIEW")
+	}
+	if approve {
+		op.Status = model.BALANCE_OPS_STATUS_PENDING
+		op.Reason = "approved"
+		op.DueBlock = 0
+		m.volumes = append(m.volumes, fakeWithdrawalVolume{op.ExchangeId, op.ChainId, op.ProfileId, op.Amount.Decimal, time.Now()})
+	} else {
+		op.Status = fakeCanceledStatus
+		op.Reason = "rejected"
+		m.balances[op.ProfileId] = m.balances[op.ProfileId].Add(op.Amount.Decimal)
+	}
+	m.notified[op.ProfileId]++
+	return nil
+}
+
+// FailWithdrawalCheck makes the admit and hold of the withdrawal fail until
+// it's called again with fail false
+func (m *FakeApiModel) FailWithdrawalCheck(id string, fail bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failChecks[id] = fail
+}
+
+func (m *FakeApiModel) Balance(profileId uint) decimal.Decimal {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.balances[profileId]
+}
+
+// Op returns a copy of the balance operation with the id
+func (m *FakeApiModel) Op(id string) *model.BalanceOps {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, ok := m.ops[id]
+	if !ok {
+		return nil
+	}
+	res := *op
+	return &res
+}
+
+func (m *FakeApiModel) Notified(profileId uint) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.notified[profileId]
+}
+
+func (m *FakeApiModel) ProcessedBlocks(forContract string, chainId uint, eventType string) []*model.ProcessedBlock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*model.ProcessedBlock{}, m.blocks[processedKey(forContract, chainId, eventType)]...)
+}
+
+func (m *FakeApiModel) opsInState(opType, status, exchangeId string, chainId uint) []*model.BalanceOps {
+	res := make([]*model.BalanceOps, 0)
+	for _, op := range m.ops {
+		if op.Type != opType || op.Status != status {
+			continue
+		}
+		if exchangeId != "" && (op.ExchangeId != exchangeId || op.ChainId != chainId) {
+			continue
+		}
+		res = append(res, op)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].OpsId < res[j].OpsId })
+	return res
+}
+
+func (m *FakeApiModel) GetWithdrawalsSuspended(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.suspended, nil
+}
+
+func (m *FakeApiModel) SuspendWithdrawals(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.suspended = true
+	return nil
+}
+
+func (m *FakeApiModel) GetPendingWithdrawals(ctx context.Context, exchangeId string, chainId uint) ([]*model.BalanceOps, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.opsInState(fakeWithdrawalType, model.BALANCE_OPS_STATUS_PENDING, exchangeId, chainId), nil
+}
+
+func (m *FakeApiModel) GetAllPendingWithdrawals(ctx context.Context) ([]*model.BalanceOps, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.opsInState(fakeWithdrawalType, model.BALANCE_OPS_STATUS_PENDING, "", 0), nil
+}
+
+func (m *FakeApiModel) AddContractMap(ctx context.Context, contract_address string, chain_id uint, exchange_id string) (*model.ContractMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	contract := &model.ContractMap{
+		ContractAddress: strings.ToLower(contract_address),
+		ChainId:         chain_id,
+		ExchangeId:      exchange_id,
+	}
+	m.contracts[exchange_id] = contract
+	return contract, nil
+}
+
+func (m *FakeApiModel) GetLastProcessedBlockNumber(ctx context.Context, forContract string, chainId uint, eventType string) (*big.Int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last, ok := m.lastBlocks[processedKey(forContract, chainId, eventType)]
+	if !ok {
+		return big.NewInt(0), nil
+	}
+	return new(big.Int).Set(last), nil
+}
+
+func (m *FakeApiModel) SetLastProcessedBlockNumber(ctx context.Context, lastProcessed *big.Int, forContract string, chainId uint, eventType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastBlocks[processedKey(forContract, chainId, eventType)] = new(big.Int).Set(lastProcessed)
+	return nil
+}
+
+func (m *FakeApiModel) SetProcessedBlock(ctx context.Context, block *model.ProcessedBlock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := processedKey(block.ContractAddress, block.ChainId, block.EventType)
+	m.lastBlocks[key] = new(big.Int).SetUint64(block.BlockNumber)
+	blocks := append([]*model.ProcessedBlock{block}, m.blocks[key]...)
+	if len(blocks) > REORG_CHECKPOINTS {
+		blocks = blocks[:REORG_CHECKPOINTS]
+	}
+	m.blocks[key] = blocks
+	return nil
+}
+
+func (m *FakeApiModel) GetProcessedBlocks(ctx context.Context, forContract string, chainId uint, eventType string, limit uint) ([]*model.ProcessedBlock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	blocks := m.blocks[processedKey(forContract, chainId, eventType)]
+	if uint(len(blocks)) > limit {
+		blocks = blocks[:limit]
+	}
+	return append([]*model.ProcessedBlock{}, blocks...), nil
+}
+
+func (m *FakeApiModel) RollbackProcessedBlocks(ctx context.Context, forkBlock uint64, vanished []string, forContract string, chainId uint, eventType string) ([]*model.BalanceOps, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := processedKey(forContract, chainId, eventType)
+	blocks := make([]*model.ProcessedBlock, 0, len(m.blocks[key]))
+	for _, block := range m.blocks[key] {
+		if block.BlockNumber <= forkBlock {
+			blocks = append(blocks, block)
+		}
+	}
+	m.blocks[key] = blocks
+	m.lastBlocks[key] = new(big.Int).SetUint64(forkBlock)
+
+	reversed := make([]*model.BalanceOps, 0)
+	for _, id := range vanished {
+		op, ok := m.ops[id]
+		if !ok {
+			continue
+		}
+		switch {
+		case op.Type == model.BALANCE_OPS_TYPE_DEPOSIT && op.Status == model.BALANCE_OPS_STATUS_SUCCESS:
+			m.balances[op.ProfileId] = m.balances[op.ProfileId].Sub(op.Amount.Decimal)
+		case op.Type == model.BALANCE_OPS_TYPE_DEPOSIT && op.Status == model.BALANCE_OPS_STATUS_UNKNOWN:
+		case op.Type == model.BALANCE_OPS_TYPE_STAKE && op.Status == model.BALANCE_OPS_STATUS_SUCCESS:
+		default:
+			continue
+		}
+		op.Status = model.BALANCE_OPS_STATUS_REORGED
+		res := *op
+		reversed = append(reversed, &res)
+	}
+	return reversed, nil
+}
+
+func (m *FakeApiModel) GetPendingDeposits(ctx context.Context, exchangeId string, chainId uint) ([]*model.BalanceOps, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.opsInState(model.BALANCE_OPS_TYPE_DEPOSIT, model.BALANCE_OPS_STATUS_PENDING, exchangeId, chainId), nil
+}
+
+func (m *FakeApiModel) GetPendingStakes(ctx context.Context, exchangeId string, chainId uint) ([]*model.BalanceOps, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.opsInState(model.BALANCE_OPS_TYPE_STAKE, model.BALANCE_OPS_STATUS_PENDING, exchangeId, chainId), nil
+}
+
+func (m *FakeApiModel) PendingDepositCanceled(ctx context.Context, opsId string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, ok := m.ops[opsId]
+	if !ok {
+		return false, fmt.Errorf("OP_NOT_FOUND")
+	}
+	if op.Type != model.BALANCE_OPS_TYPE_DEPOSIT && op.Type != model.BALANCE_OPS_TYPE_STAKE {
+		return false, fmt.Errorf("OP_IS_NOT_DEPOSIT_OR_STAKE")
+	}
+	if op.Status != model.BALANCE_OPS_STATUS_PENDING {
+		return false, fmt.Errorf("OP_NOT_PENDING")
+	}
+	op.Status = fakeCanceledStatus
+	return true, nil
+}
+
+func (m *FakeApiModel) UpdatePendingWithdrawals(ctx context.Context, currentBlock *big.Int, future_block *big.Int, for_contract string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, op := range m.ops {
+		if op.Type == fakeWithdrawalType && op.DueBlock == 0 && op.ContractAddress == strings.ToLower(for_contract) {
+			op.DueBlock = uint(future_block.Uint64())
+		}
+	}
+	return nil
+}
+
+func (m *FakeApiModel) GetProfileByWalletForExchangeId(ctx context.Context, wallet, exchange_id string) (*model.Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wallet = model.GetWalletStringInRabbitTntStandardFormat(wallet)
+	for _, profile := range m.profiles {
+		if profile.Wallet == wallet && profile.ExchangeId == exchange_id {
+			res := *profile
+			return &res, nil
+		}
+	}
+	return nil, fmt.Errorf(model.PROFILE_NOT_FOUND)
+}
+
+func (m *FakeApiModel) InvalidateCacheAndNotify(ctx context.Context, profileId uint) (*model.ProfileCache, error) {
+	m.mu.Lock()
+	m.notified[profileId]++
+	m.mu.Unlock()
+	return m.InvalidateCache(ctx, profileId)
+}
+
+func (m *FakeApiModel) InvalidateCache(ctx context.Context, profileId uint) (*model.ProfileCache, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	profile, ok := m.profiles[profileId]
+	if !ok {
+		return nil, fmt.Errorf(model.PROFILE_NOT_FOUND)
+	}
+	balance := tdecimal.NewDecimal(m.balances[profileId])
+	return &model.ProfileCache{
+		ProfileID:     profileId,
+		ProfileType:   &profile.Type,
+		Wallet:        &profile.Wallet,
+		Balance:       balance,
+		AccountEquity: balance,
+	}, nil
+}
+
+func (m *FakeApiModel) ProcessDeposit(ctx context.Context, profileId uint, deposit model.Deposit, isPoolDeposit bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !deposit.Amount.IsPositive() {
+		return fmt.Errorf("NEGATIVE_OR_ZERO_DEPOSIT_AMOUNT")
+	}
+
+	// a deposit reversed by a reorg is credited again
+	op, ok := m.ops[deposit.Id]
+	if ok && op.Status != model.BALANCE_OPS_STATUS_REORGED {
+		return fmt.Errorf("DUPLICATE ID update attempt for ops_id2=%s", deposit.Id)
+	}
+
+	// the deposit created by the front end before the deposit id is known
+	if !ok && !isPoolDeposit {
+		for _, pending := range m.ops {
+			if pending.Txhash == deposit.Tx && pending.Type == model.BALANCE_OPS_TYPE_DEPOSIT {
+				op = pending
+				delete(m.ops, pending.OpsId)
+				break
+			}
+		}
+	}
+	if op != nil && op.ProfileId != profileId {
+		return fmt.Errorf("INTEGRITY_ERROR_ID")
+	}
+	if op != nil && op.Status != model.BALANCE_OPS_STATUS_PENDING && op.Status != fakeCanceledStatus &&
+		op.Status != model.BALANCE_OPS_STATUS_REORGED {
+		return fmt.Errorf("INTEGRITY_ERROR_STATUS")
+	}
+
+	m.ops[deposit.Id] = &model.BalanceOps{
+		OpsId:           deposit.Id,
+		Status:          model.BALANCE_OPS_STATUS_SUCCESS,
+		Txhash:          deposit.Tx,
+		ProfileId:       profileId,
+		Wallet:          deposit.Wallet,
+		Type:            model.BALANCE_OPS_TYPE_DEPOSIT,
+		Id2:             deposit.Id,
+		Amount:          *deposit.Amount,
+		ExchangeId:      deposit.ExchangeId,
+		ChainId:         deposit.ChainId,
+		ContractAddress: strings.ToLower(deposit.ExchangeAddress),
+	}
+	m.balances[profileId] = m.balances[profileId].Add(deposit.Amount.Decimal)
+	return nil
+}
+
+func (m *FakeApiModel) ProcessStake(ctx context.Context, stakerProfileId uint, stake model.Stake, fromBalance bool, exchange_id string) (*model.BalanceOps, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.contracts[exchange_id]; !ok {
+		return nil, fmt.Errorf("NO_CONTRACT_MAP")
+	}
+	if !stake.Amount.IsPositive() {
+		return nil, fmt.Errorf("WRONG_STAKE_AMOUNT")
+	}
+
+	op, ok := m.ops[stake.Id]
+	if ok && op.Status == model.BALANCE_OPS_STATUS_REORGED {
+		op.Status = model.BALANCE_OPS_STATUS_SUCCESS
+		res := *op
+		return &res, nil
+	}
+	if ok {
+		return nil, fmt.Errorf("DUPLICATE_STAKE_ID")
+	}
+
+	if fromBalance {
+		m.balances[stakerProfileId] = m.balances[stakerProfileId].Sub(stake.Amount.Decimal)
+	}
+	m.balances[stake.VaultProfileId] = m.balances[stake.VaultProfileId].Add(stake.Amount.Decimal)
+	op = &model.BalanceOps{
+		OpsId:      stake.Id,
+		Status:     model.BALANCE_OPS_STATUS_SUCCESS,
+		Txhash:     stake.Tx,
+		ProfileId:  stakerProfileId,
+		Wallet:     stake.VaultWallet,
+		Type:       model.BALANCE_OPS_TYPE_STAKE,
+		Id2:        stake.Id,
+		Amount:     *stake.Amount,
+		ExchangeId: exchange_id,
+	}
+	m.ops[stake.Id] = op
+	res := *op
+	return &res, nil
+}
+
+func (m *FakeApiModel) ProcessDepositUnknown(ctx context.Context, deposit model.Deposit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !deposit.Amount.IsPositive() {
+		return fmt.Errorf("NEGATIVE_OR_ZERO_DEPOSIT_AMOUNT")
+	}
+	if _, ok := m.ops[deposit.Id]; ok {
+		return fmt.Errorf("DUPLICATE_ATTEMPT update attempt for ops_id2=%s", deposit.Id)
+	}
+
+	m.ops[deposit.Id] = &model.BalanceOps{
+		OpsId:           deposit.Id,
+		Status:          model.BALANCE_OPS_STATUS_UNKNOWN,
+		Txhash:          deposit.Tx,
+		ProfileId:       FAKE_UNKNOWN_PROFILE_ID,
+		Wallet:          deposit.Wallet,
+		Type:            model.BALANCE_OPS_TYPE_DEPOSIT,
+		Id2:             deposit.Id,
+		Amount:          *deposit.Amount,
+		ExchangeId:      deposit.ExchangeId,
+		ChainId:         deposit.ChainId,
+		ContractAddress: strings.ToLower(deposit.ExchangeAddress),
+	}
+	return nil
+}
+
+func (m *FakeApiModel) ProcessYield(ctx context.Context, yield model.Yield) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.yields = append(m.yields, yield)
+	return nil
+}
+
+func (m *FakeApiModel) CompletedWithdrawals(ctx context.Context, ids []*model.WithdrawalTxInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, info := range ids {
+		// unknown ids are only logged by tarantool
+		op, ok := m.ops[info.Id]
+		if !ok {
+			continue
+		}
+		op.Status = model.BALANCE_OPS_STATUS_SUCCESS
+		op.Txhash = info.TxHash
+	}
+	return nil
+}
+
+func (m *FakeApiModel) GetWithdrawalUsage(ctx context.Context, exchangeId string, chainId uint, profileId uint) (*model.WithdrawalUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	profile, ok := m.profiles[profileId]
+	if !ok {
+		return nil, fmt.Errorf(model.PROFILE_NOT_FOUND_ERROR)
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	chainVolume, profileVolume := decimal.Zero, decimal.Zero
+	for _, volume := range m.volumes {
+		if volume.exchangeId != exchangeId || volume.chainId != chainId || !volume.at.After(since) {
+			continue
+		}
+		chainVolume = chainVolume.Add(volume.amount)
+		if volume.profileId == profileId {
+			profileVolume = profileVolume.Add(volume.amount)
+		}
+	}
+
+	return &model.WithdrawalUsage{
+		ChainVolume:      *tdecimal.NewDecimal(chainVolume),
+		ProfileVolume:    *tdecimal.NewDecimal(profileVolume),
+		ProfileCreatedAt: profile.CreatedAt,
+	}, nil
+}
+
+func (m *FakeApiModel) uncheckedWithdrawal(bopsId string) (*model.BalanceOps, error) {
+	if m.failChecks[bopsId] {
+		return nil, fmt.Errorf("TIMEOUT")
+	}
+	op, ok := m.ops[bopsId]
+	if !ok || !isUncheckedWithdrawal(op) || op.Type != fakeWithdrawalType {
+		return nil, fmt.Errorf("NO_PENDING_WITHDRAWAL")
+	}
+	return op, nil
+}
+
+func (m *FakeApiModel) AdmitWithdrawal(ctx context.Context, bopsId string) (*model.BalanceOps, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, err := m.uncheckedWithdrawal(bopsId)
+	if err != nil {
+		return nil, err
+	}
+	op.Reason = fakeCheckedReason
+	m.volumes = append(m.volumes, fakeWithdrawalVolume{op.ExchangeId, op.ChainId, op.ProfileId, op.Amount.Decimal, time.Now()})
+	return op, nil
+}
+
+func (m *FakeApiModel) HoldWithdrawal(ctx context.Context, bopsId string, reason string) (*model.BalanceOps, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, err := m.uncheckedWithdrawal(bopsId)
+	if err != nil {
+		return nil, err
+	}
+	op.Status = model.BALANCE_OPS_STATUS_REVIEW
+	op.Reason = reason
+	op.DueBlock = fakeBlockNumNever
+	m.notified[op.ProfileId]++
+	return op, nil
+}
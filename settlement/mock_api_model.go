@@ -5,7 +5,6 @@ import (
 	"math/big"
 
 	"github.com/strips-finance/rabbit-dex-backend/model"
-	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
 )
 
 type MockApiModel struct {
@@ -40,6 +39,18 @@ func (m *MockApiModel) SetLastProcessedBlockNumber(ctx context.Context, lastProc
 	return nil
 }
 
+func (m *MockApiModel) SetProcessedBlock(ctx context.Context, block *model.ProcessedBlock) error {
+	return nil
+}
+
+func (m *MockApiModel) GetProcessedBlocks(ctx context.Context, forContract string, chainId uint, eventType string, limit uint) ([]*model.ProcessedBlock, error) {
+	return []*model.ProcessedBlock{}, nil
+}
+
+func (m *MockApiModel) RollbackProcessedBlocks(ctx context.Context, forkBlock uint64, vanished []string, forContract string, chainId uint, eventType string) ([]*model.BalanceOps, error) {
+	return []*model.BalanceOps{}, nil
+}
+
 func (m *MockApiModel) GetPendingDeposits(ctx context.Context, exchangeId string, chainId uint) ([]*model.BalanceOps, error) {
 	return []*model.BalanceOps{}, nil
 }
@@ -88,6 +99,14 @@ func (m *MockApiModel) ProcessStake(ctx context.Context, stakerProfileId uint, s
 	return nil, nil
 }
 
-func (m *MockApiModel) Rolling24hWds(ctx context.Context) (*tdecimal.Decimal, error) {
+func (m *MockApiModel) GetWithdrawalUsage(ctx context.Context, exchangeId string, chainId uint, profileId uint) (*model.WithdrawalUsage, error) {
+	return &model.WithdrawalUsage{}, nil
+}
+
+func (m *MockApiModel) AdmitWithdrawal(ctx context.Context, bopsId string) (*model.BalanceOps, error) {
+	return nil, nil
+}
+
+func (m *MockApiModel) HoldWithdrawal(ctx context.Context, bopsId string, reason string) (*model.BalanceOps, error) {
 	return nil, nil
 }
@@ -0,0 +1,211 @@
+package settlement
+
+/*
+Chain reorg detection for the deposits and staking scan. With every processed
+block range the hash of its last block is stored with the ids of the deposits
+and stakes found in the range. Before the next range is scanned the newest
+stored block is checked against the chain: the parent hash of the block after
+it must be the stored hash.
+
+On a mismatch the stored blocks are walked back to the newest one still on the
+chain (the fork point). The blocks after the fork are scanned again and the
+deposits and stakes of the orphaned ranges that are not found anymore are
+reversed in tarantool, the last processed block is set back to the fork point
+so the scan credits what the new branch includes.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/pkg/log"
+)
+
+// Stored block hashes per contract and event type, same as
+// PROCESSED_BLOCK_HASHES_LIMIT in tarantool
+const REORG_CHECKPOINTS = 256
+
+func (eh *EthereumHandler) blockHash(ctx context.Context, number *big.Int) (common.Hash, error) {
+	header, err := eh.ethClient.HeaderByNumber(ctx, number)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if header == nil {
+		return common.Hash{}, fmt.Errorf("block %s not found", number.String())
+	}
+	return header.Hash(), nil
+}
+
+func (eh *EthereumHandler) header(ctx context.Context, number uint64) (*types.Header, error) {
+	header, err := eh.ethClient.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header != nil && header.Number.Uint64() != number {
+		// some backends return the head for the numbers after it
+		return nil, nil
+	}
+	return header, nil
+}
+
+// isCanonical checks the stored hash against the parent hash of the next
+// block, or against the block itself when it's the head
+func (eh *EthereumHandler) isCanonical(ctx context.Context, block *model.ProcessedBlock) (bool, error) {
+	stored := common.HexToHash(block.BlockHash)
+
+	next, err := eh.header(ctx, block.BlockNumber+1)
+	if err != nil {
+		return false, err
+	}
+	if next != nil {
+		return next.ParentHash == stored, nil
+	}
+
+	header, err := eh.header(ctx, block.BlockNumber)
+	if err != nil {
+		return false, err
+	}
+	// the chain is shorter than the stored block
+	if header == nil {
+		return false, nil
+	}
+	return header.Hash() == stored, nil
+}
+
+func seenDepositHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, values []interface{}, accumulator interface{}) (newAccumulator interface{}, keepGoing bool) {
+	deposit_id, _, _, ignored := eh.depositLog(vLog)
+	if !ignored {
+		recordOp(accumulator, fmt.Sprintf("d_%d", deposit_id.Uint64()))
+	}
+	return accumulator, true
+}
+
+func seenStakeHandler(eh *EthereumHandler, ctx context.Context, vLog types.Log, values []interface{}, accumulator interface{}) (newAccumulator interface{}, keepGoing bool) {
+	stake_id := new(big.Int)
+	stake_id.SetBytes(vLog.Topics[1].Bytes())
+	recordOp(accumulator, fmt.Sprintf("s_%d", stake_id.Uint64()))
+	return accumulator, true
+}
+
+// collectOps returns the ids of the deposits and stakes in the blocks from
+// fromBlock to toBlock without processing them
+func (eh *EthereumHandler) collectOps(ctx context.Context, fromBlock, toBlock *big.Int) (map[string]bool, error) {
+	ops := make([]string, 0)
+	for fromBlock.Cmp(toBlock) != 1 {
+		endBlock := new(big.Int).Add(fromBlock, MAX_BLOCKS)
+		if endBlock.Cmp(toBlock) == 1 {
+			endBlock = toBlock
+		}
+		if !eh.scanDepositEvents(ctx, fromBlock, endBlock, seenDepositHandler, &ops) {
+			return nil, fmt.Errorf("error scanning deposits from block %s to block %s", fromBlock.String(), endBlock.String())
+		}
+		if !eh.scanStakeEvents(ctx, fromBlock, endBlock, seenStakeHandler, &ops) {
+			return nil, fmt.Errorf("error scanning stakes from block %s to block %s", fromBlock.String(), endBlock.String())
+		}
+		fromBlock = new(big.Int).Add(endBlock, ONE)
+	}
+
+	seen := make(map[string]bool, len(ops))
+	for _, id := range ops {
+		seen[id] = true
+	}
+	return seen, nil
+}
+
+// checkReorg rolls back the processed blocks to the fork point when the
+// newest stored block is not on the chain anymore, it returns true if the
+// last processed block was changed
+func (eh *EthereumHandler) checkReorg(ctx context.Context, lastBlock *big.Int, eventType string) (bool, error) {
+	address := eh.exchange_address.String()
+
+	stored, err := eh.apiModel.GetProcessedBlocks(ctx, address, eh.chainId, eventType, REORG_CHECKPOINTS)
+	if err != nil {
+		return false, fmt.Errorf("error reading processed blocks: %s", err.Error())
+	}
+
+	// blocks after the last processed one are left from a reset of it
+	blocks := make([]*model.ProcessedBlock, 0, len(stored))
+	for _, block := range stored {
+		if lastBlock == nil || block.BlockNumber <= lastBlock.Uint64() {
+			blocks = append(blocks, block)
+		}
+	}
+	if len(blocks) == 0 {
+		return false, nil
+	}
+
+	canonical, err := eh.isCanonical(ctx, blocks[0])
+	if err != nil {
+		return false, fmt.Errorf("error checking block %d: %s", blocks[0].BlockNumber, err.Error())
+	}
+	if canonical {
+		return false, nil
+	}
+
+	fork := -1
+	for i := 1; i < len(blocks); i++ {
+		canonical, err = eh.isCanonical(ctx, blocks[i])
+		if err != nil {
+			return false, fmt.Errorf("error checking block %d: %s", blocks[i].BlockNumber, err.Error())
+		}
+		if canonical {
+			fork = i
+			break
+		}
+	}
+	if fork < 0 {
+		logrus.WithField(log.AlertTag, log.AlertCrit).Errorf("exchangeId=%s chain_id=%d reorg deeper than the %d stored blocks, oldest stored block %d hash %s",
+			eh.exchangeId, eh.chainId, len(blocks), blocks[len(blocks)-1].BlockNumber, blocks[len(blocks)-1].BlockHash)
+		return false, fmt.Errorf("no fork point found in the %d stored blocks", len(blocks))
+	}
+	forkBlock := blocks[fork].BlockNumber
+
+	head, err := eh.getCurrentBlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	confirmed := new(big.Int).Sub(head, eh.blockConfirmations)
+	present, err := eh.collectOps(ctx, new(big.Int).SetUint64(forkBlock+1), confirmed)
+	if err != nil {
+		return false, err
+	}
+
+	vanished := make([]string, 0)
+	for _, block := range blocks[:fork] {
+		for _, id := range block.Ops {
+			if !present[id] {
+				vanished = append(vanished, id)
+			}
+		}
+	}
+
+	reversed, err := eh.apiModel.RollbackProcessedBlocks(ctx, forkBlock, vanished, address, eh.chainId, eventType)
+	if err != nil {
+		return false, fmt.Errorf("error rolling back to block %d: %s", forkBlock, err.Error())
+	}
+
+	logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("exchangeId=%s chain_id=%d reorg detected, rolled back from block %d to fork block %d, vanished=%v reversed=%d",
+		eh.exchangeId, eh.chainId, blocks[0].BlockNumber, forkBlock, vanished, len(reversed))
+
+	for _, op := range reversed {
+		logrus.Warnf("exchangeId=%s chain_id=%d reorged %s id=%s ops_id2=%s profile_id=%d amount=%s",
+			eh.exchangeId, eh.chainId, op.Type, op.OpsId, op.Id2, op.ProfileId, op.Amount.String())
+		_, err = eh.apiModel.InvalidateCacheAndNotify(ctx, op.ProfileId)
+		if err != nil {
+			logrus.Errorf("Cache error for reorged %s profile_id %d: %s", op.Id2, op.ProfileId, err.Error())
+		}
+	}
+
+	return true, nil
+}
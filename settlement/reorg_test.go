@@ -0,0 +1,78 @@
+package settlement
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+func TestReorgRollback(t *testing.T) {
+	ctx := context.Background()
+	s := newSimulatedSettlement(t)
+	trader := s.profile(wallet(1), model.PROFILE_TYPE_TRADER)
+
+	last := func() int64 {
+		block, err := s.api.GetLastProcessedBlockNumber(ctx, s.rabbit.Hex(), SIMULATED_CHAIN_ID, DEPOSIT_AND_STAKING_EVENT)
+		require.NoError(t, err)
+		return block.Int64()
+	}
+	newest := func() *model.ProcessedBlock {
+		return s.api.ProcessedBlocks(s.rabbit.Hex(), SIMULATED_CHAIN_ID, DEPOSIT_AND_STAKING_EVENT)[0]
+	}
+
+	// block 2 has d_1, processed up to block 2
+	s.deposit(1, wallet(1), 1)
+	s.mine(2)
+	s.eh.processDepositsAndStaking(ctx)
+	assert.Equal(t, int64(2), last())
+	assert.Equal(t, "1", s.api.Balance(trader.ProfileId).String())
+
+	// block 4 has d_2, processed up to block 4
+	nonce := s.nonce
+	s.deposit(2, wallet(1), 2)
+	s.mine(2)
+	s.eh.processDepositsAndStaking(ctx)
+	assert.Equal(t, int64(4), last())
+	assert.Equal(t, "3", s.api.Balance(trader.ProfileId).String())
+
+	// the blocks after 3 are replaced, d_2 is gone and d_3 is in the new block 4
+	s.fork(3)
+	s.nonce = nonce
+	d3 := s.deposit(3, wallet(1), 4)
+	s.mine(3)
+	s.eh.processDepositsAndStaking(ctx)
+
+	assert.Equal(t, model.BALANCE_OPS_STATUS_REORGED, s.api.Op("d_2").Status)
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, s.api.Op("d_1").Status)
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, s.api.Op("d_3").Status)
+	assert.Equal(t, "5", s.api.Balance(trader.ProfileId).String())
+	assert.Equal(t, int64(5), last())
+	assert.Equal(t, s.hash(5).Hex(), newest().BlockHash)
+	assert.Equal(t, []string{"d_3"}, newest().Ops)
+
+	// d_3 moves to a later block of another branch, nothing is reversed
+	s.fork(3)
+	s.mine(1)
+	assert.NoError(t, s.sim.SendTransaction(ctx, d3))
+	s.mine(3)
+	s.eh.processDepositsAndStaking(ctx)
+
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, s.api.Op("d_3").Status)
+	assert.Equal(t, "5", s.api.Balance(trader.ProfileId).String())
+	assert.Equal(t, int64(6), last())
+	assert.Equal(t, s.hash(6).Hex(), newest().BlockHash)
+
+	// d_2 is back in the chain and credited again
+	s.nonce = nonce + 1
+	s.deposit(2, wallet(1), 2)
+	s.mine(2)
+	s.eh.processDepositsAndStaking(ctx)
+
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, s.api.Op("d_2").Status)
+	assert.Equal(t, "7", s.api.Balance(trader.ProfileId).String())
+	assert.Equal(t, int64(8), last())
+}
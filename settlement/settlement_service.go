@@ -26,6 +26,9 @@ type IApiModel interface {
 	AddContractMap(ctx context.Context, contract_address string, chain_id uint, exchange_id string) (*model.ContractMap, error)
 	GetLastProcessedBlockNumber(ctx context.Context, forContract string, chainId uint, eventType string) (*big.Int, error)
 	SetLastProcessedBlockNumber(ctx context.Context, lastProcessed *big.Int, forContract string, chainId uint, eventType string) error
+	SetProcessedBlock(ctx context.Context, block *model.ProcessedBlock) error
+	GetProcessedBlocks(ctx context.Context, forContract string, chainId uint, eventType string, limit uint) ([]*model.ProcessedBlock, error)
+	RollbackProcessedBlocks(ctx context.Context, forkBlock uint64, vanished []string, forContract string, chainId uint, eventType string) ([]*model.BalanceOps, error)
 	GetPendingDeposits(ctx context.Context, exchangeId string, chainId uint) ([]*model.BalanceOps, error)
 	GetPendingStakes(ctx context.Context, exchangeId string, chainId uint) ([]*model.BalanceOps, error)
 	PendingDepositCanceled(ctx context.Context, opsId string) (bool, error)
@@ -38,7 +41,9 @@ type IApiModel interface {
 	ProcessDepositUnknown(ctx context.Context, deposit model.Deposit) error
 	ProcessYield(ctx context.Context, yield model.Yield) error
 	CompletedWithdrawals(ctx context.Context, ids []*model.WithdrawalTxInfo) error
-	Rolling24hWds(ctx context.Context) (*tdecimal.Decimal, error)
+	GetWithdrawalUsage(ctx context.Context, exchangeId string, chainId uint, profileId uint) (*model.WithdrawalUsage, error)
+	AdmitWithdrawal(ctx context.Context, bopsId string) (*model.BalanceOps, error)
+	HoldWithdrawal(ctx context.Context, bopsId string, reason string) (*model.BalanceOps, error)
 }
 
 type SettlementService struct {
@@ -138,6 +143,11 @@ func ConstructSettlementService(handlerCfgs map[string]EthHandlerCfg, apiModel I
 			processYieldInterval = time.Second * time.Duration(processYieldIntervalSeconds)
 		}
 
+		withdrawalPolicy, err := NewWithdrawalPolicy(config.WithdrawalPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("exchange_id=%s chain_id=%d %s", config.ExchangeId, config.ChainId, err.Error())
+		}
+
 		pkStr := config.ClaimerPk
 
 		exchange_address := strings.ToLower(config.ExchangeAddress)
@@ -171,6 +181,7 @@ func ConstructSettlementService(handlerCfgs map[string]EthHandlerCfg, apiModel I
 		}
 
 		ethereumHandler.settlementService = s
+		ethereumHandler.withdrawalPolicy = withdrawalPolicy
 
 		logrus.Infof("exchange_id=%s chain_id=%d ETHhandler created", config.ExchangeId, config.ChainId)
 	}
@@ -326,20 +337,9 @@ func (s *SettlementService) processPendingWithdrawals(ctx context.Context, handl
 		return
 	}
 
-	MAX_WITHDRAWAL_18 := new(big.Int)
-	MAX_WITHDRAWAL_18, ok := MAX_WITHDRAWAL_18.SetString("4000000000000000000000000", 10)
-	if !ok {
-		logrus.Error("CAN'T init MAX_WITHDRAWAL_18")
-		return
-	}
-
-	rolling24h, _ := s.apiModel.Rolling24hWds(ctx)
-	totalPending := big.NewInt(0)
-	totalPending.Add(totalPending, tdecimal.TDecimalToTokenDecimals(rolling24h, DECIMALS_18))
-
-	if totalPending.Cmp(MAX_WITHDRAWAL_18) == 1 {
-		s.SuspendWithdrawals(ctx)
-		logrus.Errorf("Settlement service, total pending check, suspending withdrawals: %s", totalPending.String())
+	// the withdrawals are scheduled only once all of them are checked, the
+	// ones checked in this pass keep their admit or hold until then
+	if !s.applyWithdrawalPolicy(ctx, handler, withdrawals) {
 		return
 	}
 	handler.updatePendingWithdrawals(ctx)
@@ -0,0 +1,349 @@
+package settlement
+
+/*
+Settlement harness on a simulated chain. go-ethereum v1.13 has no
+ethclient/simulated, the handler runs on backends.SimulatedBackend with a
+FakeApiModel.
+
+The bindings in the repo have the ABIs but no bytecode, the Rabbit,
+PoolDeposit and Vault contracts are stand-ins that emit their ABI events:
+the calldata is the event topics (the event ID first) followed by the data
+words, emitted with LOGn from a contract with n topics.
+*/
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+const (
+	SIMULATED_CHAIN_ID    = 1337
+	SIMULATED_EXCHANGE_ID = "rbx"
+	SIMULATED_DECIMALS    = 6
+)
+
+type simulatedChain struct {
+	t       *testing.T
+	sim     *backends.SimulatedBackend
+	key     *ecdsa.PrivateKey
+	address common.Address
+	nonce   uint64
+}
+
+func newSimulatedChain(t *testing.T) *simulatedChain {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	balance := new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil)
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{address: {Balance: balance}}, 8000000)
+	t.Cleanup(func() { sim.Close() })
+
+	return &simulatedChain{
+		t:       t,
+		sim:     sim,
+		key:     key,
+		address: address,
+	}
+}
+
+func (c *simulatedChain) send(to *common.Address, data []byte) *types.Transaction {
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{
+		Nonce:    c.nonce,
+		To:       to,
+		Gas:      200000,
+		GasPrice: big.NewInt(10000000000),
+		Data:     data,
+	}), types.NewEIP155Signer(big.NewInt(SIMULATED_CHAIN_ID)), c.key)
+	require.NoError(c.t, err)
+	require.NoError(c.t, c.sim.SendTransaction(context.Background(), tx))
+	c.nonce++
+	return tx
+}
+
+// deploys a contract emitting LOGn of its calldata, n topics then the data
+func (c *simulatedChain) deployEmitter(topics int) common.Address {
+	size := byte(32 * topics)
+	runtime := []byte{0x36, 0x60, 0x00, 0x60, 0x00, 0x37} // calldatacopy(0, 0, calldatasize)
+	for i := topics - 1; i >= 0; i-- {
+		runtime = append(runtime, 0x60, byte(32*i), 0x35) // calldataload(32*i)
+	}
+	runtime = append(runtime,
+		0x60, size, 0x36, 0x03, // calldatasize - 32*n
+		0x60, size, // offset 32*n
+		0xa0+byte(topics), // logn
+		0x00,
+	)
+	init := []byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}
+
+	address := crypto.CreateAddress(c.address, c.nonce)
+	c.send(nil, append(init, runtime...))
+	return address
+}
+
+func (c *simulatedChain) emit(contract common.Address, topics []common.Hash, data ...*big.Int) *types.Transaction {
+	calldata := make([]byte, 0, 32*(len(topics)+len(data)))
+	for _, topic := range topics {
+		calldata = append(calldata, topic.Bytes()...)
+	}
+	for _, word := range data {
+		calldata = append(calldata, common.BigToHash(word).Bytes()...)
+	}
+	return c.send(&contract, calldata)
+}
+
+func (c *simulatedChain) hash(number int64) common.Hash {
+	header, err := c.sim.HeaderByNumber(context.Background(), big.NewInt(number))
+	require.NoError(c.t, err)
+	return header.Hash()
+}
+
+func (c *simulatedChain) head() *big.Int {
+	header, err := c.sim.HeaderByNumber(context.Background(), nil)
+	require.NoError(c.t, err)
+	return header.Number
+}
+
+func (c *simulatedChain) fork(number int64) {
+	require.NoError(c.t, c.sim.Fork(context.Background(), c.hash(number)))
+}
+
+func (c *simulatedChain) mine(blocks int) {
+	for i := 0; i < blocks; i++ {
+		c.sim.Commit()
+	}
+}
+
+type simulatedSettlement struct {
+	*simulatedChain
+	api    *FakeApiModel
+	eh     *EthereumHandler
+	rabbit common.Address
+	pool   common.Address
+	vault  common.Address
+}
+
+// deploys the contracts in block 1 and connects a handler with 1 block
+// confirmation to them
+func newSimulatedSettlement(t *testing.T) *simulatedSettlement {
+	chain := newSimulatedChain(t)
+	s := &simulatedSettlement{
+		simulatedChain: chain,
+		api:            NewFakeApiModel(),
+		rabbit:         chain.deployEmitter(3),
+		pool:           chain.deployEmitter(4),
+		vault:          chain.deployEmitter(3),
+	}
+	chain.mine(1)
+
+	eh, err := NewEthereumHandler(s.rabbit.Hex(), s.pool.Hex(), SIMULATED_DECIMALS, []string{s.vault.Hex()}, "", "",
+		s.api, big.NewInt(10), big.NewInt(0), big.NewInt(1), 0, false, SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID)
+	require.NoError(t, err)
+	eh.ethClient = chain.sim
+	eh.settlementService = &SettlementService{apiModel: s.api}
+	s.eh = eh
+
+	_, err = s.api.AddContractMap(context.Background(), s.rabbit.Hex(), SIMULATED_CHAIN_ID, SIMULATED_EXCHANGE_ID)
+	require.NoError(t, err)
+
+	return s
+}
+
+func (s *simulatedSettlement) profile(wallet common.Address, profileType string) *model.Profile {
+	return s.api.AddProfile(wallet.Hex(), profileType, SIMULATED_EXCHANGE_ID)
+}
+
+func units(amount int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(amount), new(big.Int).Exp(big.NewInt(10), big.NewInt(SIMULATED_DECIMALS), nil))
+}
+
+func idTopic(id int64) common.Hash {
+	return common.BigToHash(big.NewInt(id))
+}
+
+func walletTopic(wallet common.Address) common.Hash {
+	return common.BytesToHash(wallet.Bytes())
+}
+
+func (s *simulatedSettlement) deposit(id int64, trader common.Address, amount int64) *types.Transaction {
+	return s.emit(s.rabbit, []common.Hash{s.eh.rabbitDepositID, idTopic(id), walletTopic(trader)}, units(amount))
+}
+
+func (s *simulatedSettlement) poolDeposit(id int64, trader common.Address, amount, poolId int64) *types.Transaction {
+	return s.emit(s.pool, []common.Hash{s.eh.proxyDepositID, idTopic(id), walletTopic(trader), idTopic(poolId)}, units(amount))
+}
+
+func (s *simulatedSettlement) stake(id int64, staker common.Address, amount int64) *types.Transaction {
+	return s.emit(s.vault, []common.Hash{s.eh.vaultStakeID, idTopic(id), walletTopic(staker)}, units(amount))
+}
+
+func (s *simulatedSettlement) withdrawalReceipt(id int64, trader common.Address, amount int64) *types.Transaction {
+	return s.emit(s.rabbit, []common.Hash{s.eh.withdrawalReceiptID, idTopic(id), walletTopic(trader)}, units(amount))
+}
+
+func wallet(n int64) common.Address {
+	return common.BigToAddress(big.NewInt(0x1000 + n))
+}
+
+func TestSimulatedDeposits(t *testing.T) {
+	ctx := context.Background()
+	s := newSimulatedSettlement(t)
+
+	trader := s.profile(wallet(1), model.PROFILE_TYPE_TRADER)
+
+	// created by the front end before the deposit id is known
+	tx := s.deposit(1, wallet(1), 5)
+	s.api.AddPendingDeposit("p_1", trader.ProfileId, tx.Hash().Hex(), decimal.NewFromInt(5), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID)
+	// pooled deposits share the tx
+	s.poolDeposit(2, wallet(1), 3, 7)
+	// individual deposit through the pool contract
+	s.poolDeposit(3, wallet(1), 2, 0)
+	// the rabbit event of the pool transfer
+	s.deposit(4, s.pool, 5)
+	// no profile for the wallet
+	s.deposit(5, wallet(2), 1)
+	s.mine(1)
+
+	ops := make([]string, 0)
+	assert.True(t, s.eh.processDepositEvents(ctx, big.NewInt(2), s.head(), &ops))
+	assert.Equal(t, []string{"d_1", "d_2", "d_3", "d_5"}, ops)
+
+	assert.Equal(t, "10", s.api.Balance(trader.ProfileId).String())
+	assert.Nil(t, s.api.Op("p_1"))
+	d1 := s.api.Op("d_1")
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, d1.Status)
+	assert.Equal(t, tx.Hash().Hex(), d1.Txhash)
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, s.api.Op("d_2").Status)
+	assert.Nil(t, s.api.Op("d_4"))
+	d5 := s.api.Op("d_5")
+	assert.Equal(t, model.BALANCE_OPS_STATUS_UNKNOWN, d5.Status)
+	assert.Equal(t, uint(FAKE_UNKNOWN_PROFILE_ID), d5.ProfileId)
+	assert.Equal(t, 3, s.api.Notified(trader.ProfileId))
+
+	// the range again credits nothing twice
+	assert.True(t, s.eh.processDepositEvents(ctx, big.NewInt(2), s.head(), nil))
+	assert.Equal(t, "10", s.api.Balance(trader.ProfileId).String())
+}
+
+func TestSimulatedStakes(t *testing.T) {
+	ctx := context.Background()
+	s := newSimulatedSettlement(t)
+
+	vault := s.profile(s.vault, model.PROFILE_TYPE_VAULT)
+	staker := s.profile(wallet(1), model.PROFILE_TYPE_TRADER)
+
+	s.stake(1, wallet(1), 4)
+	// no profile for the staker
+	s.stake(2, wallet(2), 1)
+	s.mine(1)
+
+	ops := make([]string, 0)
+	assert.True(t, s.eh.processStakeEvents(ctx, big.NewInt(2), s.head(), &ops))
+	assert.Equal(t, []string{"s_1", "s_2"}, ops)
+
+	s1 := s.api.Op("s_1")
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, s1.Status)
+	assert.Equal(t, model.BALANCE_OPS_TYPE_STAKE, s1.Type)
+	assert.Equal(t, staker.ProfileId, s1.ProfileId)
+	assert.Equal(t, "4", s.api.Balance(vault.ProfileId).String())
+	// the deposit into the vault is not taken from the staker balance
+	assert.Equal(t, "0", s.api.Balance(staker.ProfileId).String())
+	assert.Nil(t, s.api.Op("s_2"))
+	assert.Equal(t, 1, s.api.Notified(staker.ProfileId))
+	assert.Equal(t, 1, s.api.Notified(vault.ProfileId))
+
+	assert.True(t, s.eh.processStakeEvents(ctx, big.NewInt(2), s.head(), nil))
+	assert.Equal(t, "4", s.api.Balance(vault.ProfileId).String())
+
+	// a vault address whose profile is not a vault
+	s2 := newSimulatedSettlement(t)
+	s2.profile(s2.vault, model.PROFILE_TYPE_TRADER)
+	s2.profile(wallet(1), model.PROFILE_TYPE_TRADER)
+	s2.stake(1, wallet(1), 4)
+	s2.mine(1)
+	assert.True(t, s2.eh.processStakeEvents(ctx, big.NewInt(2), s2.head(), nil))
+	assert.Nil(t, s2.api.Op("s_1"))
+}
+
+func TestSimulatedDepositsAndStaking(t *testing.T) {
+	ctx := context.Background()
+	s := newSimulatedSettlement(t)
+
+	vault := s.profile(s.vault, model.PROFILE_TYPE_VAULT)
+	trader := s.profile(wallet(1), model.PROFILE_TYPE_TRADER)
+
+	s.deposit(1, wallet(1), 5)
+	s.stake(1, wallet(1), 2)
+	s.mine(1)
+	s.deposit(2, wallet(1), 1)
+	s.mine(2)
+
+	s.eh.processDepositsAndStaking(ctx)
+
+	// the head block is not confirmed
+	assert.Equal(t, "6", s.api.Balance(trader.ProfileId).String())
+	assert.Equal(t, "2", s.api.Balance(vault.ProfileId).String())
+	last, _ := s.api.GetLastProcessedBlockNumber(ctx, s.rabbit.Hex(), SIMULATED_CHAIN_ID, DEPOSIT_AND_STAKING_EVENT)
+	assert.Equal(t, int64(3), last.Int64())
+	blocks := s.api.ProcessedBlocks(s.rabbit.Hex(), SIMULATED_CHAIN_ID, DEPOSIT_AND_STAKING_EVENT)
+	assert.Len(t, blocks, 1)
+	assert.Equal(t, s.hash(3).Hex(), blocks[0].BlockHash)
+	assert.Equal(t, []string{"d_1", "d_2", "s_1"}, blocks[0].Ops)
+}
+
+func TestSimulatedWithdrawals(t *testing.T) {
+	ctx := context.Background()
+	s := newSimulatedSettlement(t)
+
+	trader := s.profile(wallet(1), model.PROFILE_TYPE_TRADER)
+	s.api.AddWithdrawal("w_1", trader.ProfileId, decimal.NewFromInt(2), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.AddWithdrawal("w_2", trader.ProfileId, decimal.NewFromInt(3), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.AddWithdrawal("w_3", trader.ProfileId, decimal.NewFromInt(1), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+
+	s.eh.updatePendingWithdrawals(ctx)
+	assert.Equal(t, uint(11), s.api.Op("w_1").DueBlock)
+
+	w1 := s.withdrawalReceipt(1, wallet(1), 2)
+	w2 := s.withdrawalReceipt(2, wallet(1), 3)
+	// a receipt of an unknown withdrawal is skipped
+	s.withdrawalReceipt(9, wallet(1), 1)
+	s.mine(2)
+
+	s.eh.completeWithdrawalsAndUnstakes(ctx)
+
+	op := s.api.Op("w_1")
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, op.Status)
+	assert.Equal(t, w1.Hash().Hex(), op.Txhash)
+	op = s.api.Op("w_2")
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, op.Status)
+	assert.Equal(t, w2.Hash().Hex(), op.Txhash)
+	assert.Equal(t, fakeClaimableStatus, s.api.Op("w_3").Status)
+	last, _ := s.api.GetLastProcessedBlockNumber(ctx, s.rabbit.Hex(), SIMULATED_CHAIN_ID, WITHDRAW_AND_UNSTAKE_EVENT)
+	assert.Equal(t, int64(2), last.Int64())
+
+	// nothing is completed while withdrawals are suspended
+	s.withdrawalReceipt(3, wallet(1), 1)
+	s.mine(2)
+	s.eh.settlementService.withdrawalSuspended = true
+	s.eh.completeWithdrawalsAndUnstakes(ctx)
+	assert.Equal(t, fakeClaimableStatus, s.api.Op("w_3").Status)
+
+	s.eh.settlementService.withdrawalSuspended = false
+	s.eh.completeWithdrawalsAndUnstakes(ctx)
+	assert.Equal(t, model.BALANCE_OPS_STATUS_SUCCESS, s.api.Op("w_3").Status)
+	last, _ = s.api.GetLastProcessedBlockNumber(ctx, s.rabbit.Hex(), SIMULATED_CHAIN_ID, WITHDRAW_AND_UNSTAKE_EVENT)
+	assert.Equal(t, int64(4), last.Int64())
+}
@@ -0,0 +1,165 @@
+package settlement
+
+/*
+Withdrawal risk policy of a chain. The new pending withdrawals are checked
+oldest first before they get their due block: a withdrawal breaching a limit
+is held in review with the breached limit as its reason, the others are let
+through and added to the 24h volumes of the chain and of the profile. A held
+withdrawal waits for an admin to approve it, it's pending again and skips the
+checks, or to reject it, it's canceled and refunded.
+*/
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/pkg/log"
+)
+
+// Reasons of the withdrawals held in review
+const (
+	WITHDRAWAL_HOLD_ROLLING_24H_CAP      = "rolling_24h_cap"
+	WITHDRAWAL_HOLD_WALLET_DAILY_CAP     = "wallet_daily_cap"
+	WITHDRAWAL_HOLD_APPROVAL_THRESHOLD   = "approval_threshold"
+	WITHDRAWAL_HOLD_NEW_ACCOUNT_COOLDOWN = "new_account_cooldown"
+)
+
+// The global 24h limit used before the policy was configurable per chain
+const DEFAULT_ROLLING_24H_CAP = "4000000"
+
+// Limits in token units, a zero limit is not checked
+type WithdrawalPolicy struct {
+	Rolling24hCap      decimal.Decimal
+	WalletDailyCap     decimal.Decimal
+	ApprovalThreshold  decimal.Decimal
+	NewAccountCooldown time.Duration
+}
+
+func parsePolicyAmount(name, value, defaultValue string) (decimal.Decimal, error) {
+	if value == "" {
+		value = defaultValue
+	}
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("error parsing withdrawal policy %s: \"%s\"", name, value)
+	}
+	if amount.IsNegative() {
+		return decimal.Zero, fmt.Errorf("negative withdrawal policy %s: \"%s\"", name, value)
+	}
+	return amount, nil
+}
+
+func NewWithdrawalPolicy(cfg WithdrawalPolicyCfg) (WithdrawalPolicy, error) {
+	var policy WithdrawalPolicy
+	var err error
+
+	policy.Rolling24hCap, err = parsePolicyAmount("rolling_24h_cap", cfg.Rolling24hCap, DEFAULT_ROLLING_24H_CAP)
+	if err != nil {
+		return policy, err
+	}
+	policy.WalletDailyCap, err = parsePolicyAmount("wallet_daily_cap", cfg.WalletDailyCap, "0")
+	if err != nil {
+		return policy, err
+	}
+	policy.ApprovalThreshold, err = parsePolicyAmount("approval_threshold", cfg.ApprovalThreshold, "0")
+	if err != nil {
+		return policy, err
+	}
+
+	if cfg.NewAccountCooldown != "" {
+		cooldownSeconds, err := strconv.ParseInt(cfg.NewAccountCooldown, 10, 64)
+		if err != nil || cooldownSeconds < 0 {
+			return policy, fmt.Errorf("error parsing withdrawal policy new_account_cooldown: \"%s\"", cfg.NewAccountCooldown)
+		}
+		policy.NewAccountCooldown = time.Second * time.Duration(cooldownSeconds)
+	}
+
+	return policy, nil
+}
+
+// Check returns the reason to hold the withdrawal or an empty string
+func (p WithdrawalPolicy) Check(withdrawal *model.BalanceOps, usage *model.WithdrawalUsage, now time.Time) string {
+	amount := withdrawal.Amount.Decimal
+
+	if p.ApprovalThreshold.IsPositive() && amount.GreaterThan(p.ApprovalThreshold) {
+		return WITHDRAWAL_HOLD_APPROVAL_THRESHOLD
+	}
+
+	if p.NewAccountCooldown > 0 && now.Sub(time.UnixMicro(usage.ProfileCreatedAt)) < p.NewAccountCooldown {
+		return WITHDRAWAL_HOLD_NEW_ACCOUNT_COOLDOWN
+	}
+
+	if p.WalletDailyCap.IsPositive() && usage.ProfileVolume.Add(amount).GreaterThan(p.WalletDailyCap) {
+		return WITHDRAWAL_HOLD_WALLET_DAILY_CAP
+	}
+
+	if p.Rolling24hCap.IsPositive() && usage.ChainVolume.Add(amount).GreaterThan(p.Rolling24hCap) {
+		return WITHDRAWAL_HOLD_ROLLING_24H_CAP
+	}
+
+	return ""
+}
+
+// A pending withdrawal without a due block and a reason was not checked yet,
+// an approved one has its reason set
+func isUncheckedWithdrawal(withdrawal *model.BalanceOps) bool {
+	return withdrawal.Status == model.BALANCE_OPS_STATUS_PENDING && withdrawal.DueBlock == 0 && withdrawal.Reason == ""
+}
+
+// applyWithdrawalPolicy checks the unchecked withdrawals, a withdrawal that
+// couldn't be checked is skipped and checked again with the next pass. It
+// returns false if one of them was skipped and the withdrawals must not be
+// scheduled, as scheduling gives a due block to every pending withdrawal
+func (s *SettlementService) applyWithdrawalPolicy(ctx context.Context, handler *EthereumHandler, withdrawals []*model.BalanceOps) bool {
+	unchecked := make([]*model.BalanceOps, 0, len(withdrawals))
+	for _, withdrawal := range withdrawals {
+		if isUncheckedWithdrawal(withdrawal) {
+			unchecked = append(unchecked, withdrawal)
+		}
+	}
+	sort.SliceStable(unchecked, func(i, j int) bool { return unchecked[i].Timestamp < unchecked[j].Timestamp })
+
+	now := time.Now()
+	checked := true
+	for _, withdrawal := range unchecked {
+		usage, err := s.apiModel.GetWithdrawalUsage(ctx, handler.exchangeId, handler.chainId, withdrawal.ProfileId)
+		if err != nil {
+			logrus.Errorf("exchangeId=%s chain_id=%d error reading withdrawal usage of profile_id=%d: %s",
+				handler.exchangeId, handler.chainId, withdrawal.ProfileId, err.Error())
+			checked = false
+			continue
+		}
+
+		reason := handler.withdrawalPolicy.Check(withdrawal, usage, now)
+		if reason == "" {
+			_, err = s.apiModel.AdmitWithdrawal(ctx, withdrawal.OpsId)
+			if err != nil {
+				logrus.Errorf("exchangeId=%s chain_id=%d error admitting withdrawal id=%s: %s",
+					handler.exchangeId, handler.chainId, withdrawal.OpsId, err.Error())
+				checked = false
+				continue
+			}
+			continue
+		}
+
+		_, err = s.apiModel.HoldWithdrawal(ctx, withdrawal.OpsId, reason)
+		if err != nil {
+			logrus.Errorf("exchangeId=%s chain_id=%d error holding withdrawal id=%s: %s",
+				handler.exchangeId, handler.chainId, withdrawal.OpsId, err.Error())
+			checked = false
+			continue
+		}
+		logrus.WithField(log.AlertTag, log.AlertHigh).Warnf("exchangeId=%s chain_id=%d withdrawal id=%s profile_id=%d amount=%s held for review reason=%s chain_volume=%s profile_volume=%s",
+			handler.exchangeId, handler.chainId, withdrawal.OpsId, withdrawal.ProfileId, withdrawal.Amount.String(), reason,
+			usage.ChainVolume.String(), usage.ProfileVolume.String())
+	}
+
+	return checked
+}
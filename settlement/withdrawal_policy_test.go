@@ -0,0 +1,190 @@
+package settlement
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+func TestWithdrawalPolicyConfig(t *testing.T) {
+	policy, err := NewWithdrawalPolicy(WithdrawalPolicyCfg{})
+	require.NoError(t, err)
+	assert.Equal(t, "4000000", policy.Rolling24hCap.String())
+	assert.True(t, policy.WalletDailyCap.IsZero())
+	assert.True(t, policy.ApprovalThreshold.IsZero())
+	assert.Equal(t, time.Duration(0), policy.NewAccountCooldown)
+
+	policy, err = NewWithdrawalPolicy(WithdrawalPolicyCfg{
+		Rolling24hCap:      "0",
+		WalletDailyCap:     "50000",
+		ApprovalThreshold:  "10000.5",
+		NewAccountCooldown: "86400",
+	})
+	require.NoError(t, err)
+	assert.True(t, policy.Rolling24hCap.IsZero())
+	assert.Equal(t, "50000", policy.WalletDailyCap.String())
+	assert.Equal(t, "10000.5", policy.ApprovalThreshold.String())
+	assert.Equal(t, 24*time.Hour, policy.NewAccountCooldown)
+
+	_, err = NewWithdrawalPolicy(WithdrawalPolicyCfg{WalletDailyCap: "lots"})
+	assert.Error(t, err)
+	_, err = NewWithdrawalPolicy(WithdrawalPolicyCfg{ApprovalThreshold: "-1"})
+	assert.Error(t, err)
+	_, err = NewWithdrawalPolicy(WithdrawalPolicyCfg{NewAccountCooldown: "1h"})
+	assert.Error(t, err)
+}
+
+func TestWithdrawalPolicyCheck(t *testing.T) {
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	policy := WithdrawalPolicy{
+		Rolling24hCap:      decimal.NewFromInt(1000),
+		WalletDailyCap:     decimal.NewFromInt(300),
+		ApprovalThreshold:  decimal.NewFromInt(200),
+		NewAccountCooldown: time.Hour,
+	}
+	usage := func(chain, profile int64, age time.Duration) *model.WithdrawalUsage {
+		return &model.WithdrawalUsage{
+			ChainVolume:      *tdecimal.NewDecimal(decimal.NewFromInt(chain)),
+			ProfileVolume:    *tdecimal.NewDecimal(decimal.NewFromInt(profile)),
+			ProfileCreatedAt: now.Add(-age).UnixMicro(),
+		}
+	}
+	withdrawal := func(amount int64) *model.BalanceOps {
+		return &model.BalanceOps{Amount: *tdecimal.NewDecimal(decimal.NewFromInt(amount))}
+	}
+
+	assert.Equal(t, "", policy.Check(withdrawal(200), usage(800, 100, 2*time.Hour), now))
+	assert.Equal(t, WITHDRAWAL_HOLD_APPROVAL_THRESHOLD, policy.Check(withdrawal(201), usage(0, 0, 2*time.Hour), now))
+	assert.Equal(t, WITHDRAWAL_HOLD_NEW_ACCOUNT_COOLDOWN, policy.Check(withdrawal(1), usage(0, 0, time.Minute), now))
+	assert.Equal(t, WITHDRAWAL_HOLD_WALLET_DAILY_CAP, policy.Check(withdrawal(101), usage(0, 200, 2*time.Hour), now))
+	assert.Equal(t, WITHDRAWAL_HOLD_ROLLING_24H_CAP, policy.Check(withdrawal(101), usage(900, 0, 2*time.Hour), now))
+
+	// zero limits are not checked
+	assert.Equal(t, "", WithdrawalPolicy{}.Check(withdrawal(1000000), usage(1000000, 1000000, 0), now))
+}
+
+func TestProcessPendingWithdrawalsPolicy(t *testing.T) {
+	ctx := context.Background()
+	s := newSimulatedSettlement(t)
+	s.eh.withdrawalPolicy = WithdrawalPolicy{
+		Rolling24hCap:      decimal.NewFromInt(100),
+		WalletDailyCap:     decimal.NewFromInt(30),
+		ApprovalThreshold:  decimal.NewFromInt(50),
+		NewAccountCooldown: time.Hour,
+	}
+	service := s.eh.settlementService
+
+	old := time.Now().Add(-2 * time.Hour).UnixMicro()
+	trader := s.profile(wallet(1), model.PROFILE_TYPE_TRADER)
+	trader.CreatedAt = old
+	whale := s.profile(wallet(2), model.PROFILE_TYPE_TRADER)
+	whale.CreatedAt = old
+	newcomer := s.profile(wallet(3), model.PROFILE_TYPE_TRADER)
+	newcomer.CreatedAt = time.Now().UnixMicro()
+	other := s.profile(wallet(4), model.PROFILE_TYPE_TRADER)
+	other.CreatedAt = old
+
+	// 10 withdrawn by the trader yesterday and 20 by others today
+	s.api.AddWithdrawalVolume(SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, trader.ProfileId, decimal.NewFromInt(10), time.Now().Add(-25*time.Hour))
+	s.api.AddWithdrawalVolume(SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, 0, decimal.NewFromInt(20), time.Now().Add(-time.Hour))
+	// another chain doesn't count
+	s.api.AddWithdrawalVolume(SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID+1, trader.ProfileId, decimal.NewFromInt(1000), time.Now())
+
+	s.api.AddPendingWithdrawal("w_1", trader.ProfileId, decimal.NewFromInt(25), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.AddPendingWithdrawal("w_2", trader.ProfileId, decimal.NewFromInt(10), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.AddPendingWithdrawal("w_3", whale.ProfileId, decimal.NewFromInt(60), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.AddPendingWithdrawal("w_4", newcomer.ProfileId, decimal.NewFromInt(5), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.AddPendingWithdrawal("w_5", whale.ProfileId, decimal.NewFromInt(30), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.AddPendingWithdrawal("w_6", other.ProfileId, decimal.NewFromInt(30), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+
+	service.processPendingWithdrawals(ctx, s.eh)
+
+	// only the offending withdrawals are held, the others get their due block
+	for _, id := range []string{"w_1", "w_5"} {
+		op := s.api.Op(id)
+		assert.Equal(t, model.BALANCE_OPS_STATUS_PENDING, op.Status, id)
+		assert.Equal(t, uint(11), op.DueBlock, id)
+	}
+	held := map[string]string{
+		"w_2": WITHDRAWAL_HOLD_WALLET_DAILY_CAP,
+		"w_3": WITHDRAWAL_HOLD_APPROVAL_THRESHOLD,
+		"w_4": WITHDRAWAL_HOLD_NEW_ACCOUNT_COOLDOWN,
+		"w_6": WITHDRAWAL_HOLD_ROLLING_24H_CAP,
+	}
+	for id, reason := range held {
+		op := s.api.Op(id)
+		assert.Equal(t, model.BALANCE_OPS_STATUS_REVIEW, op.Status, id)
+		assert.Equal(t, reason, op.Reason, id)
+	}
+	suspended, _ := s.api.GetWithdrawalsSuspended(ctx)
+	assert.False(t, suspended)
+
+	usage, err := s.api.GetWithdrawalUsage(ctx, SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, whale.ProfileId)
+	require.NoError(t, err)
+	assert.Equal(t, "75", usage.ChainVolume.String())
+	assert.Equal(t, "30", usage.ProfileVolume.String())
+
+	// an approved withdrawal is scheduled without a new check, a rejected one is refunded
+	balance := s.api.Balance(other.ProfileId)
+	require.NoError(t, s.api.ReviewWithdrawal("w_3", true))
+	require.NoError(t, s.api.ReviewWithdrawal("w_6", false))
+	assert.Error(t, s.api.ReviewWithdrawal("w_6", true))
+	s.mine(1)
+
+	service.processPendingWithdrawals(ctx, s.eh)
+
+	op := s.api.Op("w_3")
+	assert.Equal(t, model.BALANCE_OPS_STATUS_PENDING, op.Status)
+	assert.Equal(t, uint(12), op.DueBlock)
+	assert.Equal(t, fakeCanceledStatus, s.api.Op("w_6").Status)
+	assert.Equal(t, balance.Add(decimal.NewFromInt(30)).String(), s.api.Balance(other.ProfileId).String())
+	assert.Equal(t, model.BALANCE_OPS_STATUS_REVIEW, s.api.Op("w_2").Status)
+}
+
+func TestProcessPendingWithdrawalsPolicyFailure(t *testing.T) {
+	ctx := context.Background()
+	s := newSimulatedSettlement(t)
+	s.eh.withdrawalPolicy = WithdrawalPolicy{ApprovalThreshold: decimal.NewFromInt(50)}
+	service := s.eh.settlementService
+
+	trader := s.profile(wallet(1), model.PROFILE_TYPE_TRADER)
+	s.api.AddPendingWithdrawal("w_1", trader.ProfileId, decimal.NewFromInt(10), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.AddPendingWithdrawal("w_2", trader.ProfileId, decimal.NewFromInt(20), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.AddPendingWithdrawal("w_3", trader.ProfileId, decimal.NewFromInt(60), SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, s.rabbit.Hex())
+	s.api.FailWithdrawalCheck("w_2", true)
+
+	service.processPendingWithdrawals(ctx, s.eh)
+
+	// the failing withdrawal is skipped, the ones after it are still checked
+	// but nothing is scheduled while one is unchecked
+	op := s.api.Op("w_1")
+	assert.Equal(t, fakeCheckedReason, op.Reason)
+	assert.Equal(t, uint(0), op.DueBlock)
+	op = s.api.Op("w_2")
+	assert.True(t, isUncheckedWithdrawal(op))
+	op = s.api.Op("w_3")
+	assert.Equal(t, model.BALANCE_OPS_STATUS_REVIEW, op.Status)
+	assert.Equal(t, WITHDRAWAL_HOLD_APPROVAL_THRESHOLD, op.Reason)
+
+	// the skipped withdrawal is checked again with the next pass
+	s.api.FailWithdrawalCheck("w_2", false)
+	service.processPendingWithdrawals(ctx, s.eh)
+
+	for _, id := range []string{"w_1", "w_2"} {
+		op = s.api.Op(id)
+		assert.Equal(t, fakeCheckedReason, op.Reason, id)
+		assert.Equal(t, uint(11), op.DueBlock, id)
+	}
+	assert.Equal(t, model.BALANCE_OPS_STATUS_REVIEW, s.api.Op("w_3").Status)
+
+	usage, err := s.api.GetWithdrawalUsage(ctx, SIMULATED_EXCHANGE_ID, SIMULATED_CHAIN_ID, trader.ProfileId)
+	require.NoError(t, err)
+	assert.Equal(t, "30", usage.ProfileVolume.String())
+}
@@ -3,6 +3,7 @@ package slipstopper
 import (
 	"os"
 	"path"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -16,6 +17,14 @@ type ServiceConfig struct {
 	Markets                   []string `yaml:"markets"`
 	CentrifugoHMACSecretToken string   `yaml:"centrifugo_hmac_secret_token"`
 	WebsocketURI              string   `yaml:"websocket_uri"`
+	// diff of the matcher with the orders placed in tarantool
+	ReconcileInterval time.Duration `yaml:"reconcile_interval" env-default:"30s"`
+	// how far back the startup recovery looks for crossed triggers
+	RecoveryLookback time.Duration `yaml:"recovery_lookback" env-default:"24h"`
+	// last matched price time by market, the recovery goes back the lookback without it
+	StateFile string `yaml:"state_file"`
+	// serves the trigger counters on /debug/vars when set
+	MetricsAddr string `yaml:"metrics_addr"`
 }
 
 type Config struct {
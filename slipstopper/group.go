@@ -0,0 +1,46 @@
+package slipstopper
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+)
+
+// Conditional members of an oco pair or of an activated bracket cancel each
+// other. Tarantool cancels the siblings in the execute transaction, the
+// matcher only takes them out of the tree so they are not sent for execution
+// by the same price update before the cancel comes back.
+func (m *Matcher) join(order model.OrderData) {
+	if order.GroupId == "" {
+		return
+	}
+
+	members, ok := m.groups[order.GroupId]
+	if !ok {
+		members = make(map[string]model.OrderData)
+		m.groups[order.GroupId] = members
+	}
+	members[order.OrderId] = order
+}
+
+func (m *Matcher) leave(order model.OrderData) {
+	members, ok := m.groups[order.GroupId]
+	if !ok {
+		return
+	}
+
+	delete(members, order.OrderId)
+	if len(members) == 0 {
+		delete(m.groups, order.GroupId)
+	}
+}
+
+func (m *Matcher) dropSiblings(order model.OrderData) {
+	for id, member := range m.groups[order.GroupId] {
+		if id == order.OrderId {
+			continue
+		}
+		logrus.Infof("group %s triggered by id=%s, dropping id=%s", order.GroupId, order.OrderId, id)
+		m.Remove(member)
+	}
+}
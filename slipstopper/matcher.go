@@ -3,6 +3,7 @@ package slipstopper
 import (
 	"context"
 	"sync"
+	"time"
 
 	avl "github.com/emirpasic/gods/trees/avltree"
 	"github.com/shopspring/decimal"
@@ -14,10 +15,52 @@ import (
 )
 
 type Matcher struct {
-	tree           *Tree
+	// one tree per price stream (TRIGGER_BY_*), an order sits in the tree of its trigger_by
+	trees          map[string]*Tree
 	nodesByOrderId map[string]*avl.Node
 	broker         *model.Broker
 	mu             sync.Mutex
+	// set while the market index price is frozen by the pricing circuit breaker
+	degraded bool
+	// a recovery skipped while degraded, run once the price is back
+	recoveryPending bool
+	// trailing stops by order id
+	trails map[string]*trail
+	// persists a moved trailing trigger and returns the stored order
+	updateTrigger func(order model.OrderData, trigger decimal.Decimal) (*model.OrderData, error)
+	// oco/bracket members by group id and order id
+	groups map[string]map[string]model.OrderData
+	// sends a triggered order to the engine
+	execute func(order model.OrderData) error
+	// failed executes waiting for the next attempt, by order id
+	retries map[string]*retry
+	// first successful execute of the orders still in the tree, by order id
+	sent map[string]time.Time
+	// recently removed orders, by order id
+	removed map[string]time.Time
+	// last matched price by stream and its time
+	prices   map[string]decimal.Decimal
+	lastSeen time.Time
+}
+
+// price streams in the order they are matched on a market update
+var triggerSources = []string{model.TRIGGER_BY_MARK, model.TRIGGER_BY_LAST, model.TRIGGER_BY_INDEX}
+
+func newTriggerTrees() map[string]*Tree {
+	trees := make(map[string]*Tree, len(triggerSources))
+	for _, source := range triggerSources {
+		trees[source] = NewAVLTree()
+	}
+	return trees
+}
+
+// price stream the order is triggered by, mark unless the order says otherwise
+func triggerSource(order model.OrderData) string {
+	switch order.TriggerBy {
+	case model.TRIGGER_BY_LAST, model.TRIGGER_BY_INDEX:
+		return order.TriggerBy
+	}
+	return model.TRIGGER_BY_MARK
 }
 
 func NewMatcher() *Matcher {
@@ -26,25 +69,62 @@ func NewMatcher() *Matcher {
 		logrus.Fatalln(err)
 	}
 
-	return &Matcher{
-		tree:           NewAVLTree(),
+	return newMatcher(b)
+}
+
+func newMatcher(b *model.Broker) *Matcher {
+	m := &Matcher{
+		trees:          newTriggerTrees(),
 		nodesByOrderId: make(map[string]*avl.Node),
 		broker:         b,
+		trails:         make(map[string]*trail),
+		groups:         make(map[string]map[string]model.OrderData),
+		retries:        make(map[string]*retry),
+		sent:           make(map[string]time.Time),
+		removed:        make(map[string]time.Time),
+		prices:         make(map[string]decimal.Decimal),
 	}
+	m.updateTrigger = m.persistTrigger
+	m.execute = m.executeOrder
+
+	return m
 }
 
 func (m *Matcher) Insert(order model.OrderData) {
-	node := m.tree.Insert(order.TriggerPrice.Decimal, order)
+	node := m.trees[triggerSource(order)].Insert(order.TriggerPrice.Decimal, order)
 	m.nodesByOrderId[order.OrderId] = node
+
+	if order.OrderType == model.TRAILING_STOP {
+		m.track(order)
+	}
+	m.join(order)
+}
+
+// replaces an order that is already in the tree, a trailing stop keeps its
+// running high/low unless its trigger was changed outside the slipstopper
+func (m *Matcher) Update(order model.OrderData) {
+	if _, ok := m.nodesByOrderId[order.OrderId]; ok {
+		m.unlink(order)
+	}
+	m.Insert(order)
 }
 
 func (m *Matcher) Remove(order model.OrderData) {
+	m.unlink(order)
+	delete(m.trails, order.OrderId)
+	delete(m.retries, order.OrderId)
+	delete(m.sent, order.OrderId)
+	m.removed[order.OrderId] = time.Now()
+	m.leave(order)
+}
+
+func (m *Matcher) unlink(order model.OrderData) {
 	node, ok := m.nodesByOrderId[order.OrderId]
 	if ok {
 		key := node.Key
 		tup := node.Value.(Tuple)
 
-		m.tree.Delete(key)
+		m.trees[triggerSource(order)].Delete(key)
 		delete(m.nodesByOrderId, order.OrderId)
 		for _, o := range tup.Values {
 			if o.OrderId != order.OrderId {
@@ -57,57 +137,115 @@ func (m *Matcher) Remove(order model.OrderData) {
 	}
 }
 
-func (m *Matcher) OnPriceUpdate(price decimal.Decimal) {
+// SetPriceDegraded returns true if the price is back and a recovery skipped
+// while it was degraded must be run now
+func (m *Matcher) SetPriceDegraded(degraded bool) bool {
+	if m.degraded != degraded {
+		logrus.Warnf("Matcher price degraded changed to %v", degraded)
+	}
+	m.degraded = degraded
+
+	if degraded || !m.recoveryPending {
+		return false
+	}
+	m.recoveryPending = false
+	return true
+}
+
+// true if the order fires when the price rises to its trigger
+func triggersUp(order model.OrderData) bool {
+	switch order.OrderType {
+	case model.TAKE_PROFIT, model.TAKE_PROFIT_LIMIT:
+		return order.Side == model.SHORT
+	case model.STOP_LOSS, model.STOP_LOSS_LIMIT, model.STOP_LIMIT, model.STOP_MARKET, model.TRAILING_STOP:
+		return order.Side == model.LONG
+	}
+	return false
+}
+
+// true if the order fires when the price falls to its trigger
+func triggersDown(order model.OrderData) bool {
+	switch order.OrderType {
+	case model.TAKE_PROFIT, model.TAKE_PROFIT_LIMIT:
+		return order.Side == model.LONG
+	case model.STOP_LOSS, model.STOP_LOSS_LIMIT, model.STOP_LIMIT, model.STOP_MARKET, model.TRAILING_STOP:
+		return order.Side == model.SHORT
+	}
+	return false
+}
+
+// matches the orders triggered by the source (TRIGGER_BY_*) price stream
+func (m *Matcher) OnPriceUpdate(source string, price decimal.Decimal) {
+	// no conditional orders are triggered from a frozen price
+	if m.degraded {
+		logrus.Infof("price degraded, skipping price update source=%s %s", source, price)
+		return
+	}
+
+	m.prices[source] = price
+	m.lastSeen = time.Now()
+	m.moveTrailingTriggers(source, price)
+
 	// when a price update happens, we need to see if internally any orders are within this range.
 	// if any orders are found to be within the price range, then gather these orders and send them
 	// to the matching engine in tarantool to be executed.
-	apiModel := model.NewApiModel(m.broker)
+	// only the first triggered member of a group is sent
+	triggered := make(map[string]bool)
 
-	ordersLTE := m.GetByLTE(price)
+	ordersLTE := m.GetByLTE(source, price)
 	for _, item := range ordersLTE {
 		for _, val := range item.Values {
 			order := val
-			if (order.OrderType == model.STOP_LOSS && order.Side == model.LONG) ||
-				(order.OrderType == model.STOP_LOSS_LIMIT && order.Side == model.LONG) ||
-				(order.OrderType == model.TAKE_PROFIT && order.Side == model.SHORT) ||
-				(order.OrderType == model.TAKE_PROFIT_LIMIT && order.Side == model.SHORT) ||
-				(order.OrderType == model.STOP_LIMIT && order.Side == model.LONG) ||
-				(order.OrderType == model.STOP_MARKET && order.Side == model.LONG) {
-				logrus.Infof("[lte] found order to execute: id=%s trigger_price=%s fair_price=%s side=%s", order.OrderId, order.TriggerPrice, price, order.Side)
-				resp, err := apiModel.OrderExecute(context.Background(), order.ProfileID, order.MarketID, order.OrderId)
-				if err != nil {
-					logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("Error OrderExecute: err=%v", err)
-				} else {
-					logrus.Infof("Executed order with: id=%s resp=%v", order.OrderId, resp)
+			if triggersUp(order) {
+				if triggered[order.GroupId] || m.retrying(order) {
+					continue
+				}
+				logrus.Infof("[lte] found order to execute: id=%s trigger_price=%s %s_price=%s side=%s", order.OrderId, order.TriggerPrice, source, price, order.Side)
+				if m.fire(order, false) && order.GroupId != "" {
+					triggered[order.GroupId] = true
+					m.dropSiblings(order)
 				}
 			}
 		}
 	}
 
-	ordersGTE := m.GetByGTE(price)
+	ordersGTE := m.GetByGTE(source, price)
 	for _, item := range ordersGTE {
 		for _, val := range item.Values {
 			order := val
-			if (order.OrderType == model.STOP_LOSS && order.Side == model.SHORT) ||
-				(order.OrderType == model.STOP_LOSS_LIMIT && order.Side == model.SHORT) ||
-				(order.OrderType == model.TAKE_PROFIT && order.Side == model.LONG) ||
-				(order.OrderType == model.TAKE_PROFIT_LIMIT && order.Side == model.LONG) ||
-				(order.OrderType == model.STOP_LIMIT && order.Side == model.SHORT) ||
-				(order.OrderType == model.STOP_MARKET && order.Side == model.SHORT) {
-				logrus.Infof("[gte] found order to execute: id=%s trigger_price=%s fair_price=%s side=%s", order.OrderId, order.TriggerPrice, price, order.Side)
-				resp, err := apiModel.OrderExecute(context.Background(), order.ProfileID, order.MarketID, order.OrderId)
-				if err != nil {
-					logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("Error OrderExecute: err=%v", err)
-				} else {
-					logrus.Infof("Executed order with: id=%s resp=%v", order.OrderId, resp)
+			if triggersDown(order) {
+				if triggered[order.GroupId] || m.retrying(order) {
+					continue
+				}
+				logrus.Infof("[gte] found order to execute: id=%s trigger_price=%s %s_price=%s side=%s", order.OrderId, order.TriggerPrice, source, price, order.Side)
+				if m.fire(order, false) && order.GroupId != "" {
+					triggered[order.GroupId] = true
+					m.dropSiblings(order)
 				}
 			}
 		}
 	}
 }
 
+func (m *Matcher) executeOrder(order model.OrderData) error {
+	apiModel := model.NewApiModel(m.broker)
+
+	resp, err := apiModel.OrderExecute(context.Background(), order.ProfileID, order.MarketID, order.OrderId)
+	if err != nil {
+		logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("Error OrderExecute: err=%v", err)
+		return err
+	}
+	logrus.Infof("Executed order with: id=%s resp=%v", order.OrderId, resp)
+
+	return nil
+}
+
 func (m *Matcher) Size() uint64 {
-	return m.tree.GetSize()
+	var size uint64
+	for _, tree := range m.trees {
+		size += tree.GetSize()
+	}
+	return size
 }
 
 func (m *Matcher) ClearAll() {
@@ -115,23 +253,30 @@ func (m *Matcher) ClearAll() {
 	defer m.mu.Unlock()
 
 	m.nodesByOrderId = make(map[string]*avl.Node)
-	m.tree.ClearAll()
+	m.trails = make(map[string]*trail)
+	m.groups = make(map[string]map[string]model.OrderData)
+	m.retries = make(map[string]*retry)
+	m.sent = make(map[string]time.Time)
+	m.removed = make(map[string]time.Time)
+	for _, tree := range m.trees {
+		tree.ClearAll()
+	}
 }
 
-func (m *Matcher) GetByRange(min, max decimal.Decimal) []Tuple {
-	result := m.tree.RangeSearch(min, max)
+func (m *Matcher) GetByRange(source string, min, max decimal.Decimal) []Tuple {
+	result := m.trees[source].RangeSearch(min, max)
 
 	return result
 }
 
-func (m *Matcher) GetByLTE(key decimal.Decimal) []Tuple {
-	result := m.tree.LTE(key)
+func (m *Matcher) GetByLTE(source string, key decimal.Decimal) []Tuple {
+	result := m.trees[source].LTE(key)
 
 	return result
 }
 
-func (m *Matcher) GetByGTE(key decimal.Decimal) []Tuple {
-	result := m.tree.GTE(key)
+func (m *Matcher) GetByGTE(source string, key decimal.Decimal) []Tuple {
+	result := m.trees[source].GTE(key)
 
 	return result
 }
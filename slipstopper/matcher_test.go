@@ -1,10 +1,13 @@
 package slipstopper
 
 import (
+	"encoding/json"
+	"errors"
 	"golang.org/x/exp/maps"
 	"sort"
 	"testing"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/strips-finance/rabbit-dex-backend/model"
 	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
@@ -91,3 +94,226 @@ func TestMatcherFull(t *testing.T) {
 	assert.Equal(t, uint64(0), matcher.Size())
 	assert.Equal(t, 0, len(matcher.nodesByOrderId))
 }
+
+func trailingOrder(id, side, trigger string, value, percent string) model.OrderData {
+	order := model.OrderData{
+		OrderId:   id,
+		MarketID:  "BTC-USD",
+		OrderType: model.TRAILING_STOP,
+		Status:    model.PLACED,
+		Side:      side,
+	}
+	order.TriggerPrice, _ = tdecimal.NewDecimalFromString(trigger)
+	if value != "" {
+		order.CallbackValue, _ = tdecimal.NewDecimalFromString(value)
+	}
+	if percent != "" {
+		order.CallbackPercent, _ = tdecimal.NewDecimalFromString(percent)
+	}
+	return order
+}
+
+func TestMatcherTrailingStop(t *testing.T) {
+	// no broker, nothing crosses a trigger here
+	matcher := newMatcher(nil)
+
+	persisted := make(map[string]string)
+	matcher.updateTrigger = func(order model.OrderData, trigger decimal.Decimal) (*model.OrderData, error) {
+		// the engine rounds to the market tick
+		order.TriggerPrice = tdecimal.NewDecimal(trigger.Round(1))
+		persisted[order.OrderId] = order.TriggerPrice.String()
+		return &order, nil
+	}
+
+	// sells 10 below the high, the high is derived from the stored trigger
+	short := trailingOrder("1", model.SHORT, "90", "10", "")
+	// buys 10% above the low
+	long := trailingOrder("2", model.LONG, "110", "", "0.1")
+	matcher.Insert(short)
+	matcher.Insert(long)
+	assert.True(t, matcher.trails["1"].extreme.Equal(decimal.NewFromInt(100)))
+	assert.True(t, matcher.trails["2"].extreme.Equal(decimal.NewFromInt(100)))
+
+	// new high moves the short trigger only
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(105))
+	assert.Equal(t, map[string]string{"1": "95"}, persisted)
+	assert.Equal(t, uint64(2), matcher.Size())
+	_, err := matcher.trees[model.TRIGGER_BY_MARK].Get(decimal.NewFromInt(95))
+	assert.NoError(t, err)
+	_, err = matcher.trees[model.TRIGGER_BY_MARK].Get(decimal.NewFromInt(90))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	// a pullback above the trigger doesn't move anything
+	delete(persisted, "1")
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(101))
+	assert.Empty(t, persisted)
+
+	// new low moves the long trigger, rounded by the engine
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromFloat(99.5))
+	assert.Equal(t, map[string]string{"2": "109.5"}, persisted)
+	assert.True(t, matcher.trails["2"].extreme.Equal(decimal.NewFromFloat(99.5)))
+
+	// the conditional channel echo of the persisted trigger keeps the high
+	echo := trailingOrder("1", model.SHORT, "95", "10", "")
+	matcher.trails["1"].extreme = decimal.NewFromFloat(105.04)
+	matcher.Update(echo)
+	assert.True(t, matcher.trails["1"].extreme.Equal(decimal.NewFromFloat(105.04)))
+
+	// an amended trigger resets it
+	amended := trailingOrder("1", model.SHORT, "80", "10", "")
+	matcher.Update(amended)
+	assert.True(t, matcher.trails["1"].extreme.Equal(decimal.NewFromInt(90)))
+	assert.Equal(t, uint64(2), matcher.Size())
+
+	// degraded price doesn't move triggers
+	delete(persisted, "1")
+	delete(persisted, "2")
+	matcher.SetPriceDegraded(true)
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(200))
+	assert.Empty(t, persisted)
+	matcher.SetPriceDegraded(false)
+
+	matcher.Remove(amended)
+	matcher.Remove(long)
+	assert.Equal(t, uint64(0), matcher.Size())
+	assert.Empty(t, matcher.trails)
+}
+
+func groupOrder(id, orderType, side, trigger, groupId string) model.OrderData {
+	triggerPrice, _ := tdecimal.NewDecimalFromString(trigger)
+
+	return model.OrderData{
+		OrderId:      id,
+		OrderType:    orderType,
+		Side:         side,
+		Status:       model.PLACED,
+		TriggerPrice: triggerPrice,
+		GroupId:      groupId,
+		GroupType:    model.ORDER_GROUP_OCO,
+	}
+}
+
+func TestMatcherOrderGroup(t *testing.T) {
+	matcher := newMatcher(nil)
+
+	executed := make([]string, 0)
+	failing := map[string]bool{}
+	matcher.execute = func(order model.OrderData) error {
+		if failing[order.OrderId] {
+			return errors.New("engine error")
+		}
+		executed = append(executed, order.OrderId)
+		return nil
+	}
+
+	// both legs of the pair cross at 120
+	matcher.Insert(groupOrder("1", model.STOP_MARKET, model.LONG, "110", "1"))
+	matcher.Insert(groupOrder("2", model.TAKE_PROFIT, model.SHORT, "105", "1"))
+	// not grouped
+	matcher.Insert(groupOrder("3", model.STOP_MARKET, model.LONG, "100", ""))
+	// far away pair
+	matcher.Insert(groupOrder("4", model.STOP_LOSS, model.LONG, "150", "4"))
+	matcher.Insert(groupOrder("5", model.TAKE_PROFIT, model.SHORT, "140", "4"))
+	assert.Len(t, matcher.groups, 2)
+
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(120))
+
+	sort.Strings(executed)
+	assert.Len(t, executed, 2)
+	assert.Contains(t, executed, "3")
+	first := executed[0]
+	if first == "3" {
+		first = executed[1]
+	}
+	assert.Contains(t, []string{"1", "2"}, first)
+
+	// the other leg is not in the tree anymore
+	assert.Len(t, matcher.nodesByOrderId, 4)
+	_, ok := matcher.nodesByOrderId[first]
+	assert.True(t, ok)
+	assert.Len(t, matcher.groups["1"], 1)
+
+	// canceled by the engine, the echo removes the rest
+	matcher.Remove(groupOrder(first, model.STOP_MARKET, model.LONG, "110", "1"))
+	assert.NotContains(t, matcher.groups, "1")
+
+	// failed execution doesn't stop the sibling
+	executed = executed[:0]
+	failing["4"] = true
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(160))
+	sort.Strings(executed)
+	assert.Equal(t, []string{"3", "5"}, executed)
+	_, ok = matcher.nodesByOrderId["4"]
+	assert.False(t, ok)
+
+	matcher.ClearAll()
+	assert.Empty(t, matcher.groups)
+}
+
+func TestMatcherTriggerBy(t *testing.T) {
+	matcher := newMatcher(nil)
+
+	executed := make([]string, 0)
+	matcher.execute = func(order model.OrderData) error {
+		executed = append(executed, order.OrderId)
+		return nil
+	}
+	persisted := make(map[string]string)
+	matcher.updateTrigger = func(order model.OrderData, trigger decimal.Decimal) (*model.OrderData, error) {
+		order.TriggerPrice = tdecimal.NewDecimal(trigger)
+		persisted[order.OrderId] = order.TriggerPrice.String()
+		return &order, nil
+	}
+
+	// same trigger on every stream, empty is mark
+	mark := groupOrder("1", model.STOP_MARKET, model.LONG, "110", "")
+	last := groupOrder("2", model.STOP_MARKET, model.LONG, "110", "")
+	last.TriggerBy = model.TRIGGER_BY_LAST
+	index := groupOrder("3", model.STOP_MARKET, model.LONG, "110", "")
+	index.TriggerBy = model.TRIGGER_BY_INDEX
+	trailing := trailingOrder("4", model.SHORT, "90", "10", "")
+	trailing.TriggerBy = model.TRIGGER_BY_INDEX
+	for _, order := range []model.OrderData{mark, last, index, trailing} {
+		matcher.Insert(order)
+	}
+	assert.Equal(t, uint64(1), matcher.trees[model.TRIGGER_BY_MARK].GetSize())
+	assert.Equal(t, uint64(1), matcher.trees[model.TRIGGER_BY_LAST].GetSize())
+	assert.Equal(t, uint64(2), matcher.trees[model.TRIGGER_BY_INDEX].GetSize())
+
+	// a trade above the trigger fires the last price order only
+	matcher.OnPriceUpdate(model.TRIGGER_BY_LAST, decimal.NewFromInt(115))
+	assert.Equal(t, []string{"2"}, executed)
+	assert.Empty(t, persisted)
+
+	// the trailing stop follows the index only
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(112))
+	assert.Equal(t, []string{"2", "1"}, executed)
+	assert.Empty(t, persisted)
+	matcher.OnPriceUpdate(model.TRIGGER_BY_INDEX, decimal.NewFromInt(105))
+	assert.Equal(t, []string{"2", "1"}, executed)
+	assert.Equal(t, map[string]string{"4": "95"}, persisted)
+	_, err := matcher.trees[model.TRIGGER_BY_INDEX].Get(decimal.NewFromInt(95))
+	assert.NoError(t, err)
+
+	// the engine echo removes the order from its own tree
+	matcher.Remove(last)
+	assert.Equal(t, uint64(0), matcher.trees[model.TRIGGER_BY_LAST].GetSize())
+	assert.Equal(t, uint64(3), matcher.Size())
+
+	matcher.ClearAll()
+	assert.Equal(t, uint64(0), matcher.Size())
+}
+
+func TestPriceEventSourcePrice(t *testing.T) {
+	var e PriceEvent
+	err := json.Unmarshal([]byte(`{"fair_price":"100","index_price":"99","last_trade_price":"0","mark_price":"101","mark_price_usage":["slipstopper"]}`), &e)
+	assert.NoError(t, err)
+
+	assert.True(t, e.SourcePrice(model.TRIGGER_BY_MARK).Equal(decimal.NewFromInt(101)))
+	assert.True(t, e.SourcePrice(model.TRIGGER_BY_INDEX).Equal(decimal.NewFromInt(99)))
+	// no trades yet
+	assert.Nil(t, e.SourcePrice(model.TRIGGER_BY_LAST))
+
+	e.MarkPriceUsage = nil
+	assert.True(t, e.SourcePrice(model.TRIGGER_BY_MARK).Equal(decimal.NewFromInt(100)))
+}
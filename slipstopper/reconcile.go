@@ -0,0 +1,306 @@
+package slipstopper
+
+import (
+	"encoding/json"
+	"expvar"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/pkg/log"
+)
+
+// Trigger counters by market, served on /debug/vars:
+// missed - sent triggers the engine didn't execute and executes given up after the retries,
+// late - crossed triggers executed by the recovery/reconciliation instead of a price update,
+// failed - failed execute calls, every attempt is counted.
+var (
+	missedTriggers = expvar.NewMap("slipstopper_missed_triggers")
+	lateTriggers   = expvar.NewMap("slipstopper_late_triggers")
+	failedTriggers = expvar.NewMap("slipstopper_failed_triggers")
+)
+
+const (
+	retryTick        = time.Second
+	retryBaseDelay   = time.Second
+	retryMaxDelay    = time.Minute
+	retryMaxAttempts = 8
+
+	// a sent trigger still placed in tarantool after this is counted as missed
+	sentGrace = 30 * time.Second
+	// a removed order is not added back by the reconciliation for this long,
+	// the snapshot can be older than the echo that removed it
+	removedGrace = time.Minute
+
+	// minutes
+	recoveryCandlePeriod = 1
+)
+
+type retry struct {
+	order    model.OrderData
+	attempts int
+	next     time.Time
+	late     bool
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay << (attempts - 1)
+	if delay <= 0 || delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+func (m *Matcher) retrying(order model.OrderData) bool {
+	_, ok := m.retries[order.OrderId]
+	return ok
+}
+
+// fire sends the triggered order to the engine, late is set for the triggers
+// found by the recovery or the reconciliation instead of a price update.
+// A failed execute is retried with backoff by retryDue.
+func (m *Matcher) fire(order model.OrderData, late bool) bool {
+	return m.attempt(&retry{order: order, late: late}, time.Now())
+}
+
+func (m *Matcher) attempt(r *retry, now time.Time) bool {
+	id := r.order.OrderId
+
+	err := m.execute(r.order)
+	if err != nil {
+		failedTriggers.Add(r.order.MarketID, 1)
+		r.attempts++
+		if r.attempts >= retryMaxAttempts {
+			logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("giving up execute: id=%s attempts=%d err=%v", id, r.attempts, err)
+			missedTriggers.Add(r.order.MarketID, 1)
+			delete(m.retries, id)
+			return false
+		}
+		r.next = now.Add(retryDelay(r.attempts))
+		m.retries[id] = r
+		logrus.Warnf("execute failed, retry: id=%s attempts=%d next=%s", id, r.attempts, r.next)
+		return false
+	}
+
+	delete(m.retries, id)
+	if r.late {
+		lateTriggers.Add(r.order.MarketID, 1)
+	}
+	if _, ok := m.sent[id]; !ok {
+		m.sent[id] = now
+	}
+	return true
+}
+
+// retryDue executes the failed triggers whose backoff has passed. The order
+// stays in the retry until it's executed, given up or removed by the echo.
+func (m *Matcher) retryDue(now time.Time) {
+	for _, r := range m.retries {
+		if now.Before(r.next) {
+			continue
+		}
+		if m.attempt(r, now) && r.order.GroupId != "" {
+			m.dropSiblings(r.order)
+		}
+	}
+}
+
+func crossed(order model.OrderData, low, high decimal.Decimal) bool {
+	trigger := order.TriggerPrice.Decimal
+	if triggersUp(order) {
+		return !high.LessThan(trigger)
+	}
+	if triggersDown(order) {
+		return !low.GreaterThan(trigger)
+	}
+	return false
+}
+
+func (m *Matcher) orders() []model.OrderData {
+	orders := make([]model.OrderData, 0, len(m.nodesByOrderId))
+	for _, tree := range m.trees {
+		for _, tup := range tree.GTE(decimal.Zero) {
+			orders = append(orders, tup.Values...)
+		}
+	}
+	return orders
+}
+
+// recoverCrossed executes the orders whose trigger was crossed by the candles
+// after since (or after the order was placed) while nothing was matched.
+// Candles are built from trades, for the mark and index streams they are an
+// approximation and the engine makes the final check. Nothing is fired while
+// the price is degraded, the recovery is run again once it's back.
+func (m *Matcher) recoverCrossed(candles []*model.CandleData, since time.Time) int {
+	if m.degraded {
+		logrus.Infof("[recover] price degraded, recovery deferred")
+		m.recoveryPending = true
+		return 0
+	}
+
+	period := time.Duration(recoveryCandlePeriod) * time.Minute
+	triggered := make(map[string]bool)
+	count := 0
+
+	for _, order := range m.orders() {
+		if triggered[order.GroupId] || m.retrying(order) {
+			continue
+		}
+		if _, ok := m.nodesByOrderId[order.OrderId]; !ok {
+			// dropped as a sibling of a recovered one
+			continue
+		}
+
+		from := since
+		if placed := time.UnixMicro(order.UpdatedAt); placed.After(from) {
+			from = placed
+		}
+
+		for _, candle := range candles {
+			if !time.Unix(candle.Time, 0).Add(period).After(from) {
+				continue
+			}
+			if !crossed(order, candle.Low.Decimal, candle.High.Decimal) {
+				continue
+			}
+
+			logrus.Infof("[recover] crossed while down: id=%s trigger_price=%s low=%s high=%s time=%d", order.OrderId, order.TriggerPrice, candle.Low, candle.High, candle.Time)
+			count++
+			if m.fire(order, true) && order.GroupId != "" {
+				triggered[order.GroupId] = true
+				m.dropSiblings(order)
+			}
+			break
+		}
+	}
+
+	return count
+}
+
+// Reconcile diffs the matcher with the orders placed in tarantool at snapshot:
+// adds the orders whose publication was lost, removes the ones that are not
+// placed anymore and counts the sent triggers the engine didn't execute.
+func (m *Matcher) Reconcile(placed []*model.OrderData, snapshot time.Time) {
+	placedById := make(map[string]model.OrderData, len(placed))
+	for _, order := range placed {
+		placedById[order.OrderId] = *order
+	}
+
+	for id, at := range m.removed {
+		if snapshot.Sub(at) > removedGrace {
+			delete(m.removed, id)
+		}
+	}
+
+	for _, order := range m.orders() {
+		if _, ok := placedById[order.OrderId]; ok {
+			continue
+		}
+		if time.UnixMicro(order.UpdatedAt).After(snapshot) {
+			continue
+		}
+		logrus.Warnf("[reconcile] not placed in tarantool, removing: id=%s", order.OrderId)
+		m.Remove(order)
+	}
+
+	for id, order := range placedById {
+		if _, ok := m.nodesByOrderId[id]; ok {
+			continue
+		}
+		if _, ok := m.removed[id]; ok {
+			continue
+		}
+		logrus.Warnf("[reconcile] missing in the matcher, adding: id=%s trigger_price=%s", id, order.TriggerPrice)
+		m.Insert(order)
+
+		price, ok := m.prices[triggerSource(order)]
+		if ok && !m.degraded && crossed(order, price, price) {
+			if m.fire(order, true) && order.GroupId != "" {
+				m.dropSiblings(order)
+			}
+		}
+	}
+
+	for id, at := range m.sent {
+		if _, ok := placedById[id]; !ok || snapshot.Sub(at) < sentGrace {
+			continue
+		}
+		order := placedById[id]
+		logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("[reconcile] sent trigger not executed: id=%s trigger_price=%s sent_at=%s", id, order.TriggerPrice, at)
+		missedTriggers.Add(order.MarketID, 1)
+		// counted once, the live matching sends it again
+		delete(m.sent, id)
+	}
+}
+
+// Time of the last matched price by market, kept in a file so the startup
+// recovery knows since when the triggers were not matched.
+type seenState struct {
+	path string
+	mu   sync.Mutex
+	// unix seconds
+	seen map[string]int64
+}
+
+func loadSeenState(path string) *seenState {
+	s := &seenState{
+		path: path,
+		seen: make(map[string]int64),
+	}
+	if path == "" {
+		return s
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("could not read state file=%s: %v", path, err)
+		}
+		return s
+	}
+	if err = json.Unmarshal(data, &s.seen); err != nil {
+		logrus.Warnf("could not parse state file=%s: %v", path, err)
+	}
+
+	return s
+}
+
+func (s *seenState) get(market string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen, ok := s.seen[market]
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(seen, 0)
+}
+
+func (s *seenState) set(market string, seen time.Time) {
+	if s.path == "" || seen.IsZero() {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seen[market] = seen.Unix()
+	data, err := json.Marshal(s.seen)
+	if err != nil {
+		logrus.Warnf("could not encode state: %v", err)
+		return
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err = os.WriteFile(tmp, data, 0o644); err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		logrus.Warnf("could not write state file=%s: %v", s.path, err)
+	}
+}
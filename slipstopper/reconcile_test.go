@@ -0,0 +1,239 @@
+package slipstopper
+
+import (
+	"errors"
+	"expvar"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+func counter(m *expvar.Map, market string) int64 {
+	v, ok := m.Get(market).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return v.Value()
+}
+
+func marketOrder(market, id, orderType, side, trigger string, updatedAt time.Time) model.OrderData {
+	order := groupOrder(id, orderType, side, trigger, "")
+	order.MarketID = market
+	order.UpdatedAt = updatedAt.UnixMicro()
+	return order
+}
+
+func candle(at time.Time, low, high int64) *model.CandleData {
+	return &model.CandleData{
+		Time: at.Unix(),
+		Low:  *tdecimal.NewDecimal(decimal.NewFromInt(low)),
+		High: *tdecimal.NewDecimal(decimal.NewFromInt(high)),
+	}
+}
+
+func TestMatcherRetry(t *testing.T) {
+	market := "RETRY-USD"
+	matcher := newMatcher(nil)
+
+	calls := 0
+	failing := true
+	matcher.execute = func(order model.OrderData) error {
+		calls++
+		if failing {
+			return errors.New("queue is full")
+		}
+		return nil
+	}
+
+	now := time.Now()
+	matcher.Insert(marketOrder(market, "1", model.STOP_MARKET, model.LONG, "110", now))
+
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(115))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(1), counter(failedTriggers, market))
+	assert.True(t, matcher.retrying(matcher.retries["1"].order))
+
+	// backing off, price updates don't hammer the engine
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(116))
+	assert.Equal(t, 1, calls)
+	matcher.retryDue(time.Now())
+	assert.Equal(t, 1, calls)
+
+	// the delay doubles
+	next := matcher.retries["1"].next
+	matcher.retryDue(next)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2*retryBaseDelay, matcher.retries["1"].next.Sub(next))
+
+	failing = false
+	matcher.retryDue(matcher.retries["1"].next)
+	assert.Equal(t, 3, calls)
+	assert.Empty(t, matcher.retries)
+	assert.Contains(t, matcher.sent, "1")
+	assert.Equal(t, int64(0), counter(missedTriggers, market))
+	matcher.Remove(marketOrder(market, "1", model.STOP_MARKET, model.LONG, "110", now))
+
+	// given up after the attempts, back to the live matching
+	failing = true
+	matcher.Insert(marketOrder(market, "2", model.STOP_MARKET, model.LONG, "112", now))
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(115))
+	for i := 0; i < retryMaxAttempts; i++ {
+		r, ok := matcher.retries["2"]
+		if !ok {
+			break
+		}
+		matcher.retryDue(r.next)
+	}
+	assert.NotContains(t, matcher.retries, "2")
+	assert.Equal(t, int64(1), counter(missedTriggers, market))
+
+	// the echo ends the retry
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(115))
+	assert.Contains(t, matcher.retries, "2")
+	matcher.Remove(marketOrder(market, "2", model.STOP_MARKET, model.LONG, "112", now))
+	assert.Empty(t, matcher.retries)
+}
+
+func TestMatcherRecoverCrossed(t *testing.T) {
+	market := "RECOVER-USD"
+	matcher := newMatcher(nil)
+
+	executed := make([]string, 0)
+	matcher.execute = func(order model.OrderData) error {
+		executed = append(executed, order.OrderId)
+		return nil
+	}
+
+	since := time.Unix(1700000000, 0)
+	minute := time.Minute
+	candles := []*model.CandleData{
+		candle(since.Add(-minute), 80, 130),
+		candle(since, 95, 105),
+		candle(since.Add(minute), 100, 112),
+		candle(since.Add(2*minute), 96, 100),
+	}
+
+	// crossed up in the second candle
+	matcher.Insert(marketOrder(market, "1", model.STOP_MARKET, model.LONG, "110", since.Add(-time.Hour)))
+	// crossed down in the first candle after since
+	matcher.Insert(marketOrder(market, "2", model.STOP_LOSS, model.SHORT, "95", since.Add(-time.Hour)))
+	// only the candle before since crosses it
+	matcher.Insert(marketOrder(market, "3", model.STOP_MARKET, model.LONG, "120", since.Add(-time.Hour)))
+	// placed after the crossing candle
+	matcher.Insert(marketOrder(market, "4", model.STOP_MARKET, model.LONG, "111", since.Add(2*minute)))
+	// the group fires once
+	oco1 := marketOrder(market, "5", model.STOP_MARKET, model.SHORT, "97", since)
+	oco1.GroupId = "5"
+	oco2 := marketOrder(market, "6", model.TAKE_PROFIT, model.SHORT, "111", since)
+	oco2.GroupId = "5"
+	matcher.Insert(oco1)
+	matcher.Insert(oco2)
+
+	count := matcher.recoverCrossed(candles, since)
+	assert.Equal(t, 3, count)
+	assert.Len(t, executed, 3)
+	assert.Contains(t, executed, "1")
+	assert.Contains(t, executed, "2")
+	assert.NotContains(t, executed, "3")
+	assert.NotContains(t, executed, "4")
+	assert.Equal(t, int64(3), counter(lateTriggers, market))
+	assert.Len(t, matcher.groups["5"], 1)
+}
+
+func TestMatcherRecoverCrossedDegraded(t *testing.T) {
+	market := "RECOVER-DEGRADED-USD"
+	matcher := newMatcher(nil)
+
+	executed := make([]string, 0)
+	matcher.execute = func(order model.OrderData) error {
+		executed = append(executed, order.OrderId)
+		return nil
+	}
+
+	since := time.Unix(1700000000, 0)
+	candles := []*model.CandleData{candle(since, 95, 115)}
+	matcher.Insert(marketOrder(market, "1", model.STOP_MARKET, model.LONG, "110", since.Add(-time.Hour)))
+
+	// nothing fires from the candles while the price is frozen
+	assert.False(t, matcher.SetPriceDegraded(true))
+	assert.Equal(t, 0, matcher.recoverCrossed(candles, since))
+	assert.Empty(t, executed)
+	assert.False(t, matcher.SetPriceDegraded(true))
+
+	// the skipped recovery is run once the price is back
+	assert.True(t, matcher.SetPriceDegraded(false))
+	assert.False(t, matcher.SetPriceDegraded(false))
+	assert.Equal(t, 1, matcher.recoverCrossed(candles, since))
+	assert.Equal(t, []string{"1"}, executed)
+}
+
+func TestMatcherReconcile(t *testing.T) {
+	market := "RECONCILE-USD"
+	matcher := newMatcher(nil)
+
+	executed := make([]string, 0)
+	matcher.execute = func(order model.OrderData) error {
+		executed = append(executed, order.OrderId)
+		return nil
+	}
+
+	snapshot := time.Now()
+	before := snapshot.Add(-time.Hour)
+
+	matcher.OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromInt(100))
+	// canceled while the echo was lost
+	stale := marketOrder(market, "1", model.STOP_MARKET, model.LONG, "150", before)
+	// placed after the snapshot was taken
+	fresh := marketOrder(market, "2", model.STOP_MARKET, model.LONG, "150", snapshot.Add(time.Second))
+	// sent long ago, the engine didn't execute it
+	sent := marketOrder(market, "3", model.STOP_MARKET, model.LONG, "90", before)
+	matcher.Insert(stale)
+	matcher.Insert(fresh)
+	matcher.Insert(sent)
+	matcher.sent["3"] = snapshot.Add(-time.Minute)
+	// just removed by the echo, the snapshot is older
+	closed := marketOrder(market, "4", model.STOP_MARKET, model.LONG, "150", before)
+	matcher.removed["4"] = snapshot.Add(time.Second)
+	// publication lost, crossed by the last price
+	lost := marketOrder(market, "5", model.STOP_MARKET, model.LONG, "95", before)
+	// publication lost, not crossed
+	lostFar := marketOrder(market, "6", model.STOP_MARKET, model.LONG, "150", before)
+
+	matcher.Reconcile([]*model.OrderData{&sent, &closed, &lost, &lostFar}, snapshot)
+
+	assert.NotContains(t, matcher.nodesByOrderId, "1")
+	assert.Contains(t, matcher.nodesByOrderId, "2")
+	assert.Contains(t, matcher.nodesByOrderId, "3")
+	assert.NotContains(t, matcher.nodesByOrderId, "4")
+	assert.Contains(t, matcher.nodesByOrderId, "5")
+	assert.Contains(t, matcher.nodesByOrderId, "6")
+
+	assert.Equal(t, []string{"5"}, executed)
+	assert.Equal(t, int64(1), counter(lateTriggers, market))
+	assert.Equal(t, int64(1), counter(missedTriggers, market))
+	assert.NotContains(t, matcher.sent, "3")
+}
+
+func TestSeenState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slipstopper.state")
+
+	state := loadSeenState(path)
+	assert.True(t, state.get("BTC-USD").IsZero())
+
+	seen := time.Unix(1700000000, 0)
+	state.set("BTC-USD", seen)
+
+	state = loadSeenState(path)
+	assert.True(t, state.get("BTC-USD").Equal(seen))
+
+	// nothing is kept without the file
+	state = loadSeenState("")
+	state.set("BTC-USD", seen)
+	assert.True(t, state.get("BTC-USD").IsZero())
+}
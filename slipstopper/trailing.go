@@ -0,0 +1,128 @@
+package slipstopper
+
+import (
+	"context"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/strips-finance/rabbit-dex-backend/model"
+	"github.com/strips-finance/rabbit-dex-backend/pkg/log"
+	"github.com/strips-finance/rabbit-dex-backend/tdecimal"
+)
+
+// A trailing stop sells (short side) when the price falls by the callback from
+// its running high and buys (long side) when it rises by the callback from its
+// running low. Only the trigger is stored in tarantool, the high/low is derived
+// back from it on (re)subscribe.
+type trail struct {
+	order model.OrderData
+	// running high for the short side, running low for the long side
+	extreme decimal.Decimal
+}
+
+func callbackOf(d *tdecimal.Decimal) decimal.Decimal {
+	if d == nil {
+		return decimal.Zero
+	}
+	return d.Decimal
+}
+
+func trailingTrigger(order model.OrderData, extreme decimal.Decimal) decimal.Decimal {
+	value := callbackOf(order.CallbackValue)
+	percent := callbackOf(order.CallbackPercent)
+
+	if order.Side == model.LONG {
+		if value.IsPositive() {
+			return extreme.Add(value)
+		}
+		return extreme.Mul(decimal.NewFromInt(1).Add(percent))
+	}
+
+	if value.IsPositive() {
+		return extreme.Sub(value)
+	}
+	return extreme.Mul(decimal.NewFromInt(1).Sub(percent))
+}
+
+func trailingExtreme(order model.OrderData) decimal.Decimal {
+	trigger := order.TriggerPrice.Decimal
+	value := callbackOf(order.CallbackValue)
+	percent := callbackOf(order.CallbackPercent)
+
+	if order.Side == model.LONG {
+		if value.IsPositive() {
+			return trigger.Sub(value)
+		}
+		return trigger.Div(decimal.NewFromInt(1).Add(percent))
+	}
+
+	if value.IsPositive() {
+		return trigger.Add(value)
+	}
+	return trigger.Div(decimal.NewFromInt(1).Sub(percent))
+}
+
+// follow moves the high/low to the price and returns the new trigger
+// if it moved in the order's favour
+func (t *trail) follow(price decimal.Decimal) (decimal.Decimal, bool) {
+	if t.order.Side == model.LONG {
+		if !price.LessThan(t.extreme) {
+			return decimal.Zero, false
+		}
+	} else if !price.GreaterThan(t.extreme) {
+		return decimal.Zero, false
+	}
+	t.extreme = price
+
+	trigger := trailingTrigger(t.order, t.extreme)
+	current := t.order.TriggerPrice.Decimal
+	if t.order.Side == model.LONG {
+		return trigger, trigger.LessThan(current)
+	}
+	return trigger, trigger.GreaterThan(current)
+}
+
+func (m *Matcher) track(order model.OrderData) {
+	t, ok := m.trails[order.OrderId]
+	if ok && t.order.TriggerPrice.Equal(order.TriggerPrice.Decimal) {
+		t.order = order
+		return
+	}
+
+	m.trails[order.OrderId] = &trail{
+		order:   order,
+		extreme: trailingExtreme(order),
+	}
+}
+
+func (m *Matcher) moveTrailingTriggers(source string, price decimal.Decimal) {
+	for _, t := range m.trails {
+		if triggerSource(t.order) != source {
+			continue
+		}
+
+		trigger, moved := t.follow(price)
+		if !moved {
+			continue
+		}
+
+		order, err := m.updateTrigger(t.order, trigger)
+		if err != nil {
+			logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("Error UpdateTrailingTrigger: id=%s trigger_price=%s err=%v", t.order.OrderId, trigger, err)
+			continue
+		}
+		logrus.Infof("moved trailing trigger: id=%s trigger_price=%s extreme=%s", order.OrderId, order.TriggerPrice, t.extreme)
+
+		// keep the high/low, the stored trigger can be rounded to the market tick
+		m.unlink(t.order)
+		t.order = *order
+		m.Insert(*order)
+	}
+}
+
+func (m *Matcher) persistTrigger(order model.OrderData, trigger decimal.Decimal) (*model.OrderData, error) {
+	apiModel := model.NewApiModel(m.broker)
+
+	return apiModel.UpdateTrailingTrigger(context.Background(), order.MarketID, order.OrderId, trigger)
+}
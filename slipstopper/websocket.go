@@ -1,7 +1,9 @@
 package slipstopper
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
 	"time"
 
 	"github.com/centrifugal/centrifuge-go"
@@ -18,6 +20,7 @@ import (
 type WSClient struct {
 	matcherByMarket map[string]*Matcher
 	cfg             *Config
+	state           *seenState
 }
 
 type OrderEvent struct {
@@ -25,8 +28,43 @@ type OrderEvent struct {
 }
 
 type PriceEvent struct {
-	FairPrice  *decimal.Decimal `json:"fair_price"`
-	IndexPrice *decimal.Decimal `json:"index_price"`
+	FairPrice      *decimal.Decimal `json:"fair_price"`
+	IndexPrice     *decimal.Decimal `json:"index_price"`
+	LastTradePrice *decimal.Decimal `json:"last_trade_price"`
+	MarkPrice      *decimal.Decimal `json:"mark_price"`
+	MarkPriceUsage []string         `json:"mark_price_usage"`
+	PriceDegraded  *bool            `json:"price_degraded"`
+}
+
+// fair price, or mark price if the market uses it for conditional orders
+func (e *PriceEvent) TriggerPrice() *decimal.Decimal {
+	if e.MarkPrice != nil && e.MarkPrice.IsPositive() {
+		for _, usage := range e.MarkPriceUsage {
+			if usage == model.MARK_PRICE_USAGE_SLIPSTOPPER {
+				return e.MarkPrice
+			}
+		}
+	}
+	return e.FairPrice
+}
+
+// price of the TRIGGER_BY_* stream, nil when the update doesn't carry it
+// or there is no price yet (no trades on the market)
+func (e *PriceEvent) SourcePrice(source string) *decimal.Decimal {
+	var price *decimal.Decimal
+	switch source {
+	case model.TRIGGER_BY_LAST:
+		price = e.LastTradePrice
+	case model.TRIGGER_BY_INDEX:
+		price = e.IndexPrice
+	default:
+		price = e.TriggerPrice()
+	}
+
+	if price == nil || !price.IsPositive() {
+		return nil
+	}
+	return price
 }
 
 func (ws *WSClient) connToken(secretToken string, user string) (string, error) {
@@ -72,10 +110,13 @@ func (ws *WSClient) subscribe(client *centrifuge.Client, market string) {
 			matcher.ClearAll()
 
 			matcher.mu.Lock()
-			defer matcher.mu.Unlock()
 			for _, order := range orders {
 				matcher.Insert(order)
 			}
+			matcher.mu.Unlock()
+
+			// triggers crossed while the process was down or the channel dropped
+			go ws.recover(market, matcher)
 		}
 
 		logrus.Infof("Subscribed to channel=%s got orders=%d", privateSub.Channel, len(orders))
@@ -100,12 +141,7 @@ func (ws *WSClient) subscribe(client *centrifuge.Client, market string) {
 		for _, order := range data.Orders {
 			if order.Status == model.PLACED {
 				// if an order exists already then this is an update. (such as price etc...)
-				_, ok := matcher.nodesByOrderId[order.OrderId]
-				if ok {
-					matcher.Remove(order)
-				}
-				// insert new order
-				matcher.Insert(order)
+				matcher.Update(order)
 			} else {
 				// any other status means the execution of the order has been sent to the engine already.
 				matcher.Remove(order)
@@ -114,6 +150,17 @@ func (ws *WSClient) subscribe(client *centrifuge.Client, market string) {
 	})
 
 	marketSub.OnPublication(func(e centrifuge.PublicationEvent) {
+		// price degraded changes must not be dropped by the throttle
+		var status PriceEvent
+		if json.Unmarshal(e.Data, &status) == nil && status.PriceDegraded != nil {
+			matcher.mu.Lock()
+			recoverNow := matcher.SetPriceDegraded(*status.PriceDegraded)
+			matcher.mu.Unlock()
+			if recoverNow {
+				go ws.recover(market, matcher)
+			}
+		}
+
 		throttle.Do(func() {
 			var data PriceEvent
 			err = json.Unmarshal(e.Data, &data)
@@ -121,11 +168,13 @@ func (ws *WSClient) subscribe(client *centrifuge.Client, market string) {
 				logrus.Warn(err)
 				return
 			}
-			if data.FairPrice != nil {
-				logrus.Info("Received price update: ", marketSub.Channel, " ", data.FairPrice)
-				matcher.mu.Lock()
-				defer matcher.mu.Unlock()
-				matcher.OnPriceUpdate(*data.FairPrice)
+			matcher.mu.Lock()
+			defer matcher.mu.Unlock()
+			for _, source := range triggerSources {
+				if price := data.SourcePrice(source); price != nil {
+					logrus.Info("Received price update: ", marketSub.Channel, " ", source, " ", price)
+					matcher.OnPriceUpdate(source, *price)
+				}
 			}
 		})
 	})
@@ -139,6 +188,72 @@ func (ws *WSClient) subscribe(client *centrifuge.Client, market string) {
 	if err != nil {
 		logrus.Fatalln(err)
 	}
+
+	go ws.reconcile(market, matcher)
+}
+
+func (ws *WSClient) recover(market string, matcher *Matcher) {
+	matcher.mu.Lock()
+	since := matcher.lastSeen
+	matcher.mu.Unlock()
+	if since.IsZero() {
+		since = ws.state.get(market)
+	}
+
+	now := time.Now()
+	lookback := ws.cfg.Service.RecoveryLookback
+	if since.IsZero() || now.Sub(since) > lookback {
+		since = now.Add(-lookback)
+	}
+
+	apiModel := model.NewApiModel(matcher.broker)
+	candles, err := apiModel.GetCandles(context.Background(), market, recoveryCandlePeriod, since.Unix(), now.Unix())
+	if err != nil {
+		logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("recovery: could not get candles market=%s err=%v", market, err)
+		return
+	}
+
+	matcher.mu.Lock()
+	count := matcher.recoverCrossed(candles, since)
+	matcher.mu.Unlock()
+
+	logrus.Infof("recovery: market=%s since=%s crossed=%d", market, since, count)
+}
+
+func (ws *WSClient) reconcile(market string, matcher *Matcher) {
+	apiModel := model.NewApiModel(matcher.broker)
+	retries := time.NewTicker(retryTick)
+	reconciles := time.NewTicker(ws.cfg.Service.ReconcileInterval)
+
+	for {
+		select {
+		case now := <-retries.C:
+			matcher.mu.Lock()
+			matcher.retryDue(now)
+			matcher.mu.Unlock()
+		case <-reconciles.C:
+			snapshot := time.Now()
+			orders, err := apiModel.GetPlacedOrders(context.Background(), market, nil)
+			if err != nil {
+				logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("reconcile: could not get placed orders market=%s err=%v", market, err)
+				continue
+			}
+
+			placed := make([]*model.OrderData, 0, len(orders))
+			for _, order := range orders {
+				if order.MarketID == market {
+					placed = append(placed, order)
+				}
+			}
+
+			matcher.mu.Lock()
+			matcher.Reconcile(placed, snapshot)
+			seen := matcher.lastSeen
+			matcher.mu.Unlock()
+
+			ws.state.set(market, seen)
+		}
+	}
 }
 
 func (ws *WSClient) Run(readyChan chan bool) {
@@ -146,6 +261,12 @@ func (ws *WSClient) Run(readyChan chan bool) {
 	logrus.Info("Connection info: ", ws.cfg.Service.WebsocketURI)
 	logrus.Info("Markets: ", ws.cfg.Service.Markets)
 
+	if ws.cfg.Service.MetricsAddr != "" {
+		go func() {
+			logrus.Info(http.ListenAndServe(ws.cfg.Service.MetricsAddr, nil))
+		}()
+	}
+
 	token, err := ws.connToken(ws.cfg.Service.CentrifugoHMACSecretToken, "slipstopper")
 	if err != nil {
 		logrus.Fatalln(err)
@@ -193,5 +314,6 @@ func NewWSClient(cfg *Config) *WSClient {
 	return &WSClient{
 		matcherByMarket: make(map[string]*Matcher),
 		cfg:             cfg,
+		state:           loadSeenState(cfg.Service.StateFile),
 	}
 }
@@ -218,7 +218,7 @@ func TestSimpleConditionalOrderCreate(t *testing.T) {
 
 	// we should now have 1 order
 	assert.Equal(t, uint64(1), wsClient.matcherByMarket["BTC-USD"].Size())
-	tup, err := wsClient.matcherByMarket["BTC-USD"].tree.Get(sltpOrder.TriggerPrice.Decimal)
+	tup, err := wsClient.matcherByMarket["BTC-USD"].trees[model.TRIGGER_BY_MARK].Get(sltpOrder.TriggerPrice.Decimal)
 	assert.NoError(t, err)
 
 	assert.Equal(t, 1, len(tup.Values))
@@ -231,7 +231,7 @@ func TestSimpleConditionalOrderCreate(t *testing.T) {
 	assert.NoError(t, err)
 	sleep()
 
-	wsClient.matcherByMarket["BTC-USD"].OnPriceUpdate(decimal.NewFromFloat(1500.0))
+	wsClient.matcherByMarket["BTC-USD"].OnPriceUpdate(model.TRIGGER_BY_MARK, decimal.NewFromFloat(1500.0))
 	sleep()
 }
 
@@ -337,7 +337,7 @@ func TestSimpleConditionalOrderCancel(t *testing.T) {
 
 	// we should now have 1 order
 	assert.Equal(t, uint64(1), wsClient.matcherByMarket["BTC-USD"].Size())
-	tup, err := wsClient.matcherByMarket["BTC-USD"].tree.Get(sltpOrder.TriggerPrice.Decimal)
+	tup, err := wsClient.matcherByMarket["BTC-USD"].trees[model.TRIGGER_BY_MARK].Get(sltpOrder.TriggerPrice.Decimal)
 	assert.NoError(t, err)
 
 	assert.Equal(t, 1, len(tup.Values))
@@ -350,6 +350,6 @@ func TestSimpleConditionalOrderCancel(t *testing.T) {
 	sleep()
 	// we should now have 0 order
 	assert.Equal(t, uint64(0), wsClient.matcherByMarket["BTC-USD"].Size())
-	_, err = wsClient.matcherByMarket["BTC-USD"].tree.Get(sltpOrder.TriggerPrice.Decimal)
+	_, err = wsClient.matcherByMarket["BTC-USD"].trees[model.TRIGGER_BY_MARK].Get(sltpOrder.TriggerPrice.Decimal)
 	assert.Error(t, err)
 }
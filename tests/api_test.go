@@ -148,6 +148,66 @@ func (s *TestAPIPublicSuite) TestOrderAPI() {
 	require.NoError(s.T(), err)
 }
 
+func (s *TestAPIPublicSuite) TestOrdersBatchAPI() {
+	var (
+		profileId uint    = s.profile.ProfileId
+		marketId  string  = _marketId
+		price     float64 = 200.0
+		size      float64 = 1.0
+		badSize   float64 = 0.0
+	)
+
+	s.api.WhiteListProfile(s.ctx, profileId)
+
+	// [OrderBatchRes] create
+	items := []model.OrderBatchItem{
+		model.NewOrderBatchCreate(model.LIMIT, model.LONG, &price, &size, nil, nil, nil, nil, nil, nil, nil),
+		model.NewOrderBatchCreate(model.LIMIT, model.LONG, ToPtr(price-1), &size, nil, nil, nil, nil, nil, nil, nil),
+		model.NewOrderBatchCreate(model.LIMIT, model.LONG, &price, &badSize, nil, nil, nil, nil, nil, nil, nil),
+	}
+	created, err := s.api.OrdersBatch(s.ctx, profileId, marketId, items, nil)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), created, len(items))
+	for _, res := range created[:2] {
+		require.Empty(s.T(), res.Error)
+		require.Equal(s.T(), model.ORDER_ACTION_CREATE, res.Action)
+		require.NotNil(s.T(), res.Order)
+		require.Equal(s.T(), "processing", res.Order.Status)
+	}
+	require.NotEmpty(s.T(), created[2].Error)
+	require.Nil(s.T(), created[2].Order)
+	time.Sleep(time.Second)
+
+	orders, err := s.api.GetOpenOrders(s.ctx, marketId, profileId)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), orders, 2)
+
+	// [OrderBatchRes] amend + cancel
+	items = []model.OrderBatchItem{
+		model.NewOrderBatchAmend(created[0].Order.OrderId, ToPtr(price-2), nil, nil, nil),
+		model.NewOrderBatchCancel(created[1].Order.OrderId, ""),
+		model.NewOrderBatchCancel("", ""),
+	}
+	changed, err := s.api.OrdersBatch(s.ctx, profileId, marketId, items, nil)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), changed, len(items))
+	require.Empty(s.T(), changed[0].Error)
+	require.Equal(s.T(), "amending", changed[0].Order.Status)
+	require.Empty(s.T(), changed[1].Error)
+	require.Equal(s.T(), "canceling", changed[1].Order.Status)
+	require.Equal(s.T(), "ORDER_ID_OR_CLIENT_ORDER_ID_REQUIRED", changed[2].Error)
+	time.Sleep(time.Second)
+
+	orders, err = s.api.GetOpenOrders(s.ctx, marketId, profileId)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), orders, 1)
+	require.Equal(s.T(), created[0].Order.OrderId, orders[0].OrderId)
+	require.Equal(s.T(), fmt.Sprint(price-2), orders[0].Price.String())
+
+	err = s.api.CancelAll(s.ctx, profileId, true)
+	require.NoError(s.T(), err)
+}
+
 func (s *TestAPIPublicSuite) TestCancelByCoid() {
 	var (
 		profileId uint    = s.profile.ProfileId
@@ -934,6 +994,62 @@ func (s *TestAPILiqSuite) TestGetWinningPositions() {
 	require.Len(s.T(), profiles, 0) //TODO: add condition to get some profiles
 }
 
+func (s *TestAPILiqSuite) TestUpdateAdlQuantiles() {
+	var (
+		marketId   string = _marketId
+		profileId  uint   = s.profile.ProfileId
+		profileId2 uint   = profileId + 1
+	)
+
+	quantiles := []*model.AdlQuantile{
+		{ProfileID: profileId, Side: model.LONG, Quantile: 5, Score: *tdecimal.NewDecimal(decimal.RequireFromString("1.5"))},
+		{ProfileID: profileId2, Side: model.SHORT, Quantile: 2, Score: *tdecimal.NewDecimal(decimal.RequireFromString("0.25"))},
+	}
+	err := s.api.UpdateAdlQuantiles(s.ctx, marketId, quantiles)
+	require.NoError(s.T(), err)
+
+	// the stored rows, not only the getter
+	require.NoError(s.T(), evalScript(s.ctx, s.btcConn, fmt.Sprintf(`
+		local decimal = require("decimal")
+		local q = box.space.adl_quantile:get(%d)
+		if q == nil or q.side ~= "long" or q.quantile ~= 5 or q.score ~= decimal.new("1.5") then
+			error("BAD ADL QUANTILE ROW " .. tostring(q))
+		end
+		q = box.space.adl_quantile:get(%d)
+		if q == nil or q.side ~= "short" or q.quantile ~= 2 or q.score ~= decimal.new("0.25") then
+			error("BAD ADL QUANTILE ROW " .. tostring(q))
+		end
+	`, profileId, profileId2)))
+
+	quantile, err := s.api.GetAdlQuantile(s.ctx, marketId, profileId)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint(5), quantile)
+
+	// a new ranking drops the positions which left the queue
+	err = s.api.UpdateAdlQuantiles(s.ctx, marketId, quantiles[1:])
+	require.NoError(s.T(), err)
+
+	quantile, err = s.api.GetAdlQuantile(s.ctx, marketId, profileId)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint(0), quantile)
+
+	quantile, err = s.api.GetAdlQuantile(s.ctx, marketId, profileId2)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint(2), quantile)
+
+	// the profile getter answers for all markets at once
+	quantiles2, err := s.api.GetAdlQuantiles(s.ctx, profileId2)
+	require.NoError(s.T(), err)
+	found := false
+	for _, q := range quantiles2 {
+		if q.MarketID == marketId {
+			require.Equal(s.T(), uint(2), q.Quantile)
+			found = true
+		}
+	}
+	require.True(s.T(), found)
+}
+
 func (s *TestAPILiqSuite) TestQueueLiqActions() {
 	var (
 		profileId uint   = s.profile.ProfileId
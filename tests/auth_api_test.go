@@ -64,7 +64,9 @@ func (s *TestCexAuthSuite) TestCexFlow() {
 			&expiresAt,
 			jwt,
 			jwt,
-			[]string{"1", "2", "3"})
+			[]string{"1", "2", "3"},
+			nil,
+			nil)
 		require.NoError(s.T(), err)
 		require.NotEmpty(s.T(), res)
 		require.NotEmpty(s.T(), res.Key)
@@ -113,10 +115,17 @@ func (s *TestCexAuthSuite) TestCexFlow() {
 		&expiresAt,
 		jwt,
 		jwt,
-		nil)
+		nil,
+		[]string{model.API_SCOPE_READ, model.API_SCOPE_CANCEL_ONLY},
+		[]string{"BTC-USD"})
 	require.NoError(s.T(), err)
 	require.NotEmpty(s.T(), res)
 
+	scoped, err := s.api.GetByKey(context.Background(), res.Key)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), []string{model.API_SCOPE_READ, model.API_SCOPE_CANCEL_ONLY}, scoped.Scopes)
+	require.Equal(s.T(), []string{"BTC-USD"}, scoped.Markets)
+
 	err = s.api.ValidateApiKey(
 		context.Background(),
 		res.Key,
@@ -187,7 +196,9 @@ func (s *TestCexAuthSuite) TestMaxPerProfile() {
 			&expiresAt,
 			jwt,
 			jwt,
-			[]string{"1", "2", "3"})
+			[]string{"1", "2", "3"},
+			nil,
+			nil)
 		require.NoError(s.T(), err)
 		require.NotEmpty(s.T(), res)
 		require.NotEmpty(s.T(), res.Key)
@@ -206,7 +217,9 @@ func (s *TestCexAuthSuite) TestMaxPerProfile() {
 			&expiresAt,
 			jwt,
 			jwt,
-			[]string{"1", "2", "3"})
+			[]string{"1", "2", "3"},
+			nil,
+			nil)
 		require.NoError(s.T(), err)
 		require.NotEmpty(s.T(), res)
 		require.NotEmpty(s.T(), res.Key)
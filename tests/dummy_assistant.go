@@ -123,8 +123,8 @@ func (da *DummyAssistant) ClawbackRequired(ctx context.Context) bool {
 	return false
 }
 
-func (da *DummyAssistant) GetWinningTraderPostns(ctx context.Context, marketId string, side string, atPrice float64, insuranceId uint) (map[uint]*model.PositionData, error) {
-	return make(map[uint]*model.PositionData), nil
+func (da *DummyAssistant) GetAdlQueue(ctx context.Context, marketId string, side string, atPrice float64, insuranceId uint) ([]*liqengine.AdlEntry, error) {
+	return make([]*liqengine.AdlEntry, 0), nil
 }
 
 func (da *DummyAssistant) GetNextLiquidationServiceId() liqengine.ServiceId {
@@ -139,3 +139,15 @@ func (da *DummyAssistant) WaitForCancellAllAccepted(ctx context.Context, traderI
 	return nil
 }
 
+
+func (da *DummyAssistant) GetIsolatedLiqBatch(ctx context.Context, limit int) ([]*model.IsolatedMargin, error) {
+	return []*model.IsolatedMargin{}, nil
+}
+
+func (da *DummyAssistant) GetIsolatedAccountData(ctx context.Context, isolated *model.IsolatedMargin) (*liqengine.AccountData, error) {
+	return &liqengine.AccountData{}, nil
+}
+
+func (da *DummyAssistant) WaitForMarketCancelAccepted(ctx context.Context, traderId uint, marketId string) error {
+	return nil
+}
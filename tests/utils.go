@@ -1321,7 +1321,7 @@ func MakeIntegrityValid(ctx context.Context, profileConn *tarantool.Connection)
 }
 
 var (
-	conditionalOrders = []string{"stop_loss", "take_profit", "stop_loss_limit", "take_profit_limit", "stop_limit", "stop_market"}
+	conditionalOrders = []string{"stop_loss", "take_profit", "stop_loss_limit", "take_profit_limit", "stop_limit", "stop_market", "trailing_stop"}
 )
 
 func isConditionalType(t string) bool {
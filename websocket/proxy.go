@@ -260,6 +260,44 @@ func RunProxy() {
 
 			data = profile
 
+		case "orders":
+			orders, err := apiModel.GetOrdersSnapshot(context.Background(), argument, profileId)
+			if err != nil {
+				logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("apiModel.GetOrdersSnapshot err = %s", err.Error())
+				c.Status(http.StatusBadRequest)
+				return
+			} else if orders == nil {
+				logrus.WithField(log.AlertTag, log.AlertHigh).Error("orders is nil")
+				c.Status(http.StatusBadRequest)
+				return
+			}
+
+			logrus.
+				WithField("id", profileId).
+				WithField("len", len(orders.Orders)).
+				Info("Sending initial state for orders")
+
+			data = orders
+
+		case "fills":
+			fills, err := apiModel.GetFillsSnapshot(context.Background(), argument, profileId, 50)
+			if err != nil {
+				logrus.WithField(log.AlertTag, log.AlertHigh).Errorf("apiModel.GetFillsSnapshot err = %s", err.Error())
+				c.Status(http.StatusBadRequest)
+				return
+			} else if fills == nil {
+				logrus.WithField(log.AlertTag, log.AlertHigh).Error("fills is nil")
+				c.Status(http.StatusBadRequest)
+				return
+			}
+
+			logrus.
+				WithField("id", profileId).
+				WithField("len", len(fills.Fills)).
+				Info("Sending initial state for fills")
+
+			data = fills
+
 		case "orderbook":
 			orderbook, err := apiModel.GetOrderbookData(context.Background(), argument)
 			if err != nil {
@@ -293,6 +331,20 @@ func RunProxy() {
 
 			data = trades
 
+		case "liquidations":
+			liquidations, err := apiModel.GetLiquidations(context.Background(), argument, 50)
+			if err != nil {
+				logrus.WithField(log.AlertTag, log.AlertHigh).Error(err)
+				c.Status(http.StatusBadRequest)
+				return
+			}
+
+			logrus.
+				WithField("len", len(liquidations)).
+				Info("Sending initial state for liquidations")
+
+			data = liquidations
+
 		case "conditional":
 			orders, err := apiModel.GetPlacedOrders(c.Request.Context(), argument, nil)
 			if err != nil {